@@ -1,20 +1,90 @@
 package commands
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"github.com/simonwep/genesis/core"
 	"github.com/simonwep/genesis/routes"
 	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
 )
 
 func Start(*cli.Context) error {
+	if err := core.ValidateUserTemplate(); err != nil {
+		return err
+	} else if err := core.Migrate(false); err != nil {
+		return err
+	} else if err := core.NormalizeUsernames(false); err != nil {
+		return err
+	} else if _, err := core.RebuildIndexes(false); err != nil {
+		return err
+	}
+
 	router := routes.SetupRoutes()
-	core.InitializeUsers()
+
+	if !core.Config.ReadOnly {
+		core.InitializeUsers()
+	}
 
 	if err := router.SetTrustedProxies(nil); err != nil {
 		return err
-	} else if err = router.Run("0.0.0.0:" + core.Config.AppPort); err != nil {
+	}
+
+	listener, err := listen(&core.Config)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	server := &http.Server{
+		Handler: router.Handler(),
+		TLSConfig: &tls.Config{
+			MinVersion:   core.Config.TLSMinVersion,
+			CipherSuites: core.Config.TLSCipherSuites,
+		},
+	}
+	core.Logger.Info("listening for requests",
+		zap.String("address", listener.Addr().String()),
+		zap.Bool("tls", len(core.Config.TLSCertFile) != 0),
+		zap.Bool("h2c", core.Config.H2C),
+	)
+
+	// HTTP/2 is enabled automatically when serving TLS
+	if len(core.Config.TLSCertFile) != 0 {
+		return server.ServeTLS(listener, core.Config.TLSCertFile, core.Config.TLSKeyFile)
+	}
+
+	return server.Serve(listener)
+}
+
+func Migrate(ctx *cli.Context) error {
+	if err := core.Migrate(ctx.Bool("dry-run")); err != nil {
+		return err
+	}
+
+	return core.NormalizeUsernames(ctx.Bool("dry-run"))
+}
+
+// listen binds to the unix socket if one is configured, otherwise to the listen address.
+func listen(config *core.AppConfig) (net.Listener, error) {
+	if len(config.UnixSocket) == 0 {
+		return net.Listen("tcp", config.ListenAddr)
+	}
+
+	// A socket left behind by a previous run would make binding fail, other files are never removed
+	if info, err := os.Lstat(config.UnixSocket); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("unix socket path %q exists and is not a socket", config.UnixSocket)
+		} else if err := os.Remove(config.UnixSocket); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return net.Listen("unix", config.UnixSocket)
 }
@@ -46,20 +46,34 @@ func AddUser(ctx *cli.Context) error {
 
 func UpdateUser(ctx *cli.Context) error {
 	username := ctx.Args().Get(0)
-	newPassword := ctx.String("password")
+	update := core.PartialUser{}
 
-	if newPassword == "" {
+	if ctx.IsSet("password") {
+		newPassword := ctx.String("password")
+		update.Password = &newPassword
+	}
+
+	if ctx.IsSet("admin") {
+		admin := ctx.Bool("admin")
+		update.Admin = &admin
+	}
+
+	if update.Password == nil && update.Admin == nil {
+		fmt.Println("Nothing to update, use --password or --admin")
+		return nil
+	} else if update.Password != nil && *update.Password == "" {
 		fmt.Println("No password provided")
 		return nil
 	}
 
-	err := core.UpdateUser(username, core.PartialUser{
-		Password: &newPassword,
-	})
+	err := core.UpdateUser(username, update)
 
 	if errors.Is(err, core.ErrUserNotFound) {
 		fmt.Println("User not found")
 		return nil
+	} else if errors.Is(err, core.ErrPasswordReused) {
+		fmt.Println("Password has been used before")
+		return nil
 	}
 
 	return err
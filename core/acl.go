@@ -0,0 +1,163 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Permission is the access another user has been granted to a key
+type Permission string
+
+const (
+	PermissionRead      Permission = "read"
+	PermissionReadWrite Permission = "read-write"
+)
+
+var ErrInvalidPermission = errors.New("permission must be read or read-write")
+
+// Grant represents the access of a single user to a shared key
+// @Description User a key is shared with and their permission
+type Grant struct {
+	User       string     `json:"user" example:"john"`
+	Permission Permission `json:"permission" example:"read"`
+}
+
+// SharedKey represents a key another user shared with the current one
+// @Description Key shared by its owner, read it via the owner query parameter of the data endpoints
+type SharedKey struct {
+	Owner      string     `json:"owner" example:"admin"`
+	Key        string     `json:"key" example:"settings"`
+	Permission Permission `json:"permission" example:"read"`
+}
+
+// CanRead checks if the permission allows reading a key, which every valid permission does.
+func (p Permission) CanRead() bool {
+	return p == PermissionRead || p == PermissionReadWrite
+}
+
+// CanWrite checks if the permission allows storing and deleting a key.
+func (p Permission) CanWrite() bool {
+	return p == PermissionReadWrite
+}
+
+// ShareData grants grantee access to key of owner, replacing a previous grant.
+// Grants don't depend on the key being stored and are kept until revoked or either user is deleted.
+func (app *App) ShareData(owner, key, grantee string, permission Permission) error {
+	if !permission.CanRead() {
+		return ErrInvalidPermission
+	}
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if user, err := getUserTxn(txn, grantee); err != nil {
+			return err
+		} else if user == nil {
+			return ErrUserNotFound
+		} else if err := txn.Set(buildAclKey(owner, key, grantee), []byte(permission)); err != nil {
+			return err
+		}
+
+		return txn.Set(buildSharedKey(grantee, owner, key), []byte(permission))
+	})
+}
+
+// RevokeShare removes the access of grantee to key of owner, revoking a grant which doesn't exist has no effect.
+func (app *App) RevokeShare(owner, key, grantee string) error {
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if err := txn.Delete(buildAclKey(owner, key, grantee)); err != nil {
+			return err
+		}
+
+		return txn.Delete(buildSharedKey(grantee, owner, key))
+	})
+}
+
+// GetGrants lists the users key of owner is shared with, ordered by name.
+func (app *App) GetGrants(owner, key string) ([]Grant, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildAclKey(owner, key, "")
+	grants := make([]Grant, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if value, err := it.Item().ValueCopy(nil); err != nil {
+			return nil, err
+		} else {
+			grants = append(grants, Grant{User: unescapeKeySegment(string(it.Item().Key()[len(prefix):])), Permission: Permission(value)})
+		}
+	}
+
+	return grants, nil
+}
+
+// GetPermission returns the permission grantee has been granted for key of owner, an empty one if none.
+func (app *App) GetPermission(owner, key, grantee string) (Permission, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(buildAclKey(owner, key, grantee))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	value, err := item.ValueCopy(nil)
+	return Permission(value), err
+}
+
+// GetSharedWithUser lists all keys other users shared with grantee, ordered by owner and key.
+func (app *App) GetSharedWithUser(grantee string) ([]SharedKey, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildSharedPrefix(grantee)
+	shared := make([]SharedKey, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		owner, key, _ := splitKeySegment(it.Item().Key()[len(prefix):])
+
+		if value, err := it.Item().ValueCopy(nil); err != nil {
+			return nil, err
+		} else {
+			shared = append(shared, SharedKey{Owner: owner, Key: string(key), Permission: Permission(value)})
+		}
+	}
+
+	return shared, nil
+}
+
+// deleteSharesTxn removes all grants given by or to name.
+func deleteSharesTxn(txn *badger.Txn, name string) error {
+	var keys [][]byte
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+
+	prefix := buildAclPrefix(name)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key, grantee, _ := splitKeySegment(it.Item().Key()[len(prefix):])
+		keys = append(keys, it.Item().KeyCopy(nil), buildSharedKey(unescapeKeySegment(string(grantee)), name, key))
+	}
+
+	prefix = buildSharedPrefix(name)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		owner, key, _ := splitKeySegment(it.Item().Key()[len(prefix):])
+		keys = append(keys, it.Item().KeyCopy(nil), buildAclKey(owner, string(key), name))
+	}
+
+	it.Close()
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+)
+
+// App is a single Genesis instance consisting of its configuration, logger and database.
+// Multiple apps can live in the same process as long as each one uses its own database.
+type App struct {
+	Config *AppConfig
+	Logger *zap.Logger
+
+	// LoginLimiter tracks failed login attempts per user and client address
+	LoginLimiter *RateLimiter
+
+	// Clock is what expiry within the app is based on, see Now
+	Clock Clock
+
+	db    *badger.DB
+	locks *keyedMutex
+
+	// compacting guards CompactDatabase against running concurrently
+	compacting atomic.Bool
+
+	// reindexing guards Reindex against running concurrently
+	reindexing atomic.Bool
+
+	// Outcome of the scheduled backups, see BackupStatus
+	backupsSucceeded atomic.Uint64
+	backupsFailed    atomic.Uint64
+	lastBackupAt     atomic.Int64
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// Default is the app configured via environment variables, which is used by the package-level functions.
+// It has no database until OpenDefaultDatabase is called.
+var Default = &App{
+	Config:       &Config,
+	Logger:       Logger,
+	LoginLimiter: NewRateLimiter(),
+	Clock:        systemClock{},
+	locks:        newKeyedMutex(),
+}
+
+// NewApp creates an app using config, logger and an already opened database.
+// Its clock can be adjusted if config enables the test mode.
+func NewApp(config *AppConfig, logger *zap.Logger, db *badger.DB) *App {
+	return &App{
+		Config:       config,
+		Logger:       logger,
+		LoginLimiter: NewRateLimiter(),
+		Clock:        newClock(config),
+		db:           db,
+		locks:        newKeyedMutex(),
+	}
+}
+
+// dummyPasswordHash returns a hash to compare against for unknown users so it takes as long as for existing ones.
+func (app *App) dummyPasswordHash() string {
+	app.dummyHashOnce.Do(func() {
+		app.dummyHash, _ = app.hashPassword("genesis")
+	})
+
+	return app.dummyHash
+}
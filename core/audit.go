@@ -0,0 +1,8 @@
+package core
+
+import "go.uber.org/zap"
+
+// Audit records a security relevant action, such as an admin acting on behalf of another user.
+func (app *App) Audit(action string, fields ...zap.Field) {
+	app.Logger.Named("audit").Info(action, fields...)
+}
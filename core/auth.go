@@ -1,40 +1,140 @@
 package core
 
 import (
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"time"
 )
 
+// signingMethod is the only algorithm tokens are signed with and accepted for.
+var signingMethod = jwt.SigningMethodHS256
+
+var (
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrTokenInvalidated        = errors.New("token has been invalidated")
+)
+
+// JWTClaim identifies the user a token has been issued for. It deliberately carries no admin flag or other privileges,
+// they're always taken from the stored user so changes apply to existing sessions right away.
 type JWTClaim struct {
-	User string `json:"user"`
+	User         string `json:"user"`
+	Impersonator string `json:"imp,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func CreateAuthToken(user *User) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaim{
-		User: user.Name,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(Config.JWTExpiration)),
-			ID:        uuid.NewString(),
-		},
-	}).SignedString(Config.JWTSecret)
+// IssuedFor reports whether the token has been issued for user rather than a previous user of the same name, which has
+// been deleted or erased since. Tokens without the time they've been issued at, which genesis always sets, and tokens
+// of users created before their creation time has been recorded are accepted.
+func (claims *JWTClaim) IssuedFor(user *User) bool {
+	if user.CreatedAt == nil || claims.IssuedAt == nil {
+		return true
+	}
+
+	// The time a token has been issued at is only precise to the second
+	return !claims.IssuedAt.Time.Before(user.CreatedAt.Truncate(time.Second))
+}
+
+// CreateAuthToken creates a session token for user and returns it along with the time it expires at.
+func (app *App) CreateAuthToken(user *User) (string, time.Time, error) {
+	return app.createToken(JWTClaim{User: user.Name}, app.Config.JWTExpiration)
+}
+
+// CreateImpersonationToken creates a short-lived token acting as target, which carries the name of the admin who created it.
+func (app *App) CreateImpersonationToken(admin *User, target *User) (string, time.Time, error) {
+	return app.createToken(JWTClaim{User: target.Name, Impersonator: admin.Name}, app.Config.ImpersonationExpiration)
 }
 
-func ParseAuthToken(token string) (*JWTClaim, error) {
+func (app *App) ParseAuthToken(token string) (*JWTClaim, error) {
 	var claims JWTClaim
 
 	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
-		return Config.JWTSecret, nil
-	})
+		// Never trust the algorithm announced in the header, this rejects "none" as well as any other HMAC or asymmetric algorithm
+		if method, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || method.Alg() != signingMethod.Alg() {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedSigningMethod, token.Header["alg"])
+		}
+
+		return app.verificationKeys(), nil
+	}, app.parserOptions()...)
+
+	if err != nil {
+		return nil, err
+	}
 
 	if len(claims.ID) != 0 {
-		blacklisted, err := IsTokenBlacklisted(claims.ID)
+		blacklisted, err := app.IsTokenBlacklisted(claims.ID)
 
-		if blacklisted || err != nil {
+		if err != nil {
 			return nil, err
+		} else if blacklisted {
+			return nil, ErrTokenInvalidated
 		}
 	}
 
-	return &claims, err
+	// Tokens issued before usernames became case-insensitive may still carry the original name
+	claims.User = app.NormalizeUsername(claims.User)
+	return &claims, nil
+}
+
+// verificationKeys returns the secrets tokens are accepted for, the previous one keeps tokens signed before a rotation valid.
+func (app *App) verificationKeys() interface{} {
+	if len(app.Config.JWTPreviousSecret) == 0 {
+		return app.Config.JWTSecret
+	}
+
+	return jwt.VerificationKeySet{
+		Keys: []jwt.VerificationKey{app.Config.JWTSecret, app.Config.JWTPreviousSecret},
+	}
+}
+
+// parserOptions returns the options used to validate tokens, issuer and audience are only verified if configured.
+// Expiry and not-before are checked with a leeway of GENESIS_JWT_LEEWAY to tolerate clocks of servers being off.
+func (app *App) parserOptions() []jwt.ParserOption {
+	// Tokens without expiry couldn't be invalidated for a bounded time
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{signingMethod.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(app.Config.JWTLeeway),
+		jwt.WithTimeFunc(app.Now),
+	}
+
+	if len(app.Config.JWTIssuer) != 0 {
+		options = append(options, jwt.WithIssuer(app.Config.JWTIssuer))
+	}
+
+	if len(app.Config.JWTAudience) != 0 {
+		options = append(options, jwt.WithAudience(app.Config.JWTAudience))
+	}
+
+	return options
+}
+
+// createToken signs claims, the returned expiry is the one written into the token, which is only precise to the second.
+func (app *App) createToken(claims JWTClaim, expiration time.Duration) (string, time.Time, error) {
+	now := app.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        uuid.NewString(),
+		Issuer:    app.Config.JWTIssuer,
+	}
+
+	if len(app.Config.JWTAudience) != 0 {
+		claims.Audience = jwt.ClaimStrings{app.Config.JWTAudience}
+	}
+
+	token, err := jwt.NewWithClaims(signingMethod, claims).SignedString(app.Config.JWTSecret)
+	return token, claims.ExpiresAt.Time, err
+}
+
+// InvalidateToken blacklists the token described by claims until it expires, which is required for every token.
+// Tokens are accepted for GENESIS_JWT_LEEWAY beyond their expiry, so they're blacklisted for that long as well.
+func (app *App) InvalidateToken(claims *JWTClaim) error {
+	if claims.ExpiresAt == nil {
+		return jwt.ErrTokenRequiredClaimMissing
+	}
+
+	return app.StoreInvalidatedToken(claims.ID, claims.ExpiresAt.Time.Sub(app.Now())+app.Config.JWTLeeway)
 }
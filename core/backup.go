@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// backupKeyPrefix precedes the timestamp of uploaded backups, which sort chronologically that way
+const backupKeyPrefix = "genesis-"
+
+// BackupStats describes the outcome of the scheduled backups since the server started
+type BackupStats struct {
+	Succeeded     uint64
+	Failed        uint64
+	LastSuccessAt *time.Time
+}
+
+// BackupDatabase writes a full backup of the database to w, which can be restored using badger's restore command.
+func (app *App) BackupDatabase(w io.Writer) error {
+	_, err := app.db.Backup(w, 0)
+	return err
+}
+
+// UploadBackup uploads a full backup of the database to GENESIS_BACKUP_S3_BUCKET as of now and returns its key.
+// Afterward, the oldest backups beyond GENESIS_BACKUP_RETENTION are removed. The backup is written to a temporary
+// file first, as object storage requires the size of an upload in advance.
+func (app *App) UploadBackup(ctx context.Context, now time.Time) (string, error) {
+	key, err := app.uploadBackup(ctx, now)
+	if err != nil {
+		app.backupsFailed.Add(1)
+		return "", err
+	}
+
+	app.backupsSucceeded.Add(1)
+	app.lastBackupAt.Store(now.Unix())
+	return key, nil
+}
+
+func (app *App) uploadBackup(ctx context.Context, now time.Time) (string, error) {
+	store := newObjectStore(app.Config)
+	key := app.Config.BackupS3Prefix + backupKeyPrefix + now.UTC().Format("20060102T150405Z") + ".bak"
+
+	file, err := os.CreateTemp("", "genesis-backup-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := app.BackupDatabase(file); err != nil {
+		return "", fmt.Errorf("failed to back up database: %w", err)
+	} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	} else if err := store.putFile(ctx, key, file); err != nil {
+		return "", fmt.Errorf("failed to upload backup: %w", err)
+	}
+
+	if app.Config.BackupRetention <= 0 {
+		return key, nil
+	}
+
+	keys, err := store.list(ctx, app.Config.BackupS3Prefix+backupKeyPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	// Only prune what was uploaded by Genesis, in case the prefix is shared
+	backups := make([]string, 0, len(keys))
+	for _, stored := range keys {
+		if strings.HasSuffix(stored, ".bak") {
+			backups = append(backups, stored)
+		}
+	}
+
+	for len(backups) > int(app.Config.BackupRetention) {
+		if err := store.delete(ctx, backups[0]); err != nil {
+			return "", fmt.Errorf("failed to remove backup %s: %w", backups[0], err)
+		}
+
+		backups = backups[1:]
+	}
+
+	return key, nil
+}
+
+// BackupStatus returns how many scheduled backups succeeded and failed and when the last one succeeded.
+func (app *App) BackupStatus() BackupStats {
+	stats := BackupStats{
+		Succeeded: app.backupsSucceeded.Load(),
+		Failed:    app.backupsFailed.Load(),
+	}
+
+	if last := app.lastBackupAt.Load(); last != 0 {
+		at := time.Unix(last, 0).UTC()
+		stats.LastSuccessAt = &at
+	}
+
+	return stats
+}
+
+// uploadBackupsPeriodically runs UploadBackup every GENESIS_BACKUP_INTERVAL, it never returns.
+// Failures are only logged and counted, the next backup is attempted as scheduled.
+func (app *App) uploadBackupsPeriodically() {
+	ticker := time.NewTicker(app.Config.BackupInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if key, err := app.UploadBackup(context.Background(), now); err != nil {
+			app.Logger.Error("failed to upload backup", zap.Error(err))
+		} else {
+			app.Logger.Info("uploaded backup", zap.String("key", key))
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// blobRefMeta marks data and trash entries whose value is the hash of a shared blob instead of the value itself.
+const blobRefMeta byte = 1
+
+// setValueTxn stores data under key, deduplicated as reference to a shared blob if enabled.
+// The blob referenced by a previous value of key is released. Fails with ErrStorageFull if key is a new data key and
+// the global limit of keys is reached.
+func (app *App) setValueTxn(txn *badger.Txn, key []byte, data []byte) error {
+	if existed, err := releaseValueTxn(txn, key); err != nil {
+		return err
+	} else if !existed {
+		if err := app.checkKeyCountTxn(txn, key); err != nil {
+			return err
+		} else if err := app.adjustKeyCountTxn(txn, key, 1); err != nil {
+			return err
+		}
+	}
+
+	if !app.Config.DedupEnabled {
+		return txn.Set(key, data)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if err := retainBlobTxn(txn, hash, data); err != nil {
+		return err
+	}
+
+	return txn.SetEntry(badger.NewEntry(key, []byte(hash)).WithMeta(blobRefMeta))
+}
+
+// deleteValueTxn deletes key and releases the blob it references.
+func (app *App) deleteValueTxn(txn *badger.Txn, key []byte) error {
+	if existed, err := releaseValueTxn(txn, key); err != nil {
+		return err
+	} else if existed {
+		if err := app.adjustKeyCountTxn(txn, key, -1); err != nil {
+			return err
+		}
+	}
+
+	return txn.Delete(key)
+}
+
+// moveValueTxn moves the value of item to key without copying the blob it may reference.
+func (app *App) moveValueTxn(txn *badger.Txn, item *badger.Item, key []byte, ttl time.Duration) error {
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	entry := badger.NewEntry(key, value).WithMeta(item.UserMeta())
+	if ttl > 0 {
+		entry = entry.WithTTL(ttl)
+	}
+
+	if existed, err := releaseValueTxn(txn, key); err != nil {
+		return err
+	} else if !existed {
+		if err := app.adjustKeyCountTxn(txn, key, 1); err != nil {
+			return err
+		}
+	}
+
+	if err := txn.SetEntry(entry); err != nil {
+		return err
+	} else if err := app.adjustKeyCountTxn(txn, item.Key(), -1); err != nil {
+		return err
+	}
+
+	return txn.Delete(item.KeyCopy(nil))
+}
+
+// readValue returns a copy of the value of a data or trash entry, resolving blob references.
+func readValue(txn *badger.Txn, item *badger.Item) ([]byte, error) {
+	value, err := item.ValueCopy(nil)
+	if err != nil || item.UserMeta() != blobRefMeta {
+		return value, err
+	}
+
+	blob, err := txn.Get(buildBlobKey(string(value)))
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.ValueCopy(nil)
+}
+
+// valueSize returns the size of the value of a data or trash entry, resolving blob references.
+func valueSize(txn *badger.Txn, item *badger.Item) (int64, error) {
+	if item.UserMeta() != blobRefMeta {
+		return item.ValueSize(), nil
+	}
+
+	hash, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	blob, err := txn.Get(buildBlobKey(string(hash)))
+	if err != nil {
+		return 0, err
+	}
+
+	return blob.ValueSize(), nil
+}
+
+// releaseValueTxn releases the blob referenced by the current value of key and reports whether key exists.
+func releaseValueTxn(txn *badger.Txn, key []byte) (bool, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	} else if item.UserMeta() != blobRefMeta {
+		return true, nil
+	}
+
+	hash, err := item.ValueCopy(nil)
+	if err != nil {
+		return true, err
+	}
+
+	return true, releaseBlobTxn(txn, string(hash))
+}
+
+func retainBlobTxn(txn *badger.Txn, hash string, data []byte) error {
+	refs, err := getBlobRefs(txn, hash)
+	if err != nil {
+		return err
+	} else if refs == 0 {
+		if err := txn.Set(buildBlobKey(hash), data); err != nil {
+			return err
+		}
+	}
+
+	return setBlobRefs(txn, hash, refs+1)
+}
+
+func releaseBlobTxn(txn *badger.Txn, hash string) error {
+	refs, err := getBlobRefs(txn, hash)
+	if err != nil {
+		return err
+	} else if refs > 1 {
+		return setBlobRefs(txn, hash, refs-1)
+	} else if err := txn.Delete(buildBlobKey(hash)); err != nil {
+		return err
+	}
+
+	return txn.Delete(buildBlobRefsKey(hash))
+}
+
+func getBlobRefs(txn *badger.Txn, hash string) (uint64, error) {
+	item, err := txn.Get(buildBlobRefsKey(hash))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(value), nil
+}
+
+func setBlobRefs(txn *badger.Txn, hash string, refs uint64) error {
+	return txn.Set(buildBlobRefsKey(hash), binary.BigEndian.AppendUint64(nil, refs))
+}
+
+// CollectBlobs recounts the references of all blobs and deletes the ones which are no longer referenced.
+// Trashed keys expire without releasing their blob, which is why this runs periodically. Returns the amount of deleted blobs.
+func (app *App) CollectBlobs() (int, error) {
+	deleted := 0
+
+	err := app.db.Update(func(txn *badger.Txn) error {
+		deleted = 0
+
+		options := badger.DefaultIteratorOptions
+		options.PrefetchValues = false
+
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		refs := make(map[string]uint64)
+		for _, prefix := range [][]byte{[]byte(dbDataPrefix + dbKeySeparator), []byte(dbTrashPrefix + dbKeySeparator)} {
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				if it.Item().UserMeta() != blobRefMeta {
+					continue
+				} else if hash, err := it.Item().ValueCopy(nil); err != nil {
+					return err
+				} else {
+					refs[string(hash)]++
+				}
+			}
+		}
+
+		prefix := buildBlobKey("")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			hash := string(it.Item().Key()[len(prefix):])
+
+			if count, ok := refs[hash]; !ok {
+				if err := txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+					return err
+				} else if err := txn.Delete(buildBlobRefsKey(hash)); err != nil {
+					return err
+				}
+
+				deleted++
+			} else if current, err := getBlobRefs(txn, hash); err != nil {
+				return err
+			} else if current != count {
+				if err := setBlobRefs(txn, hash, count); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return deleted, err
+}
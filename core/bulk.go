@@ -0,0 +1,123 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	UserUpdateStatusUpdated   = "updated"
+	UserUpdateStatusUnchanged = "unchanged"
+	UserUpdateStatusSkipped   = "skipped"
+	UserUpdateStatusNotFound  = "not-found"
+)
+
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
+// UserFilter selects the users of a bulk update, either by name or by their admin flag, or both
+// @Description Users to update, all given conditions have to match
+type UserFilter struct {
+	Names []string `json:"names,omitempty" example:"john,jane"`
+	Admin *bool    `json:"admin,omitempty" example:"false"`
+}
+
+// UserUpdateResult represents the outcome of a bulk update for a single user
+// @Description Result of updating a single user, status is one of updated, unchanged, skipped or not-found
+type UserUpdateResult struct {
+	Name   string `json:"name" example:"john"`
+	Status string `json:"status" example:"updated"`
+}
+
+// UpdateUsers applies update to all users matching filter within a single transaction, the user named exclude is
+// skipped. Users listed by name which don't exist are reported as not found. If no admin would be left, nothing is
+// updated and ErrLastAdmin is returned.
+func (app *App) UpdateUsers(filter UserFilter, update PartialUser, exclude string) ([]UserUpdateResult, error) {
+	names := make([]string, len(filter.Names))
+	for index, name := range filter.Names {
+		names[index] = app.NormalizeUsername(name)
+	}
+
+	var results []UserUpdateResult
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		users, err := getAllUsersTxn(txn)
+		if err != nil {
+			return err
+		}
+
+		results = make([]UserUpdateResult, 0)
+		admins := 0
+
+		for _, user := range users {
+			matches := (len(names) == 0 || slices.Contains(names, user.Name)) && (filter.Admin == nil || user.Admin == *filter.Admin)
+			status := UserUpdateStatusUnchanged
+
+			switch {
+			case !matches:
+			case user.Name == exclude:
+				results = append(results, UserUpdateResult{Name: user.Name, Status: UserUpdateStatusSkipped})
+			default:
+				if update.Password != nil || (update.Admin != nil && user.Admin != *update.Admin) {
+					if err := app.updateUserTxn(txn, user, update); err != nil {
+						return err
+					}
+
+					status = UserUpdateStatusUpdated
+					if update.Admin != nil {
+						user.Admin = *update.Admin
+					}
+				}
+
+				results = append(results, UserUpdateResult{Name: user.Name, Status: status})
+			}
+
+			if user.Admin {
+				admins++
+			}
+		}
+
+		if admins == 0 && update.Admin != nil && !*update.Admin {
+			return ErrLastAdmin
+		}
+
+		for _, name := range names {
+			if !slices.ContainsFunc(users, func(user *User) bool { return user.Name == name }) {
+				results = append(results, UserUpdateResult{Name: name, Status: UserUpdateStatusNotFound})
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// getAllUsersTxn returns all users visible to txn ordered by name, including their password hash.
+func getAllUsersTxn(txn *badger.Txn) ([]*User, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	users := make([]*User, 0)
+	prefix := buildUserKey("")
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var user User
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &user)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to parse user: %w", err)
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrClockNotAdjustable = errors.New("clock can only be adjusted in test mode")
+
+// Clock tells the time everything expiring within the app is based on, e.g. sessions, invites, rate limits and
+// inactivity. Expiry of database entries is enforced by the database, which always uses the time of the system.
+type Clock interface {
+	Now() time.Time
+}
+
+// AdjustableClock is a Clock which can be moved forward, see AdvanceClock.
+type AdjustableClock interface {
+	Clock
+	Advance(d time.Duration) time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock runs along the time of the system shifted by an offset which can only be increased, so tests don't have
+// to wait for things to expire. It's used if GENESIS_TEST_MODE is enabled.
+type ManualClock struct {
+	offset atomic.Int64
+}
+
+func (c *ManualClock) Now() time.Time {
+	return time.Now().Add(time.Duration(c.offset.Load()))
+}
+
+// Advance increases the offset by d and returns the new time.
+func (c *ManualClock) Advance(d time.Duration) time.Time {
+	c.offset.Add(int64(d))
+	return c.Now()
+}
+
+// FakeClock stands still at the time it has been set to, so tests can control time entirely.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set moves the clock to now, which may also be in the past.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (c *FakeClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func newClock(config *AppConfig) Clock {
+	if config.TestMode {
+		return &ManualClock{}
+	}
+
+	return systemClock{}
+}
+
+// Now returns the current time of the clock of the app.
+func (app *App) Now() time.Time {
+	if app.Clock == nil {
+		return time.Now()
+	}
+
+	return app.Clock.Now()
+}
+
+// AdvanceClock moves the clock of the app forward by d and returns the new time. Only an AdjustableClock can be
+// moved, ErrClockNotAdjustable is returned otherwise.
+func (app *App) AdvanceClock(d time.Duration) (time.Time, error) {
+	clock, ok := app.Clock.(AdjustableClock)
+	if !ok {
+		return time.Time{}, ErrClockNotAdjustable
+	}
+
+	return clock.Advance(d), nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import "time"
+
+// ErrorCode identifies the kind of error of a failed request. Unlike messages, codes never change, so clients can rely
+// on them to handle errors and to show their own messages.
+type ErrorCode string
+
+const (
+	// Authentication and permissions
+	CodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	CodeForbidden          ErrorCode = "FORBIDDEN"
+	CodeInvalidCredentials ErrorCode = "INVALID_CREDENTIALS"
+	CodePasswordIncorrect  ErrorCode = "PASSWORD_INCORRECT"
+	CodePasswordReused     ErrorCode = "PASSWORD_REUSED"
+	CodeUserDisabled       ErrorCode = "USER_DISABLED"
+	CodeTooManyRequests    ErrorCode = "TOO_MANY_REQUESTS"
+	CodeReadOnly           ErrorCode = "READ_ONLY"
+	CodeMethodNotAllowed   ErrorCode = "METHOD_NOT_ALLOWED"
+
+	// Confirmation of destructive admin actions
+	CodeConfirmationRequired ErrorCode = "CONFIRMATION_REQUIRED"
+	CodeInvalidConfirmation  ErrorCode = "INVALID_CONFIRMATION"
+
+	// Requests
+	CodeInvalidBody          ErrorCode = "INVALID_BODY"
+	CodeInvalidJson          ErrorCode = "INVALID_JSON"
+	CodeJsonLimitExceeded    ErrorCode = "JSON_LIMIT_EXCEEDED"
+	CodeInvalidEncoding      ErrorCode = "INVALID_ENCODING"
+	CodeUnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	CodeValidationFailed     ErrorCode = "VALIDATION_FAILED"
+	CodeInvalidParameter     ErrorCode = "INVALID_PARAMETER"
+	CodeTooLarge             ErrorCode = "TOO_LARGE"
+	CodeNoFields             ErrorCode = "NO_FIELDS"
+	CodeSelfNotAllowed       ErrorCode = "SELF_NOT_ALLOWED"
+
+	// Data
+	CodeInvalidKeyPattern  ErrorCode = "INVALID_KEY_PATTERN"
+	CodeKeyTooLong         ErrorCode = "KEY_TOO_LONG"
+	CodeKeyReserved        ErrorCode = "KEY_RESERVED"
+	CodeKeyLimitExceeded   ErrorCode = "KEY_LIMIT_EXCEEDED"
+	CodeStorageFull        ErrorCode = "STORAGE_FULL"
+	CodeKeyNotFound        ErrorCode = "KEY_NOT_FOUND"
+	CodeKeyExists          ErrorCode = "KEY_EXISTS"
+	CodeKeyNotShared       ErrorCode = "KEY_NOT_SHARED"
+	CodePreconditionFailed ErrorCode = "PRECONDITION_FAILED"
+	CodePatchTestFailed    ErrorCode = "PATCH_TEST_FAILED"
+	CodeInvalidPatch       ErrorCode = "INVALID_PATCH"
+	CodeInvalidSettings    ErrorCode = "INVALID_SETTINGS"
+	CodeInvalidPermission  ErrorCode = "INVALID_PERMISSION"
+	CodeInvalidLabels      ErrorCode = "INVALID_LABELS"
+	CodeNotNumeric         ErrorCode = "NOT_NUMERIC"
+
+	// Users, invites and teams
+	CodeUserNotFound      ErrorCode = "USER_NOT_FOUND"
+	CodeUserExists        ErrorCode = "USER_EXISTS"
+	CodeUsernameReserved  ErrorCode = "USERNAME_RESERVED"
+	CodeUserLimitExceeded ErrorCode = "USER_LIMIT_EXCEEDED"
+	CodeLastAdmin         ErrorCode = "LAST_ADMIN"
+	CodeNotImpersonating  ErrorCode = "NOT_IMPERSONATING"
+	CodeInviteRequired    ErrorCode = "INVITE_REQUIRED"
+	CodeInvalidInvite     ErrorCode = "INVALID_INVITE"
+	CodeInviteNotFound    ErrorCode = "INVITE_NOT_FOUND"
+	CodeTeamNotFound      ErrorCode = "TEAM_NOT_FOUND"
+	CodeTeamExists        ErrorCode = "TEAM_EXISTS"
+	CodeInvalidTeamName   ErrorCode = "INVALID_TEAM_NAME"
+	CodeNotTeamMember     ErrorCode = "NOT_TEAM_MEMBER"
+
+	// Server
+	CodeAlreadyRunning ErrorCode = "ALREADY_RUNNING"
+	CodeInternal       ErrorCode = "INTERNAL_ERROR"
+)
+
+// ErrorResponse represents an error response
+// @Description Error response with a message meant for humans and a stable code to handle it, see ErrorCode
+// @Description Requests rejected because of a limit include it along with the current amount, resetAt is only set if the limit resets on its own.
+// @Description Internal errors include the id of the request, which is logged along with the cause.
+type ErrorResponse struct {
+	Error     string     `json:"error" example:"error message"`
+	Code      ErrorCode  `json:"code" example:"INVALID_KEY_PATTERN"`
+	Limit     *int64     `json:"limit,omitempty" example:"6"`
+	Current   *int64     `json:"current,omitempty" example:"6"`
+	ResetAt   *time.Time `json:"resetAt,omitempty" example:"2024-01-01T00:00:00Z"`
+	RequestID string     `json:"requestId,omitempty" example:"9b1deb4d3b7d4bad9bdd2b0d7b3dcb6d"`
+}
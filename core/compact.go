@@ -0,0 +1,56 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrCompactionRunning = errors.New("compaction already running")
+
+// LevelStats describes a single level of the LSM tree
+// @Description Tables and size of a level of the database
+type LevelStats struct {
+	Level      int   `json:"level" example:"1"`
+	Tables     int   `json:"tables" example:"4"`
+	Size       int64 `json:"size" example:"1048576"`
+	TargetSize int64 `json:"targetSize" example:"10485760"`
+}
+
+// CompactionResult describes a finished compaction
+// @Description Duration of the compaction in milliseconds and the levels of the database afterward
+type CompactionResult struct {
+	DurationMs int64        `json:"durationMs" example:"1200"`
+	Levels     []LevelStats `json:"levels"`
+}
+
+// CompactDatabase flattens the LSM tree of the database into a single level using workers concurrent compactors,
+// which removes tombstones and overwritten versions. Only one compaction runs at a time, ErrCompactionRunning
+// is returned while another one is in progress.
+func (app *App) CompactDatabase(workers int) (*CompactionResult, error) {
+	if !app.compacting.CompareAndSwap(false, true) {
+		return nil, ErrCompactionRunning
+	}
+
+	defer app.compacting.Store(false)
+
+	start := time.Now()
+	if err := app.db.Flatten(max(workers, 1)); err != nil {
+		return nil, err
+	}
+
+	result := &CompactionResult{
+		DurationMs: time.Since(start).Milliseconds(),
+		Levels:     make([]LevelStats, 0),
+	}
+
+	for _, level := range app.db.Levels() {
+		result.Levels = append(result.Levels, LevelStats{
+			Level:      level.Level,
+			Tables:     level.NumTables,
+			Size:       level.Size,
+			TargetSize: level.TargetSize,
+		})
+	}
+
+	return result, nil
+}
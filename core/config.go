@@ -1,63 +1,369 @@
 package core
 
 import (
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
+const (
+	// AuthErrorBodyJson answers requests without a valid session with {"error":"unauthorized"}
+	AuthErrorBodyJson = "json"
+	// AuthErrorBodyNone answers requests without a valid session with an empty body
+	AuthErrorBodyNone = "none"
+)
+
+const (
+	// CookieSameSiteStrict only sends the session cookie with requests from the same site
+	CookieSameSiteStrict = "strict"
+	// CookieSameSiteLax also sends the session cookie with top-level navigations from other sites
+	CookieSameSiteLax = "lax"
+	// CookieSameSiteNone sends the session cookie with all requests, e.g. from an app on another subdomain
+	CookieSameSiteNone = "none"
+)
+
 type AppConfig struct {
-	DbPath             string
-	BaseUrl            string
-	JWTSecret          []byte
-	JWTExpiration      time.Duration
-	JWTCookieAllowHTTP bool
-	AppBuildVersion    string
-	AppBuildDate       string
-	AppBuildCommit     string
-	AppGinMode         string
-	AppPort            string
-	AppUsersToCreate   []User
-	AppUserPattern     *regexp.Regexp
-	AppKeyPattern      *regexp.Regexp
-	AppDataMaxSize     int64
-	AppKeysPerUser     int64
-	SwaggerEnabled     bool
-}
-
-var Config = func() AppConfig {
+	LogMode                   string
+	DbPath                    string
+	ReadOnly                  bool
+	BaseUrl                   string
+	JWTSecret                 []byte
+	JWTPreviousSecret         []byte
+	JWTExpiration             time.Duration
+	JWTLeeway                 time.Duration
+	JWTCookieAllowHTTP        bool
+	JWTCookieDomain           string
+	JWTCookiePath             string
+	JWTCookieSameSite         string
+	JWTIssuer                 string
+	JWTAudience               string
+	ImpersonationExpiration   time.Duration
+	AppBuildVersion           string
+	AppBuildDate              string
+	AppBuildCommit            string
+	AppGinMode                string
+	TestMode                  bool
+	AppPort                   string
+	ListenAddr                string
+	UnixSocket                string
+	TLSCertFile               string
+	TLSKeyFile                string
+	TLSMinVersion             uint16
+	TLSCipherSuites           []uint16
+	H2C                       bool
+	AppUsersToCreate          []User
+	AppUserPattern            *regexp.Regexp
+	UsernameCaseInsensitive   bool
+	ReservedUsernames         []string
+	AppKeyPattern             *regexp.Regexp
+	AppKeyMaxLength           int64
+	AppDataMaxSize            int64
+	AppCanonicalizeJson       bool
+	AppMinifyJsonNumbers      bool
+	AppJsonMaxDepth           int64
+	AppJsonMaxArrayLength     int64
+	AppJsonMaxElements        int64
+	DedupEnabled              bool
+	CompactionWorkers         int64
+	AppKeysPerUser            int64
+	GlobalMaxKeys             int64
+	DataStatsDelimiter        string
+	AppDataCacheMaxAge        int64
+	AppMaxUsers               int64
+	AllowRegistration         bool
+	RegistrationRequireInvite bool
+	InviteTTL                 time.Duration
+	SwaggerEnabled            bool
+	SwaggerForceEnabled       bool
+	StaticDir                 string
+	StaticPath                string
+	BackupInterval            time.Duration
+	BackupRetention           int64
+	BackupS3Endpoint          string
+	BackupS3Region            string
+	BackupS3Bucket            string
+	BackupS3Prefix            string
+	BackupS3AccessKey         string
+	BackupS3SecretKey         string
+	BackupS3SessionToken      string
+	HealthDegradedLatency     time.Duration
+	MetricsEnabled            bool
+	MetricsWindow             time.Duration
+	SlowRequestThreshold      time.Duration
+	DebugLogBodies            bool
+	DebugLogBodiesPaths       []string
+	DebugLogBodiesUsers       []string
+	DebugLogBodiesMaxSize     int64
+	SettingsSchema            map[string]string
+	UserTemplate              *UserTemplate
+	TrashEnabled              bool
+	TrashTTL                  time.Duration
+	TrackLastAccess           bool
+	DataIndexes               []DataIndex
+	InactivityDisableAfter    time.Duration
+	InactivityDisableAdmins   bool
+	LoginRateLimit            int64
+	LoginRateLimitPerIP       int64
+	LoginRateLimitWindow      time.Duration
+	MaxConcurrentPerUser      int64
+	AdminReauthRequired       bool
+	AdminConfirmRequired      bool
+	AuthChallenge             string
+	AuthErrorBody             string
+	PasswordHash              string
+	PasswordHistory           int64
+	BcryptCost                int64
+	Argon2Time                uint32
+	Argon2Memory              uint32
+	Argon2Threads             uint8
+}
+
+// Config is the configuration of the Default app, it's empty until LoadConfig has been called.
+var Config AppConfig
+
+var loadConfigOnce sync.Once
+
+// LoadConfig loads envFiles, or the ones found by findEnvFiles if there are none, into the environment and parses
+// Config from it. Logger is built from the configuration afterward. It's meant to be called once at startup, later
+// calls have no effect. An invalid configuration panics.
+func LoadConfig(envFiles ...string) {
+	loadConfigOnce.Do(func() {
+		if len(envFiles) == 0 {
+			envFiles = findEnvFiles()
+		}
+
+		// Variables already set in the environment are never overridden, earlier files take precedence over later ones
+		if len(envFiles) != 0 {
+			if err := godotenv.Load(envFiles...); err != nil {
+				panic(fmt.Errorf("failed to load .env files: %w", err))
+			}
+		}
+
+		Config = parseConfig()
+		Logger = newLogger(Config.LogMode)
+		Default.Logger = Logger
+		Default.Clock = newClock(&Config)
+
+		if len(envFiles) == 0 {
+			Logger.Debug("no .env file found, using environment variables only")
+		} else {
+			Logger.Debug("loaded .env files", zap.Strings("files", envFiles))
+		}
+
+		Config.logWarnings(Logger)
+	})
+}
+
+// findEnvFiles returns the .env files to load, ordered by precedence. GENESIS_ENV_FILE takes a comma-separated list
+// of files which must exist, otherwise .env.local and .env are loaded from the working directory if present.
+func findEnvFiles() []string {
+	if explicit := os.Getenv("GENESIS_ENV_FILE"); len(explicit) != 0 {
+		return parseList(explicit)
+	}
+
+	files := make([]string, 0)
+	for _, file := range []string{".env.local", ".env"} {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+func parseConfig() AppConfig {
 	config := AppConfig{
-		DbPath:             resolvePath(os.Getenv("GENESIS_DB_PATH")),
-		BaseUrl:            os.Getenv("GENESIS_BASE_URL"),
-		JWTSecret:          []byte(os.Getenv("GENESIS_JWT_SECRET")),
-		JWTExpiration:      time.Duration(parseInt(os.Getenv("GENESIS_JWT_TOKEN_EXPIRATION"))) * time.Minute,
-		JWTCookieAllowHTTP: os.Getenv("GENESIS_JWT_COOKIE_ALLOW_HTTP") == "true",
-		AppBuildVersion:    os.Getenv("GENESIS_BUILD_VERSION"),
-		AppBuildDate:       os.Getenv("GENESIS_BUILD_DATE"),
-		AppBuildCommit:     os.Getenv("GENESIS_BUILD_COMMIT"),
-		AppGinMode:         os.Getenv("GENESIS_GIN_MODE"),
-		AppPort:            os.Getenv("GENESIS_PORT"),
-		AppUsersToCreate:   parseInitialUserList(os.Getenv("GENESIS_CREATE_USERS")),
-		AppUserPattern:     regexp.MustCompile(os.Getenv("GENESIS_USERNAME_PATTERN")),
-		AppKeyPattern:      regexp.MustCompile(os.Getenv("GENESIS_KEY_PATTERN")),
-		AppDataMaxSize:     parseInt(os.Getenv("GENESIS_DATA_MAX_SIZE")) * 1000,
-		AppKeysPerUser:     parseInt(os.Getenv("GENESIS_KEYS_PER_USER")),
-		SwaggerEnabled:     os.Getenv("GENESIS_SWAGGER_ENABLED") != "false", // Enabled by default
-	}
-
-	Logger.Debug("build info",
+		LogMode:                   os.Getenv("GENESIS_LOG_MODE"),
+		DbPath:                    resolvePath(os.Getenv("GENESIS_DB_PATH")),
+		ReadOnly:                  os.Getenv("GENESIS_READ_ONLY") == "true",
+		BaseUrl:                   os.Getenv("GENESIS_BASE_URL"),
+		JWTSecret:                 []byte(os.Getenv("GENESIS_JWT_SECRET")),
+		JWTPreviousSecret:         []byte(os.Getenv("GENESIS_JWT_PREVIOUS_SECRET")),
+		JWTExpiration:             time.Duration(parseInt(os.Getenv("GENESIS_JWT_TOKEN_EXPIRATION"))) * time.Minute,
+		JWTLeeway:                 time.Duration(parseIntOrDefault(os.Getenv("GENESIS_JWT_LEEWAY"), 30)) * time.Second,
+		JWTCookieAllowHTTP:        os.Getenv("GENESIS_JWT_COOKIE_ALLOW_HTTP") == "true",
+		JWTCookieDomain:           os.Getenv("GENESIS_JWT_COOKIE_DOMAIN"),
+		JWTCookiePath:             os.Getenv("GENESIS_JWT_COOKIE_PATH"),
+		JWTCookieSameSite:         parseCookieSameSite(os.Getenv("GENESIS_JWT_COOKIE_SAMESITE")),
+		JWTIssuer:                 os.Getenv("GENESIS_JWT_ISSUER"),
+		JWTAudience:               os.Getenv("GENESIS_JWT_AUDIENCE"),
+		ImpersonationExpiration:   time.Duration(parseIntOrDefault(os.Getenv("GENESIS_IMPERSONATION_EXPIRATION"), 15)) * time.Minute,
+		AppBuildVersion:           os.Getenv("GENESIS_BUILD_VERSION"),
+		AppBuildDate:              os.Getenv("GENESIS_BUILD_DATE"),
+		AppBuildCommit:            os.Getenv("GENESIS_BUILD_COMMIT"),
+		AppGinMode:                os.Getenv("GENESIS_GIN_MODE"),
+		TestMode:                  os.Getenv("GENESIS_TEST_MODE") == "true",
+		AppPort:                   os.Getenv("GENESIS_PORT"),
+		ListenAddr:                parseListenAddr(os.Getenv("GENESIS_LISTEN_ADDR"), os.Getenv("GENESIS_PORT")),
+		UnixSocket:                os.Getenv("GENESIS_UNIX_SOCKET"),
+		TLSCertFile:               os.Getenv("GENESIS_TLS_CERT"),
+		TLSKeyFile:                os.Getenv("GENESIS_TLS_KEY"),
+		TLSMinVersion:             parseTLSVersion(os.Getenv("GENESIS_TLS_MIN_VERSION")),
+		TLSCipherSuites:           parseCipherSuites(os.Getenv("GENESIS_TLS_CIPHER_SUITES")),
+		H2C:                       os.Getenv("GENESIS_H2C") == "true",
+		AppUsersToCreate:          parseInitialUserList(os.Getenv("GENESIS_CREATE_USERS")),
+		AppUserPattern:            regexp.MustCompile(os.Getenv("GENESIS_USERNAME_PATTERN")),
+		UsernameCaseInsensitive:   os.Getenv("GENESIS_USERNAME_CASE_INSENSITIVE") == "true",
+		ReservedUsernames:         parseList(os.Getenv("GENESIS_RESERVED_USERNAMES")),
+		AppKeyPattern:             regexp.MustCompile(os.Getenv("GENESIS_KEY_PATTERN")),
+		AppKeyMaxLength:           parseIntOrDefault(os.Getenv("GENESIS_KEY_MAX_LENGTH"), 0),
+		AppDataMaxSize:            parseInt(os.Getenv("GENESIS_DATA_MAX_SIZE")) * 1000,
+		AppCanonicalizeJson:       os.Getenv("GENESIS_CANONICALIZE_JSON") == "true",
+		AppMinifyJsonNumbers:      os.Getenv("GENESIS_MINIFY_JSON_NUMBERS") == "true",
+		AppJsonMaxDepth:           parseIntOrDefault(os.Getenv("GENESIS_JSON_MAX_DEPTH"), 0),
+		AppJsonMaxArrayLength:     parseIntOrDefault(os.Getenv("GENESIS_JSON_MAX_ARRAY_LEN"), 0),
+		AppJsonMaxElements:        parseIntOrDefault(os.Getenv("GENESIS_JSON_MAX_ELEMENTS"), 0),
+		DedupEnabled:              os.Getenv("GENESIS_DEDUP_ENABLED") == "true",
+		CompactionWorkers:         parseIntOrDefault(os.Getenv("GENESIS_COMPACTION_WORKERS"), 2),
+		AppKeysPerUser:            parseInt(os.Getenv("GENESIS_KEYS_PER_USER")),
+		GlobalMaxKeys:             parseIntOrDefault(os.Getenv("GENESIS_GLOBAL_MAX_KEYS"), 0),
+		DataStatsDelimiter:        cmp.Or(os.Getenv("GENESIS_DATA_STATS_DELIMITER"), ":"),
+		AppDataCacheMaxAge:        parseIntOrDefault(os.Getenv("GENESIS_DATA_CACHE_MAXAGE"), 0),
+		AppMaxUsers:               parseIntOrDefault(os.Getenv("GENESIS_MAX_USERS"), 0),
+		AllowRegistration:         os.Getenv("GENESIS_ALLOW_REGISTRATION") == "true",
+		RegistrationRequireInvite: os.Getenv("GENESIS_REGISTRATION_REQUIRE_INVITE") == "true",
+		InviteTTL:                 time.Duration(parseIntOrDefault(os.Getenv("GENESIS_INVITE_TTL"), 10_080)) * time.Minute,
+		SwaggerEnabled:            os.Getenv("GENESIS_SWAGGER_ENABLED") != "false", // Enabled by default, except for release mode
+		SwaggerForceEnabled:       os.Getenv("GENESIS_SWAGGER_ENABLED") == "true",
+		StaticDir:                 os.Getenv("GENESIS_STATIC_DIR"),
+		StaticPath:                os.Getenv("GENESIS_STATIC_PATH"),
+		BackupInterval:            time.Duration(parseIntOrDefault(os.Getenv("GENESIS_BACKUP_INTERVAL"), 0)) * time.Minute,
+		BackupRetention:           parseIntOrDefault(os.Getenv("GENESIS_BACKUP_RETENTION"), 0),
+		BackupS3Endpoint:          os.Getenv("GENESIS_BACKUP_S3_ENDPOINT"),
+		BackupS3Region:            cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		BackupS3Bucket:            os.Getenv("GENESIS_BACKUP_S3_BUCKET"),
+		BackupS3Prefix:            os.Getenv("GENESIS_BACKUP_S3_PREFIX"),
+		BackupS3AccessKey:         os.Getenv("AWS_ACCESS_KEY_ID"),
+		BackupS3SecretKey:         os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		BackupS3SessionToken:      os.Getenv("AWS_SESSION_TOKEN"),
+		HealthDegradedLatency:     time.Duration(parseIntOrDefault(os.Getenv("GENESIS_HEALTH_DEGRADED_MS"), 250)) * time.Millisecond,
+		MetricsEnabled:            os.Getenv("GENESIS_METRICS_ENABLED") == "true",
+		MetricsWindow:             time.Duration(parseIntOrDefault(os.Getenv("GENESIS_METRICS_WINDOW"), 5)) * time.Minute,
+		SlowRequestThreshold:      time.Duration(parseIntOrDefault(os.Getenv("GENESIS_SLOW_REQUEST_MS"), 0)) * time.Millisecond,
+		DebugLogBodies:            os.Getenv("GENESIS_DEBUG_LOG_BODIES") == "true",
+		DebugLogBodiesPaths:       parseList(os.Getenv("GENESIS_DEBUG_LOG_BODIES_PATHS")),
+		DebugLogBodiesUsers:       parseList(os.Getenv("GENESIS_DEBUG_LOG_BODIES_USERS")),
+		DebugLogBodiesMaxSize:     parseIntOrDefault(os.Getenv("GENESIS_DEBUG_LOG_BODIES_MAX_SIZE"), 4096),
+		SettingsSchema:            parseSettingsSchema(os.Getenv("GENESIS_SETTINGS_SCHEMA")),
+		UserTemplate:              parseUserTemplate(os.Getenv("GENESIS_USER_TEMPLATE"), os.Getenv("GENESIS_USER_TEMPLATE_FILE")),
+		TrashEnabled:              os.Getenv("GENESIS_TRASH_ENABLED") == "true",
+		TrashTTL:                  time.Duration(parseIntOrDefault(os.Getenv("GENESIS_TRASH_TTL"), 43_200)) * time.Minute,
+		TrackLastAccess:           os.Getenv("GENESIS_TRACK_LAST_ACCESS") == "true",
+		DataIndexes:               parseDataIndexes(os.Getenv("GENESIS_DATA_INDEXES")),
+		InactivityDisableAfter:    time.Duration(parseIntOrDefault(os.Getenv("GENESIS_INACTIVITY_DISABLE_DAYS"), 0)) * 24 * time.Hour,
+		InactivityDisableAdmins:   os.Getenv("GENESIS_INACTIVITY_DISABLE_ADMINS") == "true",
+		LoginRateLimit:            parseIntOrDefault(os.Getenv("GENESIS_LOGIN_RATE_LIMIT"), 0),
+		LoginRateLimitPerIP:       parseIntOrDefault(os.Getenv("GENESIS_LOGIN_RATE_LIMIT_IP"), 0),
+		LoginRateLimitWindow:      time.Duration(parseIntOrDefault(os.Getenv("GENESIS_LOGIN_RATE_LIMIT_WINDOW"), 1)) * time.Minute,
+		MaxConcurrentPerUser:      parseIntOrDefault(os.Getenv("GENESIS_MAX_CONCURRENT_PER_USER"), 0),
+		AdminReauthRequired:       os.Getenv("GENESIS_REQUIRE_REAUTH_FOR_ADMIN_WRITES") == "true",
+		AdminConfirmRequired:      os.Getenv("GENESIS_REQUIRE_CONFIRMATION_FOR_ADMIN_DELETES") == "true",
+		AuthChallenge:             os.Getenv("GENESIS_AUTH_CHALLENGE"),
+		AuthErrorBody:             parseAuthErrorBody(os.Getenv("GENESIS_AUTH_ERROR_BODY")),
+		PasswordHash:              parsePasswordHash(os.Getenv("GENESIS_PASSWORD_HASH")),
+		PasswordHistory:           parseIntOrDefault(os.Getenv("GENESIS_PASSWORD_HISTORY"), 0),
+		BcryptCost:                parseIntOrDefault(os.Getenv("GENESIS_BCRYPT_COST"), 10),
+		Argon2Time:                uint32(parseIntInRange("GENESIS_ARGON2_TIME", 3, 1, math.MaxUint32)),
+		Argon2Memory:              uint32(parseIntInRange("GENESIS_ARGON2_MEMORY", 65_536, 8, math.MaxUint32)),
+		Argon2Threads:             uint8(parseIntInRange("GENESIS_ARGON2_THREADS", 2, 1, math.MaxUint8)),
+	}
+
+	// Argon2 requires at least 8 KiB of memory per thread, less would silently be raised to it
+	if config.Argon2Memory < 8*uint32(config.Argon2Threads) {
+		panic(errors.New("GENESIS_ARGON2_MEMORY must be at least 8 times GENESIS_ARGON2_THREADS"))
+	}
+
+	if (len(config.TLSCertFile) == 0) != (len(config.TLSKeyFile) == 0) {
+		panic(errors.New("GENESIS_TLS_CERT and GENESIS_TLS_KEY must be set together"))
+	}
+
+	// Adjusting the clock expires sessions and resets rate limits, which must never be possible in production
+	if config.TestMode && config.AppGinMode == "release" {
+		panic(errors.New("GENESIS_TEST_MODE can't be enabled in release mode"))
+	}
+
+	// Initial users are created on every start, which would fail each time
+	for _, user := range config.AppUsersToCreate {
+		if isReservedUsername(config.ReservedUsernames, user.Name) {
+			panic(fmt.Errorf("GENESIS_CREATE_USERS contains the reserved username %q", user.Name))
+		}
+	}
+
+	if config.AppJsonMaxDepth < 0 || config.AppJsonMaxArrayLength < 0 || config.AppJsonMaxElements < 0 {
+		panic(errors.New("GENESIS_JSON_MAX_DEPTH, GENESIS_JSON_MAX_ARRAY_LEN and GENESIS_JSON_MAX_ELEMENTS must not be negative"))
+	}
+
+	if config.JWTLeeway < 0 {
+		panic(errors.New("GENESIS_JWT_LEEWAY must not be negative"))
+	}
+
+	if len(config.JWTCookiePath) != 0 && !strings.HasPrefix(config.JWTCookiePath, "/") {
+		panic(errors.New("GENESIS_JWT_COOKIE_PATH must start with a slash"))
+	}
+
+	// Browsers reject SameSite=None cookies which aren't secure
+	if config.JWTCookieSameSite == CookieSameSiteNone && config.JWTCookieAllowHTTP {
+		panic(errors.New("GENESIS_JWT_COOKIE_SAMESITE=none can't be combined with GENESIS_JWT_COOKIE_ALLOW_HTTP"))
+	}
+
+	if len(config.StaticDir) != 0 {
+		if info, err := os.Stat(config.StaticDir); err != nil || !info.IsDir() {
+			panic(fmt.Errorf("GENESIS_STATIC_DIR is not a directory: %s", config.StaticDir))
+		}
+	}
+
+	if len(config.BackupS3Endpoint) == 0 {
+		config.BackupS3Endpoint = "https://s3." + config.BackupS3Region + ".amazonaws.com"
+	}
+
+	if config.BackupInterval > 0 && len(config.BackupS3Bucket) == 0 {
+		panic(errors.New("GENESIS_BACKUP_INTERVAL requires GENESIS_BACKUP_S3_BUCKET"))
+	} else if config.BackupInterval > 0 && (len(config.BackupS3AccessKey) == 0 || len(config.BackupS3SecretKey) == 0) {
+		panic(errors.New("GENESIS_BACKUP_INTERVAL requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"))
+	}
+
+	return config
+}
+
+// logWarnings logs settings which are meant for debugging or have no effect, along with the build info.
+func (config *AppConfig) logWarnings(logger *zap.Logger) {
+	if config.TLSMinVersion == tls.VersionTLS13 && len(config.TLSCipherSuites) != 0 {
+		logger.Warn("GENESIS_TLS_CIPHER_SUITES has no effect, the cipher suites of TLS 1.3 are not configurable")
+	}
+
+	if config.TestMode {
+		logger.Warn("test mode is enabled, admins can adjust the clock of the app via POST /test/clock")
+	}
+
+	if config.DebugLogBodies {
+		logger.Warn("request and response bodies are logged, this is meant for debugging only",
+			zap.Strings("paths", config.DebugLogBodiesPaths),
+			zap.Strings("users", config.DebugLogBodiesUsers),
+		)
+	}
+
+	logger.Debug("build info",
 		zap.String("version", config.AppBuildVersion),
 		zap.String("date", config.AppBuildDate),
 		zap.String("commit", config.AppBuildCommit),
 	)
-
-	return config
-}()
+}
 
 func parseInitialUserList(raw string) []User {
 	list := make([]User, 0)
@@ -83,6 +389,177 @@ func parseInitialUserList(raw string) []User {
 	return list
 }
 
+func parseSettingsSchema(raw string) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var schema map[string]string
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		panic(fmt.Errorf("invalid settings schema: %w", err))
+	}
+
+	for field, kind := range schema {
+		switch kind {
+		case "string", "number", "boolean", "object", "array":
+		default:
+			panic(fmt.Errorf("invalid type %q for settings field %q", kind, field))
+		}
+	}
+
+	return schema
+}
+
+// parseUserTemplate parses the template seeded for new users, which is either given inline or read from file.
+// It's only checked for syntax here, see App.ValidateUserTemplate.
+func parseUserTemplate(raw string, file string) *UserTemplate {
+	if len(raw) != 0 && len(file) != 0 {
+		panic(errors.New("GENESIS_USER_TEMPLATE and GENESIS_USER_TEMPLATE_FILE are mutually exclusive"))
+	} else if len(file) != 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			panic(fmt.Errorf("failed to read user template: %w", err))
+		}
+
+		raw = string(data)
+	}
+
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var template UserTemplate
+	if err := json.Unmarshal([]byte(raw), &template); err != nil {
+		panic(fmt.Errorf("invalid user template: %w", err))
+	}
+
+	return &template
+}
+
+func parsePasswordHash(raw string) string {
+	switch raw {
+	case "":
+		return PasswordHashBcrypt
+	case PasswordHashBcrypt, PasswordHashArgon2id:
+		return raw
+	default:
+		panic(fmt.Errorf("invalid password hash %q", raw))
+	}
+}
+
+// parseAuthErrorBody validates how requests without a valid session are answered, see AuthErrorBodyJson.
+func parseAuthErrorBody(raw string) string {
+	switch raw {
+	case "":
+		return AuthErrorBodyJson
+	case AuthErrorBodyJson, AuthErrorBodyNone:
+		return raw
+	default:
+		panic(fmt.Errorf("invalid auth error body %q", raw))
+	}
+}
+
+// parseCookieSameSite validates the SameSite attribute of the session cookie, see CookieSameSiteStrict.
+func parseCookieSameSite(raw string) string {
+	switch raw {
+	case "":
+		return CookieSameSiteStrict
+	case CookieSameSiteStrict, CookieSameSiteLax, CookieSameSiteNone:
+		return raw
+	default:
+		panic(fmt.Errorf("invalid cookie same-site mode %q", raw))
+	}
+}
+
+// parseDataIndexes parses a comma-separated list of indexed fields as key-pattern:field, e.g. task_*:status.
+// Key patterns use the syntax of path.Match, fields are dot-separated paths into the stored values.
+func parseDataIndexes(raw string) []DataIndex {
+	indexes := make([]DataIndex, 0)
+
+	for _, item := range parseList(raw) {
+		pattern, field, ok := strings.Cut(item, ":")
+		if !ok || len(pattern) == 0 || slices.Contains(strings.Split(field, "."), "") {
+			panic(fmt.Errorf("invalid data index %q, expected key-pattern:field", item))
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Errorf("invalid key pattern of data index %q: %w", item, err))
+		}
+
+		indexes = append(indexes, DataIndex{KeyPattern: pattern, Field: field})
+	}
+
+	return indexes
+}
+
+// parseListenAddr validates the address to listen on, falling back to the port for compatibility.
+func parseListenAddr(raw string, port string) string {
+	if len(raw) == 0 && len(port) != 0 {
+		raw = "0.0.0.0:" + port
+	} else if len(raw) == 0 {
+		return ":8080"
+	}
+
+	if _, rawPort, err := net.SplitHostPort(raw); err != nil {
+		panic(fmt.Errorf("invalid listen address %q: %w", raw, err))
+	} else if _, err := strconv.ParseUint(rawPort, 10, 16); err != nil {
+		panic(fmt.Errorf("invalid port in listen address %q", raw))
+	}
+
+	return raw
+}
+
+// parseTLSVersion parses the minimum TLS version, versions before 1.2 are considered broken and rejected.
+func parseTLSVersion(raw string) uint16 {
+	switch raw {
+	case "", "1.2":
+		return tls.VersionTLS12
+	case "1.3":
+		return tls.VersionTLS13
+	default:
+		panic(fmt.Errorf("invalid minimum TLS version %q, must be 1.2 or 1.3", raw))
+	}
+}
+
+// parseCipherSuites parses a comma-separated list of cipher suite names as used by crypto/tls, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+// Suites with known security issues are rejected, as are lists that would prevent HTTP/2 from being negotiated.
+func parseCipherSuites(raw string) []uint16 {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	suites := make([]uint16, 0)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+
+		if index := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name }); index != -1 {
+			suites = append(suites, tls.CipherSuites()[index].ID)
+		} else if slices.ContainsFunc(tls.InsecureCipherSuites(), func(suite *tls.CipherSuite) bool { return suite.Name == name }) {
+			panic(fmt.Errorf("insecure cipher suite %q", name))
+		} else {
+			panic(fmt.Errorf("unknown cipher suite %q", name))
+		}
+	}
+
+	// HTTP/2 requires one of these, see RFC 7540 section 9.2.2
+	if !slices.Contains(suites, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) && !slices.Contains(suites, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256) {
+		panic(errors.New("cipher suites must include TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 or TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"))
+	}
+
+	return suites
+}
+
+// parseList parses a comma-separated list, surrounding whitespace and empty items are dropped.
+func parseList(raw string) []string {
+	list := make([]string, 0)
+
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); len(item) != 0 {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
 func parseInt(str string) int64 {
 	raw := strings.ReplaceAll(str, "_", "")
 	if value, err := strconv.ParseInt(raw, 10, 64); err != nil {
@@ -92,6 +569,25 @@ func parseInt(str string) int64 {
 	}
 }
 
+func parseIntOrDefault(str string, fallback int64) int64 {
+	if len(str) == 0 {
+		return fallback
+	}
+
+	return parseInt(str)
+}
+
+// parseIntInRange parses the environment variable name like parseIntOrDefault, values outside of [lower, upper] panic
+// instead of being truncated once they're converted to a smaller type.
+func parseIntInRange(name string, fallback, lower, upper int64) int64 {
+	value := parseIntOrDefault(os.Getenv(name), fallback)
+	if value < lower || value > upper {
+		panic(fmt.Errorf("%s must be between %d and %d", name, lower, upper))
+	}
+
+	return value
+}
+
 func resolvePath(path string) string {
 	return filepath.Join(currentDir(), path)
 }
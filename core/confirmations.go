@@ -0,0 +1,84 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ConfirmationTTL is how long a confirmation token can be used to execute the action it was issued for
+const ConfirmationTTL = 5 * time.Minute
+
+var ErrInvalidConfirmation = errors.New("confirmation token is invalid or expired")
+
+// Confirmation is issued for a destructive action, which is only executed if the token is sent back before it expires
+// @Description Token to send back to execute a destructive action along with what it will do
+type Confirmation struct {
+	Token     string    `json:"token" example:"9b1deb4d3b7d4bad9bdd2b0d7b3dcb6d"`
+	Impact    string    `json:"impact" example:"will delete user john and 142 keys"`
+	ExpiresAt time.Time `json:"expiresAt" example:"2025-01-01T00:05:00Z"`
+}
+
+// storedConfirmation binds a confirmation token to the admin it was issued to and the action it confirms
+type storedConfirmation struct {
+	Admin     string    `json:"admin"`
+	Action    string    `json:"action"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// CreateConfirmation issues a single-use token which allows admin to execute action within ConfirmationTTL, impact
+// describes what the action will do. Actions identify both the operation and its target, e.g. "delete-user:john".
+func (app *App) CreateConfirmation(admin, action, impact string) (*Confirmation, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+
+	confirmation := &Confirmation{
+		Token:     hex.EncodeToString(token),
+		Impact:    impact,
+		ExpiresAt: app.Now().UTC().Add(ConfirmationTTL),
+	}
+
+	data, err := json.Marshal(storedConfirmation{Admin: admin, Action: action, ExpiresAt: confirmation.ExpiresAt})
+	if err != nil {
+		return nil, err
+	}
+
+	return confirmation, app.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(buildConfirmationKey(confirmation.Token), data).WithTTL(ConfirmationTTL))
+	})
+}
+
+// ConsumeConfirmation invalidates token if it has been issued to admin for action, otherwise ErrInvalidConfirmation is
+// returned. Each token can only be used once, even by concurrent requests.
+func (app *App) ConsumeConfirmation(admin, action, token string) error {
+	if len(token) == 0 {
+		return ErrInvalidConfirmation
+	}
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		item, err := txn.Get(buildConfirmationKey(token))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrInvalidConfirmation
+		} else if err != nil {
+			return err
+		}
+
+		var stored storedConfirmation
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &stored)
+		}); err != nil {
+			return err
+		} else if stored.Admin != admin || stored.Action != action || !stored.ExpiresAt.After(app.Now()) {
+			return ErrInvalidConfirmation
+		}
+
+		return txn.Delete(buildConfirmationKey(token))
+	})
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	ErrNotNumeric       = errors.New("stored value is not a number")
+	ErrNumberOutOfRange = errors.New("number is out of range")
+)
+
+// IncrementDataForUser adds each increment to the number stored under its key of name within a single transaction,
+// keys which don't exist yet are created starting at zero. Returns the resulting values by key. Integers are added
+// exactly, other numbers as 64-bit floats. If the value of any key isn't a number, nothing is changed and
+// ErrNotNumeric is returned along with those keys in order.
+func (app *App) IncrementDataForUser(name string, increments map[string]json.Number) (map[string]json.Number, []string, error) {
+	keys := make([]string, 0, len(increments))
+	for key := range increments {
+		keys = append(keys, key)
+	}
+
+	// Lock in order so concurrent batches sharing keys can't deadlock
+	slices.Sort(keys)
+	for _, key := range keys {
+		defer app.lockData(name, key)()
+	}
+
+	var results map[string]json.Number
+	var failed []string
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		results = make(map[string]json.Number, len(keys))
+		failed = nil
+		created := 0
+
+		for _, key := range keys {
+			var current interface{} = json.Number("0")
+
+			if item, err := txn.Get(dataKey(name, key)); errors.Is(err, badger.ErrKeyNotFound) {
+				created++
+			} else if err != nil {
+				return err
+			} else if value, err := readValue(txn, item); err != nil {
+				return err
+			} else if err := decodeSingleJson(value, &current); err != nil {
+				return err
+			}
+
+			number, ok := current.(json.Number)
+			if !ok {
+				failed = append(failed, key)
+				continue
+			}
+
+			sum, err := addNumbers(number, increments[key])
+			if err != nil {
+				return err
+			}
+
+			results[key] = sum
+		}
+
+		if len(failed) != 0 {
+			return ErrNotNumeric
+		} else if created != 0 && int64(len(collectKeysTxn(txn, dataKey(name, "")))+created) > app.Config.AppKeysPerUser {
+			return ErrTooManyKeys
+		}
+
+		for _, key := range keys {
+			if err := app.setValueTxn(txn, dataKey(name, key), []byte(results[key])); err != nil {
+				return err
+			} else if err := app.indexDataTxn(txn, name, key, []byte(results[key])); err != nil {
+				return err
+			} else if err := app.markUpdatedTxn(txn, name, key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, ErrNotNumeric) {
+		return nil, failed, err
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	return results, nil, nil
+}
+
+// addNumbers returns the sum of a and b, which is exact if both are integers.
+func addNumbers(a, b json.Number) (json.Number, error) {
+	if isJsonInteger(a) && isJsonInteger(b) {
+		x, okX := new(big.Int).SetString(a.String(), 10)
+		y, okY := new(big.Int).SetString(b.String(), 10)
+		if !okX || !okY {
+			return "", ErrNumberOutOfRange
+		}
+
+		return json.Number(x.Add(x, y).String()), nil
+	}
+
+	x, err := a.Float64()
+	if err != nil {
+		return "", ErrNumberOutOfRange
+	}
+
+	y, err := b.Float64()
+	if err != nil {
+		return "", ErrNumberOutOfRange
+	}
+
+	sum := x + y
+	if math.IsInf(sum, 0) {
+		return "", ErrNumberOutOfRange
+	}
+
+	return json.Number(strconv.FormatFloat(sum, 'g', -1, 64)), nil
+}
+
+func isJsonInteger(number json.Number) bool {
+	return !strings.ContainsAny(number.String(), ".eE")
+}
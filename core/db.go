@@ -7,7 +7,8 @@ import (
 	"fmt"
 	"github.com/dgraph-io/badger/v4"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
+	"io"
+	"math/rand/v2"
 	"os"
 	"os/signal"
 	"strings"
@@ -17,132 +18,296 @@ import (
 
 const (
 	dbKeySeparator       = "/"
+	dbKeyEscape          = "\\"
 	dbUserPrefix         = "usr" // user:{name}
 	dbDataPrefix         = "dat"
 	dbExpiredTokenPrefix = "exp" // data:{name}:{key}
+	dbSettingsPrefix     = "set" // settings:{name}
+	dbTrashPrefix        = "trs" // trash:{name}:{key}
+	dbMetaPrefix         = "met" // meta:{name}:{key}
+	dbSystemPrefix       = "sys" // system:{key}
+	dbBlobPrefix         = "blb" // blob:{hash}
+	dbBlobRefsPrefix     = "brc" // blob-references:{hash}
+	dbInvitePrefix       = "inv" // invite:{id}
+	dbTeamPrefix         = "tms" // team:{name}
+	dbTeamDataPrefix     = "tmd" // team-data:{team}:{key}
+	dbAclPrefix          = "acl" // acl:{owner}:{key}:{grantee}
+	dbSharedPrefix       = "shr" // shared:{grantee}:{owner}:{key}
+	dbLabelPrefix        = "lbl" // label:{name}:{label}:{value}:{key}
+	dbIndexPrefix        = "idx" // index:{name}:{field}:{value}:{key}
+	dbConfirmationPrefix = "cnf" // confirmation:{token}
+	dbSchemaVersionKey   = "schema"
+	dbKeyCountKey        = "keys"
+	dbIndexesKey         = "indexes"
 )
 
 var (
 	ErrUserAlreadyExists = errors.New("a user with this name already exists")
 	ErrUserNotFound      = errors.New("user not found")
+	ErrTooManyUsers      = errors.New("maximum amount of users reached")
+	ErrTooManyKeys       = errors.New("maximum amount of keys reached")
+	ErrGeneratedKey      = errors.New("generated key doesn't match the key pattern")
+	ErrDataNotFound      = errors.New("key not found")
 )
 
+// ReservedKeys are the fixed segments of routes below /data, keys with these names couldn't be read via /data/:key.
+var ReservedKeys = []string{"count", "exists", "increment-batch", "keys", "poll", "query", "stats", "trash", "validate-key"}
+
 // User represents a user in the system
 // @Description User with credentials
 type User struct {
 	Name     string `json:"name" validate:"required,gte=3,lte=32" example:"admin"`
 	Admin    bool   `json:"admin" example:"true"`
 	Password string `json:"password" validate:"required,gte=8,lte=64" example:"password123"`
+
+	// Maintained by genesis itself and ignored when creating users, see DisableInactiveUsers
+	Disabled bool `json:"disabled,omitempty" swaggerignore:"true"`
+	// Hashes of previous passwords, newest first, see GENESIS_PASSWORD_HISTORY
+	PasswordHistory []string   `json:"passwordHistory,omitempty" swaggerignore:"true"`
+	CreatedAt       *time.Time `json:"createdAt,omitempty" swaggerignore:"true"`
+	LastLoginAt     *time.Time `json:"lastLoginAt,omitempty" swaggerignore:"true"`
+	EnabledAt       *time.Time `json:"enabledAt,omitempty" swaggerignore:"true"`
 }
 
 // PartialUser represents partial user data for updates
-// @Description Partial user data (both fields optional)
+// @Description Partial user data (all fields optional)
 type PartialUser struct {
 	Admin    *bool   `json:"admin,omitempty" example:"false"`
 	Password *string `json:"password,omitempty" validate:"omitempty,gte=8,lte=64" example:"newPassword123"`
+	Disabled *bool   `json:"disabled,omitempty" example:"false"`
 }
 
 // PublicUser represents user information without sensitive data
 // @Description User information returned to clients (no password)
 type PublicUser struct {
-	Name  string `json:"name" example:"admin"`
-	Admin bool   `json:"admin" example:"true"`
+	Name     string `json:"name" example:"admin"`
+	Admin    bool   `json:"admin" example:"true"`
+	Disabled bool   `json:"disabled,omitempty" example:"false"`
 }
 
-var database *badger.DB
+func (app *App) CreateUser(user User) error {
+	txn := app.db.NewTransaction(true)
+	defer txn.Discard()
 
-func CreateUser(user User) error {
-	txn := database.NewTransaction(true)
-	key := buildUserKey(user.Name)
+	if err := app.createUserTxn(txn, user, app.countUsers(txn)); err != nil {
+		return err
+	} else if err := txn.Commit(); err != nil {
+		return fmt.Errorf("failed to commit data: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUsers creates all users within a single transaction, if one of them fails none is created and its index returned.
+func (app *App) CreateUsers(users []User) (int, error) {
+	txn := app.db.NewTransaction(true)
 	defer txn.Discard()
 
-	if existingUser, err := GetUser(user.Name); existingUser != nil {
+	// Existing users are only counted once, the ones created within the transaction are added to them
+	count := app.countUsers(txn)
+	for index, user := range users {
+		if err := app.createUserTxn(txn, user, count); err != nil {
+			return index, err
+		}
+
+		count++
+	}
+
+	if err := txn.Commit(); err != nil {
+		return -1, fmt.Errorf("failed to commit data: %w", err)
+	}
+
+	return -1, nil
+}
+
+// CreateEachUser creates users within a single transaction like CreateUsers, but users which are reserved, already
+// exist or exceed the maximum amount of users are skipped and their error is returned at their index. Any other error
+// aborts the transaction, in which case none is created.
+func (app *App) CreateEachUser(users []User) ([]error, error) {
+	var results []error
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		results = make([]error, len(users))
+		count := app.countUsers(txn)
+
+		for index, user := range users {
+			switch err := app.createUserTxn(txn, user, count); {
+			case errors.Is(err, ErrUsernameReserved), errors.Is(err, ErrUserAlreadyExists), errors.Is(err, ErrTooManyUsers):
+				results[index] = err
+			case err != nil:
+				return err
+			default:
+				count++
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// createUserTxn creates user within txn, count is the amount of users visible to it, see countUsers.
+// Nothing is written if user can't be created because of its name or the maximum amount of users.
+func (app *App) createUserTxn(txn *badger.Txn, user User, count int64) error {
+	user.Name = app.NormalizeUsername(user.Name)
+	key := buildUserKey(user.Name)
+
+	if app.IsUsernameReserved(user.Name) {
+		return ErrUsernameReserved
+	} else if _, err := txn.Get(key); err == nil {
 		return ErrUserAlreadyExists
-	} else if err != nil {
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
 		return fmt.Errorf("failed to check if user already exists")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if app.Config.AppMaxUsers > 0 && count >= app.Config.AppMaxUsers {
+		return ErrTooManyUsers
+	}
+
+	now := app.Now().UTC()
+	hash, err := app.hashPassword(user.Password)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	} else if data, err := json.Marshal(User{
-		Name:     user.Name,
-		Admin:    user.Admin,
-		Password: string(hash),
+		Name:      user.Name,
+		Admin:     user.Admin,
+		Password:  hash,
+		CreatedAt: &now,
 	}); err != nil {
 		return fmt.Errorf("failed to create user data: %w", err)
 	} else if err := txn.Set(key, data); err != nil {
 		return fmt.Errorf("failed to store user: %w", err)
-	} else if err := txn.Commit(); err != nil {
-		return fmt.Errorf("failed to commit data: %w", err)
+	} else if err := app.seedUserTxn(txn, user.Name); err != nil {
+		return fmt.Errorf("failed to seed user data: %w", err)
 	}
 
 	return nil
 }
 
-func UpdateUser(name string, user PartialUser) error {
-	txn := database.NewTransaction(true)
-	key := buildUserKey(name)
-	defer txn.Discard()
+// countUsers counts all users visible to txn, including the ones created within it. They're only needed to enforce
+// GENESIS_MAX_USERS, so without a limit they aren't counted at all.
+func (app *App) countUsers(txn *badger.Txn) int64 {
+	if app.Config.AppMaxUsers <= 0 {
+		return 0
+	}
 
-	existingUser, err := GetUser(name)
-	if err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return ErrUserNotFound
-		}
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	prefix := buildUserKey("")
+	count := int64(0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		count++
+	}
 
+	return count
+}
+
+func (app *App) UpdateUser(name string, user PartialUser) error {
+	name = app.NormalizeUsername(name)
+	txn := app.db.NewTransaction(true)
+	defer txn.Discard()
+
+	if existingUser, err := getUserTxn(txn, name); err != nil {
 		return fmt.Errorf("failed to check if user exists")
+	} else if existingUser == nil {
+		return ErrUserNotFound
+	} else if err := app.updateUserTxn(txn, existingUser, user); err != nil {
+		return err
+	} else if err := txn.Commit(); err != nil {
+		return fmt.Errorf("failed to commit data: %w", err)
 	}
 
-	if user.Password == nil {
-		user.Password = &existingUser.Password
-	} else {
-		if hash, err := hashPassword(*user.Password); err != nil {
+	return nil
+}
+
+// updateUserTxn stores user with the fields set in update applied, the password is hashed first.
+// Fails with ErrPasswordReused if the new password is one of the ones remembered, see checkPasswordHistory.
+func (app *App) updateUserTxn(txn *badger.Txn, user *User, update PartialUser) error {
+	updated := *user
+
+	if update.Password != nil {
+		if err := app.checkPasswordHistory(user, *update.Password); err != nil {
+			return err
+		} else if hash, err := app.hashPassword(*update.Password); err != nil {
 			return fmt.Errorf("failed to hash password: %w", err)
 		} else {
-			user.Password = &hash
+			updated.Password = hash
+			updated.PasswordHistory = app.passwordHistoryAfterChange(user)
 		}
 	}
 
-	if user.Admin == nil {
-		user.Admin = &existingUser.Admin
+	if update.Admin != nil {
+		updated.Admin = *update.Admin
 	}
 
-	if data, err := json.Marshal(User{
-		Name:     name,
-		Admin:    *user.Admin,
-		Password: *user.Password,
-	}); err != nil {
-		return fmt.Errorf("failed to create user data: %w", err)
-	} else if err := txn.Set(key, data); err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
-	} else if err := txn.Commit(); err != nil {
-		return fmt.Errorf("failed to commit data: %w", err)
+	// Re-enabled users get a fresh period of inactivity before being disabled again
+	if update.Disabled != nil && *update.Disabled != user.Disabled {
+		if updated.Disabled = *update.Disabled; !updated.Disabled {
+			now := app.Now().UTC()
+			updated.EnabledAt = &now
+		}
 	}
 
-	return nil
+	return setUserTxn(txn, &updated)
 }
 
-func AuthenticateUser(name string, password string) (*User, error) {
-	user, err := GetUser(name)
+func (app *App) AuthenticateUser(name string, password string) (*User, error) {
+	name = app.NormalizeUsername(name)
+	user, err := app.GetUser(name)
 
 	if err != nil {
 		return nil, err
 	} else if user == nil {
+		// Compare against a dummy hash to take as long as for existing users, which prevents enumerating users by timing
+		_, _, _ = app.verifyPassword(app.dummyPasswordHash(), password)
 		return nil, nil
-	} else if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+	}
+
+	valid, outdated, err := app.verifyPassword(user.Password, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify password: %w", err)
+	} else if !valid {
 		return nil, errors.New("invalid password")
+	} else if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	if !app.Config.ReadOnly {
+		if err := app.recordLogin(name); err != nil {
+			app.Logger.Warn("failed to record login", zap.String("user", name), zap.Error(err))
+		}
+	}
+
+	if outdated && !app.Config.ReadOnly {
+		// Transparently upgrade the hash to the configured algorithm, the user is authenticated either way
+		if err := app.rehashPassword(name, user.Password, password); err != nil {
+			app.Logger.Warn("failed to rehash password", zap.String("user", name), zap.Error(err))
+		}
 	}
 
 	return user, nil
 }
 
-func GetUser(name string) (*User, error) {
-	txn := database.NewTransaction(false)
-	key := buildUserKey(name)
+func (app *App) GetUser(name string) (*User, error) {
+	txn := app.db.NewTransaction(false)
 	defer txn.Discard()
 
-	data, err := txn.Get(key)
+	return getUserTxn(txn, app.NormalizeUsername(name))
+}
+
+// getUserTxn returns the user named name as visible to txn, or nil if there is none.
+func getUserTxn(txn *badger.Txn, name string) (*User, error) {
+	data, err := txn.Get(buildUserKey(name))
 	if err != nil {
 		if errors.Is(err, badger.ErrKeyNotFound) {
 			return nil, nil
@@ -157,8 +322,8 @@ func GetUser(name string) (*User, error) {
 	})
 }
 
-func GetUsers(skip string) ([]*PublicUser, error) {
-	txn := database.NewTransaction(true)
+func (app *App) GetUsers(skip string) ([]*PublicUser, error) {
+	txn := app.db.NewTransaction(true)
 	defer txn.Discard()
 
 	it := txn.NewIterator(badger.DefaultIteratorOptions)
@@ -191,8 +356,8 @@ func GetUsers(skip string) ([]*PublicUser, error) {
 	return users, nil
 }
 
-func GetAllUsers() ([]*PublicUser, error) {
-	txn := database.NewTransaction(true)
+func (app *App) GetAllUsers() ([]*PublicUser, error) {
+	txn := app.db.NewTransaction(true)
 	defer txn.Discard()
 
 	it := txn.NewIterator(badger.DefaultIteratorOptions)
@@ -219,121 +384,271 @@ func GetAllUsers() ([]*PublicUser, error) {
 	return users, nil
 }
 
-func DeleteUser(name string) error {
-	txn := database.NewTransaction(true)
-	defer txn.Discard()
+// CountAdmins returns the number of users with admin rights which aren't disabled.
+func (app *App) CountAdmins() (int, error) {
+	users, err := app.GetAllUsers()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, user := range users {
+		if user.Admin && !user.Disabled {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// DeleteUser removes a user along with everything stored for it. Deleting data adjusts the global amount of keys, so
+// it's retried like other writes if it conflicts with a concurrent one.
+func (app *App) DeleteUser(name string) error {
+	name = app.NormalizeUsername(name)
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		return app.deleteUserTxn(txn, name)
+	})
+}
 
+func (app *App) deleteUserTxn(txn *badger.Txn, name string) error {
 	it := txn.NewIterator(badger.DefaultIteratorOptions)
 
-	// Remove data
-	prefix := buildUserDataKey(name, "")
-	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-		if err := txn.Delete(it.Item().Key()); err != nil {
-			it.Close()
-			return err
+	// Remove data, trashed data and metadata
+	for _, prefix := range [][]byte{dataKey(name, ""), buildTrashKey(name, ""), buildMetaKey(name, ""), buildLabelPrefix(name, ""), buildIndexPrefix(name, "")} {
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if err := app.deleteValueTxn(txn, it.Item().KeyCopy(nil)); err != nil {
+				it.Close()
+				return err
+			}
 		}
 	}
 
 	it.Close()
 
-	// Remove user
-	if err := txn.Delete(buildUserKey(name)); err != nil {
+	// Remove memberships
+	if err := removeFromTeamsTxn(txn, name); err != nil {
 		return err
 	}
 
-	return txn.Commit()
-}
-
-func SetDataForUser(name string, key string, data []byte) error {
-	txn := database.NewTransaction(true)
-	defer txn.Discard()
+	// Remove keys shared by or with the user
+	if err := deleteSharesTxn(txn, name); err != nil {
+		return err
+	}
 
-	if err := txn.Set(buildUserDataKey(name, key), data); err != nil {
+	// Remove settings
+	if err := txn.Delete(buildSettingsKey(name)); err != nil {
 		return err
-	} else {
-		return txn.Commit()
 	}
+
+	// Remove user
+	return txn.Delete(buildUserKey(name))
 }
 
-func DeleteDataFromUser(name string, key string) error {
-	txn := database.NewTransaction(true)
-	defer txn.Discard()
+func (app *App) SetDataForUser(name string, key string, data []byte) error {
+	defer app.lockData(name, key)()
 
-	if err := txn.Delete(buildUserDataKey(name, key)); err != nil {
-		return err
-	} else {
-		return txn.Commit()
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if err := app.setValueTxn(txn, dataKey(name, key), data); err != nil {
+			return err
+		} else if err := app.indexDataTxn(txn, name, key, data); err != nil {
+			return err
+		}
+
+		return app.markUpdatedTxn(txn, name, key)
+	})
+}
+
+// CreateDataWithGeneratedKey stores data under a new, unique key of name and returns the key, which is a ULID so keys
+// sort by the time they've been created at. Fails with ErrTooManyKeys if name has already reached the maximum amount of keys.
+func (app *App) CreateDataWithGeneratedKey(name string, data []byte) (string, error) {
+	var key string
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		if int64(len(collectKeysTxn(txn, dataKey(name, "")))) >= app.Config.AppKeysPerUser {
+			return ErrTooManyKeys
+		}
+
+		for {
+			key = newULID()
+
+			if !app.Config.AppKeyPattern.MatchString(key) || (app.Config.AppKeyMaxLength > 0 && int64(len(key)) > app.Config.AppKeyMaxLength) {
+				return ErrGeneratedKey
+			} else if _, err := txn.Get(dataKey(name, key)); errors.Is(err, badger.ErrKeyNotFound) {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if err := app.setValueTxn(txn, dataKey(name, key), data); err != nil {
+			return err
+		} else if err := app.indexDataTxn(txn, name, key, data); err != nil {
+			return err
+		}
+
+		return app.markUpdatedTxn(txn, name, key)
+	})
+
+	if err != nil {
+		return "", err
 	}
+
+	return key, nil
 }
 
-func GetDataFromUser(name string, key string) ([]byte, error) {
-	txn := database.NewTransaction(false)
+// UpdateDataForUser replaces the value of key with the result of fn, which receives the current value or nil if there is none.
+// Updates of the same key are serialized, so read-modify-write operations such as merging don't lose concurrent updates.
+// If fn fails nothing is stored and its error returned.
+func (app *App) UpdateDataForUser(name string, key string, fn func(current []byte) ([]byte, error)) error {
+	defer app.lockData(name, key)()
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		var current []byte
+
+		item, err := txn.Get(dataKey(name, key))
+		if err == nil {
+			if current, err = readValue(txn, item); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		if updated, err := fn(current); err != nil {
+			return err
+		} else if err := app.setValueTxn(txn, dataKey(name, key), updated); err != nil {
+			return err
+		} else if err := app.indexDataTxn(txn, name, key, updated); err != nil {
+			return err
+		}
+
+		return app.markUpdatedTxn(txn, name, key)
+	})
+}
+
+func (app *App) DeleteDataFromUser(name string, key string) error {
+	return app.DeleteDataFromUserIfMatch(name, key, "")
+}
+
+// DeleteDataFromUserIfMatch deletes key only if its current value matches etag, see matchETagTxn.
+// The check and deletion happen within the same transaction.
+func (app *App) DeleteDataFromUserIfMatch(name string, key string, etag string) error {
+	defer app.lockData(name, key)()
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if err := matchETagTxn(txn, dataKey(name, key), etag); err != nil {
+			return err
+		} else if err := app.deleteValueTxn(txn, dataKey(name, key)); err != nil {
+			return err
+		}
+
+		return deleteMetaTxn(txn, name, key)
+	})
+}
+
+func (app *App) GetDataFromUser(name string, key string) ([]byte, error) {
+	txn := app.db.NewTransaction(false)
 	defer txn.Discard()
 
-	item, err := txn.Get(buildUserDataKey(name, key))
+	item, err := txn.Get(dataKey(name, key))
 	if err != nil {
 		return nil, err
 	}
 
-	var data []byte
-	return data, item.Value(func(v []byte) error {
-		*&data = v
-		return nil
-	})
+	// Tracking reads costs an additional write for every read
+	if app.Config.TrackLastAccess && !app.Config.ReadOnly {
+		if err := app.TouchData(name, key); err != nil {
+			app.Logger.Error("failed to track last access", zap.String("user", name), zap.Error(err))
+		}
+	}
+
+	return readValue(txn, item)
 }
 
-func GetAllDataFromUser(name string) ([]byte, error) {
-	txn := database.NewTransaction(false)
+func (app *App) GetAllDataFromUser(name string) ([]byte, error) {
+	txn := app.db.NewTransaction(false)
 	defer txn.Discard()
 
 	it := txn.NewIterator(badger.DefaultIteratorOptions)
 	defer it.Close()
 
-	prefix := buildUserDataKey(name, "")
+	prefix := dataKey(name, "")
 	data := make([]string, 0)
 
 	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 		item := it.Item()
 		key := item.Key()
 
-		err := item.Value(func(v []byte) error {
-			if rawKey, err := json.Marshal(string(key[len(prefix):])); err != nil {
-				return err
-			} else {
-				data = append(data, string(rawKey)+":"+string(v))
-			}
-
-			return nil
-		})
-
-		if err != nil {
+		if v, err := readValue(txn, item); err != nil {
 			break
+		} else if rawKey, err := json.Marshal(string(key[len(prefix):])); err != nil {
+			break
+		} else {
+			data = append(data, string(rawKey)+":"+string(v))
 		}
 	}
 
 	return []byte("{" + strings.Join(data, ",") + "}"), nil
 }
 
-func GetDataCountForUser(name, includedKey string) int64 {
-	txn := database.NewTransaction(false)
+// StreamDataFromUser writes all keys of a user as newline delimited JSON to w, one {"key":...,"value":...} object per line.
+// Entries are written while iterating, so the data is never buffered as a whole.
+func (app *App) StreamDataFromUser(name string, w io.Writer) error {
+	txn := app.db.NewTransaction(false)
 	defer txn.Discard()
 
 	it := txn.NewIterator(badger.DefaultIteratorOptions)
 	defer it.Close()
 
-	prefix := buildUserDataKey(name, "")
-	hadIncludedKey := false
-	count := int64(0)
+	prefix := dataKey(name, "")
 
 	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-		if !hadIncludedKey {
-			key := string(it.Item().Key())
-			hadIncludedKey = key == string(buildUserDataKey(name, includedKey))
+		item := it.Item()
+
+		if v, err := readValue(txn, item); err != nil {
+			return err
+		} else if rawKey, err := json.Marshal(string(item.Key()[len(prefix):])); err != nil {
+			return err
+		} else if _, err := fmt.Fprintf(w, "{\"key\":%s,\"value\":%s}\n", rawKey, v); err != nil {
+			return err
 		}
+	}
 
-		count++
+	return nil
+}
+
+// CountDataForUser counts the keys of a user starting with prefix.
+func (app *App) CountDataForUser(name, prefix string) int64 {
+	count, _ := app.countDataForUser(name, prefix, "")
+	return count
+}
+
+// DataExistsForUser reports which of keys are stored for a user, using a single transaction and a key-only iterator
+// so no value is read.
+func (app *App) DataExistsForUser(name string, keys []string) map[string]bool {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	exists := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		fullKey := dataKey(name, key)
+		it.Seek(fullKey)
+		exists[key] = it.Valid() && bytes.Equal(it.Item().Key(), fullKey)
 	}
 
+	return exists
+}
+
+// GetDataCountForUser returns the amount of keys of a user as if includedKey were stored as well.
+func (app *App) GetDataCountForUser(name, includedKey string) int64 {
+	count, hadIncludedKey := app.countDataForUser(name, "", includedKey)
+
 	if !hadIncludedKey {
 		count++
 	}
@@ -341,14 +656,46 @@ func GetDataCountForUser(name, includedKey string) int64 {
 	return count
 }
 
-func StoreInvalidatedToken(jti string, expiration time.Duration) error {
-	return database.Update(func(txn *badger.Txn) error {
+func (app *App) countDataForUser(name, prefix, includedKey string) (int64, bool) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	fullPrefix := dataKey(name, prefix)
+	fullIncludedKey := string(dataKey(name, includedKey))
+	hadIncludedKey := false
+	count := int64(0)
+
+	for it.Seek(fullPrefix); it.ValidForPrefix(fullPrefix); it.Next() {
+		if !hadIncludedKey {
+			hadIncludedKey = string(it.Item().Key()) == fullIncludedKey
+		}
+
+		count++
+	}
+
+	return count, hadIncludedKey
+}
+
+// StoreInvalidatedToken blacklists the token with the given id for the remaining lifetime of it.
+// Tokens which already expired are useless anyway and therefore not stored.
+func (app *App) StoreInvalidatedToken(jti string, expiration time.Duration) error {
+	if expiration <= 0 {
+		return nil
+	}
+
+	return app.db.Update(func(txn *badger.Txn) error {
 		return txn.SetEntry(badger.NewEntry(buildExpiredKey(jti), []byte{}).WithTTL(expiration))
 	})
 }
 
-func IsTokenBlacklisted(jti string) (bool, error) {
-	txn := database.NewTransaction(false)
+func (app *App) IsTokenBlacklisted(jti string) (bool, error) {
+	txn := app.db.NewTransaction(false)
 	defer txn.Discard()
 
 	item, err := txn.Get(buildExpiredKey(jti))
@@ -360,32 +707,32 @@ func IsTokenBlacklisted(jti string) (bool, error) {
 	}
 }
 
-func ResetDatabase() {
-	if err := database.DropAll(); err != nil {
-		Logger.Fatal("failed to drop database", zap.Error(err))
+func (app *App) ResetDatabase() {
+	if err := app.db.DropAll(); err != nil {
+		app.Logger.Fatal("failed to drop database", zap.Error(err))
 	}
 
-	InitializeUsers()
+	app.InitializeUsers()
 }
 
-func InitializeUsers() {
-	for _, user := range Config.AppUsersToCreate {
-		if existingUser, err := GetUser(user.Name); err != nil {
-			Logger.Error("failed to check for user", zap.Error(err))
+func (app *App) InitializeUsers() {
+	for _, user := range app.Config.AppUsersToCreate {
+		if existingUser, err := app.GetUser(user.Name); err != nil {
+			app.Logger.Error("failed to check for user", zap.Error(err))
 		} else if existingUser != nil {
 			continue
 		}
 
-		if err := CreateUser(user); err != nil {
-			Logger.Error("failed to create user", zap.Error(err))
+		if err := app.CreateUser(user); err != nil {
+			app.Logger.Error("failed to create user", zap.Error(err))
 		} else {
-			Logger.Info("created new user", zap.String("name", user.Name), zap.Bool("admin", user.Admin))
+			app.Logger.Info("created new user", zap.String("name", user.Name), zap.Bool("admin", user.Admin))
 		}
 	}
 }
 
-func printDebugInformation() {
-	txn := database.NewTransaction(false)
+func (app *App) printDebugInformation() {
+	txn := app.db.NewTransaction(false)
 	defer txn.Discard()
 
 	it := txn.NewIterator(badger.DefaultIteratorOptions)
@@ -395,41 +742,206 @@ func printDebugInformation() {
 	results[dbUserPrefix] = 0
 	results[dbDataPrefix] = 0
 	results[dbExpiredTokenPrefix] = 0
+	results[dbSettingsPrefix] = 0
+	results[dbTrashPrefix] = 0
+	results[dbMetaPrefix] = 0
+	results[dbBlobPrefix] = 0
+	results[dbTeamPrefix] = 0
+	results[dbTeamDataPrefix] = 0
+	results[dbAclPrefix] = 0
 
 	for it.Rewind(); it.Valid(); it.Next() {
 		key := strings.Split(string(it.Item().Key()), dbKeySeparator)
 		results[key[0]]++
 	}
 
-	Logger.Debug("users", zap.Int("count", results[dbUserPrefix]))
-	Logger.Debug("datasets", zap.Int("count", results[dbDataPrefix]))
-	Logger.Debug("expired keys", zap.Int("count", results[dbExpiredTokenPrefix]))
+	app.Logger.Debug("users", zap.Int("count", results[dbUserPrefix]))
+	app.Logger.Debug("datasets", zap.Int("count", results[dbDataPrefix]))
+	app.Logger.Debug("expired keys", zap.Int("count", results[dbExpiredTokenPrefix]))
+	app.Logger.Debug("settings", zap.Int("count", results[dbSettingsPrefix]))
+	app.Logger.Debug("trashed datasets", zap.Int("count", results[dbTrashPrefix]))
+	app.Logger.Debug("metadata", zap.Int("count", results[dbMetaPrefix]))
+	app.Logger.Debug("blobs", zap.Int("count", results[dbBlobPrefix]))
+	app.Logger.Debug("teams", zap.Int("count", results[dbTeamPrefix]))
+	app.Logger.Debug("team datasets", zap.Int("count", results[dbTeamDataPrefix]))
+	app.Logger.Debug("shared keys", zap.Int("count", results[dbAclPrefix]))
 }
 
 func buildExpiredKey(key string) []byte {
 	return []byte(dbExpiredTokenPrefix + dbKeySeparator + key)
 }
 
+func buildTrashKey(name, key string) []byte {
+	return []byte(dbTrashPrefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator + key)
+}
+
+func buildBlobKey(hash string) []byte {
+	return []byte(dbBlobPrefix + dbKeySeparator + hash)
+}
+
+func buildBlobRefsKey(hash string) []byte {
+	return []byte(dbBlobRefsPrefix + dbKeySeparator + hash)
+}
+
+func buildInviteKey(id string) []byte {
+	return []byte(dbInvitePrefix + dbKeySeparator + id)
+}
+
+func buildConfirmationKey(token string) []byte {
+	return []byte(dbConfirmationPrefix + dbKeySeparator + token)
+}
+
+func buildTeamKey(name string) []byte {
+	return []byte(dbTeamPrefix + dbKeySeparator + name)
+}
+
+func buildTeamDataKey(team, key string) []byte {
+	return []byte(dbTeamDataPrefix + dbKeySeparator + escapeKeySegment(team) + dbKeySeparator + key)
+}
+
+// buildAclKey escapes the key as well, as it's followed by the grantee.
+func buildAclKey(owner, key, grantee string) []byte {
+	return []byte(dbAclPrefix + dbKeySeparator + escapeKeySegment(owner) + dbKeySeparator + escapeKeySegment(key) + dbKeySeparator + escapeKeySegment(grantee))
+}
+
+func buildAclPrefix(owner string) []byte {
+	return []byte(dbAclPrefix + dbKeySeparator + escapeKeySegment(owner) + dbKeySeparator)
+}
+
+func buildSharedKey(grantee, owner, key string) []byte {
+	return []byte(dbSharedPrefix + dbKeySeparator + escapeKeySegment(grantee) + dbKeySeparator + escapeKeySegment(owner) + dbKeySeparator + key)
+}
+
+func buildSharedPrefix(grantee string) []byte {
+	return []byte(dbSharedPrefix + dbKeySeparator + escapeKeySegment(grantee) + dbKeySeparator)
+}
+
+func buildSystemKey(key string) []byte {
+	return []byte(dbSystemPrefix + dbKeySeparator + key)
+}
+
+func buildMetaKey(name, key string) []byte {
+	return []byte(dbMetaPrefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator + key)
+}
+
+func buildLabelKey(name, label, value, key string) []byte {
+	return append(buildLabelPrefix(name, label), []byte(escapeKeySegment(value)+dbKeySeparator+key)...)
+}
+
+// buildLabelPrefix returns the prefix of the index entries of label, or of all labels of name if label is empty.
+func buildLabelPrefix(name, label string) []byte {
+	if len(label) == 0 {
+		return []byte(dbLabelPrefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator)
+	}
+
+	return []byte(dbLabelPrefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator + escapeKeySegment(label) + dbKeySeparator)
+}
+
+func buildIndexKey(name, field, value, key string) []byte {
+	return append(buildIndexPrefix(name, field), []byte(escapeKeySegment(value)+dbKeySeparator+key)...)
+}
+
+// buildIndexPrefix returns the prefix of the index entries of field, or of all indexed fields of name if field is empty.
+func buildIndexPrefix(name, field string) []byte {
+	if len(field) == 0 {
+		return []byte(dbIndexPrefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator)
+	}
+
+	return []byte(dbIndexPrefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator + escapeKeySegment(field) + dbKeySeparator)
+}
+
+func buildSettingsKey(name string) []byte {
+	return []byte(dbSettingsPrefix + dbKeySeparator + escapeKeySegment(name))
+}
+
 func buildUserKey(name string) []byte {
 	return []byte(dbUserPrefix + dbKeySeparator + name)
 }
 
-func buildUserDataKey(name, key string) []byte {
-	return []byte(dbDataPrefix + dbKeySeparator + name + dbKeySeparator + key)
+// dataKey combines the name of a user and one of their keys, the name is escaped so no user's keyspace can reach into
+// another one, e.g. data of user "a/b" is never listed as key "b/..." of user "a". Keys are left as they are since
+// they always come last.
+func dataKey(name, key string) []byte {
+	return []byte(dbDataPrefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator + key)
 }
 
-func hashPassword(pwd string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+// escapeKeySegment escapes the separator and the escape character itself within segment.
+func escapeKeySegment(segment string) string {
+	return keySegmentEscaper.Replace(segment)
+}
 
-	if err != nil {
-		return "", err
-	} else {
-		return string(hashed), err
+var keySegmentEscaper = strings.NewReplacer(dbKeyEscape, dbKeyEscape+dbKeyEscape, dbKeySeparator, dbKeyEscape+dbKeySeparator)
+
+var keySegmentUnescaper = strings.NewReplacer(dbKeyEscape+dbKeyEscape, dbKeyEscape, dbKeyEscape+dbKeySeparator, dbKeySeparator)
+
+// unescapeKeySegment reverts escapeKeySegment.
+func unescapeKeySegment(segment string) string {
+	return keySegmentUnescaper.Replace(segment)
+}
+
+// splitKeySegment splits rest at the first separator which isn't escaped, returning the unescaped segment before it
+// and everything after it. Fails if there is no such separator.
+func splitKeySegment(rest []byte) (string, []byte, bool) {
+	for index := 0; index < len(rest); index++ {
+		switch string(rest[index]) {
+		case dbKeyEscape:
+			index++
+		case dbKeySeparator:
+			return unescapeKeySegment(string(rest[:index])), rest[index+1:], true
+		}
+	}
+
+	return "", nil, false
+}
+
+const (
+	updateAttempts   = 10
+	updateRetryDelay = time.Millisecond
+)
+
+// updateWithRetry runs fn in a read-write transaction, retrying it if it conflicts with a concurrent one.
+// Shared blobs and the global amount of keys make conflicts between transactions of different users likely, so retries
+// are delayed increasingly, with jitter so conflicting transactions don't retry in lockstep.
+func (app *App) updateWithRetry(fn func(txn *badger.Txn) error) error {
+	var err error
+
+	for attempt := 0; attempt < updateAttempts; attempt++ {
+		if err = app.db.Update(fn); !errors.Is(err, badger.ErrConflict) {
+			return err
+		} else if attempt < updateAttempts-1 {
+			delay := updateRetryDelay << attempt
+			time.Sleep(delay/2 + rand.N(delay))
+		}
+	}
+
+	return err
+}
+
+// OpenInMemoryDatabase opens an empty database which only lives in memory, to be used via UseDatabase.
+func OpenInMemoryDatabase() (*badger.DB, error) {
+	options := badger.DefaultOptions("").WithInMemory(true)
+	options.Logger = nil
+
+	return badger.Open(options)
+}
+
+// UseDatabase replaces the database of the app and returns the previous one, which is left open.
+func (app *App) UseDatabase(db *badger.DB) *badger.DB {
+	previous := app.db
+	app.db = db
+	return previous
+}
+
+// CloseDatabase flushes and closes the database, releasing the lock on it.
+func (app *App) CloseDatabase() {
+	if err := app.db.Close(); err != nil {
+		app.Logger.Error("failed to close database", zap.Error(err))
 	}
 }
 
-func init() {
-	options := badger.DefaultOptions(Config.DbPath)
+// OpenDatabase opens the database at config.DbPath using options suited for small databases.
+func OpenDatabase(config *AppConfig) (*badger.DB, error) {
+	options := badger.DefaultOptions(config.DbPath)
 	options.Logger = nil
 
 	// Adjust options for a smaller database
@@ -437,11 +949,52 @@ func init() {
 	options.ValueLogFileSize = 64 << 20 // 64MB
 	options.NumLevelZeroTables = 1
 	options.NumLevelZeroTablesStall = 2
+	options.ReadOnly = config.ReadOnly
 
-	if db, err := badger.Open(options); err != nil {
+	return badger.Open(options)
+}
+
+// collectGarbage removes unreferenced blobs and runs the value log GC once an hour, it never returns.
+// Invalidated tokens are swept on start as well.
+func (app *App) collectGarbage() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if swept, err := app.SweepInvalidatedTokens(); err != nil {
+			app.Logger.Error("failed to sweep invalidated tokens", zap.Error(err))
+		} else if swept > 0 {
+			app.Logger.Info("swept invalidated tokens", zap.Int("count", swept))
+		}
+
+		<-ticker.C
+
+		if deleted, err := app.CollectBlobs(); err != nil {
+			app.Logger.Error("failed to collect unreferenced blobs", zap.Error(err))
+		} else if deleted > 0 {
+			app.Logger.Info("collected unreferenced blobs", zap.Int("count", deleted))
+		}
+
+		err := app.db.RunValueLogGC(0.5)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			continue
+		} else if err != nil {
+			app.Logger.Error("failed to run value log GC", zap.Error(err))
+		}
+	}
+}
+
+// OpenDefaultDatabase opens the database of the Default app, closes it on SIGINT and SIGTERM and starts the background
+// jobs enabled in Config. LoadConfig must have been called before.
+func OpenDefaultDatabase() {
+
+	// Badger doesn't expose a typed error for a held directory lock, so it's checked separately
+	if db, err := OpenDatabase(&Config); err != nil && isDatabaseLocked(Config.DbPath) {
+		Logger.Fatal("database is locked by another process, stop the running server before using the cli", zap.String("path", Config.DbPath), zap.Error(err))
+	} else if err != nil {
 		Logger.Fatal("failed to open database", zap.Error(err))
 	} else {
-		database = db
+		Default.db = db
 	}
 
 	// Shutdown database gracefully
@@ -452,28 +1005,26 @@ func init() {
 		sig := <-sigs
 		Logger.Info("received signal, closing database", zap.String("signal", sig.String()))
 
-		if err := database.Close(); err != nil {
+		if err := Default.db.Close(); err != nil {
 			Logger.Error("failed to close database", zap.Error(err))
 		}
 
 		os.Exit(0)
 	}()
 
-	// Run garbage collector once an hour
-	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
+	// A read-only database can't be modified
+	if !Config.ReadOnly {
+		go Default.collectGarbage()
 
-		for {
-			<-ticker.C
-			err := database.RunValueLogGC(0.5)
-			if errors.Is(err, badger.ErrNoRewrite) {
-				continue
-			} else if err != nil {
-				Logger.Error("failed to run value log GC", zap.Error(err))
-			}
+		if Config.InactivityDisableAfter > 0 {
+			go Default.disableInactiveUsersPeriodically()
 		}
-	}()
+	}
+
+	// Backups only read the database, which is why they run in read-only mode as well
+	if Config.BackupInterval > 0 {
+		go Default.uploadBackupsPeriodically()
+	}
 
-	printDebugInformation()
+	Default.printDebugInformation()
 }
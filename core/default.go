@@ -0,0 +1,488 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+)
+
+// Package-level functions operating on the Default app, kept for compatibility.
+
+// ShareData calls App.ShareData on the Default app.
+func ShareData(owner, key, grantee string, permission Permission) error {
+	return Default.ShareData(owner, key, grantee, permission)
+}
+
+// RevokeShare calls App.RevokeShare on the Default app.
+func RevokeShare(owner, key, grantee string) error {
+	return Default.RevokeShare(owner, key, grantee)
+}
+
+// GetGrants calls App.GetGrants on the Default app.
+func GetGrants(owner, key string) ([]Grant, error) {
+	return Default.GetGrants(owner, key)
+}
+
+// GetPermission calls App.GetPermission on the Default app.
+func GetPermission(owner, key, grantee string) (Permission, error) {
+	return Default.GetPermission(owner, key, grantee)
+}
+
+// GetSharedWithUser calls App.GetSharedWithUser on the Default app.
+func GetSharedWithUser(grantee string) ([]SharedKey, error) {
+	return Default.GetSharedWithUser(grantee)
+}
+
+// Audit calls App.Audit on the Default app.
+func Audit(action string, fields ...zap.Field) {
+	Default.Audit(action, fields...)
+}
+
+// CreateAuthToken calls App.CreateAuthToken on the Default app.
+func CreateAuthToken(user *User) (string, time.Time, error) {
+	return Default.CreateAuthToken(user)
+}
+
+// CreateImpersonationToken calls App.CreateImpersonationToken on the Default app.
+func CreateImpersonationToken(admin *User, target *User) (string, time.Time, error) {
+	return Default.CreateImpersonationToken(admin, target)
+}
+
+// ParseAuthToken calls App.ParseAuthToken on the Default app.
+func ParseAuthToken(token string) (*JWTClaim, error) {
+	return Default.ParseAuthToken(token)
+}
+
+// InvalidateToken calls App.InvalidateToken on the Default app.
+func InvalidateToken(claims *JWTClaim) error {
+	return Default.InvalidateToken(claims)
+}
+
+// CollectBlobs calls App.CollectBlobs on the Default app.
+func CollectBlobs() (int, error) {
+	return Default.CollectBlobs()
+}
+
+// UpdateUsers calls App.UpdateUsers on the Default app.
+func UpdateUsers(filter UserFilter, update PartialUser, exclude string) ([]UserUpdateResult, error) {
+	return Default.UpdateUsers(filter, update, exclude)
+}
+
+// CompactDatabase calls App.CompactDatabase on the Default app.
+func CompactDatabase(workers int) (*CompactionResult, error) {
+	return Default.CompactDatabase(workers)
+}
+
+// CreateUser calls App.CreateUser on the Default app.
+func CreateUser(user User) error {
+	return Default.CreateUser(user)
+}
+
+// CreateUsers calls App.CreateUsers on the Default app.
+func CreateUsers(users []User) (int, error) {
+	return Default.CreateUsers(users)
+}
+
+// CreateEachUser calls App.CreateEachUser on the Default app.
+func CreateEachUser(users []User) ([]error, error) {
+	return Default.CreateEachUser(users)
+}
+
+// UpdateUser calls App.UpdateUser on the Default app.
+func UpdateUser(name string, user PartialUser) error {
+	return Default.UpdateUser(name, user)
+}
+
+// AuthenticateUser calls App.AuthenticateUser on the Default app.
+func AuthenticateUser(name string, password string) (*User, error) {
+	return Default.AuthenticateUser(name, password)
+}
+
+// GetUser calls App.GetUser on the Default app.
+func GetUser(name string) (*User, error) {
+	return Default.GetUser(name)
+}
+
+// GetUsers calls App.GetUsers on the Default app.
+func GetUsers(skip string) ([]*PublicUser, error) {
+	return Default.GetUsers(skip)
+}
+
+// GetAllUsers calls App.GetAllUsers on the Default app.
+func GetAllUsers() ([]*PublicUser, error) {
+	return Default.GetAllUsers()
+}
+
+// DisableInactiveUsers calls App.DisableInactiveUsers on the Default app.
+func DisableInactiveUsers(now time.Time) ([]string, error) {
+	return Default.DisableInactiveUsers(now)
+}
+
+// CountAdmins calls App.CountAdmins on the Default app.
+func CountAdmins() (int, error) {
+	return Default.CountAdmins()
+}
+
+// DeleteUser calls App.DeleteUser on the Default app.
+func DeleteUser(name string) error {
+	return Default.DeleteUser(name)
+}
+
+// SetDataForUser calls App.SetDataForUser on the Default app.
+func SetDataForUser(name string, key string, data []byte) error {
+	return Default.SetDataForUser(name, key, data)
+}
+
+// CreateDataWithGeneratedKey calls App.CreateDataWithGeneratedKey on the Default app.
+func CreateDataWithGeneratedKey(name string, data []byte) (string, error) {
+	return Default.CreateDataWithGeneratedKey(name, data)
+}
+
+// UpdateDataForUser calls App.UpdateDataForUser on the Default app.
+func UpdateDataForUser(name string, key string, fn func(current []byte) ([]byte, error)) error {
+	return Default.UpdateDataForUser(name, key, fn)
+}
+
+// IncrementDataForUser calls App.IncrementDataForUser on the Default app.
+func IncrementDataForUser(name string, increments map[string]json.Number) (map[string]json.Number, []string, error) {
+	return Default.IncrementDataForUser(name, increments)
+}
+
+// DeleteDataFromUser calls App.DeleteDataFromUser on the Default app.
+func DeleteDataFromUser(name string, key string) error {
+	return Default.DeleteDataFromUser(name, key)
+}
+
+// DeleteDataFromUserIfMatch calls App.DeleteDataFromUserIfMatch on the Default app.
+func DeleteDataFromUserIfMatch(name string, key string, etag string) error {
+	return Default.DeleteDataFromUserIfMatch(name, key, etag)
+}
+
+// GetDataFromUser calls App.GetDataFromUser on the Default app.
+func GetDataFromUser(name string, key string) ([]byte, error) {
+	return Default.GetDataFromUser(name, key)
+}
+
+// GetAllDataFromUser calls App.GetAllDataFromUser on the Default app.
+func GetAllDataFromUser(name string) ([]byte, error) {
+	return Default.GetAllDataFromUser(name)
+}
+
+// StreamDataFromUser calls App.StreamDataFromUser on the Default app.
+func StreamDataFromUser(name string, w io.Writer) error {
+	return Default.StreamDataFromUser(name, w)
+}
+
+// CountDataForUser calls App.CountDataForUser on the Default app.
+func CountDataForUser(name, prefix string) int64 {
+	return Default.CountDataForUser(name, prefix)
+}
+
+// CountAllData calls App.CountAllData on the Default app.
+func CountAllData() (int64, error) {
+	return Default.CountAllData()
+}
+
+// QueryDataIndex calls App.QueryDataIndex on the Default app.
+func QueryDataIndex(name string, field string, value *string) ([]string, error) {
+	return Default.QueryDataIndex(name, field, value)
+}
+
+// RebuildIndexes calls App.RebuildIndexes on the Default app.
+func RebuildIndexes(force bool) (bool, error) {
+	return Default.RebuildIndexes(force)
+}
+
+// Reindex calls App.Reindex on the Default app.
+func Reindex() (*ReindexResult, error) {
+	return Default.Reindex()
+}
+
+// PollDataForUser calls App.PollDataForUser on the Default app.
+func PollDataForUser(name string, known map[string]string) (map[string][]byte, []string, error) {
+	return Default.PollDataForUser(name, known)
+}
+
+// DataExistsForUser calls App.DataExistsForUser on the Default app.
+func DataExistsForUser(name string, keys []string) map[string]bool {
+	return Default.DataExistsForUser(name, keys)
+}
+
+// GetDataCountForUser calls App.GetDataCountForUser on the Default app.
+func GetDataCountForUser(name, includedKey string) int64 {
+	return Default.GetDataCountForUser(name, includedKey)
+}
+
+// StoreInvalidatedToken calls App.StoreInvalidatedToken on the Default app.
+func StoreInvalidatedToken(jti string, expiration time.Duration) error {
+	return Default.StoreInvalidatedToken(jti, expiration)
+}
+
+// IsTokenBlacklisted calls App.IsTokenBlacklisted on the Default app.
+func IsTokenBlacklisted(jti string) (bool, error) {
+	return Default.IsTokenBlacklisted(jti)
+}
+
+// ResetDatabase calls App.ResetDatabase on the Default app.
+func ResetDatabase() {
+	Default.ResetDatabase()
+}
+
+// InitializeUsers calls App.InitializeUsers on the Default app.
+func InitializeUsers() {
+	Default.InitializeUsers()
+}
+
+// UseDatabase calls App.UseDatabase on the Default app.
+func UseDatabase(db *badger.DB) *badger.DB {
+	return Default.UseDatabase(db)
+}
+
+// CloseDatabase calls App.CloseDatabase on the Default app.
+func CloseDatabase() {
+	Default.CloseDatabase()
+}
+
+// ExportUser calls App.ExportUser on the Default app.
+func ExportUser(name string, w io.Writer) error {
+	return Default.ExportUser(name, w)
+}
+
+// ForgetUser calls App.ForgetUser on the Default app.
+func ForgetUser(name string) (*ForgetSummary, error) {
+	return Default.ForgetUser(name)
+}
+
+// CreateInvite calls App.CreateInvite on the Default app.
+func CreateInvite(createdBy string, admin bool, ttl time.Duration) (*Invite, error) {
+	return Default.CreateInvite(createdBy, admin, ttl)
+}
+
+// GetInvites calls App.GetInvites on the Default app.
+func GetInvites() ([]*Invite, error) {
+	return Default.GetInvites()
+}
+
+// DeleteInvite calls App.DeleteInvite on the Default app.
+func DeleteInvite(id string) error {
+	return Default.DeleteInvite(id)
+}
+
+// CreateUserWithInvite calls App.CreateUserWithInvite on the Default app.
+func CreateUserWithInvite(user User, id string) (*Invite, error) {
+	return Default.CreateUserWithInvite(user, id)
+}
+
+// GetDataMeta calls App.GetDataMeta on the Default app.
+func GetDataMeta(name string, key string) (*DataMeta, error) {
+	return Default.GetDataMeta(name, key)
+}
+
+// TouchData calls App.TouchData on the Default app.
+func TouchData(name string, key string) error {
+	return Default.TouchData(name, key)
+}
+
+// GetLastModified calls App.GetLastModified on the Default app.
+func GetLastModified(name string) (*time.Time, error) {
+	return Default.GetLastModified(name)
+}
+
+// GetKeysNotAccessedSince calls App.GetKeysNotAccessedSince on the Default app.
+func GetKeysNotAccessedSince(name string, since time.Time) ([]string, error) {
+	return Default.GetKeysNotAccessedSince(name, since)
+}
+
+// Migrate calls App.Migrate on the Default app.
+func Migrate(dryRun bool) error {
+	return Default.Migrate(dryRun)
+}
+
+// GetSettings calls App.GetSettings on the Default app.
+func GetSettings(name string) ([]byte, error) {
+	return Default.GetSettings(name)
+}
+
+// SetSettings calls App.SetSettings on the Default app.
+func SetSettings(name string, data []byte) error {
+	return Default.SetSettings(name, data)
+}
+
+// SetSettingsIfMatch calls App.SetSettingsIfMatch on the Default app.
+func SetSettingsIfMatch(name string, data []byte, etag string) error {
+	return Default.SetSettingsIfMatch(name, data, etag)
+}
+
+// ValidateSettings calls App.ValidateSettings on the Default app.
+func ValidateSettings(data []byte) error {
+	return Default.ValidateSettings(data)
+}
+
+// CreateTeam calls App.CreateTeam on the Default app.
+func CreateTeam(name, createdBy string) (*Team, error) {
+	return Default.CreateTeam(name, createdBy)
+}
+
+// GetTeam calls App.GetTeam on the Default app.
+func GetTeam(name string) (*Team, error) {
+	return Default.GetTeam(name)
+}
+
+// GetTeams calls App.GetTeams on the Default app.
+func GetTeams() ([]*Team, error) {
+	return Default.GetTeams()
+}
+
+// DeleteTeam calls App.DeleteTeam on the Default app.
+func DeleteTeam(name string) error {
+	return Default.DeleteTeam(name)
+}
+
+// AddTeamMember calls App.AddTeamMember on the Default app.
+func AddTeamMember(team, user string) (*Team, error) {
+	return Default.AddTeamMember(team, user)
+}
+
+// RemoveTeamMember calls App.RemoveTeamMember on the Default app.
+func RemoveTeamMember(team, user string) (*Team, error) {
+	return Default.RemoveTeamMember(team, user)
+}
+
+// IsTeamMember calls App.IsTeamMember on the Default app.
+func IsTeamMember(team, user string) (bool, error) {
+	return Default.IsTeamMember(team, user)
+}
+
+// SetDataForTeam calls App.SetDataForTeam on the Default app.
+func SetDataForTeam(team, key string, data []byte) error {
+	return Default.SetDataForTeam(team, key, data)
+}
+
+// GetDataFromTeam calls App.GetDataFromTeam on the Default app.
+func GetDataFromTeam(team, key string) ([]byte, error) {
+	return Default.GetDataFromTeam(team, key)
+}
+
+// GetAllDataFromTeam calls App.GetAllDataFromTeam on the Default app.
+func GetAllDataFromTeam(team string) ([]byte, error) {
+	return Default.GetAllDataFromTeam(team)
+}
+
+// DeleteDataFromTeamIfMatch calls App.DeleteDataFromTeamIfMatch on the Default app.
+func DeleteDataFromTeamIfMatch(team, key string, etag string) error {
+	return Default.DeleteDataFromTeamIfMatch(team, key, etag)
+}
+
+// GetDataCountForTeam calls App.GetDataCountForTeam on the Default app.
+func GetDataCountForTeam(team, includedKey string) int64 {
+	return Default.GetDataCountForTeam(team, includedKey)
+}
+
+// ValidateUserTemplate calls App.ValidateUserTemplate on the Default app.
+func ValidateUserTemplate() error {
+	return Default.ValidateUserTemplate()
+}
+
+// GetInvalidatedTokens calls App.GetInvalidatedTokens on the Default app.
+func GetInvalidatedTokens() ([]*InvalidatedToken, error) {
+	return Default.GetInvalidatedTokens()
+}
+
+// SweepInvalidatedTokens calls App.SweepInvalidatedTokens on the Default app.
+func SweepInvalidatedTokens() (int, error) {
+	return Default.SweepInvalidatedTokens()
+}
+
+// TrashDataFromUser calls App.TrashDataFromUser on the Default app.
+func TrashDataFromUser(name string, key string) error {
+	return Default.TrashDataFromUser(name, key)
+}
+
+// TrashDataFromUserIfMatch calls App.TrashDataFromUserIfMatch on the Default app.
+func TrashDataFromUserIfMatch(name string, key string, etag string) error {
+	return Default.TrashDataFromUserIfMatch(name, key, etag)
+}
+
+// PurgeDataFromUser calls App.PurgeDataFromUser on the Default app.
+func PurgeDataFromUser(name string, key string) error {
+	return Default.PurgeDataFromUser(name, key)
+}
+
+// PurgeDataFromUserIfMatch calls App.PurgeDataFromUserIfMatch on the Default app.
+func PurgeDataFromUserIfMatch(name string, key string, etag string) error {
+	return Default.PurgeDataFromUserIfMatch(name, key, etag)
+}
+
+// RestoreDataFromTrash calls App.RestoreDataFromTrash on the Default app.
+func RestoreDataFromTrash(name string, key string) error {
+	return Default.RestoreDataFromTrash(name, key)
+}
+
+// GetTrashFromUser calls App.GetTrashFromUser on the Default app.
+func GetTrashFromUser(name string) ([]*TrashEntry, error) {
+	return Default.GetTrashFromUser(name)
+}
+
+// GetStorageUsage calls App.GetStorageUsage on the Default app.
+func GetStorageUsage() ([]*UserUsage, error) {
+	return Default.GetStorageUsage()
+}
+
+// SetDataLabels calls App.SetDataLabels on the Default app.
+func SetDataLabels(name string, key string, update map[string]*string) (Labels, error) {
+	return Default.SetDataLabels(name, key, update)
+}
+
+// GetKeysFromUser calls App.GetKeysFromUser on the Default app.
+func GetKeysFromUser(name string, label string) ([]string, error) {
+	return Default.GetKeysFromUser(name, label)
+}
+
+// GetDataStatsForUser calls App.GetDataStatsForUser on the Default app.
+func GetDataStatsForUser(name, prefix, delimiter string) (*DataStats, error) {
+	return Default.GetDataStatsForUser(name, prefix, delimiter)
+}
+
+// NormalizeUsername calls App.NormalizeUsername on the Default app.
+func NormalizeUsername(name string) string {
+	return Default.NormalizeUsername(name)
+}
+
+// NormalizeUsernames calls App.NormalizeUsernames on the Default app.
+func NormalizeUsernames(dryRun bool) error {
+	return Default.NormalizeUsernames(dryRun)
+}
+
+// PingDatabase calls App.PingDatabase on the Default app.
+func PingDatabase() (time.Duration, error) {
+	return Default.PingDatabase()
+}
+
+// BackupDatabase calls App.BackupDatabase on the Default app.
+func BackupDatabase(w io.Writer) error {
+	return Default.BackupDatabase(w)
+}
+
+// UploadBackup calls App.UploadBackup on the Default app.
+func UploadBackup(ctx context.Context, now time.Time) (string, error) {
+	return Default.UploadBackup(ctx, now)
+}
+
+// BackupStatus calls App.BackupStatus on the Default app.
+func BackupStatus() BackupStats {
+	return Default.BackupStatus()
+}
+
+// CreateConfirmation calls App.CreateConfirmation on the Default app.
+func CreateConfirmation(admin, action, impact string) (*Confirmation, error) {
+	return Default.CreateConfirmation(admin, action, impact)
+}
+
+// ConsumeConfirmation calls App.ConsumeConfirmation on the Default app.
+func ConsumeConfirmation(admin, action, token string) error {
+	return Default.ConsumeConfirmation(admin, action, token)
+}
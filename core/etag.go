@@ -0,0 +1,94 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ETag builds the strong entity tag of a value as sent in the ETag header.
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+// PollDataForUser compares the ETags a client knows for keys of a user with their current values within a single
+// transaction. Returns the values of keys whose ETag differs by key, and the keys which don't exist anymore in order.
+// A key which doesn't exist is only reported as deleted if an ETag is known for it, an empty one means the client
+// hasn't seen it yet, so it's returned once it's created.
+func (app *App) PollDataForUser(name string, known map[string]string) (map[string][]byte, []string, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	changed := make(map[string][]byte)
+	deleted := make([]string, 0)
+
+	for key, etag := range known {
+		item, err := txn.Get(dataKey(name, key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			if len(etag) != 0 {
+				deleted = append(deleted, key)
+			}
+
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		value, err := readValue(txn, item)
+		if err != nil {
+			return nil, nil, err
+		} else if ETag(value) != etag {
+			changed[key] = value
+		}
+	}
+
+	slices.Sort(deleted)
+	return changed, deleted, nil
+}
+
+// matchETagTxn fails with ErrPreconditionFailed unless the value stored under key matches etag,
+// which may be a list of tags or "*" as sent via If-Match. An empty etag always matches.
+func matchETagTxn(txn *badger.Txn, key []byte, etag string) error {
+	if len(etag) == 0 {
+		return nil
+	}
+
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return ErrPreconditionFailed
+	} else if err != nil {
+		return err
+	}
+
+	value, err := readValue(txn, item)
+	if err != nil {
+		return err
+	}
+
+	return matchETag(value, etag)
+}
+
+// matchETag fails with ErrPreconditionFailed unless value matches etag, see matchETagTxn.
+func matchETag(value []byte, etag string) error {
+	if len(etag) == 0 {
+		return nil
+	}
+
+	current := ETag(value)
+	for _, candidate := range strings.Split(etag, ",") {
+
+		// If-Match uses the strong comparison, weak tags never match
+		if candidate = strings.TrimSpace(candidate); candidate == current || candidate == "*" {
+			return nil
+		}
+	}
+
+	return ErrPreconditionFailed
+}
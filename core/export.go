@@ -0,0 +1,113 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ExportedUser is a user as it's exported, with everything stored for it except for its password hashes.
+type ExportedUser struct {
+	Name        string     `json:"name" example:"admin"`
+	Admin       bool       `json:"admin" example:"true"`
+	Disabled    bool       `json:"disabled,omitempty" example:"false"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty" example:"2025-01-01T00:00:00Z"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty" example:"2025-01-01T00:00:00Z"`
+	EnabledAt   *time.Time `json:"enabledAt,omitempty" example:"2025-01-01T00:00:00Z"`
+}
+
+// ExportUser writes everything stored for a user as a single JSON document to w, except for its password hashes:
+// {"exportedAt": string, "user": ExportedUser, "settings": object, "data": object, "meta": object, "trash": object}
+// Values are streamed one by one from a single snapshot of the database, so large accounts don't have to fit into memory.
+func (app *App) ExportUser(name string, w io.Writer) error {
+	name = app.NormalizeUsername(name)
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	user, err := getUserTxn(txn, name)
+	if err != nil {
+		return err
+	} else if user == nil {
+		return ErrUserNotFound
+	}
+
+	settings := []byte("{}")
+	if item, err := txn.Get(buildSettingsKey(name)); err == nil {
+		if settings, err = item.ValueCopy(nil); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+
+	header, err := json.Marshal(struct {
+		ExportedAt time.Time    `json:"exportedAt"`
+		User       ExportedUser `json:"user"`
+	}{app.Now().UTC(), ExportedUser{
+		Name:        user.Name,
+		Admin:       user.Admin,
+		Disabled:    user.Disabled,
+		CreatedAt:   user.CreatedAt,
+		LastLoginAt: user.LastLoginAt,
+		EnabledAt:   user.EnabledAt,
+	}})
+	if err != nil {
+		return err
+	}
+
+	// Continue the header object with the remaining fields
+	if _, err := fmt.Fprintf(w, "%s,\"settings\":%s", header[:len(header)-1], settings); err != nil {
+		return err
+	}
+
+	for _, section := range []struct {
+		field  string
+		prefix []byte
+	}{
+		{"data", dataKey(name, "")},
+		{"meta", buildMetaKey(name, "")},
+		{"trash", buildTrashKey(name, "")},
+	} {
+		if _, err := fmt.Fprintf(w, ",%q:", section.field); err != nil {
+			return err
+		} else if err := exportPrefix(txn, section.prefix, w); err != nil {
+			return fmt.Errorf("failed to export %s: %w", section.field, err)
+		}
+	}
+
+	_, err = io.WriteString(w, "}")
+	return err
+}
+
+// exportPrefix writes all entries starting with prefix as JSON object to w, using the remainder of the key as field name.
+func exportPrefix(txn *badger.Txn, prefix []byte, w io.Writer) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	separator := "{"
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+
+		if value, err := readValue(txn, item); err != nil {
+			return err
+		} else if key, err := json.Marshal(string(item.Key()[len(prefix):])); err != nil {
+			return err
+		} else if _, err := fmt.Fprintf(w, "%s%s:%s", separator, key, value); err != nil {
+			return err
+		}
+
+		separator = ","
+	}
+
+	if separator == "{" {
+		_, err := io.WriteString(w, "{}")
+		return err
+	}
+
+	_, err := io.WriteString(w, "}")
+	return err
+}
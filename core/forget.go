@@ -0,0 +1,135 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ForgetSummary lists what has been erased by ForgetUser
+// @Description Amount of records erased for a user
+type ForgetSummary struct {
+	Keys        int  `json:"keys" example:"12"`
+	TrashedKeys int  `json:"trashedKeys" example:"2"`
+	Meta        int  `json:"meta" example:"12"`
+	Settings    bool `json:"settings" example:"true"`
+	Invites     int  `json:"invites" example:"1"`
+}
+
+// ForgetUser erases a user along with everything referencing them within a single transaction:
+// data, trash, metadata, settings and invites created by them. Blobs only used by the user are released as well.
+// Sessions of the user are rejected afterward, even if a user of the same name is created again, see JWTClaim.IssuedFor.
+func (app *App) ForgetUser(name string) (*ForgetSummary, error) {
+	var summary ForgetSummary
+	name = app.NormalizeUsername(name)
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		summary = ForgetSummary{}
+
+		if user, err := getUserTxn(txn, name); err != nil {
+			return err
+		} else if user == nil {
+			return ErrUserNotFound
+		}
+
+		for _, section := range []struct {
+			prefix []byte
+			count  *int
+		}{
+			{dataKey(name, ""), &summary.Keys},
+			{buildTrashKey(name, ""), &summary.TrashedKeys},
+			{buildMetaKey(name, ""), &summary.Meta},
+			// Label and data indexes are derived from metadata and therefore not counted on their own
+			{buildLabelPrefix(name, ""), new(int)},
+			{buildIndexPrefix(name, ""), new(int)},
+		} {
+			keys := collectKeysTxn(txn, section.prefix)
+			for _, key := range keys {
+				if err := app.deleteValueTxn(txn, key); err != nil {
+					return err
+				}
+			}
+
+			*section.count = len(keys)
+		}
+
+		if _, err := txn.Get(buildSettingsKey(name)); err == nil {
+			summary.Settings = true
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		if err := txn.Delete(buildSettingsKey(name)); err != nil {
+			return err
+		}
+
+		invites, err := collectInvitesTxn(txn, name)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range invites {
+			if err := txn.Delete(buildInviteKey(id)); err != nil {
+				return err
+			}
+		}
+
+		summary.Invites = len(invites)
+
+		if err := removeFromTeamsTxn(txn, name); err != nil {
+			return err
+		}
+
+		if err := deleteSharesTxn(txn, name); err != nil {
+			return err
+		}
+
+		return txn.Delete(buildUserKey(name))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+// collectKeysTxn returns all keys starting with prefix, deleting them while iterating isn't possible.
+func collectKeysTxn(txn *badger.Txn, prefix []byte) [][]byte {
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	keys := make([][]byte, 0)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+
+	return keys
+}
+
+// collectInvitesTxn returns the ids of all invites created by name.
+func collectInvitesTxn(txn *badger.Txn, name string) ([]string, error) {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildInviteKey("")
+	ids := make([]string, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var invite Invite
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &invite)
+		}); err != nil {
+			return nil, err
+		} else if invite.CreatedBy == name {
+			ids = append(ids, invite.ID)
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,22 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// PingDatabase reads a single key from the database and returns how long it took, which hints at how busy it is.
+func (app *App) PingDatabase() (time.Duration, error) {
+	start := time.Now()
+	err := app.db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(buildSystemKey(dbSchemaVersionKey)); err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		return nil
+	})
+
+	return time.Since(start), err
+}
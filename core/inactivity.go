@@ -0,0 +1,136 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+)
+
+var ErrUserDisabled = errors.New("user is disabled")
+
+// recordLogin stores the current time as last login of the user named name.
+func (app *App) recordLogin(name string) error {
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		user, err := getUserTxn(txn, name)
+		if err != nil {
+			return err
+		} else if user == nil {
+			return ErrUserNotFound
+		}
+
+		now := app.Now().UTC()
+		user.LastLoginAt = &now
+		return setUserTxn(txn, user)
+	})
+}
+
+// DisableInactiveUsers disables users who haven't logged in for GENESIS_INACTIVITY_DISABLE_DAYS and returns their names.
+// Users are considered active since their last login, creation or re-enabling by an admin, whichever is the latest.
+// Users stored before any of these were tracked start their period of inactivity now. Admins are exempt unless
+// GENESIS_INACTIVITY_DISABLE_ADMINS is enabled, the last admin which isn't disabled is never disabled.
+func (app *App) DisableInactiveUsers(now time.Time) ([]string, error) {
+	if app.Config.InactivityDisableAfter <= 0 {
+		return nil, nil
+	}
+
+	var disabled []string
+	var lastActive []time.Time
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		users, err := getAllUsersTxn(txn)
+		if err != nil {
+			return err
+		}
+
+		disabled, lastActive = make([]string, 0), make([]time.Time, 0)
+		admins := 0
+
+		for _, user := range users {
+			if user.Admin && !user.Disabled {
+				admins++
+			}
+		}
+
+		for _, user := range users {
+			active := latestTime(user.CreatedAt, user.LastLoginAt, user.EnabledAt)
+
+			switch {
+			case user.Disabled, user.Admin && !app.Config.InactivityDisableAdmins:
+				continue
+			case active == nil:
+				user.CreatedAt = &now
+			case now.Sub(*active) < app.Config.InactivityDisableAfter:
+				continue
+			case user.Admin && admins <= 1:
+				app.Logger.Warn("not disabling the last admin despite inactivity", zap.String("user", user.Name))
+				continue
+			default:
+				if user.Admin {
+					admins--
+				}
+
+				user.Disabled = true
+				disabled = append(disabled, user.Name)
+				lastActive = append(lastActive, *active)
+			}
+
+			if err := setUserTxn(txn, user); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for index, name := range disabled {
+		app.Audit("user disabled due to inactivity", zap.String("user", name), zap.Time("lastActiveAt", lastActive[index]))
+	}
+
+	return disabled, nil
+}
+
+// disableInactiveUsersPeriodically runs DisableInactiveUsers on start and once an hour, it never returns.
+func (app *App) disableInactiveUsersPeriodically() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if _, err := app.DisableInactiveUsers(app.Now().UTC()); err != nil {
+			app.Logger.Error("failed to disable inactive users", zap.Error(err))
+		}
+
+		<-ticker.C
+	}
+}
+
+// setUserTxn stores user as it is, the password has to be hashed already.
+func setUserTxn(txn *badger.Txn, user *User) error {
+	if data, err := json.Marshal(user); err != nil {
+		return fmt.Errorf("failed to create user data: %w", err)
+	} else if err := txn.Set(buildUserKey(user.Name), data); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return nil
+}
+
+// latestTime returns the latest of times, nil if none is set.
+func latestTime(times ...*time.Time) *time.Time {
+	var latest *time.Time
+
+	for _, t := range times {
+		if t != nil && (latest == nil || t.After(*latest)) {
+			latest = t
+		}
+	}
+
+	return latest
+}
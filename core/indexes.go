@@ -0,0 +1,272 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+)
+
+// maxIndexedValueLength limits the size of index entries, longer values aren't indexed
+const maxIndexedValueLength = 256
+
+var ErrFieldNotIndexed = errors.New("field is not indexed")
+
+// DataIndex declares a field of the values stored under keys matching KeyPattern as indexed, see GENESIS_DATA_INDEXES.
+// Fields are dot-separated paths into the value, array items are addressed by their index, e.g. "tags.0".
+type DataIndex struct {
+	KeyPattern string
+	Field      string
+}
+
+// QueryDataIndex lists the keys of a user in order whose indexed field has value, or which have any value for it if
+// value is nil. Strings are matched as they are, numbers and booleans by their JSON representation. Fails with
+// ErrFieldNotIndexed if field isn't declared as indexed for any key.
+func (app *App) QueryDataIndex(name string, field string, value *string) ([]string, error) {
+	if !slices.ContainsFunc(app.Config.DataIndexes, func(index DataIndex) bool { return index.Field == field }) {
+		return nil, ErrFieldNotIndexed
+	}
+
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := buildIndexPrefix(name, field)
+	if value != nil {
+		prefix = buildIndexKey(name, field, *value, "")
+	}
+
+	keys := make([]string, 0)
+	for _, entry := range collectKeysTxn(txn, prefix) {
+		rest := entry[len(prefix):]
+
+		// Entries of any value start with the value, which is escaped like a name
+		if value == nil {
+			_, key, ok := splitKeySegment(rest)
+			if !ok {
+				continue
+			}
+
+			rest = key
+		}
+
+		keys = append(keys, string(rest))
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// RebuildIndexes rebuilds the indexes of all users if GENESIS_DATA_INDEXES changed since they've been built, or
+// always if force is set, and reports whether it did so. Each user is indexed within a separate transaction.
+// A read-only database is never modified, outdated indexes are only logged.
+func (app *App) RebuildIndexes(force bool) (bool, error) {
+	definition := indexDefinition(app.Config.DataIndexes)
+	var users []*User
+	var built string
+
+	if err := app.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(buildSystemKey(dbIndexesKey))
+		if err == nil {
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			built = string(value)
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		users, err = getAllUsersTxn(txn)
+		return err
+	}); err != nil {
+		return false, err
+	} else if built == definition && !force {
+		return false, nil
+	} else if app.Config.ReadOnly {
+		app.Logger.Warn("indexes are outdated but can't be rebuilt in read-only mode", zap.String("indexes", definition))
+		return false, nil
+	}
+
+	start := time.Now()
+	if err := app.db.DropPrefix([]byte(dbIndexPrefix + dbKeySeparator)); err != nil {
+		return false, err
+	}
+
+	for _, user := range users {
+		if err := app.updateWithRetry(func(txn *badger.Txn) error {
+			_, err := app.rebuildUserIndexTxn(txn, user.Name)
+			return err
+		}); err != nil {
+			return false, err
+		}
+	}
+
+	if err := app.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(buildSystemKey(dbIndexesKey), []byte(definition))
+	}); err != nil {
+		return false, err
+	}
+
+	app.Logger.Info("rebuilt indexes", zap.String("indexes", definition), zap.Int("users", len(users)), zap.Duration("took", time.Since(start)))
+	return true, nil
+}
+
+// rebuildUserIndexTxn replaces the index entries of all keys of a user and returns the amount of entries.
+func (app *App) rebuildUserIndexTxn(txn *badger.Txn, name string) (int, error) {
+	for _, entry := range collectKeysTxn(txn, buildIndexPrefix(name, "")) {
+		if err := txn.Delete(entry); err != nil {
+			return 0, err
+		}
+	}
+
+	prefix := dataKey(name, "")
+	values := make(map[string][]byte)
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		value, err := readValue(txn, it.Item())
+		if err != nil {
+			it.Close()
+			return 0, err
+		}
+
+		values[string(it.Item().Key()[len(prefix):])] = value
+	}
+
+	it.Close()
+	count := 0
+
+	for key, value := range values {
+		indexed := app.indexValues(key, value)
+		if err := app.replaceIndexEntriesTxn(txn, name, key, indexed); err != nil {
+			return 0, err
+		}
+
+		count += len(indexed)
+	}
+
+	return count, nil
+}
+
+// indexDataTxn updates the index entries of key after data has been stored under it.
+func (app *App) indexDataTxn(txn *badger.Txn, name string, key string, data []byte) error {
+	if len(app.Config.DataIndexes) == 0 {
+		return nil
+	}
+
+	return app.replaceIndexEntriesTxn(txn, name, key, app.indexValues(key, data))
+}
+
+// replaceIndexEntriesTxn replaces the index entries of key with values. Indexed values are kept in the metadata of key,
+// so the entries can be removed along with it without reading the value, see deleteMetaTxn.
+func (app *App) replaceIndexEntriesTxn(txn *badger.Txn, name string, key string, values map[string]string) error {
+	stored, err := getStoredMeta(txn, name, key)
+	if err != nil {
+		return err
+	} else if (stored == nil || len(stored.Indexed) == 0) && len(values) == 0 {
+		return nil
+	}
+
+	if stored != nil {
+		for field, value := range stored.Indexed {
+			if err := txn.Delete(buildIndexKey(name, field, value, key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for field, value := range values {
+		if err := txn.Set(buildIndexKey(name, field, value, key), []byte{}); err != nil {
+			return err
+		}
+	}
+
+	return app.updateMetaTxn(txn, name, key, func(meta *storedMeta, now time.Time) {
+		meta.Indexed = values
+	})
+}
+
+// indexValues extracts the values of the fields indexed for key from data. Fields which don't exist, aren't a string,
+// number or boolean, or are too long aren't included.
+func (app *App) indexValues(key string, data []byte) map[string]string {
+	fields := make([]string, 0)
+	for _, index := range app.Config.DataIndexes {
+		if matched, _ := path.Match(index.KeyPattern, key); matched && !slices.Contains(fields, index.Field) {
+			fields = append(fields, index.Field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil
+	}
+
+	values := make(map[string]string)
+	for _, field := range fields {
+		var value string
+
+		switch leaf := lookupField(document, field).(type) {
+		case string:
+			value = leaf
+		case json.Number:
+			value = leaf.String()
+		case bool:
+			value = strconv.FormatBool(leaf)
+		default:
+			continue
+		}
+
+		if len(value) <= maxIndexedValueLength {
+			values[field] = value
+		}
+	}
+
+	return values
+}
+
+// lookupField resolves the dot-separated path field within document, returns nil if it doesn't exist.
+func lookupField(document any, field string) any {
+	for _, segment := range strings.Split(field, ".") {
+		switch current := document.(type) {
+		case map[string]any:
+			document = current[segment]
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil
+			}
+
+			document = current[index]
+		default:
+			return nil
+		}
+	}
+
+	return document
+}
+
+// indexDefinition describes indexes in a stable way, so changes between restarts can be detected.
+func indexDefinition(indexes []DataIndex) string {
+	entries := make([]string, len(indexes))
+	for i, index := range indexes {
+		entries[i] = index.KeyPattern + ":" + index.Field
+	}
+
+	slices.Sort(entries)
+	return strings.Join(slices.Compact(entries), ",")
+}
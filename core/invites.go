@@ -0,0 +1,129 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var ErrInviteNotFound = errors.New("invite not found")
+
+// Invite represents a single-use token which allows registering a new account
+// @Description Single-use invite for registering a new account
+type Invite struct {
+	ID        string    `json:"id" example:"9b1deb4d3b7d4bad9bdd2b0d7b3dcb6d"`
+	CreatedBy string    `json:"createdBy" example:"admin"`
+	Admin     bool      `json:"admin" example:"false"`
+	CreatedAt time.Time `json:"createdAt" example:"2025-01-01T00:00:00Z"`
+	ExpiresAt time.Time `json:"expiresAt" example:"2025-01-08T00:00:00Z"`
+}
+
+// CreateInvite mints a new invite which expires after ttl, users registering with it are admins if admin is true.
+func (app *App) CreateInvite(createdBy string, admin bool, ttl time.Duration) (*Invite, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate invite id: %w", err)
+	}
+
+	now := app.Now().UTC()
+	invite := &Invite{
+		ID:        hex.EncodeToString(id),
+		CreatedBy: createdBy,
+		Admin:     admin,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite data: %w", err)
+	}
+
+	return invite, app.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(buildInviteKey(invite.ID), data).WithTTL(ttl))
+	})
+}
+
+// GetInvites lists all invites which haven't been redeemed or expired yet, oldest first.
+func (app *App) GetInvites() ([]*Invite, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildInviteKey("")
+	invites := make([]*Invite, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var invite Invite
+
+		if data, err := it.Item().ValueCopy(nil); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(data, &invite); err != nil {
+			return nil, fmt.Errorf("failed to parse invite: %w", err)
+		} else if !invite.ExpiresAt.After(app.Now()) {
+			continue
+		}
+
+		invites = append(invites, &invite)
+	}
+
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.Before(invites[j].CreatedAt)
+	})
+
+	return invites, nil
+}
+
+// DeleteInvite revokes an invite, returns ErrInviteNotFound if it doesn't exist (anymore).
+func (app *App) DeleteInvite(id string) error {
+	return app.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(buildInviteKey(id)); errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrInviteNotFound
+		} else if err != nil {
+			return err
+		}
+
+		return txn.Delete(buildInviteKey(id))
+	})
+}
+
+// CreateUserWithInvite creates a user and redeems the invite within the same transaction,
+// the invite can therefore only be used once even if multiple users try to register with it at the same time.
+// The admin flag of the user is taken from the invite, which is returned on success.
+func (app *App) CreateUserWithInvite(user User, id string) (*Invite, error) {
+	var invite Invite
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		item, err := txn.Get(buildInviteKey(id))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrInviteNotFound
+		} else if err != nil {
+			return err
+		} else if data, err := item.ValueCopy(nil); err != nil {
+			return err
+		} else if err := json.Unmarshal(data, &invite); err != nil {
+			return fmt.Errorf("failed to parse invite: %w", err)
+		} else if !invite.ExpiresAt.After(app.Now()) {
+			return ErrInviteNotFound
+		} else if err := txn.Delete(buildInviteKey(id)); err != nil {
+			return err
+		}
+
+		user.Admin = invite.Admin
+		return app.createUserTxn(txn, user, app.countUsers(txn))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var ErrStorageFull = errors.New("maximum amount of keys across all users reached")
+
+// The amount of data keys of all users and teams is stored under a system key and adjusted within every transaction that stores
+// a new key or removes one, so the global limit can be enforced without counting them. Concurrent transactions changing
+// the amount conflict on that key and are retried with a backoff, see updateWithRetry, which keeps it exact. As this serializes writes of all users, the
+// amount is only maintained while GENESIS_GLOBAL_MAX_KEYS is set and counted again on start, see recountKeys.
+
+// checkKeyCountTxn fails with ErrStorageFull if key is a data key, GENESIS_GLOBAL_MAX_KEYS is set and reached.
+func (app *App) checkKeyCountTxn(txn *badger.Txn, key []byte) error {
+	if app.Config.GlobalMaxKeys <= 0 || !isDataKey(key) {
+		return nil
+	} else if count, err := getKeyCountTxn(txn); err != nil {
+		return err
+	} else if count >= uint64(app.Config.GlobalMaxKeys) {
+		return ErrStorageFull
+	}
+
+	return nil
+}
+
+// CountAllData returns the amount of data keys of all users and teams, which is what GENESIS_GLOBAL_MAX_KEYS limits.
+func (app *App) CountAllData() (int64, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	count, err := getKeyCountTxn(txn)
+	return int64(count), err
+}
+
+// adjustKeyCountTxn adds delta to the amount of data keys if key is one and the global limit is enabled.
+func (app *App) adjustKeyCountTxn(txn *badger.Txn, key []byte, delta int64) error {
+	if app.Config.GlobalMaxKeys <= 0 || !isDataKey(key) {
+		return nil
+	}
+
+	count, err := getKeyCountTxn(txn)
+	if err != nil {
+		return err
+	} else if delta < 0 && count < uint64(-delta) {
+		count = 0
+	} else {
+		count = uint64(int64(count) + delta)
+	}
+
+	return txn.Set(buildSystemKey(dbKeyCountKey), binary.BigEndian.AppendUint64(nil, count))
+}
+
+func getKeyCountTxn(txn *badger.Txn) (uint64, error) {
+	item, err := txn.Get(buildSystemKey(dbKeyCountKey))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// recountKeys counts the data keys of all users and teams if GENESIS_GLOBAL_MAX_KEYS is set, as the stored amount is outdated if
+// keys have been changed while the limit was disabled. Nothing is written in dry-run or read-only mode.
+func (app *App) recountKeys(dryRun bool) error {
+	if app.Config.GlobalMaxKeys <= 0 || app.Config.ReadOnly || dryRun {
+		return nil
+	}
+
+	return app.db.Update(countDataKeysTxn)
+}
+
+// countDataKeysTxn stores the amount of data keys of all users and teams, which are counted once when migrating.
+func countDataKeysTxn(txn *badger.Txn) error {
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	count := uint64(0)
+	for _, prefix := range dataKeyPrefixes {
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			count++
+		}
+	}
+
+	return txn.Set(buildSystemKey(dbKeyCountKey), binary.BigEndian.AppendUint64(nil, count))
+}
+
+// dataKeyPrefixes are the prefixes of the keys counted towards GENESIS_GLOBAL_MAX_KEYS.
+var dataKeyPrefixes = [][]byte{
+	[]byte(dbDataPrefix + dbKeySeparator),
+	[]byte(dbTeamDataPrefix + dbKeySeparator),
+}
+
+func isDataKey(key []byte) bool {
+	for _, prefix := range dataKeyPrefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const keyLockShards = 32
+
+// keyedMutex serializes operations per key, entries only exist while a key is locked or waited for.
+// Keys are spread across shards so unrelated keys don't contend on the same map.
+type keyedMutex struct {
+	shards [keyLockShards]keyLockShard
+}
+
+type keyLockShard struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	km := &keyedMutex{}
+
+	for i := range km.shards {
+		km.shards[i].locks = make(map[string]*keyLock)
+	}
+
+	return km
+}
+
+// Lock blocks until key is available and returns the function to release it again.
+func (km *keyedMutex) Lock(key string) func() {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	shard := &km.shards[hash.Sum32()%keyLockShards]
+
+	shard.mu.Lock()
+	lock, ok := shard.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		shard.locks[key] = lock
+	}
+	lock.refs++
+	shard.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		shard.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(shard.locks, key)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// lockData locks key of the user name, use the returned function to unlock it.
+func (app *App) lockData(name, key string) func() {
+	return app.locks.Lock(name + "\x00" + key)
+}
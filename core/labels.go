@@ -0,0 +1,130 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	maxLabelsPerKey = 32
+	maxLabelLength  = 128
+)
+
+var ErrInvalidLabels = errors.New("invalid labels")
+
+// Labels are user-defined names and values attached to a key, e.g. category=notes.
+type Labels map[string]string
+
+// SetDataLabels updates the labels of key, labels with a nil value are removed and all others are set. Returns the
+// resulting labels, ErrDataNotFound if key doesn't exist and ErrInvalidLabels if a name or value isn't allowed.
+// Labels are indexed, so keys can be listed by label without reading the metadata of all keys, see GetKeysFromUser.
+func (app *App) SetDataLabels(name string, key string, update map[string]*string) (Labels, error) {
+	for label, value := range update {
+		if len(label) == 0 || len(label) > maxLabelLength || strings.Contains(label, "=") {
+			return nil, fmt.Errorf("%w: names must be between 1 and %d bytes long and must not contain '='", ErrInvalidLabels, maxLabelLength)
+		} else if value != nil && len(*value) > maxLabelLength {
+			return nil, fmt.Errorf("%w: values must not be longer than %d bytes", ErrInvalidLabels, maxLabelLength)
+		}
+	}
+
+	var labels Labels
+	defer app.lockData(name, key)()
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		labels = make(Labels)
+
+		if _, err := txn.Get(dataKey(name, key)); errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrDataNotFound
+		} else if err != nil {
+			return err
+		} else if stored, err := getStoredMeta(txn, name, key); err != nil {
+			return err
+		} else if stored != nil {
+			for label, value := range stored.Labels {
+				labels[label] = value
+			}
+		}
+
+		for label, value := range update {
+			if current, ok := labels[label]; ok {
+				if err := txn.Delete(buildLabelKey(name, label, current, key)); err != nil {
+					return err
+				}
+
+				delete(labels, label)
+			}
+
+			if value != nil {
+				labels[label] = *value
+			}
+		}
+
+		if len(labels) > maxLabelsPerKey {
+			return fmt.Errorf("%w: a key can't have more than %d labels", ErrInvalidLabels, maxLabelsPerKey)
+		}
+
+		for label, value := range labels {
+			if err := txn.Set(buildLabelKey(name, label, value, key), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return app.updateMetaTxn(txn, name, key, func(meta *storedMeta, now time.Time) {
+			meta.Labels = labels
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// GetKeysFromUser lists the keys of a user in order. If label is given, only keys with this label are listed, which is
+// either the name of a label or name=value to only include keys where it has this value.
+func (app *App) GetKeysFromUser(name string, label string) ([]string, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	keys := make([]string, 0)
+
+	if len(label) == 0 {
+		prefix := dataKey(name, "")
+		for _, key := range collectKeysTxn(txn, prefix) {
+			keys = append(keys, string(key[len(prefix):]))
+		}
+
+		return keys, nil
+	}
+
+	label, value, hasValue := strings.Cut(label, "=")
+	prefix := buildLabelPrefix(name, label)
+	if hasValue {
+		prefix = buildLabelKey(name, label, value, "")
+	}
+
+	for _, entry := range collectKeysTxn(txn, prefix) {
+		rest := entry[len(prefix):]
+
+		// Entries of any value start with the value, which is escaped like a name
+		if !hasValue {
+			_, key, ok := splitKeySegment(rest)
+			if !ok {
+				continue
+			}
+
+			rest = key
+		}
+
+		keys = append(keys, string(rest))
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package core
+
+// isDatabaseLocked always reports false, the lock badger takes on the directory isn't checked on this platform.
+func isDatabaseLocked(string) bool {
+	return false
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package core
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// isDatabaseLocked reports whether another process holds the lock badger takes on the directory of an open database.
+func isDatabaseLocked(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+
+	// The lock, if acquired, is released along with f
+	defer f.Close()
+
+	return errors.Is(syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB), syscall.EWOULDBLOCK)
+}
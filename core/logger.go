@@ -2,28 +2,18 @@ package core
 
 import (
 	"log"
-	"os"
-	"path"
-	"runtime"
-	"testing"
 
-	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
-var Logger = func() *zap.Logger {
-	_, filename, _, _ := runtime.Caller(0)
-	var root = path.Join(path.Dir(filename), "..")
-
-	envFile := path.Join(root, ".env")
-	if testing.Testing() {
-		envFile = path.Join(root, ".env.test")
-	}
-
-	envSkipped := godotenv.Load(envFile)
+// Logger is the logger of the Default app. It logs in development mode until LoadConfig replaced it with the
+// configured one.
+var Logger = newLogger("")
 
+// newLogger builds a logger for mode, which is either production or anything else for development.
+func newLogger(mode string) *zap.Logger {
 	var cfg zap.Config
-	if os.Getenv("GENESIS_LOG_MODE") == "production" {
+	if mode == "production" {
 		cfg = zap.NewProductionConfig()
 	} else {
 		cfg = zap.NewDevelopmentConfig()
@@ -34,9 +24,5 @@ var Logger = func() *zap.Logger {
 		log.Fatal(err)
 	}
 
-	if envSkipped != nil {
-		logger.Debug(".env file skipped")
-	}
-
 	return logger
-}()
+}
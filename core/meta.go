@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// DataMeta represents information about a stored key without its value
+// @Description Information about a stored key, lastAccessedAt is only set if access tracking is enabled and updatedAt is unknown for keys stored by older versions
+type DataMeta struct {
+	Key            string     `json:"key" example:"settings"`
+	Size           int64      `json:"size" example:"128"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty" example:"2025-01-01T00:00:00Z"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty" example:"2025-01-01T00:00:00Z"`
+	Labels         Labels     `json:"labels,omitempty"`
+}
+
+type storedMeta struct {
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+	LastAccessedAt *time.Time `json:"lastAccessedAt,omitempty"`
+	Labels         Labels     `json:"labels,omitempty"`
+	// Values of the indexed fields, see DataIndex
+	Indexed map[string]string `json:"indexed,omitempty"`
+}
+
+// GetDataMeta returns the metadata of key, badger.ErrKeyNotFound is returned if the key doesn't exist.
+func (app *App) GetDataMeta(name string, key string) (*DataMeta, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(dataKey(name, key))
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := valueSize(txn, item)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &DataMeta{Key: key, Size: size}
+
+	if stored, err := getStoredMeta(txn, name, key); err != nil {
+		return nil, err
+	} else if stored != nil {
+		meta.UpdatedAt, meta.LastAccessedAt, meta.Labels = stored.UpdatedAt, stored.LastAccessedAt, stored.Labels
+	}
+
+	return meta, nil
+}
+
+// TouchData records the current time as the last access of key.
+func (app *App) TouchData(name string, key string) error {
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		return app.updateMetaTxn(txn, name, key, func(meta *storedMeta, now time.Time) {
+			meta.LastAccessedAt = &now
+		})
+	})
+}
+
+// GetLastModified returns when any key of a user has been updated the last time, nil if unknown.
+func (app *App) GetLastModified(name string) (*time.Time, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildMetaKey(name, "")
+	var lastModified *time.Time
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var stored storedMeta
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &stored)
+		}); err != nil {
+			return nil, err
+		} else if stored.UpdatedAt != nil && (lastModified == nil || stored.UpdatedAt.After(*lastModified)) {
+			lastModified = stored.UpdatedAt
+		}
+	}
+
+	return lastModified, nil
+}
+
+// GetKeysNotAccessedSince returns all keys of a user which haven't been read or written since the given time.
+// Keys without a recorded access, e.g. stored before tracking was enabled, are never included.
+func (app *App) GetKeysNotAccessedSince(name string, since time.Time) ([]string, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildMetaKey(name, "")
+	keys := make([]string, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var stored storedMeta
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &stored)
+		}); err != nil {
+			return nil, err
+		} else if stored.LastAccessedAt != nil && stored.LastAccessedAt.Before(since) {
+			keys = append(keys, string(it.Item().Key()[len(prefix):]))
+		}
+	}
+
+	return keys, nil
+}
+
+// markUpdatedTxn records that key has been written, which counts as access as well.
+func (app *App) markUpdatedTxn(txn *badger.Txn, name string, key string) error {
+	return app.updateMetaTxn(txn, name, key, func(meta *storedMeta, now time.Time) {
+		meta.UpdatedAt = &now
+
+		if app.Config.TrackLastAccess {
+			meta.LastAccessedAt = &now
+		}
+	})
+}
+
+func (app *App) updateMetaTxn(txn *badger.Txn, name string, key string, update func(meta *storedMeta, now time.Time)) error {
+	stored, err := getStoredMeta(txn, name, key)
+	if err != nil {
+		return err
+	} else if stored == nil {
+		stored = &storedMeta{}
+	}
+
+	update(stored, app.Now().UTC())
+
+	if data, err := json.Marshal(stored); err != nil {
+		return err
+	} else {
+		return txn.Set(buildMetaKey(name, key), data)
+	}
+}
+
+// deleteMetaTxn deletes the metadata of key along with the index entries of its labels and indexed fields.
+func deleteMetaTxn(txn *badger.Txn, name string, key string) error {
+	stored, err := getStoredMeta(txn, name, key)
+	if err != nil {
+		return err
+	} else if stored != nil {
+		for label, value := range stored.Labels {
+			if err := txn.Delete(buildLabelKey(name, label, value, key)); err != nil {
+				return err
+			}
+		}
+
+		for field, value := range stored.Indexed {
+			if err := txn.Delete(buildIndexKey(name, field, value, key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return txn.Delete(buildMetaKey(name, key))
+}
+
+func getStoredMeta(txn *badger.Txn, name string, key string) (*storedMeta, error) {
+	item, err := txn.Get(buildMetaKey(name, key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stored storedMeta
+	return &stored, item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &stored)
+	})
+}
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSchemaTooNew      = errors.New("database schema is newer than this version of genesis")
+	ErrReadOnlyMigration = errors.New("database needs to be migrated, which is not possible in read-only mode")
+)
+
+type migration struct {
+	name  string
+	apply func(txn *badger.Txn) error
+}
+
+// migrations brings the database from one schema version to the next, the version of a database is the amount of migrations applied to it.
+// Never change or remove existing migrations, only append new ones. Each migration runs in a single transaction.
+var migrations = []migration{
+	{
+		// Databases created before migrations existed already use this layout, there is nothing to change
+		name:  "initial key layout",
+		apply: func(txn *badger.Txn) error { return nil },
+	},
+	{
+		name:  "escape separators in usernames",
+		apply: escapeUsernamesTxn,
+	},
+	{
+		name:  "count data keys",
+		apply: countDataKeysTxn,
+	},
+}
+
+// Migrate applies all pending migrations in order and records the new schema version along with each of them.
+// Afterward, the amount of data keys is counted if GENESIS_GLOBAL_MAX_KEYS is set. In dry-run mode pending migrations
+// are only logged.
+func (app *App) Migrate(dryRun bool) error {
+	version, err := app.getSchemaVersion()
+	if err != nil {
+		return err
+	} else if version > len(migrations) {
+		return fmt.Errorf("%w: %d, latest known is %d", ErrSchemaTooNew, version, len(migrations))
+	} else if version == len(migrations) {
+		app.Logger.Debug("database schema is up to date", zap.Int("version", version))
+		return app.recountKeys(dryRun)
+	}
+
+	if app.Config.ReadOnly && !dryRun {
+		return fmt.Errorf("%w: %d pending migrations", ErrReadOnlyMigration, len(migrations)-version)
+	}
+
+	for ; version < len(migrations); version++ {
+		current := migrations[version]
+		fields := []zap.Field{zap.Int("version", version+1), zap.String("name", current.name)}
+
+		if dryRun {
+			app.Logger.Info("pending migration", fields...)
+			continue
+		}
+
+		if err := app.db.Update(func(txn *badger.Txn) error {
+			if err := current.apply(txn); err != nil {
+				return err
+			}
+
+			return txn.Set(buildSystemKey(dbSchemaVersionKey), []byte(strconv.Itoa(version+1)))
+		}); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", version+1, current.name, err)
+		}
+
+		app.Logger.Info("applied migration", fields...)
+	}
+
+	return app.recountKeys(dryRun)
+}
+
+func (app *App) getSchemaVersion() (int, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(buildSystemKey(dbSchemaVersionKey))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(string(value))
+}
+
+// escapeUsernamesTxn moves the keys of users and teams whose name contains the key separator or escape character to
+// their escaped keyspace, see dataKey. Keys matching several names are moved to the one with the longest name, which
+// is the one they were returned for before. Grants are rewritten as a whole, see escapeGrantsTxn.
+func escapeUsernamesTxn(txn *badger.Txn) error {
+	type move struct {
+		to    []byte
+		item  *badger.Item
+		value []byte
+	}
+
+	users := collectNamesTxn(txn, buildUserKey(""))
+	teams := collectNamesTxn(txn, buildTeamKey(""))
+
+	claimed := make(map[string]bool)
+	moves := make([]move, 0)
+
+	add := func(key, to []byte) error {
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		claimed[string(key)] = true
+		moves = append(moves, move{to: to, item: item, value: value})
+		return nil
+	}
+
+	for _, group := range []struct {
+		names    []string
+		prefixes []string
+	}{
+		{users, []string{dbDataPrefix, dbTrashPrefix, dbMetaPrefix}},
+		{teams, []string{dbTeamDataPrefix}},
+	} {
+		for _, name := range group.names {
+			if escapeKeySegment(name) == name {
+				continue
+			}
+
+			for _, prefix := range group.prefixes {
+				raw := []byte(prefix + dbKeySeparator + name + dbKeySeparator)
+				escaped := []byte(prefix + dbKeySeparator + escapeKeySegment(name) + dbKeySeparator)
+
+				for _, key := range collectKeysTxn(txn, raw) {
+					if claimed[string(key)] {
+						continue
+					}
+
+					if err := add(key, append(slices.Clone(escaped), key[len(raw):]...)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	// Settings are stored under the name alone, so they can't belong to another user
+	for _, name := range users {
+		raw := []byte(dbSettingsPrefix + dbKeySeparator + name)
+		if escaped := buildSettingsKey(name); !bytes.Equal(raw, escaped) {
+			if err := add(raw, escaped); err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+		}
+	}
+
+	// The escaped key of one user may be the unescaped key of another one, so nothing is stored before all keys are removed.
+	// Values are moved as they are, which keeps the references of deduplicated blobs intact.
+	for _, m := range moves {
+		if err := txn.Delete(m.item.KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range moves {
+		if err := txn.SetEntry(withRemainingTTL(badger.NewEntry(m.to, m.value).WithMeta(m.item.UserMeta()), m.item)); err != nil {
+			return err
+		}
+	}
+
+	return escapeGrantsTxn(txn, users)
+}
+
+// escapeGrantsTxn rewrites all grants with escaped names and keys, see buildAclKey. Names and keys may both contain
+// separators, so owner and grantee are matched against users, longest names first. Grants of users which don't exist
+// anymore are split at the first and last separator.
+func escapeGrantsTxn(txn *badger.Txn, users []string) error {
+	type grant struct {
+		owner, key, grantee string
+		permission          []byte
+	}
+
+	var grants []grant
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	prefix := []byte(dbAclPrefix + dbKeySeparator)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		rest := string(it.Item().Key()[len(prefix):])
+
+		owner, _, found := strings.Cut(rest, dbKeySeparator)
+		if index := slices.IndexFunc(users, func(name string) bool { return strings.HasPrefix(rest, name+dbKeySeparator) }); index != -1 {
+			owner = users[index]
+		} else if !found {
+			continue
+		}
+
+		rest = rest[len(owner)+1:]
+		grantee := rest[strings.LastIndex(rest, dbKeySeparator)+1:]
+		if index := slices.IndexFunc(users, func(name string) bool { return strings.HasSuffix(rest, dbKeySeparator+name) }); index != -1 {
+			grantee = users[index]
+		} else if grantee == rest {
+			continue
+		}
+
+		if value, err := it.Item().ValueCopy(nil); err != nil {
+			it.Close()
+			return err
+		} else {
+			grants = append(grants, grant{owner: owner, key: rest[:len(rest)-len(grantee)-1], grantee: grantee, permission: value})
+		}
+	}
+
+	it.Close()
+
+	for _, key := range append(collectKeysTxn(txn, prefix), collectKeysTxn(txn, []byte(dbSharedPrefix+dbKeySeparator))...) {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range grants {
+		if err := txn.Set(buildAclKey(g.owner, g.key, g.grantee), g.permission); err != nil {
+			return err
+		} else if err := txn.Set(buildSharedKey(g.grantee, g.owner, g.key), g.permission); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectNamesTxn returns the names of all users or teams stored under prefix, longest first so keys of user "a/b/c"
+// aren't claimed by user "a/b".
+func collectNamesTxn(txn *badger.Txn, prefix []byte) []string {
+	names := make([]string, 0)
+	for _, key := range collectKeysTxn(txn, prefix) {
+		names = append(names, string(key[len(prefix):]))
+	}
+
+	slices.SortFunc(names, func(a, b string) int { return len(b) - len(a) })
+	return names
+}
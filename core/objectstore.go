@@ -0,0 +1,245 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// objectStore is a minimal client for S3-compatible object storage, it only supports what backups need.
+// Objects are addressed path-style (endpoint/bucket/key), which works with AWS as well as MinIO and friends. The endpoint
+// may include a path, e.g. for storage behind a reverse proxy, which is signed along with the bucket and key.
+type objectStore struct {
+	endpoint     string
+	pathPrefix   string
+	region       string
+	bucket       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	now          func() time.Time
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func newObjectStore(config *AppConfig) *objectStore {
+	endpoint := strings.TrimSuffix(config.BackupS3Endpoint, "/")
+	pathPrefix := ""
+	if parsed, err := url.Parse(endpoint); err == nil {
+		pathPrefix = parsed.EscapedPath()
+	}
+
+	return &objectStore{
+		endpoint:     endpoint,
+		pathPrefix:   pathPrefix,
+		region:       config.BackupS3Region,
+		bucket:       config.BackupS3Bucket,
+		accessKey:    config.BackupS3AccessKey,
+		secretKey:    config.BackupS3SecretKey,
+		sessionToken: config.BackupS3SessionToken,
+		client:       &http.Client{Timeout: 30 * time.Minute},
+		now:          time.Now,
+	}
+}
+
+// putFile uploads the file to key, the file is read twice to sign its content before sending it.
+func (s *objectStore) putFile(ctx context.Context, key string, file *os.File) error {
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := s.request(ctx, http.MethodPut, key, nil, file, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = size
+	return s.do(req, nil)
+}
+
+// list returns the keys of all objects starting with prefix in lexical order.
+func (s *objectStore) list(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	token := ""
+
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if len(token) != 0 {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.request(ctx, http.MethodGet, "", query, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		if err := s.do(req, &result); err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			break
+		}
+
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// delete removes the object stored at key.
+func (s *objectStore) delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	return s.do(req, nil)
+}
+
+// do sends req and decodes the XML response into result if given, responses other than 2xx are returned as error.
+func (s *objectStore) do(req *http.Request, result any) error {
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("object storage responded with %s: %s", res.Status, strings.TrimSpace(string(body)))
+	} else if result != nil {
+		return xml.NewDecoder(res.Body).Decode(result)
+	}
+
+	return nil
+}
+
+// request creates a request for the object key (or the bucket if key is empty) signed with AWS Signature Version 4.
+func (s *objectStore) request(ctx context.Context, method, key string, query url.Values, body io.Reader, payloadHash string) (*http.Request, error) {
+	path := "/" + awsEscape(s.bucket, false)
+	if len(key) != 0 {
+		path += "/" + awsEscape(key, true)
+	}
+
+	canonicalQuery := canonicalAwsQuery(query)
+	rawUrl := s.endpoint + path
+	if len(canonicalQuery) != 0 {
+		rawUrl += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawUrl, body)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", now.Format("20060102T150405Z"))
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if len(s.sessionToken) != 0 {
+		req.Header.Set("x-amz-security-token", s.sessionToken)
+		signed = append(signed, "x-amz-security-token")
+	}
+
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	signedHeaders := strings.Join(signed, ";")
+	canonicalRequest := strings.Join([]string{method, s.pathPrefix + path, canonicalQuery, headers.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + req.Header.Get("x-amz-date") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSha256([]byte("AWS4"+s.secretKey), date)
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		signingKey = hmacSha256(signingKey, part)
+	}
+
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return req, nil
+}
+
+// canonicalAwsQuery encodes query sorted by name as required for signing.
+func canonicalAwsQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters and, if keepSlash is set, slashes.
+func awsEscape(value string, keepSlash bool) string {
+	var escaped strings.Builder
+
+	for _, b := range []byte(value) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			escaped.WriteByte(b)
+		case b == '/' && keepSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
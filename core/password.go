@@ -0,0 +1,165 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	ErrUnknownPasswordHash = errors.New("unknown password hash")
+	ErrPasswordReused      = errors.New("password has been used before")
+)
+
+// hashPassword hashes pwd using the algorithm configured via GENESIS_PASSWORD_HASH.
+func (app *App) hashPassword(pwd string) (string, error) {
+	if app.Config.PasswordHash == PasswordHashArgon2id {
+		return app.hashArgon2id(pwd)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(pwd), int(app.Config.BcryptCost))
+
+	if err != nil {
+		return "", err
+	} else {
+		return string(hashed), err
+	}
+}
+
+// verifyPassword checks pwd against hash, the algorithm is detected from the prefix of the hash.
+// outdated is true if the hash doesn't use the currently configured algorithm or parameters.
+func (app *App) verifyPassword(hash, pwd string) (valid bool, outdated bool, err error) {
+	if strings.HasPrefix(hash, "$"+PasswordHashArgon2id+"$") {
+		return app.verifyArgon2id(hash, pwd)
+	} else if strings.HasPrefix(hash, "$2") {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pwd)); err != nil {
+			return false, false, nil
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, err != nil || app.Config.PasswordHash != PasswordHashBcrypt || cost != int(app.Config.BcryptCost), nil
+	}
+
+	return false, false, ErrUnknownPasswordHash
+}
+
+// hashArgon2id hashes pwd in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (app *App) hashArgon2id(pwd string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(pwd), salt, app.Config.Argon2Time, app.Config.Argon2Memory, app.Config.Argon2Threads, argon2KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		PasswordHashArgon2id, argon2.Version,
+		app.Config.Argon2Memory, app.Config.Argon2Time, app.Config.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (app *App) verifyArgon2id(hash, pwd string) (bool, bool, error) {
+	var version int
+	var memory, time uint32
+	var threads uint8
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownPasswordHash
+	} else if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrUnknownPasswordHash
+	} else if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrUnknownPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrUnknownPasswordHash
+	}
+
+	computed := argon2.IDKey([]byte(pwd), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, computed) != 1 {
+		return false, false, nil
+	}
+
+	outdated := app.Config.PasswordHash != PasswordHashArgon2id ||
+		memory != app.Config.Argon2Memory ||
+		time != app.Config.Argon2Time ||
+		threads != app.Config.Argon2Threads
+
+	return true, outdated, nil
+}
+
+// checkPasswordHistory fails with ErrPasswordReused if pwd is the current password of user or one of the previous
+// ones, GENESIS_PASSWORD_HISTORY passwords are remembered including the current one. Hashes which can't be
+// verified, e.g. because they're malformed, are skipped.
+func (app *App) checkPasswordHistory(user *User, pwd string) error {
+	depth := int(app.Config.PasswordHistory)
+	if depth <= 0 {
+		return nil
+	}
+
+	hashes := append([]string{user.Password}, user.PasswordHistory...)
+	for _, hash := range hashes[:min(depth, len(hashes))] {
+		if valid, _, err := app.verifyPassword(hash, pwd); err == nil && valid {
+			return ErrPasswordReused
+		}
+	}
+
+	return nil
+}
+
+// passwordHistoryAfterChange returns the previous passwords of user once its current one is replaced, older ones
+// beyond GENESIS_PASSWORD_HISTORY are dropped.
+func (app *App) passwordHistoryAfterChange(user *User) []string {
+	depth := int(app.Config.PasswordHistory)
+	if depth <= 1 {
+		return nil
+	}
+
+	history := append([]string{user.Password}, user.PasswordHistory...)
+	return history[:min(depth-1, len(history))]
+}
+
+// rehashPassword replaces the hash of the password of name with one using the configured algorithm. Nothing is
+// changed if the password has been changed since it was verified against previous, its history is kept as it is.
+func (app *App) rehashPassword(name, previous, pwd string) error {
+	hash, err := app.hashPassword(pwd)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		user, err := getUserTxn(txn, name)
+		if err != nil {
+			return err
+		} else if user == nil || user.Password != previous {
+			return nil
+		}
+
+		user.Password = hash
+		return setUserTxn(txn, user)
+	})
+}
@@ -0,0 +1,374 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch    = errors.New("invalid patch")
+	ErrPatchTestFailed = errors.New("patch test failed")
+)
+
+// ApplyJSONPatch applies a JSON patch as defined by RFC 6902 to document and returns the result.
+// Operations are applied in order and either all or none of them take effect. A failing test operation results in
+// ErrPatchTestFailed, any other problem with the patch, such as a path which doesn't exist, in ErrInvalidPatch.
+// Numbers are kept as they are, but object keys are sorted in the result.
+func ApplyJSONPatch(document []byte, patch []byte) ([]byte, error) {
+	var operations []map[string]json.RawMessage
+	if err := decodeSingleJson(patch, &operations); err != nil || operations == nil {
+		return nil, fmt.Errorf("%w: must be an array of operations", ErrInvalidPatch)
+	}
+
+	var value interface{}
+	if err := decodeSingleJson(document, &value); err != nil {
+		return nil, err
+	}
+
+	for index, operation := range operations {
+		var err error
+		if value, err = applyPatchOperation(value, operation); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", index, err)
+		}
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+func applyPatchOperation(document interface{}, operation map[string]json.RawMessage) (interface{}, error) {
+	var op string
+	if raw, ok := operation["op"]; !ok || json.Unmarshal(raw, &op) != nil {
+		return nil, fmt.Errorf("%w: missing op", ErrInvalidPatch)
+	}
+
+	path, err := patchPointer(operation, "path")
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "add":
+		if value, err := patchValue(operation); err != nil {
+			return nil, err
+		} else {
+			return addPointer(document, path, value)
+		}
+	case "remove":
+		document, _, err = removePointer(document, path)
+		return document, err
+	case "replace":
+		if value, err := patchValue(operation); err != nil {
+			return nil, err
+		} else if len(path) == 0 {
+			return value, nil
+		} else if document, _, err = removePointer(document, path); err != nil {
+			return nil, err
+		} else {
+			return addPointer(document, path, value)
+		}
+	case "move":
+		from, err := patchPointer(operation, "from")
+		if err != nil {
+			return nil, err
+		} else if len(from) < len(path) && isPointerPrefix(from, path) {
+			return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+		}
+
+		document, value, err := removePointer(document, from)
+		if err != nil {
+			return nil, err
+		}
+
+		return addPointer(document, path, value)
+	case "copy":
+		if from, err := patchPointer(operation, "from"); err != nil {
+			return nil, err
+		} else if value, err := getPointer(document, from); err != nil {
+			return nil, err
+		} else {
+			return addPointer(document, path, copyJsonValue(value))
+		}
+	case "test":
+		if value, err := patchValue(operation); err != nil {
+			return nil, err
+		} else if current, err := getPointer(document, path); err != nil || !jsonEqual(current, value) {
+			return nil, fmt.Errorf("%w: value at %s differs", ErrPatchTestFailed, operation["path"])
+		}
+
+		return document, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op)
+	}
+}
+
+// patchPointer parses the JSON pointer (RFC 6901) stored under field into its unescaped reference tokens.
+func patchPointer(operation map[string]json.RawMessage, field string) ([]string, error) {
+	var pointer string
+	if raw, ok := operation[field]; !ok || json.Unmarshal(raw, &pointer) != nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidPatch, field)
+	} else if len(pointer) == 0 {
+		return []string{}, nil
+	} else if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w: %s must start with a slash", ErrInvalidPatch, field)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		if strings.Contains(strings.NewReplacer("~0", "", "~1", "").Replace(token), "~") {
+			return nil, fmt.Errorf("%w: invalid escape sequence in %s", ErrInvalidPatch, field)
+		}
+
+		tokens[index] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func patchValue(operation map[string]json.RawMessage) (interface{}, error) {
+	var value interface{}
+	if raw, ok := operation["value"]; !ok {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+	} else if err := decodeSingleJson(raw, &value); err != nil {
+		return nil, fmt.Errorf("%w: invalid value", ErrInvalidPatch)
+	}
+
+	return value, nil
+}
+
+func isPointerPrefix(prefix, path []string) bool {
+	for index := range prefix {
+		if prefix[index] != path[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getPointer returns the value path refers to.
+func getPointer(document interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := document.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+			}
+
+			document = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			document = node[index]
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse into %q", ErrInvalidPatch, token)
+		}
+	}
+
+	return document, nil
+}
+
+// addPointer adds value at path, replacing object members and inserting into arrays.
+func addPointer(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return updateParent(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			index := len(node)
+			if token != "-" {
+				var err error
+				if index, err = arrayIndex(token, len(node)); err != nil {
+					return nil, err
+				}
+			}
+
+			return append(node[:index], append([]interface{}{value}, node[index:]...)...), nil
+		default:
+			return nil, fmt.Errorf("%w: cannot add %q to a scalar value", ErrInvalidPatch, token)
+		}
+	})
+}
+
+// removePointer removes the value at path, which must exist, and returns it along with the updated document.
+func removePointer(document interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	var removed interface{}
+	document, err := updateParent(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, token)
+			}
+
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+
+			removed = node[index]
+			return append(node[:index], node[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: cannot remove %q from a scalar value", ErrInvalidPatch, token)
+		}
+	})
+
+	return document, removed, err
+}
+
+// updateParent replaces the container holding the last token of path with the result of fn.
+func updateParent(document interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(document, path[0])
+	}
+
+	switch node := document.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: member %q not found", ErrInvalidPatch, path[0])
+		}
+
+		updated, err := updateParent(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		node[path[0]] = updated
+		return node, nil
+	case []interface{}:
+		index, err := arrayIndex(path[0], len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+
+		updated, err := updateParent(node[index], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		node[index] = updated
+		return node, nil
+	default:
+		return nil, fmt.Errorf("%w: cannot traverse into %q", ErrInvalidPatch, path[0])
+	}
+}
+
+// arrayIndex parses token as array index between 0 and upper, leading zeros aren't allowed.
+func arrayIndex(token string, upper int) (int, error) {
+	index, err := strconv.Atoi(token)
+
+	if err != nil || index < 0 || index > upper || strconv.Itoa(index) != token {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+
+	return index, nil
+}
+
+func copyJsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			copied[key] = copyJsonValue(item)
+		}
+
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for index, item := range value {
+			copied[index] = copyJsonValue(item)
+		}
+
+		return copied
+	default:
+		return value
+	}
+}
+
+// jsonEqual compares two values as described for the test operation, numbers are equal if their values are.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for key, item := range a {
+			if other, ok := b[key]; !ok || !jsonEqual(item, other) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for index := range a {
+			if !jsonEqual(a[index], b[index]) {
+				return false
+			}
+		}
+
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+
+		x, okX := new(big.Rat).SetString(a.String())
+		y, okY := new(big.Rat).SetString(b.String())
+		return okX && okY && x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+// decodeSingleJson decodes data, which must consist of exactly one JSON value, keeping numbers as they are.
+func decodeSingleJson(data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(value); err != nil {
+		return err
+	} else if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after json value")
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the amount of attempts per key within a fixed window.
+type RateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	nextSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int64
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{windows: make(map[string]*rateWindow)}
+}
+
+// RateLimit describes the window of a key after an attempt has been recorded for it.
+type RateLimit struct {
+	Allowed bool
+	Limit   int64
+	// Attempts counted within the current window, rejected ones aren't counted
+	Current int64
+	ResetAt time.Time
+}
+
+// Allow records an attempt for key made at now and reports whether it's within limit attempts per window along with the
+// state of the window. A non-positive limit disables limiting, in which case only Allowed is set.
+func (r *RateLimiter) Allow(key string, limit int64, window time.Duration, now time.Time) RateLimit {
+	if limit <= 0 || window <= 0 {
+		return RateLimit{Allowed: true}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now, window)
+
+	current, ok := r.windows[key]
+	if !ok || now.Sub(current.start) >= window {
+		current = &rateWindow{start: now}
+		r.windows[key] = current
+	}
+
+	result := RateLimit{Limit: limit, ResetAt: current.start.Add(window)}
+	if current.count < limit {
+		current.count++
+		result.Allowed = true
+	}
+
+	result.Current = current.count
+	return result
+}
+
+// Reset forgets all recorded attempts.
+func (r *RateLimiter) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.windows = make(map[string]*rateWindow)
+}
+
+// sweep removes expired windows once per window to keep memory bounded.
+func (r *RateLimiter) sweep(now time.Time, window time.Duration) {
+	if now.Before(r.nextSweep) {
+		return
+	}
+
+	for key, current := range r.windows {
+		if now.Sub(current.start) >= window {
+			delete(r.windows, key)
+		}
+	}
+
+	r.nextSweep = now.Add(window)
+}
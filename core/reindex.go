@@ -0,0 +1,137 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+)
+
+// reindexProgressInterval is the amount of users after which the progress of Reindex is logged
+const reindexProgressInterval = 100
+
+var ErrReindexRunning = errors.New("reindex already running")
+
+// ReindexResult describes a finished reindex
+// @Description Duration of the reindex in milliseconds and the amount of users, keys and index entries afterward
+type ReindexResult struct {
+	DurationMs int64 `json:"durationMs" example:"1200"`
+	Users      int   `json:"users" example:"12"`
+	Keys       int64 `json:"keys" example:"340"`
+	Labels     int   `json:"labels" example:"85"`
+	Indexed    int   `json:"indexed" example:"120"`
+}
+
+// Reindex rebuilds everything derived from the stored data: the label index, the indexes declared in
+// GENESIS_DATA_INDEXES and the amount of keys across all users. Each user is rebuilt within a separate transaction,
+// which conflicts with concurrent writes and is retried, so it's safe to run while serving requests and running it
+// again doesn't change anything. Only one reindex runs at a time, ErrReindexRunning is returned while another one is
+// in progress.
+func (app *App) Reindex() (*ReindexResult, error) {
+	if !app.reindexing.CompareAndSwap(false, true) {
+		return nil, ErrReindexRunning
+	}
+
+	defer app.reindexing.Store(false)
+
+	var users []*User
+	if err := app.db.View(func(txn *badger.Txn) (err error) {
+		users, err = getAllUsersTxn(txn)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result := &ReindexResult{Users: len(users)}
+
+	for i, user := range users {
+		var labels, indexed int
+
+		if err := app.updateWithRetry(func(txn *badger.Txn) (err error) {
+			if labels, err = rebuildUserLabelsTxn(txn, user.Name); err != nil {
+				return err
+			}
+
+			indexed, err = app.rebuildUserIndexTxn(txn, user.Name)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+
+		result.Labels += labels
+		result.Indexed += indexed
+
+		if (i+1)%reindexProgressInterval == 0 {
+			app.Logger.Info("reindexing", zap.Int("users", i+1), zap.Int("total", len(users)))
+		}
+	}
+
+	if err := app.updateWithRetry(func(txn *badger.Txn) error {
+		if err := countDataKeysTxn(txn); err != nil {
+			return err
+		} else if count, err := getKeyCountTxn(txn); err != nil {
+			return err
+		} else {
+			result.Keys = int64(count)
+		}
+
+		return txn.Set(buildSystemKey(dbIndexesKey), []byte(indexDefinition(app.Config.DataIndexes)))
+	}); err != nil {
+		return nil, err
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	app.Logger.Info("reindexed", zap.Int("users", result.Users), zap.Int64("keys", result.Keys), zap.Int64("durationMs", result.DurationMs))
+	return result, nil
+}
+
+// rebuildUserLabelsTxn replaces the label index of a user with the labels kept in the metadata of each of its keys and
+// returns the amount of entries.
+func rebuildUserLabelsTxn(txn *badger.Txn, name string) (int, error) {
+	for _, entry := range collectKeysTxn(txn, buildLabelPrefix(name, "")) {
+		if err := txn.Delete(entry); err != nil {
+			return 0, err
+		}
+	}
+
+	prefix := buildMetaKey(name, "")
+	labels := make(map[string]Labels)
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var stored storedMeta
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &stored)
+		}); err != nil {
+			it.Close()
+			return 0, err
+		}
+
+		labels[string(it.Item().Key()[len(prefix):])] = stored.Labels
+	}
+
+	it.Close()
+	count := 0
+
+	for key, values := range labels {
+		if _, err := txn.Get(dataKey(name, key)); errors.Is(err, badger.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		for label, value := range values {
+			if err := txn.Set(buildLabelKey(name, label, value, key), []byte{}); err != nil {
+				return 0, err
+			}
+
+			count++
+		}
+	}
+
+	return count, nil
+}
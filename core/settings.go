@@ -0,0 +1,96 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var ErrInvalidSettings = errors.New("invalid settings")
+
+// GetSettings returns the settings document of a user, which is an empty object if none has been stored yet.
+func (app *App) GetSettings(name string) ([]byte, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return getSettingsTxn(txn, name)
+}
+
+func getSettingsTxn(txn *badger.Txn, name string) ([]byte, error) {
+	item, err := txn.Get(buildSettingsKey(name))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return []byte("{}"), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+// SetSettings validates and stores the settings document of a user.
+func (app *App) SetSettings(name string, data []byte) error {
+	return app.SetSettingsIfMatch(name, data, "")
+}
+
+// SetSettingsIfMatch validates and stores the settings document of a user only if the current one matches etag,
+// see matchETagTxn. Settings which haven't been stored yet match the ETag of the empty object they're served as.
+func (app *App) SetSettingsIfMatch(name string, data []byte, etag string) error {
+	if err := app.ValidateSettings(data); err != nil {
+		return err
+	}
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if current, err := getSettingsTxn(txn, name); err != nil {
+			return err
+		} else if err := matchETag(current, etag); err != nil {
+			return err
+		}
+
+		return txn.Set(buildSettingsKey(name), data)
+	})
+}
+
+// ValidateSettings checks that data is a JSON object encoded as UTF-8 and, if a schema is configured,
+// that it only contains fields defined by the schema with the declared types.
+func (app *App) ValidateSettings(data []byte) error {
+	var fields map[string]json.RawMessage
+
+	// The decoder silently replaces invalid UTF-8, which would be stored as it is
+	if !utf8.Valid(data) {
+		return fmt.Errorf("%w: settings must be valid UTF-8", ErrInvalidSettings)
+	} else if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return fmt.Errorf("%w: settings must be a json object", ErrInvalidSettings)
+	} else if app.Config.SettingsSchema == nil {
+		return nil
+	}
+
+	for field, value := range fields {
+		if expected, ok := app.Config.SettingsSchema[field]; !ok {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidSettings, field)
+		} else if actual := jsonType(value); actual != expected {
+			return fmt.Errorf("%w: field %q must be of type %s", ErrInvalidSettings, field, expected)
+		}
+	}
+
+	return nil
+}
+
+func jsonType(value json.RawMessage) string {
+	switch value[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,310 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	ErrTeamAlreadyExists = errors.New("a team with this name already exists")
+	ErrTeamNotFound      = errors.New("team not found")
+)
+
+// Team represents a group of users sharing a data namespace
+// @Description Team whose members share data stored under /teams/{team}/data
+type Team struct {
+	Name      string    `json:"name" example:"family"`
+	Members   []string  `json:"members" example:"alice,bob"`
+	CreatedBy string    `json:"createdBy" example:"admin"`
+	CreatedAt time.Time `json:"createdAt" example:"2025-01-01T00:00:00Z"`
+}
+
+// CreateTeam creates a team without any members, returns ErrTeamAlreadyExists if the name is taken.
+func (app *App) CreateTeam(name, createdBy string) (*Team, error) {
+	team := &Team{
+		Name:      name,
+		Members:   make([]string, 0),
+		CreatedBy: createdBy,
+		CreatedAt: app.Now().UTC(),
+	}
+
+	return team, app.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(buildTeamKey(name)); err == nil {
+			return ErrTeamAlreadyExists
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		return setTeamTxn(txn, team)
+	})
+}
+
+// GetTeam returns the team with the given name, ErrTeamNotFound if it doesn't exist.
+func (app *App) GetTeam(name string) (*Team, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return getTeamTxn(txn, name)
+}
+
+// GetTeams lists all teams ordered by name.
+func (app *App) GetTeams() ([]*Team, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildTeamKey("")
+	teams := make([]*Team, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var team Team
+
+		if data, err := it.Item().ValueCopy(nil); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(data, &team); err != nil {
+			return nil, fmt.Errorf("failed to parse team: %w", err)
+		}
+
+		teams = append(teams, &team)
+	}
+
+	return teams, nil
+}
+
+// DeleteTeam removes a team along with all of its data.
+func (app *App) DeleteTeam(name string) error {
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if _, err := getTeamTxn(txn, name); err != nil {
+			return err
+		}
+
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		prefix := buildTeamDataKey(name, "")
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if err := app.deleteValueTxn(txn, it.Item().KeyCopy(nil)); err != nil {
+				it.Close()
+				return err
+			}
+		}
+
+		it.Close()
+		return txn.Delete(buildTeamKey(name))
+	})
+}
+
+// AddTeamMember adds an existing user to a team, adding a member twice has no effect.
+// Returns ErrTeamNotFound or ErrUserNotFound if either of them doesn't exist.
+func (app *App) AddTeamMember(team, user string) (*Team, error) {
+	return app.updateTeam(team, func(txn *badger.Txn, t *Team) error {
+		if existing, err := getUserTxn(txn, user); err != nil {
+			return err
+		} else if existing == nil {
+			return ErrUserNotFound
+		} else if !slices.Contains(t.Members, user) {
+			t.Members = append(t.Members, user)
+			slices.Sort(t.Members)
+		}
+
+		return nil
+	})
+}
+
+// RemoveTeamMember removes a user from a team, removing a user who isn't a member has no effect.
+func (app *App) RemoveTeamMember(team, user string) (*Team, error) {
+	return app.updateTeam(team, func(txn *badger.Txn, t *Team) error {
+		t.Members = slices.DeleteFunc(t.Members, func(member string) bool {
+			return member == user
+		})
+
+		return nil
+	})
+}
+
+// IsTeamMember checks if user is a member of team, teams which don't exist have no members.
+func (app *App) IsTeamMember(team, user string) (bool, error) {
+	if t, err := app.GetTeam(team); errors.Is(err, ErrTeamNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	} else {
+		return slices.Contains(t.Members, user), nil
+	}
+}
+
+func (app *App) updateTeam(name string, fn func(txn *badger.Txn, team *Team) error) (*Team, error) {
+	var team *Team
+
+	err := app.updateWithRetry(func(txn *badger.Txn) error {
+		var err error
+		if team, err = getTeamTxn(txn, name); err != nil {
+			return err
+		} else if err := fn(txn, team); err != nil {
+			return err
+		}
+
+		return setTeamTxn(txn, team)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return team, nil
+}
+
+// removeFromTeamsTxn removes user from all teams, so a new user with the same name doesn't inherit memberships.
+func removeFromTeamsTxn(txn *badger.Txn, user string) error {
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildTeamKey("")
+	teams := make([]*Team, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var team Team
+
+		if data, err := it.Item().ValueCopy(nil); err != nil {
+			return err
+		} else if err := json.Unmarshal(data, &team); err != nil {
+			return fmt.Errorf("failed to parse team: %w", err)
+		} else if slices.Contains(team.Members, user) {
+			teams = append(teams, &team)
+		}
+	}
+
+	for _, team := range teams {
+		team.Members = slices.DeleteFunc(team.Members, func(member string) bool {
+			return member == user
+		})
+
+		if err := setTeamTxn(txn, team); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getTeamTxn(txn *badger.Txn, name string) (*Team, error) {
+	var team Team
+
+	if item, err := txn.Get(buildTeamKey(name)); errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrTeamNotFound
+	} else if err != nil {
+		return nil, err
+	} else if data, err := item.ValueCopy(nil); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &team); err != nil {
+		return nil, fmt.Errorf("failed to parse team: %w", err)
+	}
+
+	return &team, nil
+}
+
+func setTeamTxn(txn *badger.Txn, team *Team) error {
+	data, err := json.Marshal(team)
+	if err != nil {
+		return fmt.Errorf("failed to create team data: %w", err)
+	}
+
+	return txn.Set(buildTeamKey(team.Name), data)
+}
+
+// SetDataForTeam stores data under key in the namespace of a team.
+func (app *App) SetDataForTeam(team, key string, data []byte) error {
+	defer app.lockTeamData(team, key)()
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		return app.setValueTxn(txn, buildTeamDataKey(team, key), data)
+	})
+}
+
+// GetDataFromTeam returns the value of key in the namespace of a team, badger.ErrKeyNotFound if there is none.
+func (app *App) GetDataFromTeam(team, key string) ([]byte, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(buildTeamDataKey(team, key))
+	if err != nil {
+		return nil, err
+	}
+
+	return readValue(txn, item)
+}
+
+// GetAllDataFromTeam returns all keys of a team as a single JSON object.
+func (app *App) GetAllDataFromTeam(team string) ([]byte, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildTeamDataKey(team, "")
+	data := make([]string, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+
+		if v, err := readValue(txn, item); err != nil {
+			return nil, err
+		} else if rawKey, err := json.Marshal(string(item.Key()[len(prefix):])); err != nil {
+			return nil, err
+		} else {
+			data = append(data, string(rawKey)+":"+string(v))
+		}
+	}
+
+	return []byte("{" + strings.Join(data, ",") + "}"), nil
+}
+
+// DeleteDataFromTeamIfMatch deletes key of a team only if its current value matches etag, see matchETagTxn.
+func (app *App) DeleteDataFromTeamIfMatch(team, key string, etag string) error {
+	defer app.lockTeamData(team, key)()
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if err := matchETagTxn(txn, buildTeamDataKey(team, key), etag); err != nil {
+			return err
+		}
+
+		return app.deleteValueTxn(txn, buildTeamDataKey(team, key))
+	})
+}
+
+// GetDataCountForTeam returns the amount of keys of a team as if includedKey were stored as well.
+func (app *App) GetDataCountForTeam(team, includedKey string) int64 {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	prefix := buildTeamDataKey(team, "")
+	fullIncludedKey := string(buildTeamDataKey(team, includedKey))
+	count := int64(1)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if string(it.Item().Key()) != fullIncludedKey {
+			count++
+		}
+	}
+
+	return count
+}
+
+// lockTeamData locks key of a team, team names may equal user names so they use a separate lock namespace.
+func (app *App) lockTeamData(team, key string) func() {
+	return app.locks.Lock(dbTeamDataPrefix + "\x00" + team + "\x00" + key)
+}
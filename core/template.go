@@ -0,0 +1,89 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var ErrInvalidUserTemplate = errors.New("invalid user template")
+
+// UserTemplate is the data every new user starts with, see GENESIS_USER_TEMPLATE.
+type UserTemplate struct {
+	Settings json.RawMessage            `json:"settings"`
+	Data     map[string]json.RawMessage `json:"data"`
+}
+
+// ValidateUserTemplate checks the configured template against the settings schema and the limits for keys, which
+// has to be done once on start so creating users can't fail because of it. Template keys count towards the keys
+// per user, a template with more keys than allowed is rejected.
+func (app *App) ValidateUserTemplate() error {
+	template := app.Config.UserTemplate
+	if template == nil {
+		return nil
+	}
+
+	if len(template.Settings) != 0 {
+		if err := app.ValidateSettings(template.Settings); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidUserTemplate, err)
+		}
+	}
+
+	if app.Config.AppKeysPerUser > 0 && int64(len(template.Data)) > app.Config.AppKeysPerUser {
+		return fmt.Errorf("%w: %d keys exceed the limit of %d keys per user", ErrInvalidUserTemplate, len(template.Data), app.Config.AppKeysPerUser)
+	}
+
+	for key, value := range template.Data {
+		if !app.Config.AppKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: key %q must match %s", ErrInvalidUserTemplate, key, app.Config.AppKeyPattern.String())
+		} else if slices.Contains(ReservedKeys, key) {
+			return fmt.Errorf("%w: key %q is reserved", ErrInvalidUserTemplate, key)
+		} else if app.Config.AppKeyMaxLength > 0 && int64(len(key)) > app.Config.AppKeyMaxLength {
+			return fmt.Errorf("%w: key %q is longer than %d bytes", ErrInvalidUserTemplate, key, app.Config.AppKeyMaxLength)
+		} else if app.Config.AppDataMaxSize > 0 && int64(len(value)) > app.Config.AppDataMaxSize {
+			return fmt.Errorf("%w: value of key %q is larger than %d bytes", ErrInvalidUserTemplate, key, app.Config.AppDataMaxSize)
+		}
+	}
+
+	return nil
+}
+
+// seedUserTxn stores the settings and keys of the configured template for the new user name.
+func (app *App) seedUserTxn(txn *badger.Txn, name string) error {
+	template := app.Config.UserTemplate
+	if template == nil {
+		return nil
+	}
+
+	if len(template.Settings) != 0 {
+		if err := txn.Set(buildSettingsKey(name), compactJson(template.Settings)); err != nil {
+			return err
+		}
+	}
+
+	for key, value := range template.Data {
+		if err := app.setValueTxn(txn, dataKey(name, key), compactJson(value)); err != nil {
+			return err
+		} else if err := app.indexDataTxn(txn, name, key, value); err != nil {
+			return err
+		} else if err := app.markUpdatedTxn(txn, name, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compactJson removes insignificant whitespace from data, which has been validated while parsing the template.
+func compactJson(data json.RawMessage) []byte {
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, data); err != nil {
+		return data
+	}
+
+	return buffer.Bytes()
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// InvalidatedToken represents the ID of a token invalidated by logging out
+// @Description Invalidated token and the remaining time in seconds until it's removed
+type InvalidatedToken struct {
+	ID        string    `json:"id" example:"3f1c2a9e-5d4b-4c8e-9a7f-1b2c3d4e5f60"`
+	ExpiresAt time.Time `json:"expiresAt" example:"2025-01-01T00:00:00Z"`
+	TTL       int64     `json:"ttl" example:"3600"`
+}
+
+// GetInvalidatedTokens lists all invalidated tokens which haven't expired yet, sorted by expiry.
+func (app *App) GetInvalidatedTokens() ([]*InvalidatedToken, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	prefix := buildExpiredKey("")
+	tokens := make([]*InvalidatedToken, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		expiresAt := time.Unix(int64(item.ExpiresAt()), 0).UTC()
+
+		tokens = append(tokens, &InvalidatedToken{
+			ID:        string(item.Key()[len(prefix):]),
+			ExpiresAt: expiresAt,
+			TTL:       int64(time.Until(expiresAt).Seconds()),
+		})
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ExpiresAt.Before(tokens[j].ExpiresAt)
+	})
+
+	return tokens, nil
+}
+
+// SweepInvalidatedTokens is a safety net for the invalidated tokens, which are expected to expire along with the token.
+// Entries stored without an expiry get the maximum lifetime of a token so they can't accumulate forever, entries past
+// their expiry are deleted right away instead of waiting for badger to drop them. Returns the number of swept entries.
+func (app *App) SweepInvalidatedTokens() (int, error) {
+	var expired, unbounded [][]byte
+	now := uint64(time.Now().Unix())
+
+	err := app.db.View(func(txn *badger.Txn) error {
+		options := badger.DefaultIteratorOptions
+		options.PrefetchValues = false
+		options.AllVersions = true
+
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		var previous []byte
+		prefix := buildExpiredKey("")
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			// Versions are ordered from newest to oldest, only the newest one is relevant
+			if bytes.Equal(item.Key(), previous) {
+				continue
+			}
+
+			previous = item.KeyCopy(nil)
+			if item.ExpiresAt() != 0 && item.ExpiresAt() <= now {
+				expired = append(expired, previous)
+			} else if item.ExpiresAt() == 0 && !item.IsDeletedOrExpired() {
+				unbounded = append(unbounded, previous)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	} else if len(expired) == 0 && len(unbounded) == 0 {
+		return 0, nil
+	}
+
+	err = app.updateWithRetry(func(txn *badger.Txn) error {
+		for _, key := range expired {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range unbounded {
+			if err := txn.SetEntry(badger.NewEntry(key, []byte{}).WithTTL(app.maxTokenLifetime())); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(expired) + len(unbounded), nil
+}
+
+// maxTokenLifetime returns the longest time a token issued by this app can be valid for, including the leeway.
+func (app *App) maxTokenLifetime() time.Duration {
+	return max(app.Config.JWTExpiration, app.Config.ImpersonationExpiration) + app.Config.JWTLeeway
+}
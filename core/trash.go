@@ -0,0 +1,129 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	ErrTrashEntryNotFound = errors.New("key not found in trash")
+	ErrDataAlreadyExists  = errors.New("key already exists")
+)
+
+// TrashEntry represents a deleted key which can still be restored
+// @Description Deleted key which can be restored until it expires
+type TrashEntry struct {
+	Key       string    `json:"key" example:"settings"`
+	ExpiresAt time.Time `json:"expiresAt" example:"2025-01-01T00:00:00Z"`
+}
+
+// TrashDataFromUser moves the value stored for key into the trash, where it's kept for Config.TrashTTL.
+// Trashing a key that doesn't exist is a no-op.
+func (app *App) TrashDataFromUser(name string, key string) error {
+	return app.TrashDataFromUserIfMatch(name, key, "")
+}
+
+// TrashDataFromUserIfMatch trashes key only if its current value matches etag, see matchETagTxn.
+func (app *App) TrashDataFromUserIfMatch(name string, key string, etag string) error {
+	defer app.lockData(name, key)()
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if err := matchETagTxn(txn, dataKey(name, key), etag); err != nil {
+			return err
+		}
+
+		item, err := txn.Get(dataKey(name, key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := app.moveValueTxn(txn, item, buildTrashKey(name, key), app.Config.TrashTTL); err != nil {
+			return err
+		}
+
+		return deleteMetaTxn(txn, name, key)
+	})
+}
+
+// PurgeDataFromUser removes key from both the data of a user and the trash.
+func (app *App) PurgeDataFromUser(name string, key string) error {
+	return app.PurgeDataFromUserIfMatch(name, key, "")
+}
+
+// PurgeDataFromUserIfMatch purges key only if its current value matches etag, see matchETagTxn.
+func (app *App) PurgeDataFromUserIfMatch(name string, key string, etag string) error {
+	defer app.lockData(name, key)()
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		if err := matchETagTxn(txn, dataKey(name, key), etag); err != nil {
+			return err
+		} else if err := app.deleteValueTxn(txn, dataKey(name, key)); err != nil {
+			return err
+		} else if err := deleteMetaTxn(txn, name, key); err != nil {
+			return err
+		}
+
+		return app.deleteValueTxn(txn, buildTrashKey(name, key))
+	})
+}
+
+// RestoreDataFromTrash moves a trashed key back, it fails if the key has been stored again in the meantime.
+func (app *App) RestoreDataFromTrash(name string, key string) error {
+	defer app.lockData(name, key)()
+
+	return app.updateWithRetry(func(txn *badger.Txn) error {
+		item, err := txn.Get(buildTrashKey(name, key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrTrashEntryNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := txn.Get(dataKey(name, key)); err == nil {
+			return ErrDataAlreadyExists
+		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		} else if err := app.checkKeyCountTxn(txn, dataKey(name, key)); err != nil {
+			return err
+		}
+
+		value, err := readValue(txn, item)
+		if err != nil {
+			return err
+		} else if err := app.moveValueTxn(txn, item, dataKey(name, key), 0); err != nil {
+			return err
+		}
+
+		return app.indexDataTxn(txn, name, key, value)
+	})
+}
+
+// GetTrashFromUser lists all trashed keys of a user.
+func (app *App) GetTrashFromUser(name string) ([]*TrashEntry, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	prefix := buildTrashKey(name, "")
+	entries := make([]*TrashEntry, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+
+		entries = append(entries, &TrashEntry{
+			Key:       string(item.Key()[len(prefix):]),
+			ExpiresAt: time.Unix(int64(item.ExpiresAt()), 0).UTC(),
+		})
+	}
+
+	return entries, nil
+}
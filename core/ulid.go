@@ -0,0 +1,29 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// ulidAlphabet is Crockford's base32, which leaves out letters easily confused with digits
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID, 26 characters encoding the current time in milliseconds followed by 80 random bits.
+// ULIDs sort lexicographically by the time they've been generated at.
+func newULID() string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(id[6:])
+
+	high, low := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+
+	var encoded [26]byte
+	for index := len(encoded) - 1; index >= 0; index-- {
+		encoded[index] = ulidAlphabet[low&31]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+
+	return string(encoded[:])
+}
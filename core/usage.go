@@ -0,0 +1,143 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// UserUsage represents the storage used by a single user
+// @Description Amount of keys and bytes stored by a user
+type UserUsage struct {
+	Name  string `json:"name" example:"admin"`
+	Keys  int64  `json:"keys" example:"4"`
+	Bytes int64  `json:"bytes" example:"2048"`
+}
+
+// GetStorageUsage aggregates the amount of keys and bytes stored per user in a single key-only scan.
+// The result is sorted by bytes, then by keys, in descending order.
+func (app *App) GetStorageUsage() ([]*UserUsage, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	usage := make(map[string]*UserUsage)
+
+	// Collect all users first so users without data show up as well
+	userPrefix := buildUserKey("")
+	for it.Seek(userPrefix); it.ValidForPrefix(userPrefix); it.Next() {
+		name := string(it.Item().Key()[len(userPrefix):])
+		usage[name] = &UserUsage{Name: name}
+	}
+
+	dataPrefix := []byte(dbDataPrefix + dbKeySeparator)
+	for it.Seek(dataPrefix); it.ValidForPrefix(dataPrefix); it.Next() {
+		item := it.Item()
+		name, _, ok := splitKeySegment(item.Key()[len(dataPrefix):])
+		if !ok {
+			continue
+		}
+
+		entry, ok := usage[name]
+		if !ok {
+			entry = &UserUsage{Name: name}
+			usage[name] = entry
+		}
+
+		size, err := valueSize(txn, item)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Keys++
+		entry.Bytes += size
+	}
+
+	list := make([]*UserUsage, 0, len(usage))
+	for _, entry := range usage {
+		list = append(list, entry)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Bytes != list[j].Bytes {
+			return list[i].Bytes > list[j].Bytes
+		} else if list[i].Keys != list[j].Keys {
+			return list[i].Keys > list[j].Keys
+		}
+
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
+
+// DataStats represents the amount of keys and bytes stored by a user
+// @Description Amount of keys and bytes stored by a user, grouped by the part of the key before the delimiter
+type DataStats struct {
+	Keys   int64             `json:"keys" example:"4"`
+	Bytes  int64             `json:"bytes" example:"2048"`
+	Groups []*DataGroupStats `json:"groups"`
+}
+
+// DataGroupStats represents the keys sharing a prefix
+// @Description Amount of keys and bytes stored under a prefix, which can be passed as prefix to break it down further
+type DataGroupStats struct {
+	Prefix string `json:"prefix" example:"budget:"`
+	Keys   int64  `json:"keys" example:"2"`
+	Bytes  int64  `json:"bytes" example:"1024"`
+}
+
+// GetDataStatsForUser aggregates the keys of a user starting with prefix in a single scan, grouped by the part after
+// prefix up to and including the first delimiter. Keys without another delimiter are grouped under prefix itself.
+// Values aren't read, but sizes of deduplicated values are looked up per key. Groups are sorted by their prefix.
+func (app *App) GetDataStatsForUser(name, prefix, delimiter string) (*DataStats, error) {
+	txn := app.db.NewTransaction(false)
+	defer txn.Discard()
+
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = false
+
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	stats := &DataStats{Groups: make([]*DataGroupStats, 0)}
+	groups := make(map[string]*DataGroupStats)
+	fullPrefix := dataKey(name, prefix)
+
+	for it.Seek(fullPrefix); it.ValidForPrefix(fullPrefix); it.Next() {
+		item := it.Item()
+		size, err := valueSize(txn, item)
+		if err != nil {
+			return nil, err
+		}
+
+		group := prefix
+		if before, _, found := strings.Cut(string(item.Key()[len(fullPrefix):]), delimiter); found {
+			group = prefix + before + delimiter
+		}
+
+		entry, ok := groups[group]
+		if !ok {
+			entry = &DataGroupStats{Prefix: group}
+			groups[group] = entry
+			stats.Groups = append(stats.Groups, entry)
+		}
+
+		entry.Keys++
+		entry.Bytes += size
+		stats.Keys++
+		stats.Bytes += size
+	}
+
+	sort.Slice(stats.Groups, func(i, j int) bool {
+		return stats.Groups[i].Prefix < stats.Groups[j].Prefix
+	})
+
+	return stats, nil
+}
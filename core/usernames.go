@@ -0,0 +1,294 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrUsernameCollision = errors.New("usernames collide once normalized")
+	ErrUsernameReserved  = errors.New("username is reserved")
+)
+
+// NormalizeUsername returns the canonical form of name, which is lowercase and NFC normalized if usernames are
+// case-insensitive and name itself otherwise. Names from requests and tokens must be normalized before looking them up.
+func (app *App) NormalizeUsername(name string) string {
+	if !app.Config.UsernameCaseInsensitive {
+		return name
+	}
+
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// IsUsernameReserved reports whether name is one of GENESIS_RESERVED_USERNAMES, which are compared case-insensitively
+// and unicode normalized regardless of GENESIS_USERNAME_CASE_INSENSITIVE.
+func (app *App) IsUsernameReserved(name string) bool {
+	return isReservedUsername(app.Config.ReservedUsernames, name)
+}
+
+func isReservedUsername(reserved []string, name string) bool {
+	folded := strings.ToLower(norm.NFC.String(name))
+	return slices.ContainsFunc(reserved, func(candidate string) bool {
+		return strings.ToLower(norm.NFC.String(candidate)) == folded
+	})
+}
+
+// NormalizeUsernames renames all users whose name isn't normalized yet along with everything stored for them, so they
+// can still be found once usernames are case-insensitive. Nothing is changed if two users would end up with the same
+// name, ErrUsernameCollision is returned instead and one of them has to be renamed or deleted first.
+// Does nothing unless usernames are case-insensitive, in dry-run mode pending renames are only logged.
+func (app *App) NormalizeUsernames(dryRun bool) error {
+	if !app.Config.UsernameCaseInsensitive {
+		return nil
+	}
+
+	users, err := app.GetAllUsers()
+	if err != nil {
+		return err
+	}
+
+	groups := make(map[string][]string)
+	renames := make(map[string]string)
+
+	for _, user := range users {
+		normalized := app.NormalizeUsername(user.Name)
+		groups[normalized] = append(groups[normalized], user.Name)
+
+		if normalized != user.Name {
+			renames[user.Name] = normalized
+		}
+	}
+
+	var collisions []string
+	for _, names := range groups {
+		if len(names) > 1 {
+			slices.Sort(names)
+			collisions = append(collisions, strings.Join(names, ", "))
+		}
+	}
+
+	if len(collisions) != 0 {
+		slices.Sort(collisions)
+		return fmt.Errorf("%w: %s", ErrUsernameCollision, strings.Join(collisions, "; "))
+	} else if len(renames) == 0 {
+		return nil
+	}
+
+	for old, normalized := range renames {
+		app.Logger.Info("renaming user to normalized name", zap.String("name", old), zap.String("normalized", normalized), zap.Bool("dryRun", dryRun))
+	}
+
+	if dryRun {
+		return nil
+	} else if app.Config.ReadOnly {
+		return fmt.Errorf("%w: %d usernames have to be normalized", ErrReadOnlyMigration, len(renames))
+	}
+
+	return app.db.Update(func(txn *badger.Txn) error {
+		rename := func(name string) string {
+			if normalized, ok := renames[name]; ok {
+				return normalized
+			}
+
+			return name
+		}
+
+		for old, normalized := range renames {
+			if err := app.renameUserTxn(txn, old, normalized); err != nil {
+				return err
+			}
+		}
+
+		if err := renameGrantsTxn(txn, rename); err != nil {
+			return err
+		} else if err := renameTeamMembersTxn(txn, rename); err != nil {
+			return err
+		}
+
+		return renameInviteCreatorsTxn(txn, rename)
+	})
+}
+
+// renameUserTxn moves the user old along with their data, trash, metadata and settings to name.
+func (app *App) renameUserTxn(txn *badger.Txn, old, name string) error {
+	user, err := getUserTxn(txn, old)
+	if err != nil {
+		return err
+	} else if user == nil {
+		return ErrUserNotFound
+	}
+
+	user.Name = name
+	if data, err := json.Marshal(user); err != nil {
+		return fmt.Errorf("failed to create user data: %w", err)
+	} else if err := txn.Set(buildUserKey(name), data); err != nil {
+		return err
+	} else if err := txn.Delete(buildUserKey(old)); err != nil {
+		return err
+	}
+
+	if item, err := txn.Get(buildSettingsKey(old)); err == nil {
+		if err := app.moveKeyTxn(txn, item, buildSettingsKey(name)); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+
+	for _, prefixes := range [][2][]byte{
+		{dataKey(old, ""), dataKey(name, "")},
+		{buildTrashKey(old, ""), buildTrashKey(name, "")},
+		{buildMetaKey(old, ""), buildMetaKey(name, "")},
+		{buildLabelPrefix(old, ""), buildLabelPrefix(name, "")},
+		{buildIndexPrefix(old, ""), buildIndexPrefix(name, "")},
+	} {
+		for _, key := range collectKeysTxn(txn, prefixes[0]) {
+			if item, err := txn.Get(key); err != nil {
+				return err
+			} else if err := app.moveKeyTxn(txn, item, append(slices.Clone(prefixes[1]), key[len(prefixes[0]):]...)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// renameGrantsTxn rewrites all grants whose owner or grantee is renamed.
+func renameGrantsTxn(txn *badger.Txn, rename func(name string) string) error {
+	type grant struct {
+		owner, key, grantee string
+		permission          []byte
+	}
+
+	var grants []grant
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	prefix := []byte(dbAclPrefix + dbKeySeparator)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		owner, rest, _ := splitKeySegment(it.Item().Key()[len(prefix):])
+		key, grantee, _ := splitKeySegment(rest)
+
+		if value, err := it.Item().ValueCopy(nil); err != nil {
+			it.Close()
+			return err
+		} else {
+			grants = append(grants, grant{owner: owner, key: key, grantee: unescapeKeySegment(string(grantee)), permission: value})
+		}
+	}
+
+	it.Close()
+
+	for _, g := range grants {
+		owner, grantee := rename(g.owner), rename(g.grantee)
+		if owner == g.owner && grantee == g.grantee {
+			continue
+		}
+
+		for _, key := range [][]byte{buildAclKey(g.owner, g.key, g.grantee), buildSharedKey(g.grantee, g.owner, g.key)} {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		if err := txn.Set(buildAclKey(owner, g.key, grantee), g.permission); err != nil {
+			return err
+		} else if err := txn.Set(buildSharedKey(grantee, owner, g.key), g.permission); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renameTeamMembersTxn replaces renamed members in all teams.
+func renameTeamMembersTxn(txn *badger.Txn, rename func(name string) string) error {
+	teams := make([]*Team, 0)
+	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	prefix := buildTeamKey("")
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var team Team
+
+		if data, err := it.Item().ValueCopy(nil); err != nil {
+			it.Close()
+			return err
+		} else if err := json.Unmarshal(data, &team); err != nil {
+			it.Close()
+			return fmt.Errorf("failed to parse team: %w", err)
+		}
+
+		teams = append(teams, &team)
+	}
+
+	it.Close()
+
+	for _, team := range teams {
+		for index, member := range team.Members {
+			team.Members[index] = rename(member)
+		}
+
+		slices.Sort(team.Members)
+		if err := setTeamTxn(txn, team); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renameInviteCreatorsTxn replaces renamed creators of open invites, which keep their expiry.
+func renameInviteCreatorsTxn(txn *badger.Txn, rename func(name string) string) error {
+	for _, key := range collectKeysTxn(txn, buildInviteKey("")) {
+		var invite Invite
+
+		if item, err := txn.Get(key); err != nil {
+			return err
+		} else if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &invite)
+		}); err != nil {
+			return fmt.Errorf("failed to parse invite: %w", err)
+		} else if name := rename(invite.CreatedBy); name != invite.CreatedBy {
+			invite.CreatedBy = name
+
+			if data, err := json.Marshal(invite); err != nil {
+				return fmt.Errorf("failed to create invite data: %w", err)
+			} else if err := txn.SetEntry(withRemainingTTL(badger.NewEntry(key, data), item)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// withRemainingTTL sets the expiry of entry to the one of item.
+func withRemainingTTL(entry *badger.Entry, item *badger.Item) *badger.Entry {
+	if ttl := remainingTTL(item); ttl > 0 {
+		return entry.WithTTL(ttl)
+	}
+
+	return entry
+}
+
+// moveKeyTxn moves item to key, keeping its expiry and blob reference.
+func (app *App) moveKeyTxn(txn *badger.Txn, item *badger.Item, key []byte) error {
+	return app.moveValueTxn(txn, item, key, remainingTTL(item))
+}
+
+// remainingTTL returns the time until item expires, zero if it never does.
+func remainingTTL(item *badger.Item) time.Duration {
+	if item.ExpiresAt() == 0 {
+		return 0
+	}
+
+	return max(time.Until(time.Unix(int64(item.ExpiresAt()), 0)), time.Second)
+}
@@ -10,6 +10,9 @@ import (
 )
 
 func main() {
+	core.LoadConfig()
+	core.OpenDefaultDatabase()
+
 	app := &cli.App{
 		Name:  "genesis",
 		Usage: "A tiny server for all your json needs",
@@ -23,8 +26,21 @@ func main() {
 				Action: commands.Start,
 			},
 			{
-				Name:  "users",
-				Usage: "Manage users",
+				Name:      "migrate",
+				Usage:     "Migrate the database to the latest schema, this is done automatically on start",
+				UsageText: "genesis migrate [--dry-run]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Only list pending migrations and usernames to normalize",
+					},
+				},
+				Action: commands.Migrate,
+			},
+			{
+				Name:    "users",
+				Aliases: []string{"user"},
+				Usage:   "Manage users directly in the database, the server must not be running",
 				Subcommands: []*cli.Command{
 					{
 						Name:      "ls",
@@ -42,19 +58,25 @@ func main() {
 					},
 					{
 						Name:      "add",
+						Aliases:   []string{"create"},
 						Usage:     "Adds a user, add ! at the end of the username to make the user an admin",
 						UsageText: "genesis user add [username] [password]",
 						Action:    commands.AddUser,
 					},
 					{
 						Name:      "update",
-						Usage:     "Updates a user",
+						Aliases:   []string{"reset"},
+						Usage:     "Updates a user, e.g. to reset the password of a locked out admin",
 						UsageText: "genesis user update [flags] [username]",
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:  "password",
 								Usage: "Sets a new password",
 							},
+							&cli.BoolFlag{
+								Name:  "admin",
+								Usage: "Grants (--admin) or revokes (--admin=false) admin rights",
+							},
 						},
 						Action: commands.UpdateUser,
 					},
@@ -63,7 +85,10 @@ func main() {
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	err := app.Run(os.Args)
+	core.CloseDatabase()
+
+	if err != nil {
 		core.Logger.Fatal("failed to run command", zap.Error(err))
 	}
 }
@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
+	"io"
 	"net/http"
+	"unicode/utf8"
 )
 
 func LimitBodySize(n int64) gin.HandlerFunc {
@@ -14,3 +16,63 @@ func LimitBodySize(n int64) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// ValidateEncoding fails reading request bodies with ErrInvalidEncoding as soon as they aren't valid UTF-8.
+// It's only needed for bodies which don't pass MinifyJson, which validates them already.
+func ValidateEncoding() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "PATCH" {
+			c.Request.Body = newEncodingReader(c.Request.Body)
+		}
+
+		c.Next()
+	}
+}
+
+// encodingReader validates the encoding of the data read from reader. Runes may be split across reads, an
+// incomplete one at the end of a read is kept until the next one completes it.
+type encodingReader struct {
+	reader  io.ReadCloser
+	pending []byte
+	err     error
+}
+
+func newEncodingReader(reader io.ReadCloser) *encodingReader {
+	return &encodingReader{reader: reader}
+}
+
+func (r *encodingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.reader.Read(p)
+
+	data := p[:n]
+	if len(r.pending) != 0 {
+		data = append(r.pending, data...)
+	}
+
+	end := len(data)
+	for i := end - 1; i >= 0 && i > end-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+
+			break
+		}
+	}
+
+	if !utf8.Valid(data[:end]) || (err == io.EOF && end != len(data)) {
+		r.err = ErrInvalidEncoding
+		return 0, r.err
+	}
+
+	r.pending = append([]byte(nil), data[end:]...)
+	return n, err
+}
+
+func (r *encodingReader) Close() error {
+	return r.reader.Close()
+}
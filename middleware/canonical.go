@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CanonicalizeJson replaces the body of JSON requests with its canonical form as defined by RFC 8785 (JCS),
+// so logically equal documents are stored byte for byte identical. It's an alternative to MinifyJson.
+// Bodies exceeding limits are rejected with 400 before they're decoded.
+func CanonicalizeJson(limits JsonLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if (c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "PATCH") && c.Request.Header.Get("Content-Type") == "application/json" {
+			body, err := io.ReadAll(c.Request.Body)
+			_ = c.Request.Body.Close()
+
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+				return
+			} else if err != nil {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+
+			var limitError *JsonLimitError
+			if err := CheckJsonLimits(body, limits); errors.As(err, &limitError) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, core.ErrorResponse{Error: limitError.Error(), Code: core.CodeJsonLimitExceeded, Limit: &limitError.Limit, Current: &limitError.Current})
+				return
+			}
+
+			canonical, err := CanonicalizeJsonBytes(body)
+			if err != nil {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+
+			c.Request.Body = io.NopCloser(bytes.NewReader(canonical))
+			c.Request.ContentLength = int64(len(canonical))
+			c.Request.Header.Set("Content-Length", strconv.Itoa(len(canonical)))
+		}
+
+		c.Next()
+	}
+}
+
+// CanonicalizeJsonBytes validates a single JSON document and returns its canonical form.
+// Numbers are represented as IEEE 754 doubles, as required by JCS, which may lose precision for very large integers.
+func CanonicalizeJsonBytes(data []byte) ([]byte, error) {
+	// The decoder silently replaces invalid UTF-8 with U+FFFD, which would alter the stored data
+	if !utf8.Valid(data) {
+		return nil, ErrInvalidEncoding
+	}
+
+	decoder := stdjson.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, ErrInvalidJson
+	} else if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, ErrInvalidJson
+	}
+
+	var buffer bytes.Buffer
+	if err := writeCanonical(&buffer, value); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func writeCanonical(buffer *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteString("null")
+	case bool:
+		buffer.WriteString(strconv.FormatBool(value))
+	case string:
+		writeCanonicalString(buffer, value)
+	case stdjson.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidJson, err)
+		}
+
+		buffer.WriteString(formatCanonicalNumber(number))
+	case []interface{}:
+		buffer.WriteByte('[')
+		for index, item := range value {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+
+			if err := writeCanonical(buffer, item); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+
+		// Keys are sorted by their UTF-16 code units
+		slices.SortFunc(keys, func(a, b string) int {
+			return slices.Compare(utf16.Encode([]rune(a)), utf16.Encode([]rune(b)))
+		})
+
+		buffer.WriteByte('{')
+		for index, key := range keys {
+			if index > 0 {
+				buffer.WriteByte(',')
+			}
+
+			writeCanonicalString(buffer, key)
+			buffer.WriteByte(':')
+
+			if err := writeCanonical(buffer, value[key]); err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('}')
+	default:
+		return fmt.Errorf("%w: unexpected type %T", ErrInvalidJson, value)
+	}
+
+	return nil
+}
+
+func writeCanonicalString(buffer *bytes.Buffer, value string) {
+	buffer.WriteByte('"')
+
+	for _, r := range value {
+		switch r {
+		case '"':
+			buffer.WriteString(`\"`)
+		case '\\':
+			buffer.WriteString(`\\`)
+		case '\b':
+			buffer.WriteString(`\b`)
+		case '\f':
+			buffer.WriteString(`\f`)
+		case '\n':
+			buffer.WriteString(`\n`)
+		case '\r':
+			buffer.WriteString(`\r`)
+		case '\t':
+			buffer.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buffer.WriteString(fmt.Sprintf(`\u%04x`, r))
+			} else {
+				buffer.WriteRune(r)
+			}
+		}
+	}
+
+	buffer.WriteByte('"')
+}
+
+// formatCanonicalNumber formats a number like ECMAScript's Number.prototype.toString.
+func formatCanonicalNumber(number float64) string {
+	if number == 0 {
+		return "0"
+	}
+
+	if abs := math.Abs(number); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+
+	// Go pads exponents to two digits (1e-07), ECMAScript doesn't (1e-7)
+	formatted := strconv.FormatFloat(number, 'e', -1, 64)
+	mantissa, exponent, _ := strings.Cut(formatted, "e")
+	sign, digits := exponent[:1], strings.TrimLeft(exponent[1:], "0")
+
+	return mantissa + "e" + sign + digits
+}
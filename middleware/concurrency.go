@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"net/http"
+	"sync"
+)
+
+// LimitConcurrency rejects requests with 429 while limit other requests with the same key are still being processed.
+// Requests for which key returns an empty string aren't limited. Slots are released even if a handler panics.
+func LimitConcurrency(limit int64, key func(c *gin.Context) string) gin.HandlerFunc {
+	var mutex sync.Mutex
+	inFlight := make(map[string]int64)
+
+	release := func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if inFlight[name]--; inFlight[name] <= 0 {
+			delete(inFlight, name)
+		}
+	}
+
+	return func(c *gin.Context) {
+		name := key(c)
+		if len(name) == 0 {
+			c.Next()
+			return
+		}
+
+		mutex.Lock()
+		if current := inFlight[name]; current >= limit {
+			mutex.Unlock()
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, core.ErrorResponse{Error: "too many concurrent requests", Code: core.CodeTooManyRequests, Limit: &limit, Current: &current})
+			return
+		}
+
+		inFlight[name]++
+		mutex.Unlock()
+
+		defer release(name)
+		c.Next()
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// passwordField matches the value of every JSON field with "password" in its name, including values cut off by the size cap
+var passwordField = regexp.MustCompile(`(?i)("[^"]*password[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*(?:"|\\?$)`)
+
+// LogBodies logs the request and response body of requests whose path starts with one of paths or which are sent by one
+// of users, which is meant for debugging single clients. Only the first maxSize bytes of each body are logged and values
+// of password fields are redacted. Bodies of other requests aren't touched at all.
+func LogBodies(paths []string, users []string, maxSize int64, logger *zap.Logger, user func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := ""
+		if !slices.ContainsFunc(paths, func(path string) bool { return strings.HasPrefix(c.Request.URL.Path, path) }) {
+			if len(users) == 0 {
+				c.Next()
+				return
+			} else if name = user(c); !slices.Contains(users, name) {
+				c.Next()
+				return
+			}
+		}
+
+		request := &bodyCapture{limit: maxSize}
+		response := &bodyCapture{limit: maxSize}
+
+		if c.Request.Body != nil {
+			c.Request.Body = &capturingReader{ReadCloser: c.Request.Body, capture: request}
+		}
+
+		c.Writer = &capturingWriter{ResponseWriter: c.Writer, capture: response}
+		c.Next()
+
+		if len(name) == 0 {
+			name = user(c)
+		}
+
+		logger.Info("request bodies",
+			zap.String("requestId", RequestID(c)),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", c.Writer.Status()),
+			zap.String("user", name),
+			zap.String("request", request.String()),
+			zap.Bool("requestTruncated", request.truncated),
+			zap.String("response", response.String()),
+			zap.Bool("responseTruncated", response.truncated),
+		)
+	}
+}
+
+// bodyCapture keeps the first limit bytes passed to it.
+type bodyCapture struct {
+	limit     int64
+	buffer    bytes.Buffer
+	truncated bool
+}
+
+func (b *bodyCapture) capture(p []byte) {
+	room := int(b.limit) - b.buffer.Len()
+	if room < len(p) {
+		b.truncated = true
+		p = p[:max(room, 0)]
+	}
+
+	b.buffer.Write(p)
+}
+
+// String returns the captured bytes with passwords redacted.
+func (b *bodyCapture) String() string {
+	return passwordField.ReplaceAllString(b.buffer.String(), `$1"[redacted]"`)
+}
+
+type capturingReader struct {
+	io.ReadCloser
+	capture *bodyCapture
+}
+
+func (r *capturingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.capture(p[:n])
+	return n, err
+}
+
+type capturingWriter struct {
+	gin.ResponseWriter
+	capture *bodyCapture
+}
+
+func (w *capturingWriter) Write(p []byte) (int, error) {
+	w.capture.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.capture.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
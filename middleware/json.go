@@ -1,20 +1,25 @@
 package middleware
 
 import (
+	stdjson "encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/minify/v2/json"
 	"github.com/tdewolff/parse/v2"
 	"io"
 	"net/http"
+	"unicode/utf8"
 )
 
-func MinifyJson() gin.HandlerFunc {
+// MinifyJson minifies and validates JSON request bodies while they're read. Numbers are passed through as sent unless
+// minifyNumbers is set, which shortens their representation, e.g. 1000000 to 1e6. Bodies exceeding limits fail to be
+// read with a *JsonLimitError, bodies which aren't valid UTF-8 with ErrInvalidEncoding.
+func MinifyJson(minifyNumbers bool, limits JsonLimits) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if (c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "PATCH") && c.Request.Header.Get("Content-Type") == "application/json" {
 
-			m := minify.New()
-			m.AddFunc("application/json", json.Minify)
+			m := newMinifier(minifyNumbers)
 
 			bodyReader := c.Request.Body
 			defer bodyReader.Close()
@@ -28,9 +33,13 @@ func MinifyJson() gin.HandlerFunc {
 			go func() {
 				defer minifyWriter.Close()
 
-				err := m.Minify("application/json", minifyWriter, bodyReader)
+				err := m.Minify("application/json", minifyWriter, LimitJsonReader(newEncodingReader(bodyReader), limits))
 
-				if _, ok := err.(*parse.Error); ok {
+				// The minifier passes string contents through as they are, so the encoding is validated while reading
+				var limitError *JsonLimitError
+				if errors.As(err, &limitError) || errors.Is(err, ErrInvalidEncoding) {
+					_ = minifyWriter.CloseWithError(err)
+				} else if _, ok := err.(*parse.Error); ok {
 					c.AbortWithStatus(http.StatusBadRequest)
 				} else if _, ok = err.(*http.MaxBytesError); ok {
 					c.AbortWithStatus(http.StatusRequestEntityTooLarge)
@@ -43,3 +52,29 @@ func MinifyJson() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+var (
+	ErrInvalidJson     = errors.New("invalid json")
+	ErrInvalidEncoding = errors.New("invalid encoding, json must be valid UTF-8")
+)
+
+// MinifyJsonBytes minifies and validates a single JSON document outside a request body, see MinifyJson.
+func MinifyJsonBytes(data []byte, minifyNumbers bool) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, ErrInvalidEncoding
+	} else if minified, err := newMinifier(minifyNumbers).Bytes("application/json", data); err != nil {
+		return nil, err
+	} else if !stdjson.Valid(minified) {
+		return nil, ErrInvalidJson
+	} else {
+		return minified, nil
+	}
+}
+
+// newMinifier creates a JSON minifier, numbers are kept as they are unless minifyNumbers is set as rewriting them
+// changes the stored bytes, e.g. of large integers which clients parse as strings or big numbers.
+func newMinifier(minifyNumbers bool) *minify.M {
+	m := minify.New()
+	m.Add("application/json", &json.Minifier{KeepNumbers: !minifyNumbers})
+	return m
+}
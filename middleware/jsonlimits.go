@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"io"
+	"strconv"
+)
+
+// JsonLimits restricts the structure of JSON documents, a limit of zero disables it.
+// MaxElements applies to the amount of array items and object members of a document in total.
+type JsonLimits struct {
+	MaxDepth       int64
+	MaxArrayLength int64
+	MaxElements    int64
+}
+
+func (limits JsonLimits) enabled() bool {
+	return limits.MaxDepth > 0 || limits.MaxArrayLength > 0 || limits.MaxElements > 0
+}
+
+// JsonLimitError is returned if a document exceeds one of its JsonLimits, Current is the value which exceeded it.
+type JsonLimitError struct {
+	Name    string
+	Limit   int64
+	Current int64
+}
+
+func (e *JsonLimitError) Error() string {
+	return "json exceeds the maximum " + e.Name + " of " + strconv.FormatInt(e.Limit, 10)
+}
+
+// CheckJsonLimits validates the structure of data against limits, the document itself isn't validated.
+func CheckJsonLimits(data []byte, limits JsonLimits) error {
+	if !limits.enabled() {
+		return nil
+	}
+
+	return newJsonLimiter(limits).scan(data)
+}
+
+// LimitJsonReader returns a reader which fails with a *JsonLimitError as soon as the document read from r exceeds
+// limits, so oversized documents are rejected without reading them as a whole.
+func LimitJsonReader(r io.Reader, limits JsonLimits) io.Reader {
+	if !limits.enabled() {
+		return r
+	}
+
+	return &jsonLimitReader{reader: r, limiter: newJsonLimiter(limits)}
+}
+
+type jsonLimitReader struct {
+	reader  io.Reader
+	limiter *jsonLimiter
+	err     error
+}
+
+func (r *jsonLimitReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.reader.Read(p)
+	if r.err = r.limiter.scan(p[:n]); r.err != nil {
+		return 0, r.err
+	}
+
+	return n, err
+}
+
+type jsonContainer struct {
+	array bool
+	empty bool
+	count int64
+}
+
+// jsonLimiter tracks the structure of a document across chunks of it. It only keeps the containers currently open,
+// so its memory is bound by the depth of the document.
+type jsonLimiter struct {
+	limits   JsonLimits
+	stack    []jsonContainer
+	elements int64
+	inString bool
+	escaped  bool
+}
+
+func newJsonLimiter(limits JsonLimits) *jsonLimiter {
+	return &jsonLimiter{limits: limits}
+}
+
+func (l *jsonLimiter) scan(data []byte) error {
+	for _, b := range data {
+		if l.inString {
+			if l.escaped {
+				l.escaped = false
+			} else if b == '\\' {
+				l.escaped = true
+			} else if b == '"' {
+				l.inString = false
+			}
+
+			continue
+		}
+
+		switch b {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case ']', '}':
+			if len(l.stack) != 0 {
+				l.stack = l.stack[:len(l.stack)-1]
+			}
+
+			continue
+		}
+
+		// Anything else within an empty container is its first element, every further one follows a comma
+		if top := len(l.stack) - 1; top >= 0 && l.stack[top].empty {
+			l.stack[top].empty = false
+			if err := l.count(); err != nil {
+				return err
+			}
+		}
+
+		switch b {
+		case '"':
+			l.inString = true
+		case ',':
+			if err := l.count(); err != nil {
+				return err
+			}
+		case '[', '{':
+			l.stack = append(l.stack, jsonContainer{array: b == '[', empty: true})
+			if depth := int64(len(l.stack)); l.limits.MaxDepth > 0 && depth > l.limits.MaxDepth {
+				return &JsonLimitError{Name: "depth", Limit: l.limits.MaxDepth, Current: depth}
+			}
+		}
+	}
+
+	return nil
+}
+
+// count adds an element to the innermost container.
+func (l *jsonLimiter) count() error {
+	if len(l.stack) == 0 {
+		return nil
+	}
+
+	container := &l.stack[len(l.stack)-1]
+	container.count++
+	l.elements++
+
+	if container.array && l.limits.MaxArrayLength > 0 && container.count > l.limits.MaxArrayLength {
+		return &JsonLimitError{Name: "array length", Limit: l.limits.MaxArrayLength, Current: container.count}
+	} else if l.limits.MaxElements > 0 && l.elements > l.limits.MaxElements {
+		return &JsonLimitError{Name: "amount of elements", Limit: l.limits.MaxElements, Current: l.elements}
+	}
+
+	return nil
+}
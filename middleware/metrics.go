@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsBucket is the duration covered by a single slot of the rolling window
+const metricsBucket = 10 * time.Second
+
+// Metrics counts requests per route and status and keeps a rolling window of them to derive error rates,
+// which are exposed in the Prometheus text format.
+type Metrics struct {
+	mutex  sync.Mutex
+	window time.Duration
+	totals map[requestSeries]uint64
+	recent map[routeSeries][]metricsSlot
+}
+
+type routeSeries struct {
+	method string
+	route  string
+}
+
+type requestSeries struct {
+	routeSeries
+	code int
+}
+
+type metricsSlot struct {
+	bucket int64
+	total  uint64
+	client uint64
+	server uint64
+}
+
+// NewMetrics creates metrics with error rates computed over window, which is rounded up to multiples of ten seconds.
+func NewMetrics(window time.Duration) *Metrics {
+	return &Metrics{
+		window: max(window, metricsBucket),
+		totals: make(map[requestSeries]uint64),
+		recent: make(map[routeSeries][]metricsSlot),
+	}
+}
+
+// Handler records every request passing through it, requests not matching any route are grouped as "unmatched".
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = "unmatched"
+		}
+
+		m.record(c.Request.Method, route, c.Writer.Status(), time.Now())
+	}
+}
+
+func (m *Metrics) record(method, route string, code int, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	series := routeSeries{method: method, route: route}
+	m.totals[requestSeries{routeSeries: series, code: code}]++
+
+	slots, ok := m.recent[series]
+	if !ok {
+		slots = make([]metricsSlot, m.slots())
+		m.recent[series] = slots
+	}
+
+	bucket := now.UnixNano() / int64(metricsBucket)
+	slot := &slots[bucket%int64(len(slots))]
+
+	if slot.bucket != bucket {
+		*slot = metricsSlot{bucket: bucket}
+	}
+
+	slot.total++
+	if code >= 500 {
+		slot.server++
+	} else if code >= 400 {
+		slot.client++
+	}
+}
+
+func (m *Metrics) slots() int {
+	return int((m.window + metricsBucket - 1) / metricsBucket)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var out strings.Builder
+	window := strconv.FormatFloat(m.window.Seconds(), 'f', -1, 64)
+
+	requests := make([]requestSeries, 0, len(m.totals))
+	for series := range m.totals {
+		requests = append(requests, series)
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].routeSeries != requests[j].routeSeries {
+			return requests[i].routeSeries.less(requests[j].routeSeries)
+		}
+
+		return requests[i].code < requests[j].code
+	})
+
+	out.WriteString("# HELP genesis_http_requests_total Total number of HTTP requests by route and status code.\n")
+	out.WriteString("# TYPE genesis_http_requests_total counter\n")
+	for _, series := range requests {
+		fmt.Fprintf(&out, "genesis_http_requests_total{%s,code=\"%d\"} %d\n", series.labels(), series.code, m.totals[series])
+	}
+
+	routes := make([]routeSeries, 0, len(m.recent))
+	for series := range m.recent {
+		routes = append(routes, series)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].less(routes[j])
+	})
+
+	// Slots older than the window are skipped rather than cleared, so idle routes report zero
+	oldest := time.Now().UnixNano()/int64(metricsBucket) - int64(m.slots()) + 1
+	windowed := make(map[routeSeries]metricsSlot, len(routes))
+
+	for _, series := range routes {
+		var sum metricsSlot
+		for _, slot := range m.recent[series] {
+			if slot.bucket >= oldest {
+				sum.total += slot.total
+				sum.client += slot.client
+				sum.server += slot.server
+			}
+		}
+
+		windowed[series] = sum
+	}
+
+	out.WriteString("# HELP genesis_http_window_requests Number of HTTP requests by route within the last " + window + " seconds.\n")
+	out.WriteString("# TYPE genesis_http_window_requests gauge\n")
+	for _, series := range routes {
+		fmt.Fprintf(&out, "genesis_http_window_requests{%s} %d\n", series.labels(), windowed[series].total)
+	}
+
+	out.WriteString("# HELP genesis_http_error_rate Share of HTTP requests by route answered with a 4xx or 5xx status within the last " + window + " seconds.\n")
+	out.WriteString("# TYPE genesis_http_error_rate gauge\n")
+	for _, series := range routes {
+		sum := windowed[series]
+		fmt.Fprintf(&out, "genesis_http_error_rate{%s,class=\"4xx\"} %s\n", series.labels(), formatRate(sum.client, sum.total))
+		fmt.Fprintf(&out, "genesis_http_error_rate{%s,class=\"5xx\"} %s\n", series.labels(), formatRate(sum.server, sum.total))
+	}
+
+	written, err := io.WriteString(w, out.String())
+	return int64(written), err
+}
+
+func (s routeSeries) less(other routeSeries) bool {
+	if s.route != other.route {
+		return s.route < other.route
+	}
+
+	return s.method < other.method
+}
+
+func (s routeSeries) labels() string {
+	return "method=\"" + escapeLabel(s.method) + "\",route=\"" + escapeLabel(s.route) + "\""
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+// formatRate returns errors relative to total, which is zero without any requests.
+func formatRate(errors, total uint64) string {
+	if total == 0 {
+		return "0"
+	}
+
+	return strconv.FormatFloat(float64(errors)/float64(total), 'g', -1, 64)
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"net/http"
+	"slices"
+)
+
+// RejectWrites rejects all requests which may modify data, only safe methods and the given routes are passed through.
+func RejectWrites(allowedRoutes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || slices.Contains(allowedRoutes, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		c.Header("Allow", "GET, HEAD, OPTIONS")
+		c.AbortWithStatusJSON(http.StatusMethodNotAllowed, core.ErrorResponse{Error: "this instance is read-only", Code: core.CodeReadOnly})
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestIDHeader carries the id of a request, it's taken from requests if valid and always sent back.
+const RequestIDHeader = "X-Request-Id"
+
+const (
+	requestIDKey = "requestId"
+	stackKey     = "errorStack"
+)
+
+// validRequestID restricts ids sent by clients, e.g. by a proxy, to what's safe to log and send back
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Recover replaces gin.Recovery, it assigns each request an id and logs panics along with the stack trace where they
+// occurred. Responses with status 500 are logged as well, including the stack recorded by CaptureStack if any.
+// Clients only get a JSON core.ErrorResponse with the request id, never anything about the cause. Panics caused by broken
+// connections are only logged, as nothing can be sent anymore.
+func Recover(logger *zap.Logger, user func(c *gin.Context) string) gin.HandlerFunc {
+	// The stack is logged explicitly, the one of this middleware would only be misleading
+	logger = logger.WithOptions(zap.AddStacktrace(zapcore.FatalLevel))
+
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		defer func() {
+			fields := func() []zap.Field {
+				return []zap.Field{
+					zap.String("requestId", id),
+					zap.String("method", c.Request.Method),
+					zap.String("path", c.Request.URL.Path),
+					zap.String("user", user(c)),
+				}
+			}
+
+			recovered := recover()
+			if err, ok := recovered.(error); ok && isBrokenConnection(err) {
+				logger.Warn("connection closed while responding", append(fields(), zap.Error(err))...)
+				c.Abort()
+			} else if recovered != nil {
+				logger.Error("recovered from panic", append(fields(), zap.Any("panic", recovered), zap.String("stack", string(debug.Stack())))...)
+
+				if c.Writer.Written() {
+					c.Abort()
+				} else {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, core.ErrorResponse{Error: "internal server error", Code: core.CodeInternal, RequestID: id})
+				}
+			} else if c.Writer.Status() == http.StatusInternalServerError {
+				logger.Error("internal server error", append(fields(), zap.String("stack", c.GetString(stackKey)))...)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// RequestID returns the id Recover assigned to the request.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// CaptureStack records the stack of the caller, to be logged by Recover along with the error response it's about to send.
+func CaptureStack(c *gin.Context) {
+	c.Set(stackKey, string(debug.Stack()))
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func isBrokenConnection(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
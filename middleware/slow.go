@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// LogSlowRequests logs requests taking longer than threshold as warning, which is far cheaper than logging every request.
+// The user is only determined for slow requests, requests panicking are logged by Recover instead.
+func LogSlowRequests(threshold time.Duration, logger *zap.Logger, user func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if duration := time.Since(start); duration > threshold {
+			logger.Warn("slow request",
+				zap.String("requestId", RequestID(c)),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Int("status", c.Writer.Status()),
+				zap.String("user", user(c)),
+				zap.Duration("duration", duration),
+			)
+		}
+	}
+}
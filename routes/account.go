@@ -1,9 +1,12 @@
 package routes
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
+	"go.uber.org/zap"
 	"net/http"
 )
 
@@ -12,6 +15,28 @@ type updateBody struct {
 	NewPassword     string `json:"newPassword" validate:"required,gte=8,lte=64"`
 }
 
+// Account godoc
+// @Summary      Get current user
+// @Description  Returns the currently authenticated user
+// @Tags         account
+// @Produce      json
+// @Success      200 {object} core.PublicUser "Current user"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Security     CookieAuth
+// @Router       /account [get]
+func Account(c *gin.Context) {
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else {
+		c.JSON(http.StatusOK, core.PublicUser{
+			Name:  user.Name,
+			Admin: user.Admin,
+		})
+	}
+}
+
 // UpdateAccount godoc
 // @Summary      Update account password
 // @Description  Update the password for the currently authenticated user
@@ -20,36 +45,144 @@ type updateBody struct {
 // @Produce      json
 // @Param        request body UpdatePasswordRequest true "Password update request"
 // @Success      200 "Password updated successfully"
-// @Failure      400 {object} ErrorResponse "Invalid JSON or validation failed"
-// @Failure      401 {object} ErrorResponse "Unauthorized or current password incorrect"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, validation failed or the new password has been used before"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized or current password incorrect"
 // @Security     CookieAuth
 // @Router       /account/update [post]
 func UpdateAccount(c *gin.Context) {
+	app := appOf(c)
 	validate := validator.New()
 	user := authenticateUser(c)
 
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		respondUnauthorized(c)
 		return
 	}
 
 	var body updateBody
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
 		return
-	} else if _, err := core.AuthenticateUser(user.Name, body.CurrentPassword); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password incorrect"})
+	} else if _, err := app.AuthenticateUser(user.Name, body.CurrentPassword); err != nil {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
 		return
 	}
 
 	if err := validate.Struct(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed, must contain currentPassword and newPassword"})
-	} else if err := core.UpdateUser(user.Name, core.PartialUser{
+		respondError(c, http.StatusBadRequest, core.CodeValidationFailed, "validation failed, must contain currentPassword and newPassword")
+	} else if err := app.UpdateUser(user.Name, core.PartialUser{
 		Admin:    nil,
 		Password: &body.NewPassword,
-	}); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to update user"})
+	}); errors.Is(err, core.ErrPasswordReused) {
+		respondError(c, http.StatusBadRequest, core.CodePasswordReused, "new password has been used before")
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInternal, "failed to update user")
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// VerifyPassword godoc
+// @Summary      Verify the current password
+// @Description  Check the password of the currently authenticated user without issuing a new token or touching the session cookie, e.g. before showing sensitive settings.
+// @Description  Attempts count towards the same limits as logins, so it can't be used to guess passwords faster.
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        request body ReauthRequest true "Current password of the user"
+// @Success      200 "Password is correct"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized or current password incorrect"
+// @Failure      429 {object} core.ErrorResponse "Too many attempts for this user or from this address, see Retry-After"
+// @Security     CookieAuth
+// @Router       /account/verify-password [post]
+func VerifyPassword(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+	var body reauthBody
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if limit := allowLoginAttempt(c, user.Name); !limit.Allowed {
+		respondRateLimited(c, limit, "too many attempts, try again later")
+	} else if c.ShouldBindJSON(&body) != nil {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if authenticated, err := app.AuthenticateUser(user.Name, body.CurrentPassword); err != nil || authenticated == nil {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// Settings godoc
+// @Summary      Get account settings
+// @Description  Retrieve the settings document of the currently authenticated user, an empty object if none has been stored yet
+// @Description  The ETag can be sent as If-Match when replacing the settings, conditional requests via If-None-Match are supported.
+// @Tags         account
+// @Produce      json
+// @Param        If-None-Match header string false "ETag of a previous response"
+// @Success      200 {object} map[string]interface{} "Settings document"
+// @Success      304 "Settings haven't changed"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve settings"
+// @Security     CookieAuth
+// @Router       /account/settings [get]
+func Settings(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if data, err := app.GetSettings(user.Name); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve settings")
+		app.Logger.Error("failed to retrieve settings", zap.Error(err))
+	} else {
+		respondWithData(c, data, nil)
+	}
+}
+
+// UpdateSettings godoc
+// @Summary      Replace account settings
+// @Description  Replace the settings document of the currently authenticated user. The document must be a JSON object and is validated against GENESIS_SETTINGS_SCHEMA if configured.
+// @Description  Settings don't count towards the amount of keys per user.
+// @Description  With If-Match the settings are only replaced if their ETag matches, otherwise 412 is returned.
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        settings body map[string]interface{} true "Settings document"
+// @Param        If-Match header string false "Only replace the settings if their current ETag matches"
+// @Success      200 "Settings stored successfully"
+// @Header       200 {string} ETag "ETag of the stored settings"
+// @Failure      400 {object} core.ErrorResponse "Invalid body, JSON exceeding its limits or settings don't match the schema"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      412 {object} core.ErrorResponse "Settings have been changed since they were read"
+// @Failure      413 {object} core.ErrorResponse "Request entity too large"
+// @Failure      500 {object} core.ErrorResponse "Failed to store settings"
+// @Security     CookieAuth
+// @Router       /account/settings [put]
+func UpdateSettings(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+	var limitError *middleware.JsonLimitError
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if body, err := c.GetRawData(); errors.As(err, &limitError) {
+		respondJsonLimitExceeded(c, limitError)
+	} else if errors.Is(err, middleware.ErrInvalidEncoding) {
+		respondInvalidEncoding(c)
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid body")
+	} else if err := app.SetSettingsIfMatch(user.Name, body, c.GetHeader("If-Match")); err != nil {
+		if errors.Is(err, core.ErrInvalidSettings) {
+			respondError(c, http.StatusBadRequest, core.CodeInvalidSettings, err.Error())
+		} else if errors.Is(err, core.ErrPreconditionFailed) {
+			respondError(c, http.StatusPreconditionFailed, core.CodePreconditionFailed, "settings have been changed")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to store settings")
+			app.Logger.Error("failed to store settings", zap.Error(err))
+		}
 	} else {
+		c.Header("ETag", core.ETag(body))
 		c.Status(http.StatusOK)
 	}
 }
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"github.com/simonwep/genesis/core"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
@@ -40,3 +41,235 @@ func TestUpdatePassword(t *testing.T) {
 		},
 	})
 }
+
+func TestPasswordHistory(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.PasswordHistory = 2
+	t.Cleanup(func() {
+		core.Config.PasswordHistory = 0
+	})
+
+	// The current and the previous password are remembered
+	for _, change := range []struct {
+		current string
+		next    string
+		status  int
+	}{
+		{"hgEiPCZP", "6sBX4AZb", http.StatusOK},
+		{"6sBX4AZb", "hgEiPCZP", http.StatusBadRequest},
+		{"6sBX4AZb", "6sBX4AZb", http.StatusBadRequest},
+		{"6sBX4AZb", "Lk2pQ9vX", http.StatusOK},
+		{"Lk2pQ9vX", "hgEiPCZP", http.StatusOK},
+	} {
+		tryAuthorizedPost("/account/update", AuthorizedBodyConfig{
+			Token: token,
+			Body:  "{\"currentPassword\": \"" + change.current + "\",\"newPassword\": \"" + change.next + "\"}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, change.status, response.Code, change.next)
+
+				if change.status == http.StatusBadRequest {
+					assert.Contains(t, response.Body.String(), string(core.CodePasswordReused))
+				}
+			},
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.LoginRateLimit = 2
+	t.Cleanup(func() {
+		core.Config.LoginRateLimit = 0
+		core.Default.LoginLimiter.Reset()
+	})
+
+	for _, password := range []string{"hgEiPCZP", "wrong"} {
+		tryAuthorizedPost("/account/verify-password", AuthorizedBodyConfig{
+			Token: token,
+			Body:  "{\"currentPassword\": \"" + password + "\"}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				if password == "wrong" {
+					assert.Equal(t, http.StatusUnauthorized, response.Code)
+					assert.Contains(t, response.Body.String(), string(core.CodePasswordIncorrect))
+				} else {
+					assert.Equal(t, http.StatusOK, response.Code)
+				}
+
+				assert.Empty(t, response.Header().Get("Set-Cookie"))
+			},
+		})
+	}
+
+	// Attempts share the limit of logins
+	tryAuthorizedPost("/account/verify-password", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"currentPassword\": \"hgEiPCZP\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusTooManyRequests, response.Code)
+			assert.NotEmpty(t, response.Header().Get("Retry-After"))
+		},
+	})
+
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"hgEiPCZP\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusTooManyRequests, response.Code)
+		},
+	})
+}
+
+func TestSettings(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/account/settings", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"theme\": \"dark\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "[1, 2]",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account/settings", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"theme\":\"dark\"}", response.Body.String())
+		},
+	})
+
+	// settings are not part of the regular data
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{}", response.Body.String())
+		},
+	})
+}
+
+func TestSettingsIfMatch(t *testing.T) {
+	token := loginUser(t)
+	var etag string
+
+	// Settings which haven't been stored yet can be replaced conditionally as well
+	tryAuthorizedGet("/account/settings", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token:   token,
+		Body:    "{\"theme\": \"dark\"}",
+		Headers: map[string]string{"If-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NotEqual(t, etag, response.Header().Get("ETag"))
+		},
+	})
+
+	// Another device still holding the old ETag must not overwrite the change
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token:   token,
+		Body:    "{\"theme\": \"light\"}",
+		Headers: map[string]string{"If-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account/settings", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"theme\":\"dark\"}", response.Body.String())
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedGet("/account/settings", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotModified, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token:   token,
+		Body:    "{\"theme\": \"light\"}",
+		Headers: map[string]string{"If-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestSettingsSchema(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.SettingsSchema = map[string]string{"theme": "string", "fontSize": "number"}
+	defer func() { core.Config.SettingsSchema = nil }()
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"theme\": \"dark\", \"fontSize\": 12}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"theme\": 12}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"language\": \"en\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
+
+func TestAccount(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"name\":\"foo\",\"admin\":false}", response.Body.String())
+		},
+	})
+
+	tryUnauthorizedGet("/account", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
@@ -0,0 +1,170 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// StorageUsage godoc
+// @Summary      Get storage usage per user
+// @Description  List the amount of keys and bytes stored by each user, sorted by bytes in descending order (admin only)
+// @Tags         admin
+// @Produce      json
+// @Param        offset query int false "Amount of users to skip"
+// @Param        limit query int false "Maximum amount of users to return (default 100, max 1000)"
+// @Success      200 {object} UsageResponse "Storage usage per user"
+// @Header       200 {integer} X-Total-Count "Total amount of users"
+// @Header       200 {string} Link "Links to the next and previous page (RFC 8288)"
+// @Failure      400 {object} core.ErrorResponse "Invalid pagination parameters"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve storage usage"
+// @Security     CookieAuth
+// @Router       /admin/usage [get]
+func StorageUsage(c *gin.Context) {
+	app := appOf(c)
+	if !isAsAdminAuthenticated(c) {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if offset, limit, ok := parsePagination(c); !ok {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "invalid offset or limit")
+	} else if usage, err := app.GetStorageUsage(); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve storage usage")
+		app.Logger.Error("failed to retrieve storage usage", zap.Error(err))
+	} else {
+		setPaginationHeaders(c, len(usage), offset, limit)
+		c.JSON(http.StatusOK, UsageResponse{
+			Total: len(usage),
+			Users: paginate(usage, offset, limit),
+		})
+	}
+}
+
+// InvalidatedTokens godoc
+// @Summary      List invalidated tokens
+// @Description  Get the amount of tokens invalidated by logging out which haven't expired yet, use ids=true to list them along with their remaining lifetime (admin only)
+// @Tags         admin
+// @Produce      json
+// @Param        ids query bool false "Include the ids of the tokens"
+// @Param        offset query int false "Amount of tokens to skip"
+// @Param        limit query int false "Maximum amount of tokens to return (default 100, max 1000)"
+// @Success      200 {object} InvalidatedTokensResponse "Invalidated tokens"
+// @Header       200 {integer} X-Total-Count "Total amount of tokens"
+// @Header       200 {string} Link "Links to the next and previous page (RFC 8288), only with ids"
+// @Failure      400 {object} core.ErrorResponse "Invalid pagination parameters"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve invalidated tokens"
+// @Security     CookieAuth
+// @Router       /admin/invalidated-tokens [get]
+func InvalidatedTokens(c *gin.Context) {
+	app := appOf(c)
+	if !isAsAdminAuthenticated(c) {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if offset, limit, ok := parsePagination(c); !ok {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "invalid offset or limit")
+	} else if tokens, err := app.GetInvalidatedTokens(); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve invalidated tokens")
+		app.Logger.Error("failed to retrieve invalidated tokens", zap.Error(err))
+	} else {
+		response := InvalidatedTokensResponse{Total: len(tokens)}
+
+		if c.Query("ids") == "true" {
+			response.Tokens = paginate(tokens, offset, limit)
+			setPaginationHeaders(c, len(tokens), offset, limit)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// CompactDatabase godoc
+// @Summary      Compact the database
+// @Description  Flatten the database into a single level to remove deleted and overwritten values, e.g. during low-traffic windows (admin only).
+// @Description  Uses GENESIS_COMPACTION_WORKERS concurrent workers, only one compaction can run at a time.
+// @Tags         admin
+// @Produce      json
+// @Success      200 {object} core.CompactionResult "Duration and levels after the compaction"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      409 {object} core.ErrorResponse "Compaction already running"
+// @Failure      500 {object} core.ErrorResponse "Failed to compact database"
+// @Security     CookieAuth
+// @Router       /admin/compact [post]
+func CompactDatabase(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if result, err := app.CompactDatabase(int(app.Config.CompactionWorkers)); errors.Is(err, core.ErrCompactionRunning) {
+		respondError(c, http.StatusConflict, core.CodeAlreadyRunning, "compaction already running")
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to compact database")
+		app.Logger.Error("failed to compact database", zap.Error(err))
+	} else {
+		app.Audit("database compacted", zap.String("admin", admin.Name), zap.Int64("durationMs", result.DurationMs))
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// Reindex godoc
+// @Summary      Rebuild derived data
+// @Description  Rebuild the label index, the indexes declared in GENESIS_DATA_INDEXES and the amount of keys across all users from the stored data, e.g. after restoring a backup (admin only).
+// @Description  Users are rebuilt one at a time while requests are being served, running it again doesn't change anything. Only one reindex can run at a time.
+// @Tags         admin
+// @Produce      json
+// @Success      200 {object} core.ReindexResult "Duration and amount of users, keys and index entries"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      409 {object} core.ErrorResponse "Reindex already running"
+// @Failure      500 {object} core.ErrorResponse "Failed to reindex"
+// @Security     CookieAuth
+// @Router       /admin/reindex [post]
+func Reindex(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if result, err := app.Reindex(); errors.Is(err, core.ErrReindexRunning) {
+		respondError(c, http.StatusConflict, core.CodeAlreadyRunning, "reindex already running")
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to reindex")
+		app.Logger.Error("failed to reindex", zap.Error(err))
+	} else {
+		app.Audit("database reindexed", zap.String("admin", admin.Name), zap.Int64("durationMs", result.DurationMs))
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// AdvanceClock godoc
+// @Summary      Advance the clock of the app
+// @Description  Move the clock everything expiring within the app is based on forward, e.g. sessions, invites, rate limits and inactivity (admin only).
+// @Description  Only available if GENESIS_TEST_MODE is enabled, which can't be combined with release mode. Expiry enforced by the database, e.g. of the trash, keeps using the time of the system.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        request body AdvanceClockRequest true "Duration to advance the clock by"
+// @Success      200 {object} ClockResponse "Time of the clock afterward"
+// @Failure      400 {object} core.ErrorResponse "Invalid body or duration"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only or the clock can't be adjusted"
+// @Security     CookieAuth
+// @Router       /test/clock [post]
+func AdvanceClock(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	var body AdvanceClockRequest
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if err := c.ShouldBindJSON(&body); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid body")
+	} else if by, err := time.ParseDuration(body.By); err != nil || by <= 0 {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "by must be a positive duration, e.g. 1h30m")
+	} else if now, err := app.AdvanceClock(by); err != nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, err.Error())
+	} else {
+		app.Audit("clock advanced", zap.String("admin", admin.Name), zap.Duration("by", by), zap.Time("now", now))
+		c.JSON(http.StatusOK, ClockResponse{Now: now.UTC()})
+	}
+}
@@ -0,0 +1,285 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStorageUsage(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/admin/usage", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	tryAuthorizedGet("/admin/usage", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body UsageResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, 3, body.Total)
+			assert.Equal(t, "3", response.Header().Get("X-Total-Count"))
+			assert.Empty(t, response.Header().Get("Link"))
+			assert.Equal(t, "foo", body.Users[0].Name)
+			assert.Equal(t, int64(1), body.Users[0].Keys)
+			assert.Equal(t, int64(len("{\"hello\":\"world!\"}")), body.Users[0].Bytes)
+		},
+	})
+
+	tryAuthorizedGet("/admin/usage?offset=1&limit=1", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body UsageResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, 3, body.Total)
+			assert.Len(t, body.Users, 1)
+			assert.Equal(t, "3", response.Header().Get("X-Total-Count"))
+			assert.Equal(t, "</admin/usage?limit=1&offset=2>; rel=\"next\", </admin/usage?limit=1&offset=0>; rel=\"prev\"", response.Header().Get("Link"))
+		},
+	})
+
+	tryAuthorizedGet("/admin/usage?limit=0", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
+
+func TestInvalidatedTokens(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/admin/invalidated-tokens", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/logout", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	tryAuthorizedGet("/admin/invalidated-tokens", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body InvalidatedTokensResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.GreaterOrEqual(t, body.Total, 1)
+			assert.Empty(t, body.Tokens)
+		},
+	})
+
+	tryAuthorizedGet("/admin/invalidated-tokens?ids=true", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body InvalidatedTokensResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Len(t, body.Tokens, body.Total)
+			assert.NotEmpty(t, body.Tokens[0].ID)
+			assert.Greater(t, body.Tokens[0].TTL, int64(0))
+		},
+	})
+}
+
+func TestCompactDatabase(t *testing.T) {
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	tryAuthorizedPost("/admin/compact", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/key", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"a\": 1}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/admin/compact", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var result core.CompactionResult
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+			assert.GreaterOrEqual(t, result.DurationMs, int64(0))
+			assert.NotEmpty(t, result.Levels)
+		},
+	})
+
+	// Compaction doesn't change any data
+	tryAuthorizedGet("/data/key", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"a\":1}", response.Body.String())
+		},
+	})
+}
+
+func TestReindex(t *testing.T) {
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	tryAuthorizedPost("/admin/reindex", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/task", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"status\": \"open\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/task/labels", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"category\": \"work\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Existing keys aren't indexed until the indexes are rebuilt
+	core.Config.DataIndexes = []core.DataIndex{{KeyPattern: "*", Field: "status"}}
+	t.Cleanup(func() {
+		core.Config.DataIndexes = nil
+	})
+
+	tryAuthorizedGet("/data/query?field=status", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"keys\":[]}", response.Body.String())
+		},
+	})
+
+	// Running it again yields the same result
+	for range 2 {
+		tryAuthorizedPost("/admin/reindex", AuthorizedBodyConfig{
+			Token: adminToken,
+			Handler: func(response *httptest.ResponseRecorder) {
+				var result core.ReindexResult
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+				assert.GreaterOrEqual(t, result.DurationMs, int64(0))
+				assert.Equal(t, int64(1), result.Keys)
+				assert.Equal(t, 1, result.Labels)
+				assert.Equal(t, 1, result.Indexed)
+			},
+		})
+	}
+
+	for url, expected := range map[string]string{
+		"/data/query?field=status&value=open": "{\"keys\":[\"task\"]}",
+		"/data/keys?label=category=work":      "{\"keys\":[\"task\"]}",
+	} {
+		tryAuthorizedGet(url, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, expected, response.Body.String(), url)
+			},
+		})
+	}
+}
+
+func TestAdvanceClock(t *testing.T) {
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	tryAuthorizedPost("/test/clock", AuthorizedBodyConfig{
+		Token: adminToken,
+		Body:  "{\"by\": \"1h\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	clock := core.Default.Clock
+	core.Config.TestMode = true
+	core.Default.Clock = &core.ManualClock{}
+	t.Cleanup(func() {
+		core.Config.TestMode = false
+		core.Default.Clock = clock
+	})
+
+	tryAuthorizedPost("/test/clock", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"by\": \"1h\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	for _, body := range []string{"{}", "{\"by\": \"soon\"}", "{\"by\": \"-1h\"}"} {
+		tryAuthorizedPost("/test/clock", AuthorizedBodyConfig{
+			Token: adminToken,
+			Body:  body,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code, body)
+			},
+		})
+	}
+
+	start := time.Now()
+	tryAuthorizedPost("/test/clock", AuthorizedBodyConfig{
+		Token: adminToken,
+		Body:  "{\"by\": \"" + (core.Config.JWTExpiration + core.Config.JWTLeeway + time.Minute).String() + "\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			var result ClockResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+			assert.True(t, result.Now.After(start.Add(core.Config.JWTExpiration)))
+		},
+	})
+
+	// Sessions issued before have expired
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: loginUser(t),
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
@@ -1,11 +1,15 @@
 package routes
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/simonwep/genesis/core"
 	"go.uber.org/zap"
 	"net/http"
+	"path"
+	"strings"
 	"time"
 )
 
@@ -14,25 +18,57 @@ type loginBody struct {
 	Password string `json:"password" validate:"required"`
 }
 
-const cookieName = "gt"
+// Reasons why authenticating a request failed, used for logging and metrics
+const (
+	authFailureMissingToken     = "missing_token"
+	authFailureInvalidToken     = "invalid_token"
+	authFailureExpiredToken     = "expired_token"
+	authFailureInvalidatedToken = "invalidated_token"
+	authFailureUserNotFound     = "user_not_found"
+	authFailureUserDisabled     = "user_disabled"
+	authFailureLookupFailed     = "lookup_failed"
+)
+
+const (
+	cookieName      = "gt"
+	tokenMediaType  = "application/jwt"
+	impersonatorKey = "impersonator"
+	authFailureKey  = "authFailure"
+
+	// Using POST /login without credentials to fetch the current user is superseded by GET /account
+	whoamiDeprecation = "@1792108800"                   // 2026-10-16, see RFC 9745
+	whoamiSunset      = "Thu, 01 Jul 2027 00:00:00 GMT" // see RFC 8594
+)
 
 // Login godoc
 // @Summary      Authenticate user
 // @Description  Login with username and password, returns user info and sets JWT cookie. If already authenticated (valid cookie), returns current user info.
+// @Description  Calling it without credentials to fetch the current user is deprecated in favor of GET /account and answered with Deprecation, Sunset and Link headers.
+// @Description  Non-browser clients can pass mode=token or "Accept: application/jwt" to receive the JWT in the body (see TokenResponse) instead of a cookie.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        credentials body LoginRequest false "Login credentials (optional if cookie present)"
+// @Param        mode query string false "Set to 'token' to receive the JWT in the response body"
 // @Success      200 {object} core.PublicUser "User authenticated successfully"
-// @Failure      400 {object} ErrorResponse "Invalid JSON or validation failed"
-// @Failure      401 {object} ErrorResponse "Invalid credentials"
-// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON or validation failed"
+// @Failure      401 {object} core.ErrorResponse "Invalid credentials"
+// @Failure      403 {object} core.ErrorResponse "User is disabled"
+// @Failure      429 {object} core.ErrorResponse "Too many login attempts for this user or from this address, see Retry-After"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
 // @Router       /login [post]
 func Login(c *gin.Context) {
+	app := appOf(c)
 	validate := validator.New()
 	user := authenticateUser(c)
 
 	if user != nil {
+		if c.Request.ContentLength == 0 {
+			c.Header("Deprecation", whoamiDeprecation)
+			c.Header("Sunset", whoamiSunset)
+			c.Header("Link", "<"+path.Join("/", app.Config.BaseUrl, "account")+">; rel=\"successor-version\"")
+		}
+
 		c.JSON(http.StatusOK, core.PublicUser{
 			Name:  user.Name,
 			Admin: user.Admin,
@@ -43,38 +79,47 @@ func Login(c *gin.Context) {
 
 	var body loginBody
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
 		return
 	} else if err := validate.Struct(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation of json failed, must contain user and password"})
+		respondError(c, http.StatusBadRequest, core.CodeValidationFailed, "validation of json failed, must contain user and password")
 		return
 	}
 
-	user, err := core.AuthenticateUser(body.User, body.Password)
-	if user == nil || err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "username or password incorrect"})
+	body.User = app.NormalizeUsername(body.User)
+	if limit := allowLoginAttempt(c, body.User); !limit.Allowed {
+		respondRateLimited(c, limit, "too many login attempts, try again later")
+		return
+	}
+
+	user, err := app.AuthenticateUser(body.User, body.Password)
+	if errors.Is(err, core.ErrUserDisabled) {
+		respondError(c, http.StatusForbidden, core.CodeUserDisabled, "user is disabled")
+		return
+	} else if user == nil || err != nil {
+		respondError(c, http.StatusUnauthorized, core.CodeInvalidCredentials, "username or password incorrect")
 		return
 	}
 
-	if refreshToken, err := core.CreateAuthToken(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create auth token"})
-		core.Logger.Error("failed to create auth token", zap.Error(err))
+	if refreshToken, expiresAt, err := app.CreateAuthToken(user); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to create auth token")
+		app.Logger.Error("failed to create auth token", zap.Error(err))
 	} else {
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     cookieName,
-			Value:    refreshToken,
-			Path:     "/",
-			Expires:  time.Now().Add(core.Config.JWTExpiration),
-			Secure:   !core.Config.JWTCookieAllowHTTP,
-			HttpOnly: true,
-			SameSite: http.SameSiteStrictMode,
-		})
+		respondWithSession(c, user, refreshToken, expiresAt, "")
+	}
+}
 
-		c.JSON(http.StatusOK, core.PublicUser{
-			Name:  user.Name,
-			Admin: user.Admin,
-		})
+// allowLoginAttempt throttles login attempts per username, regardless of whether it exists, and per client address.
+// The limit which has been reached is returned if an attempt isn't allowed.
+func allowLoginAttempt(c *gin.Context, name string) core.RateLimit {
+	app := appOf(c)
+	window := app.Config.LoginRateLimitWindow
+
+	if limit := app.LoginLimiter.Allow("user:"+name, app.Config.LoginRateLimit, window, app.Now()); !limit.Allowed {
+		return limit
 	}
+
+	return app.LoginLimiter.Allow("ip:"+c.ClientIP(), app.Config.LoginRateLimitPerIP, window, app.Now())
 }
 
 // Logout godoc
@@ -83,44 +128,185 @@ func Login(c *gin.Context) {
 // @Tags         auth
 // @Produce      json
 // @Success      200 "Logout successful"
-// @Failure      401 {object} ErrorResponse "No refresh token found or invalid token"
-// @Failure      500 {object} ErrorResponse "Failed to invalidate token"
+// @Failure      401 {object} core.ErrorResponse "No refresh token found or invalid token"
+// @Failure      500 {object} core.ErrorResponse "Failed to invalidate token"
 // @Security     CookieAuth
 // @Router       /logout [post]
 func Logout(c *gin.Context) {
-	refreshToken, err := c.Cookie(cookieName)
-
-	if err != nil || len(refreshToken) == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token not found"})
-	} else if parsed, err := core.ParseAuthToken(refreshToken); err != nil || parsed == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
-	} else if err := core.StoreInvalidatedToken(parsed.ID, parsed.ExpiresAt.Sub(time.Now())); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store invalidated token"})
-	} else {
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     cookieName,
-			Value:    "",
-			Path:     "/",
-			Expires:  time.Now(),
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteStrictMode,
-		})
+	app := appOf(c)
+	refreshToken := getAuthToken(c)
 
+	if len(refreshToken) == 0 {
+		respondUnauthorized(c)
+	} else if parsed, err := app.ParseAuthToken(refreshToken); err != nil || parsed == nil {
+		respondUnauthorized(c)
+	} else if err := app.InvalidateToken(parsed); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to store invalidated token")
+	} else {
+		clearSessionCookie(c)
 		c.Status(http.StatusOK)
 	}
 }
 
+// clearSessionCookie tells browsers to remove the session cookie by letting it expire at the epoch, which is in the past
+// regardless of the clock of the app or the browser.
+// Browsers only replace a cookie with the same domain and path, so it's scoped the same way as the session cookie.
+func clearSessionCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, sessionCookie(appOf(c), "", time.Unix(0, 0)))
+}
+
+// sessionCookie returns the cookie storing token until expiresAt, scoped as configured by GENESIS_JWT_COOKIE_DOMAIN,
+// GENESIS_JWT_COOKIE_PATH and GENESIS_JWT_COOKIE_SAMESITE.
+func sessionCookie(app *core.App, token string, expiresAt time.Time) *http.Cookie {
+	sameSite := http.SameSiteStrictMode
+	switch app.Config.JWTCookieSameSite {
+	case core.CookieSameSiteLax:
+		sameSite = http.SameSiteLaxMode
+	case core.CookieSameSiteNone:
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     cookiePath(app.Config),
+		Domain:   app.Config.JWTCookieDomain,
+		Expires:  expiresAt,
+		Secure:   !app.Config.JWTCookieAllowHTTP,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+}
+
+// cookiePath returns GENESIS_JWT_COOKIE_PATH, or the base url if it isn't set, so the cookie is only sent to the API.
+func cookiePath(config *core.AppConfig) string {
+	if len(config.JWTCookiePath) != 0 {
+		return config.JWTCookiePath
+	}
+
+	return path.Join("/", config.BaseUrl)
+}
+
+// authenticateUser returns the user of the current session, or nil if there is none.
+// The reason why authentication failed is logged and available via authFailureReason, it must never be sent to clients.
 func authenticateUser(c *gin.Context) *core.User {
-	refreshToken, err := c.Cookie(cookieName)
+	app := appOf(c)
+	refreshToken := getAuthToken(c)
 
-	if err != nil || len(refreshToken) == 0 {
-		return nil
-	} else if parsed, err := core.ParseAuthToken(refreshToken); err != nil || parsed == nil {
-		return nil
-	} else if user, err := core.GetUser(parsed.User); err != nil {
-		return nil
+	if len(refreshToken) == 0 {
+		return failAuthentication(c, authFailureMissingToken, nil)
+	} else if parsed, err := app.ParseAuthToken(refreshToken); err != nil || parsed == nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return failAuthentication(c, authFailureExpiredToken, err)
+		case errors.Is(err, core.ErrTokenInvalidated):
+			return failAuthentication(c, authFailureInvalidatedToken, err)
+		default:
+			return failAuthentication(c, authFailureInvalidToken, err)
+		}
+	} else if user, err := app.GetUser(parsed.User); err != nil {
+		return failAuthentication(c, authFailureLookupFailed, err)
+	} else if user == nil {
+		return failAuthentication(c, authFailureUserNotFound, nil)
+	} else if !parsed.IssuedFor(user) {
+		return failAuthentication(c, authFailureInvalidatedToken, nil)
+	} else if user.Disabled {
+		return failAuthentication(c, authFailureUserDisabled, nil)
 	} else {
+		if len(parsed.Impersonator) != 0 {
+			c.Set(impersonatorKey, parsed.Impersonator)
+		}
+
 		return user
 	}
 }
+
+// sessionUser returns the name of the user the request has been sent by without looking them up, empty if there's no valid session.
+func sessionUser(c *gin.Context) string {
+	if token := getAuthToken(c); len(token) == 0 {
+		return ""
+	} else if parsed, err := appOf(c).ParseAuthToken(token); err != nil || parsed == nil {
+		return ""
+	} else {
+		return parsed.User
+	}
+}
+
+func failAuthentication(c *gin.Context, reason string, err error) *core.User {
+	app := appOf(c)
+	c.Set(authFailureKey, reason)
+	app.Logger.Debug("authentication failed", zap.String("reason", reason), zap.String("path", c.FullPath()), zap.Error(err))
+	return nil
+}
+
+// authFailureReason returns a coarse reason why authenticateUser failed for this request, empty if it didn't.
+func authFailureReason(c *gin.Context) string {
+	return c.GetString(authFailureKey)
+}
+
+// respondUnauthorized answers a request without a valid session, which is configured centrally to send a
+// WWW-Authenticate challenge and to omit the error body, so responses don't reveal more than necessary.
+func respondUnauthorized(c *gin.Context) {
+	app := appOf(c)
+
+	if len(app.Config.AuthChallenge) != 0 {
+		c.Header("WWW-Authenticate", app.Config.AuthChallenge)
+	}
+
+	if app.Config.AuthErrorBody == core.AuthErrorBodyNone {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	} else {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, core.ErrorResponse{Error: "unauthorized", Code: core.CodeUnauthorized})
+	}
+}
+
+// authenticateAdmin returns the current user if it's an admin, sessions of an impersonating admin are never considered to be one.
+// It's the only way handlers check for admin rights, which are taken from the user as currently stored and never from the token.
+func authenticateAdmin(c *gin.Context) *core.User {
+	user := authenticateUser(c)
+
+	if user == nil || !user.Admin || len(c.GetString(impersonatorKey)) != 0 {
+		return nil
+	}
+
+	return user
+}
+
+// respondWithSession hands out token as session cookie or, for non-browser clients, in the response body.
+// expiresAt must be the expiry of token as returned when creating it.
+func respondWithSession(c *gin.Context, user *core.User, token string, expiresAt time.Time, impersonator string) {
+	app := appOf(c)
+	if wantsTokenInBody(c) {
+		c.JSON(http.StatusOK, TokenResponse{
+			Name:         user.Name,
+			Admin:        user.Admin,
+			Impersonator: impersonator,
+			Token:        token,
+			ExpiresAt:    expiresAt,
+		})
+
+		return
+	}
+
+	http.SetCookie(c.Writer, sessionCookie(app, token, expiresAt))
+
+	c.JSON(http.StatusOK, core.PublicUser{
+		Name:  user.Name,
+		Admin: user.Admin,
+	})
+}
+
+// getAuthToken returns the token sent as bearer token or, if there is none, the one from the session cookie.
+func getAuthToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	} else if token, err := c.Cookie(cookieName); err == nil {
+		return token
+	}
+
+	return ""
+}
+
+func wantsTokenInBody(c *gin.Context) bool {
+	return c.Query("mode") == "token" || strings.Contains(c.GetHeader("Accept"), tokenMediaType)
+}
@@ -1,11 +1,17 @@
 package routes
 
 import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func loginUser(t *testing.T) string {
@@ -40,6 +46,20 @@ func loginAdmin(t *testing.T) string {
 	return token
 }
 
+func loginAs(t *testing.T, user, password string) string {
+	var token string
+
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"" + user + "\", \"password\": \"" + password + "\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			token = response.Header().Get("Set-Cookie")
+		},
+	})
+
+	return token
+}
+
 func TestInvalidLogin(t *testing.T) {
 	core.ResetDatabase()
 
@@ -94,6 +114,89 @@ func TestLogout(t *testing.T) {
 	})
 }
 
+func TestCrossSubdomainCookie(t *testing.T) {
+	core.Config.JWTCookieDomain = ".example.com"
+	core.Config.JWTCookieSameSite = core.CookieSameSiteNone
+	t.Cleanup(func() {
+		core.Config.JWTCookieDomain = ""
+		core.Config.JWTCookieSameSite = core.CookieSameSiteStrict
+	})
+
+	token := loginUser(t)
+	for _, attribute := range []string{"Path=/", "Domain=example.com", "HttpOnly", "Secure", "SameSite=None"} {
+		assert.Contains(t, token, attribute)
+	}
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// The cookie is only removed by browsers if the domain matches the one it was set with
+	tryAuthorizedPost("/logout", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			cookie := response.Header().Get("Set-Cookie")
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, cookie, "gt=;")
+
+			for _, attribute := range []string{"Path=/", "Domain=example.com", "HttpOnly", "Secure", "SameSite=None"} {
+				assert.Contains(t, cookie, attribute)
+			}
+		},
+	})
+}
+
+func TestCookiePath(t *testing.T) {
+	core.Config.BaseUrl = "/api"
+	t.Cleanup(func() {
+		core.Config.BaseUrl = ""
+		core.Config.JWTCookiePath = ""
+	})
+
+	core.ResetDatabase()
+	var token string
+
+	tryUnauthorizedPost("/api/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"hgEiPCZP\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			token = response.Header().Get("Set-Cookie")
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, token, "Path=/api;")
+		},
+	})
+
+	tryAuthorizedGet("/api/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// The cookie is only removed by browsers if the path matches the one it was set with
+	tryAuthorizedPost("/api/logout", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			cookie := response.Header().Get("Set-Cookie")
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, cookie, "gt=;")
+			assert.Contains(t, cookie, "Path=/api;")
+		},
+	})
+
+	core.Config.JWTCookiePath = "/"
+
+	tryUnauthorizedPost("/api/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"hgEiPCZP\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Header().Get("Set-Cookie"), "Path=/;")
+		},
+	})
+}
+
 func TestReLogin(t *testing.T) {
 	token := loginUser(t)
 
@@ -101,6 +204,9 @@ func TestReLogin(t *testing.T) {
 		Token: token,
 		Handler: func(response *httptest.ResponseRecorder) {
 			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NotEmpty(t, response.Header().Get("Deprecation"))
+			assert.NotEmpty(t, response.Header().Get("Sunset"))
+			assert.Contains(t, response.Header().Get("Link"), "/account>")
 		},
 	})
 
@@ -111,3 +217,637 @@ func TestReLogin(t *testing.T) {
 		},
 	})
 }
+
+func TestLoginTokenMode(t *testing.T) {
+	core.ResetDatabase()
+	var body TokenResponse
+
+	// Start in between two seconds as the expiry of tokens is only precise to the second
+	start := time.Now().Add(time.Hour).Truncate(time.Second).Add(500 * time.Millisecond)
+	previous := core.Default.Clock
+	core.Default.Clock = core.NewFakeClock(start)
+	t.Cleanup(func() {
+		core.Default.Clock = previous
+	})
+
+	tryUnauthorizedPost("/login?mode=token", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"hgEiPCZP\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Header().Get("Set-Cookie"))
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, "foo", body.Name)
+			assert.NotEmpty(t, body.Token)
+		},
+	})
+
+	claims, err := core.ParseAuthToken(body.Token)
+	assert.NoError(t, err)
+	assert.True(t, body.ExpiresAt.Equal(claims.ExpiresAt.Time))
+	assert.True(t, body.ExpiresAt.Equal(start.Add(core.Config.JWTExpiration).Truncate(time.Second)))
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Headers: map[string]string{"Authorization": "Bearer " + body.Token},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/logout", AuthorizedBodyConfig{
+		Headers: map[string]string{"Authorization": "Bearer " + body.Token},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Headers: map[string]string{"Authorization": "Bearer " + body.Token},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestLoginAcceptJWT(t *testing.T) {
+	core.ResetDatabase()
+
+	tryAuthorizedPost("/login", AuthorizedBodyConfig{
+		Body:    "{\"user\": \"foo\", \"password\": \"hgEiPCZP\"}",
+		Headers: map[string]string{"Accept": "application/jwt"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\"token\":")
+		},
+	})
+}
+
+func TestForgedSigningMethod(t *testing.T) {
+	core.ResetDatabase()
+
+	claims := core.JWTClaim{
+		User: "bar",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			ID:        "forged",
+		},
+	}
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.NoError(t, err)
+
+	hs384, err := jwt.NewWithClaims(jwt.SigningMethodHS384, claims).SignedString(core.Config.JWTSecret)
+	assert.NoError(t, err)
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(core.Config.JWTSecret)
+	assert.NoError(t, err)
+
+	for _, token := range []string{unsigned, hs384} {
+		tryAuthorizedGet("/data", AuthorizedConfig{
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, response.Code)
+			},
+		})
+
+		_, err := core.ParseAuthToken(token)
+		assert.Error(t, err)
+	}
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Headers: map[string]string{"Authorization": "Bearer " + hs256},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestIssuerAndAudience(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.JWTIssuer = "genesis"
+	core.Config.JWTAudience = "service-a"
+	t.Cleanup(func() {
+		core.Config.JWTIssuer = ""
+		core.Config.JWTAudience = ""
+	})
+
+	// Tokens without the claims are rejected once they're configured
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	token = loginAs(t, "foo", "hgEiPCZP")
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	foreign, err := jwt.NewWithClaims(jwt.SigningMethodHS256, core.JWTClaim{
+		User: "foo",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Issuer:    "genesis",
+			Audience:  jwt.ClaimStrings{"service-b"},
+			ID:        "foreign",
+		},
+	}).SignedString(core.Config.JWTSecret)
+	assert.NoError(t, err)
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Headers: map[string]string{"Authorization": "Bearer " + foreign},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestTokenLeeway(t *testing.T) {
+	loginUser(t)
+
+	leeway := core.Config.JWTLeeway
+	t.Cleanup(func() {
+		core.Config.JWTLeeway = leeway
+	})
+
+	sign := func(notBefore, expiresAt time.Time) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, core.JWTClaim{
+			User: "foo",
+			RegisteredClaims: jwt.RegisteredClaims{
+				NotBefore: jwt.NewNumericDate(notBefore),
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+				ID:        "leeway",
+			},
+		}).SignedString(core.Config.JWTSecret)
+		assert.NoError(t, err)
+		return signed
+	}
+
+	now := time.Now()
+	early := sign(now.Add(10*time.Second), now.Add(time.Hour))
+	late := sign(now.Add(-time.Hour), now.Add(-10*time.Second))
+
+	for _, leeway := range []time.Duration{0, 30 * time.Second} {
+		core.Config.JWTLeeway = leeway
+
+		for _, token := range []string{early, late} {
+			tryAuthorizedGet("/account", AuthorizedConfig{
+				Headers: map[string]string{"Authorization": "Bearer " + token},
+				Handler: func(response *httptest.ResponseRecorder) {
+					if leeway == 0 {
+						assert.Equal(t, http.StatusUnauthorized, response.Code)
+					} else {
+						assert.Equal(t, http.StatusOK, response.Code)
+					}
+				},
+			})
+		}
+	}
+
+	// Issued tokens aren't valid before they've been issued
+	token, _, err := core.CreateAuthToken(&core.User{Name: "foo"})
+	assert.NoError(t, err)
+
+	claims, err := core.ParseAuthToken(token)
+	assert.NoError(t, err)
+	assert.NotNil(t, claims.NotBefore)
+	assert.NotNil(t, claims.IssuedAt)
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	core.ResetDatabase()
+
+	core.Config.LoginRateLimit = 2
+	t.Cleanup(func() {
+		core.Config.LoginRateLimit = 0
+		core.Default.LoginLimiter.Reset()
+	})
+
+	for _, user := range []string{"foo", "unknown"} {
+		for i := 0; i < 2; i++ {
+			tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+				Body: "{\"user\": \"" + user + "\", \"password\": \"wrong\"}",
+				Handler: func(response *httptest.ResponseRecorder) {
+					assert.Equal(t, http.StatusUnauthorized, response.Code)
+				},
+			})
+		}
+
+		tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+			Body: "{\"user\": \"" + user + "\", \"password\": \"wrong\"}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusTooManyRequests, response.Code)
+				assert.Equal(t, "60", response.Header().Get("Retry-After"))
+
+				var body core.ErrorResponse
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+				assert.Equal(t, core.CodeTooManyRequests, body.Code)
+				assert.Equal(t, int64(2), *body.Limit)
+				assert.Equal(t, int64(2), *body.Current)
+				assert.WithinDuration(t, time.Now().Add(time.Minute), *body.ResetAt, 5*time.Second)
+			},
+		})
+	}
+
+	// Other users are not affected
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"baz\", \"password\": \"8d7f6g5h\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := core.Default.Clock
+
+	core.Default.Clock = core.NewFakeClock(start)
+	core.Config.LoginRateLimit = 1
+	t.Cleanup(func() {
+		core.Default.Clock = clock
+		core.Config.LoginRateLimit = 0
+		core.Default.LoginLimiter.Reset()
+	})
+
+	token := loginUser(t)
+	expiry := start.Add(core.Config.JWTExpiration + core.Config.JWTLeeway)
+
+	// Timestamps are taken from the clock
+	tryAuthorizedPost("/data/key", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/key/meta", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var meta core.DataMeta
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &meta))
+			assert.Equal(t, start, *meta.UpdatedAt)
+		},
+	})
+
+	// Sessions expire exactly once the leeway has passed
+	for offset, status := range map[time.Duration]int{-time.Second: http.StatusOK, 0: http.StatusUnauthorized} {
+		core.Default.Clock.(*core.FakeClock).Set(expiry.Add(offset))
+
+		tryAuthorizedGet("/account", AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code, offset)
+			},
+		})
+	}
+
+	// Lockouts end once the window has passed
+	for _, status := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+			Body: "{\"user\": \"foo\", \"password\": \"wrong\"}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code)
+			},
+		})
+	}
+
+	core.Default.Clock.(*core.FakeClock).Advance(core.Config.LoginRateLimitWindow)
+
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"hgEiPCZP\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestAuthFailureReason(t *testing.T) {
+	token := loginUser(t)
+
+	authenticate := func(cookie string) (*core.User, string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/data", nil)
+		c.Request.Header.Set("Cookie", cookie)
+		return authenticateUser(c), authFailureReason(c)
+	}
+
+	sign := func(user string, expiresAt time.Time) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, core.JWTClaim{
+			User: user,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+				ID:        user,
+			},
+		}).SignedString(core.Config.JWTSecret)
+		assert.NoError(t, err)
+		return "gt=" + signed
+	}
+
+	user, reason := authenticate(token)
+	assert.NotNil(t, user)
+	assert.Empty(t, reason)
+
+	for cookie, expected := range map[string]string{
+		"":                                      authFailureMissingToken,
+		"gt=ab":                                 authFailureInvalidToken,
+		sign("foo", time.Now().Add(-time.Hour)): authFailureExpiredToken,
+		sign("nobody", time.Now().Add(time.Hour)): authFailureUserNotFound,
+	} {
+		user, reason := authenticate(cookie)
+		assert.Nil(t, user)
+		assert.Equal(t, expected, reason)
+	}
+
+	tryAuthorizedPost("/logout", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	_, reason = authenticate(token)
+	assert.Equal(t, authFailureInvalidatedToken, reason)
+}
+
+func TestLogoutExpiredToken(t *testing.T) {
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, core.JWTClaim{
+		User: "foo",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			ID:        "expired",
+		},
+	}).SignedString(core.Config.JWTSecret)
+	assert.NoError(t, err)
+
+	tryAuthorizedPost("/logout", AuthorizedBodyConfig{
+		Headers: map[string]string{"Authorization": "Bearer " + expired},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	assert.NoError(t, core.StoreInvalidatedToken("expired", -time.Hour))
+	assert.NoError(t, core.StoreInvalidatedToken("expired", 0))
+
+	blacklisted, err := core.IsTokenBlacklisted("expired")
+	assert.NoError(t, err)
+	assert.False(t, blacklisted)
+}
+
+func TestSecretRotation(t *testing.T) {
+	token := loginUser(t)
+	secret := core.Config.JWTSecret
+	t.Cleanup(func() {
+		core.Config.JWTSecret = secret
+		core.Config.JWTPreviousSecret = nil
+	})
+
+	core.Config.JWTSecret = []byte("rotated")
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	// Tokens signed with the previous secret remain valid, new ones are signed with the current secret
+	core.Config.JWTPreviousSecret = secret
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	user, err := core.GetUser("foo")
+	assert.NoError(t, err)
+
+	rotated, _, err := core.CreateAuthToken(user)
+	assert.NoError(t, err)
+
+	_, err = jwt.Parse(rotated, func(*jwt.Token) (interface{}, error) {
+		return []byte("rotated"), nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestPasswordRehash(t *testing.T) {
+	loginUser(t)
+
+	core.Config.PasswordHash = core.PasswordHashArgon2id
+	core.Config.Argon2Memory = 1024
+	core.Config.Argon2Time = 1
+	t.Cleanup(func() {
+		core.Config.PasswordHash = core.PasswordHashBcrypt
+		core.Config.Argon2Memory = 65_536
+		core.Config.Argon2Time = 3
+		_, _ = core.AuthenticateUser("foo", "hgEiPCZP")
+	})
+
+	// Existing bcrypt hashes keep working and are upgraded on login
+	loginAs(t, "foo", "hgEiPCZP")
+
+	user, err := core.GetUser("foo")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$v=19$m=1024,t=1,p=2$"))
+
+	loginAs(t, "foo", "hgEiPCZP")
+
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"wrong\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	// Switching back rehashes using bcrypt
+	core.Config.PasswordHash = core.PasswordHashBcrypt
+	loginAs(t, "foo", "hgEiPCZP")
+
+	user, err = core.GetUser("foo")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(user.Password, "$2a$10$"))
+}
+
+func TestUnauthorizedResponse(t *testing.T) {
+	tryUnauthorizedGet("/data", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+			assert.Empty(t, response.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, "{\"error\":\"unauthorized\",\"code\":\"UNAUTHORIZED\"}", response.Body.String())
+		},
+	})
+
+	core.Config.AuthChallenge = "Bearer realm=\"genesis\""
+	core.Config.AuthErrorBody = core.AuthErrorBodyNone
+	t.Cleanup(func() {
+		core.Config.AuthChallenge = ""
+		core.Config.AuthErrorBody = core.AuthErrorBodyJson
+	})
+
+	for _, url := range []string{"/data", "/account", "/teams", "/data/key/share"} {
+		tryUnauthorizedGet(url, UnauthorizedConfig{
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnauthorized, response.Code)
+				assert.Equal(t, "Bearer realm=\"genesis\"", response.Header().Get("WWW-Authenticate"))
+				assert.Empty(t, response.Body.String())
+			},
+		})
+	}
+
+	tryUnauthorizedPost("/logout", UnauthorizedBodyConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+			assert.Equal(t, "Bearer realm=\"genesis\"", response.Header().Get("WWW-Authenticate"))
+		},
+	})
+
+	// Wrong credentials on login aren't a missing session and keep their message
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"wrong\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+			assert.Contains(t, response.Body.String(), "username or password incorrect")
+		},
+	})
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	token := loginUser(t)
+	otherToken := loginAs(t, "baz", "8d7f6g5h")
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	router := gin.New()
+	router.Use(gin.Recovery(), func(c *gin.Context) {
+		c.Set(appKey, core.Default)
+	}, middleware.LimitConcurrency(1, sessionUser))
+	router.GET("/slow", func(c *gin.Context) {
+		entered <- struct{}{}
+		<-release
+		c.Status(http.StatusOK)
+	})
+	router.GET("/fast", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("failed")
+	})
+
+	serve := func(path, token string) int {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", path, nil)
+		request.Header.Set("Cookie", token)
+		router.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	done := make(chan int)
+	go func() {
+		done <- serve("/slow", token)
+	}()
+	<-entered
+
+	// Only requests of the same user are limited
+	assert.Equal(t, http.StatusTooManyRequests, serve("/fast", token))
+	assert.Equal(t, http.StatusOK, serve("/fast", otherToken))
+	assert.Equal(t, http.StatusOK, serve("/fast", ""))
+
+	// Rejections include the limit like other limits do
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/fast", nil)
+	request.Header.Set("Cookie", token)
+	router.ServeHTTP(response, request)
+	assert.Equal(t, "{\"error\":\"too many concurrent requests\",\"code\":\"TOO_MANY_REQUESTS\",\"limit\":1,\"current\":1}", response.Body.String())
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, http.StatusOK, serve("/fast", token))
+
+	// Slots are released even if the handler panics
+	assert.Equal(t, http.StatusInternalServerError, serve("/panic", token))
+	assert.Equal(t, http.StatusOK, serve("/fast", token))
+}
+
+func TestInvalidatedTokenExpiry(t *testing.T) {
+	loginUser(t)
+
+	assert.NoError(t, core.StoreInvalidatedToken("short", time.Second))
+	blacklisted, err := core.IsTokenBlacklisted("short")
+	assert.NoError(t, err)
+	assert.True(t, blacklisted)
+
+	// Entries disappear along with the token, the sweep deletes them right away
+	time.Sleep(2 * time.Second)
+
+	blacklisted, err = core.IsTokenBlacklisted("short")
+	assert.NoError(t, err)
+	assert.False(t, blacklisted)
+
+	swept, err := core.SweepInvalidatedTokens()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, swept)
+
+	swept, err = core.SweepInvalidatedTokens()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, swept)
+
+	// Tokens without expiry couldn't be invalidated for a bounded time and are rejected
+	unbounded, err := jwt.NewWithClaims(jwt.SigningMethodHS256, core.JWTClaim{
+		User:             "foo",
+		RegisteredClaims: jwt.RegisteredClaims{ID: "unbounded"},
+	}).SignedString(core.Config.JWTSecret)
+	assert.NoError(t, err)
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Headers: map[string]string{"Authorization": "Bearer " + unbounded},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestAdminRightsOfExistingSessions(t *testing.T) {
+	token := loginAdmin(t)
+	userToken := loginAs(t, "foo", "hgEiPCZP")
+
+	// The token only identifies the user, the admin flag is never part of it
+	parsed, err := core.ParseAuthToken(strings.TrimPrefix(strings.Split(token, ";")[0], "gt="))
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", parsed.User)
+
+	// Demoting an admin revokes their rights with the next request of the existing session
+	assert.NoError(t, core.UpdateUser("bar", core.PartialUser{Admin: new(bool)}))
+	tryAuthorizedGet("/user", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\"admin\":false")
+		},
+	})
+
+	// Promoting a user grants them the rights without logging in again
+	admin := true
+	assert.NoError(t, core.UpdateUser("foo", core.PartialUser{Admin: &admin}))
+	tryAuthorizedGet("/user", AuthorizedConfig{
+		Token: userToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"path"
+)
+
+// SetDataBatch godoc
+// @Summary      Set multiple keys at once or create a key
+// @Description  Store or update multiple keys with a single multipart/form-data request, where the name of each part is the key and its content the JSON value.
+// @Description  Each part is validated like a single POST /data/{key}, invalid parts are reported in the result without aborting the request.
+// @Description  A single application/json body is stored under a new key generated by the server instead, which is a ULID so keys sort by their creation.
+// @Tags         data
+// @Accept       mpfd
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} BatchResponse "Result per key"
+// @Success      201 {object} CreatedDataResponse "Generated key of a JSON body, which is sent as Location header as well"
+// @Failure      400 {object} core.ErrorResponse "Not a multipart body, or invalid JSON"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Too many keys (limit exceeded) for a JSON body"
+// @Failure      413 {object} core.ErrorResponse "Request entity too large"
+// @Failure      500 {object} core.ErrorResponse "Failed to set data"
+// @Failure      507 {object} core.ErrorResponse "Maximum amount of keys across all users reached for a JSON body"
+// @Security     CookieAuth
+// @Router       /data [post]
+func SetDataBatch(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+		return
+	} else if c.ContentType() == "application/json" {
+		createData(c, user)
+		return
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "expected a multipart/form-data body")
+		return
+	}
+
+	response := BatchResponse{Results: make([]BatchResult, 0)}
+
+	for {
+		part, err := reader.NextPart()
+
+		var maxBytesError *http.MaxBytesError
+		if errors.Is(err, io.EOF) {
+			break
+		} else if errors.As(err, &maxBytesError) {
+			respondError(c, http.StatusRequestEntityTooLarge, core.CodeTooLarge, "request entity too large")
+			return
+		} else if err != nil {
+			respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid multipart body")
+			return
+		}
+
+		key := part.FormName()
+		data, err := io.ReadAll(io.LimitReader(part, app.Config.AppDataMaxSize+1))
+		_ = part.Close()
+
+		var limitError *middleware.JsonLimitError
+		result := BatchResult{Key: key, Status: http.StatusOK}
+		if err != nil {
+			result.Status, result.Code, result.Error = http.StatusBadRequest, core.CodeInvalidBody, "invalid body"
+		} else if status, failure := checkDataKey(app, user.Name, key); status != 0 {
+			result.Status, result.Code, result.Error = status, failure.Code, failure.Error
+		} else if int64(len(data)) > app.Config.AppDataMaxSize {
+			result.Status, result.Code, result.Error = http.StatusRequestEntityTooLarge, core.CodeTooLarge, tooLargeMessage(app)
+		} else if minified, err := processJsonBytes(app, data); errors.Is(err, middleware.ErrInvalidEncoding) {
+			result.Status, result.Code, result.Error = http.StatusBadRequest, core.CodeInvalidEncoding, err.Error()
+		} else if errors.As(err, &limitError) {
+			result.Status, result.Code, result.Error = http.StatusBadRequest, core.CodeJsonLimitExceeded, err.Error()
+		} else if err != nil {
+			result.Status, result.Code, result.Error = http.StatusBadRequest, core.CodeInvalidJson, "invalid json"
+		} else if err := app.SetDataForUser(user.Name, key, minified); errors.Is(err, core.ErrStorageFull) {
+			result.Status, result.Code, result.Error = http.StatusInsufficientStorage, core.CodeStorageFull, err.Error()
+		} else if err != nil {
+			result.Status, result.Code, result.Error = http.StatusInternalServerError, core.CodeInternal, "failed to set data"
+			app.Logger.Error("failed to set data", zap.Error(err))
+		}
+
+		if result.Status == http.StatusOK {
+			response.Stored++
+		} else {
+			response.Failed++
+		}
+
+		response.Results = append(response.Results, result)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// createData stores a single JSON body under a key generated for user.
+func createData(c *gin.Context, user *core.User) {
+	app := appOf(c)
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, app.Config.AppDataMaxSize+1))
+
+	var maxBytesError *http.MaxBytesError
+	var limitError *middleware.JsonLimitError
+	if errors.As(err, &maxBytesError) || int64(len(data)) > app.Config.AppDataMaxSize {
+		respondError(c, http.StatusRequestEntityTooLarge, core.CodeTooLarge, tooLargeMessage(app))
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid body")
+	} else if minified, err := processJsonBytes(app, data); errors.Is(err, middleware.ErrInvalidEncoding) {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidEncoding, err.Error())
+	} else if errors.As(err, &limitError) {
+		respondJsonLimitExceeded(c, limitError)
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+	} else if key, err := app.CreateDataWithGeneratedKey(user.Name, minified); err != nil {
+		if errors.Is(err, core.ErrTooManyKeys) {
+			respondKeyLimitExceeded(c, user.Name)
+		} else if errors.Is(err, core.ErrStorageFull) {
+			respondStorageFull(c)
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to set data")
+			app.Logger.Error("failed to set data", zap.Error(err))
+		}
+	} else {
+		c.Header("Location", path.Join("/", app.Config.BaseUrl, "data", key))
+		c.JSON(http.StatusCreated, CreatedDataResponse{Key: key})
+	}
+}
+
+// processJsonBytes minifies or, if enabled, canonicalizes a single JSON document.
+func processJsonBytes(app *core.App, data []byte) ([]byte, error) {
+	if err := middleware.CheckJsonLimits(data, jsonLimits(app)); err != nil {
+		return nil, err
+	} else if app.Config.AppCanonicalizeJson {
+		return middleware.CanonicalizeJsonBytes(data)
+	}
+
+	return middleware.MinifyJsonBytes(data, app.Config.AppMinifyJsonNumbers)
+}
+
+// jsonLimits returns the limits of the structure of stored JSON documents, see GENESIS_JSON_MAX_DEPTH.
+func jsonLimits(app *core.App) middleware.JsonLimits {
+	return middleware.JsonLimits{
+		MaxDepth:       app.Config.AppJsonMaxDepth,
+		MaxArrayLength: app.Config.AppJsonMaxArrayLength,
+		MaxElements:    app.Config.AppJsonMaxElements,
+	}
+}
@@ -0,0 +1,146 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func buildMultipartBody(t *testing.T, parts [][2]string) (string, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, part := range parts {
+		assert.NoError(t, writer.WriteField(part[0], part[1]))
+	}
+
+	assert.NoError(t, writer.Close())
+	return body.String(), writer.FormDataContentType()
+}
+
+func TestSetDataBatch(t *testing.T) {
+	token := loginUser(t)
+
+	body, contentType := buildMultipartBody(t, [][2]string{
+		{"foo", "{\"hello\": \"world!\"}"},
+		{"bar", "[1, 2, 3]"},
+		{"baz", "{\"hello\": "},
+		{"🦧", "{}"},
+		{"qux", "{\"hello\": \"\xff\"}"},
+	})
+
+	tryAuthorizedPost("/data", AuthorizedBodyConfig{
+		Token:   token,
+		Body:    body,
+		Headers: map[string]string{"Content-Type": contentType},
+		Handler: func(response *httptest.ResponseRecorder) {
+			var result BatchResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+			assert.Equal(t, 2, result.Stored)
+			assert.Equal(t, 3, result.Failed)
+			assert.Equal(t, http.StatusBadRequest, result.Results[2].Status)
+			assert.Equal(t, http.StatusBadRequest, result.Results[3].Status)
+			assert.Equal(t, http.StatusBadRequest, result.Results[4].Status)
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"bar\":[1,2,3],\"foo\":{\"hello\":\"world!\"}}", response.Body.String())
+		},
+	})
+}
+
+func TestSetDataBatchLimits(t *testing.T) {
+	token := loginUser(t)
+
+	body, contentType := buildMultipartBody(t, [][2]string{
+		{"bar1", "1"},
+		{"bar2", "2"},
+		{"bar3", "3"},
+		{"bar4", "4"},
+	})
+
+	tryAuthorizedPost("/data", AuthorizedBodyConfig{
+		Token:   token,
+		Body:    body,
+		Headers: map[string]string{"Content-Type": contentType},
+		Handler: func(response *httptest.ResponseRecorder) {
+			var result BatchResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+			assert.Equal(t, 3, result.Stored)
+			assert.Equal(t, http.StatusForbidden, result.Results[3].Status)
+		},
+	})
+
+	tryAuthorizedPost("/data", AuthorizedBodyConfig{
+		Token:   token,
+		Body:    "{}",
+		Headers: map[string]string{"Content-Type": "text/plain"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	// JSON bodies are stored under a generated key, which is subject to the same limit
+	tryAuthorizedPost("/data", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+}
+
+func TestCreateDataWithGeneratedKey(t *testing.T) {
+	token := loginUser(t)
+	var key string
+
+	tryAuthorizedPost("/data", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"event\": \"login\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body CreatedDataResponse
+			assert.Equal(t, http.StatusCreated, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Regexp(t, "^[0-9A-HJKMNP-TV-Z]{26}$", body.Key)
+			assert.Equal(t, "/data/"+body.Key, response.Header().Get("Location"))
+			key = body.Key
+		},
+	})
+
+	tryAuthorizedGet("/data/"+key, AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"event\":\"login\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPost("/data", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"event\"",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	// Generated keys count towards the limit of keys
+	for _, status := range []int{http.StatusCreated, http.StatusCreated, http.StatusForbidden} {
+		tryAuthorizedPost("/data", AuthorizedBodyConfig{
+			Token: token,
+			Body:  "{}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code)
+			},
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// respondWithData sends json data along with caching headers, conditional requests are answered with 304 if it hasn't changed.
+func respondWithData(c *gin.Context, data []byte, lastModified *time.Time) {
+	respondWithRepresentation(c, core.ETag(data), data, lastModified)
+}
+
+// respondWithRepresentation responds with body, a representation of the data identified by etag, see respondWithData.
+func respondWithRepresentation(c *gin.Context, etag string, body []byte, lastModified *time.Time) {
+	app := appOf(c)
+
+	// Data is always user-specific and must never end up in shared caches
+	if app.Config.AppDataCacheMaxAge > 0 {
+		c.Header("Cache-Control", "private, max-age="+strconv.FormatInt(app.Config.AppDataCacheMaxAge, 10))
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+
+	c.Header("ETag", etag)
+	c.Header("Vary", "Cookie, Authorization")
+
+	if lastModified != nil {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if isNotModified(c, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+	} else {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// isNotModified evaluates If-None-Match and, only if absent, If-Modified-Since as described in RFC 9110.
+func isNotModified(c *gin.Context, etag string, lastModified *time.Time) bool {
+	if header := c.GetHeader("If-None-Match"); len(header) != 0 {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if header := c.GetHeader("If-Modified-Since"); len(header) != 0 && lastModified != nil {
+		if since, err := http.ParseTime(header); err == nil {
+			return !lastModified.Truncate(time.Second).After(since)
+		}
+	}
+
+	return false
+}
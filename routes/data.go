@@ -1,134 +1,798 @@
 package routes
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gin-gonic/gin"
 	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
 	"go.uber.org/zap"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Data godoc
 // @Summary      Get all data
-// @Description  Retrieve all data for the authenticated user as a JSON object
+// @Description  Retrieve all data for the authenticated user as a JSON object, supports conditional requests via If-None-Match
+// @Description  With shared=true the data is wrapped in an object which also lists the keys other users shared with the authenticated one.
+// @Description  Clients sending "Accept: application/x-ndjson" receive one {"key":...,"value":...} object per line instead, which is streamed without an ETag.
+// @Description  With flatten=true the object maps the dot-separated path of every leaf to its value instead, array items are addressed by their index, e.g. "list.0.name".
 // @Tags         data
 // @Produce      json
+// @Produce      x-ndjson
+// @Param        shared query bool false "Include keys shared by other users, see SharedDataResponse"
+// @Param        flatten query bool false "Flatten nested values into dot-separated paths"
+// @Param        If-None-Match header string false "ETag of a previous response"
 // @Success      200 {object} map[string]interface{} "User data as JSON object"
-// @Failure      401 {object} ErrorResponse "Unauthorized"
-// @Failure      500 {object} ErrorResponse "Failed to retrieve data"
+// @Success      304 "Data hasn't changed"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve data"
 // @Security     CookieAuth
 // @Router       /data [get]
 func Data(c *gin.Context) {
+	app := appOf(c)
 	user := authenticateUser(c)
 
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-	} else if data, err := core.GetAllDataFromUser(user.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve data"})
-		core.Logger.Error("failed to retrieve data", zap.Error(err))
+		respondUnauthorized(c)
+	} else if strings.Contains(c.GetHeader("Accept"), ndjsonMediaType) {
+		streamData(c, user.Name)
+	} else if data, err := app.GetAllDataFromUser(user.Name); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve data")
+		app.Logger.Error("failed to retrieve data", zap.Error(err))
+	} else if data, err = flattenDataIfRequested(c, data); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve data")
+		app.Logger.Error("failed to flatten data", zap.Error(err))
+	} else if c.Query("shared") == "true" {
+		if data, err := withSharedData(app, user.Name, data); err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve data")
+			app.Logger.Error("failed to retrieve shared data", zap.Error(err))
+		} else {
+			respondWithData(c, data, nil)
+		}
+	} else {
+		// Deleting a key doesn't show up in the modification time of the remaining ones, so only the ETag is reliable here
+		respondWithData(c, data, nil)
+	}
+}
+
+// flattenDataIfRequested flattens the object of all keys if the flatten query parameter is set, see flattenData.
+func flattenDataIfRequested(c *gin.Context, data []byte) ([]byte, error) {
+	if c.Query("flatten") != "true" {
+		return data, nil
+	}
+
+	return flattenData(data)
+}
+
+// flattenData turns the object of all keys into one mapping the dot-separated path of each leaf to its value,
+// e.g. {"budget":{"list":[{"name":"a"}]}} becomes {"budget.list.0.name":"a"}.
+// Empty objects and arrays are kept as leaves, so they don't disappear. Dots within names are not escaped.
+func flattenData(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var nested map[string]any
+	if err := decoder.Decode(&nested); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]any)
+	for key, value := range nested {
+		flattenValue(flat, key, value)
+	}
+
+	return marshalUnescaped(flat)
+}
+
+func flattenValue(flat map[string]any, path string, value any) {
+	switch value := value.(type) {
+	case map[string]any:
+		if len(value) == 0 {
+			flat[path] = value
+		}
+
+		for name, child := range value {
+			flattenValue(flat, path+"."+name, child)
+		}
+	case []any:
+		if len(value) == 0 {
+			flat[path] = value
+		}
+
+		for index, child := range value {
+			flattenValue(flat, path+"."+strconv.Itoa(index), child)
+		}
+	default:
+		flat[path] = value
+	}
+}
+
+// ndjsonMediaType is the media type of newline delimited JSON as sent by streamData
+const ndjsonMediaType = "application/x-ndjson"
+
+// streamData writes all keys of a user as newline delimited JSON while reading them from the database.
+func streamData(c *gin.Context, name string) {
+	app := appOf(c)
+	c.Header("Content-Type", ndjsonMediaType+"; charset=utf-8")
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("Vary", "Accept, Cookie, Authorization")
+
+	err := app.StreamDataFromUser(name, c.Writer)
+
+	// Once the first bytes are sent the status can't be changed anymore, all we can do is to log the error
+	if err != nil && !c.Writer.Written() {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve data")
+		app.Logger.Error("failed to stream data", zap.Error(err))
+	} else if err != nil {
+		app.Logger.Error("failed to stream data", zap.Error(err))
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// DataCount godoc
+// @Summary      Count keys
+// @Description  Count the keys of the authenticated user without transferring them, optionally only those starting with prefix
+// @Tags         data
+// @Produce      json
+// @Param        prefix query string false "Only count keys starting with this prefix"
+// @Success      200 {object} CountResponse "Amount of keys"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Security     CookieAuth
+// @Router       /data/count [get]
+func DataCount(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else {
+		c.JSON(http.StatusOK, CountResponse{
+			Count: app.CountDataForUser(user.Name, c.Query("prefix")),
+			Limit: app.Config.AppKeysPerUser,
+		})
+	}
+}
+
+// DataStats godoc
+// @Summary      Aggregate statistics about data
+// @Description  Count the keys and bytes of the authenticated user, grouped by the part of the key before a delimiter (GENESIS_DATA_STATS_DELIMITER).
+// @Description  Scans all keys starting with prefix without reading their values, pass the prefix of a group to break it down further.
+// @Tags         data
+// @Produce      json
+// @Param        prefix query string false "Only include keys starting with this prefix"
+// @Success      200 {object} core.DataStats "Statistics"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to compute statistics"
+// @Security     CookieAuth
+// @Router       /data/stats [get]
+func DataStats(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if stats, err := app.GetDataStatsForUser(user.Name, c.Query("prefix"), app.Config.DataStatsDelimiter); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to compute statistics")
+		app.Logger.Error("failed to compute statistics", zap.Error(err))
 	} else {
-		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		c.JSON(http.StatusOK, stats)
 	}
 }
 
+// ValidateKey godoc
+// @Summary      Validate a key
+// @Description  Check if a key is valid without storing anything, returns the pattern and maximum length keys are checked against
+// @Tags         data
+// @Produce      json
+// @Param        key query string true "Key to validate"
+// @Success      200 {object} KeyValidationResponse "Validation result"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Security     CookieAuth
+// @Router       /data/validate-key [get]
+func ValidateKey(c *gin.Context) {
+	app := appOf(c)
+	key := c.Query("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+		return
+	}
+
+	response := KeyValidationResponse{
+		Valid:     true,
+		Pattern:   app.Config.AppKeyPattern.String(),
+		MaxLength: app.Config.AppKeyMaxLength,
+	}
+
+	if message := invalidKeyMessage(app, key); len(message) != 0 {
+		response.Valid, response.Error = false, message
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// invalidKeyMessage returns why key can't be used, empty if it's valid.
+func invalidKeyMessage(app *core.App, key string) string {
+	if len(key) == 0 {
+		return "key must not be empty"
+	} else if isKeyTooLong(app, key) {
+		return keyTooLongMessage(app)
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		return "key must match " + app.Config.AppKeyPattern.String()
+	} else if slices.Contains(core.ReservedKeys, key) {
+		return reservedKeyMessage(key)
+	}
+
+	return ""
+}
+
+// DataExists godoc
+// @Summary      Check which keys exist
+// @Description  Check which of the given keys of the authenticated user exist without transferring their values.
+// @Description  Invalid keys are reported as not existing and listed separately.
+// @Tags         data
+// @Accept       json
+// @Produce      json
+// @Param        keys body []string true "Keys to check"
+// @Success      200 {object} ExistsResponse "Existence per key"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, expected an array of keys"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Security     CookieAuth
+// @Router       /data/exists [post]
+func DataExists(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+	var keys []string
+
+	if user == nil {
+		respondUnauthorized(c)
+		return
+	} else if err := c.ShouldBindJSON(&keys); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json, expected an array of keys")
+		return
+	}
+
+	valid := make([]string, 0, len(keys))
+	response := ExistsResponse{Exists: make(map[string]bool, len(keys))}
+
+	for _, key := range keys {
+		if len(invalidKeyMessage(app, key)) != 0 {
+			response.Exists[key] = false
+			response.Invalid = append(response.Invalid, key)
+		} else {
+			valid = append(valid, key)
+		}
+	}
+
+	for key, exists := range app.DataExistsForUser(user.Name, valid) {
+		response.Exists[key] = exists
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PollData godoc
+// @Summary      Poll multiple keys for changes
+// @Description  Compare the ETags the client knows for the given keys with their current values and return only the keys which changed, along with their values, and the keys which have been deleted.
+// @Description  Send an empty ETag for keys which haven't been seen yet, they're returned once they exist and aren't reported as deleted before. Invalid keys are listed separately.
+// @Tags         data
+// @Accept       json
+// @Produce      json
+// @Param        known body map[string]string true "Known ETag per key"
+// @Success      200 {object} PollResponse "Changed and deleted keys"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, expected an object of ETags"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      413 {object} core.ErrorResponse "Request entity too large"
+// @Failure      500 {object} core.ErrorResponse "Failed to poll data"
+// @Security     CookieAuth
+// @Router       /data/poll [post]
+func PollData(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+	var known map[string]string
+
+	if user == nil {
+		respondUnauthorized(c)
+		return
+	} else if err := c.ShouldBindJSON(&known); err != nil || known == nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json, expected an object of etags")
+		return
+	}
+
+	valid := make(map[string]string, len(known))
+	response := PollResponse{Changed: make(map[string]PolledValue)}
+
+	for key, etag := range known {
+		if len(invalidKeyMessage(app, key)) != 0 {
+			response.Invalid = append(response.Invalid, key)
+		} else {
+			valid[key] = etag
+		}
+	}
+
+	changed, deleted, err := app.PollDataForUser(user.Name, valid)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to poll data")
+		app.Logger.Error("failed to poll data", zap.Error(err))
+		return
+	}
+
+	for key, value := range changed {
+		response.Changed[key] = PolledValue{Value: value, ETag: core.ETag(value)}
+	}
+
+	slices.Sort(response.Invalid)
+	response.Deleted = deleted
+	c.JSON(http.StatusOK, response)
+}
+
+// IncrementDataBatch godoc
+// @Summary      Increment multiple counters at once
+// @Description  Add a number to each of the given keys within a single transaction, keys which don't exist yet are created starting at 0. Returns the resulting value of each key.
+// @Description  Integers are added exactly, other numbers as 64-bit floats. If the value stored under any key isn't a number, nothing is incremented and the keys are listed in the response.
+// @Tags         data
+// @Accept       json
+// @Produce      json
+// @Param        increments body map[string]number true "Amount to add per key"
+// @Success      200 {object} map[string]number "Resulting value per key"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, an increment isn't a number or a key is invalid"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Too many keys (limit exceeded)"
+// @Failure      409 {object} NotNumericResponse "Values of some keys aren't numbers"
+// @Failure      413 {object} core.ErrorResponse "Request entity too large"
+// @Failure      500 {object} core.ErrorResponse "Failed to increment data"
+// @Failure      507 {object} core.ErrorResponse "Maximum amount of keys across all users reached"
+// @Security     CookieAuth
+// @Router       /data/increment-batch [post]
+func IncrementDataBatch(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+	var maxBytesError *http.MaxBytesError
+	var limitError *middleware.JsonLimitError
+
+	if user == nil {
+		respondUnauthorized(c)
+		return
+	}
+
+	body, err := c.GetRawData()
+	if errors.As(err, &maxBytesError) {
+		respondError(c, http.StatusRequestEntityTooLarge, core.CodeTooLarge, tooLargeMessage(app))
+		return
+	} else if errors.As(err, &limitError) {
+		respondJsonLimitExceeded(c, limitError)
+		return
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid body")
+		return
+	}
+
+	increments, err := parseIncrements(body)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json, expected an object of numbers")
+		return
+	}
+
+	for key := range increments {
+		if message := invalidKeyMessage(app, key); len(message) != 0 {
+			code := core.CodeInvalidKeyPattern
+			if isKeyTooLong(app, key) {
+				code = core.CodeKeyTooLong
+			} else if slices.Contains(core.ReservedKeys, key) {
+				code = core.CodeKeyReserved
+			}
+
+			respondError(c, http.StatusBadRequest, code, "invalid key "+strconv.Quote(key)+": "+message)
+			return
+		}
+	}
+
+	results, failed, err := app.IncrementDataForUser(user.Name, increments)
+	switch {
+	case errors.Is(err, core.ErrNotNumeric):
+		c.JSON(http.StatusConflict, NotNumericResponse{
+			ErrorResponse: core.ErrorResponse{Error: "values of some keys aren't numbers", Code: core.CodeNotNumeric},
+			Keys:          failed,
+		})
+	case errors.Is(err, core.ErrNumberOutOfRange):
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, err.Error())
+	case errors.Is(err, core.ErrTooManyKeys):
+		respondKeyLimitExceeded(c, user.Name)
+	case errors.Is(err, core.ErrStorageFull):
+		respondStorageFull(c)
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to increment data")
+		app.Logger.Error("failed to increment data", zap.Error(err))
+	default:
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// parseIncrements decodes a JSON object mapping keys to the amount they're incremented by.
+func parseIncrements(body []byte) (map[string]json.Number, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	} else if raw == nil || decoder.More() {
+		return nil, errors.New("expected a single object")
+	}
+
+	increments := make(map[string]json.Number, len(raw))
+	for key, value := range raw {
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, errors.New("increment of " + key + " is not a number")
+		}
+
+		increments[key] = number
+	}
+
+	return increments, nil
+}
+
 // DataByKey godoc
 // @Summary      Get data by key
-// @Description  Retrieve the data stored for a specific key
+// @Description  Retrieve the data stored for a specific key, supports conditional requests via If-None-Match and If-Modified-Since
+// @Description  Keys shared by other users are read by passing their name as owner.
+// @Description  Pass envelope=true to receive the value wrapped along with its key, ETag and time of the last modification.
+// @Description  Pass a JSON value as default to receive it instead of 204 if the key doesn't exist, the key isn't created by doing so.
+// @Description  Pass download=true to make browsers save the response as {key}.json.
 // @Tags         data
 // @Produce      json
 // @Param        key path string true "Data key"
-// @Success      200 {object} map[string]interface{} "Data for the specified key"
+// @Param        owner query string false "User who shared the key"
+// @Param        default query string false "URL-encoded JSON returned if the key doesn't exist"
+// @Param        envelope query bool false "Wrap the value in a DataEnvelope"
+// @Param        pretty query bool false "Indent the response for humans, the ETag stays the one of the value"
+// @Param        download query bool false "Send the value as attachment named after the key"
+// @Param        If-None-Match header string false "ETag of a previous response"
+// @Param        If-Modified-Since header string false "Last-Modified of a previous response"
+// @Success      200 {object} map[string]interface{} "Data for the specified key, a DataEnvelope if requested"
+// @Success      304 "Data hasn't changed"
 // @Failure      204 "No content found for key"
-// @Failure      401 {object} ErrorResponse "Unauthorized"
-// @Failure      404 {object} ErrorResponse "Key not found or invalid key pattern"
-// @Failure      500 {object} ErrorResponse "Failed to retrieve data"
+// @Failure      400 {object} core.ErrorResponse "Key too long or default isn't valid JSON"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Key of the owner not shared with the user"
+// @Failure      404 {object} core.ErrorResponse "Key not found or invalid key pattern"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve data"
 // @Security     CookieAuth
 // @Router       /data/{key} [get]
 func DataByKey(c *gin.Context) {
+	app := appOf(c)
 	key := c.Param("key")
 	user := authenticateUser(c)
 
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-	} else if !core.Config.AppKeyPattern.MatchString(key) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
-	} else if data, err := core.GetDataFromUser(user.Name, key); err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			c.JSON(http.StatusNoContent, gin.H{"error": "key not found"})
+		respondUnauthorized(c)
+	} else if owner, status, failure := dataOwner(c, user, key, false); status != 0 {
+		c.JSON(status, failure)
+	} else if isKeyTooLong(app, key) {
+		respondError(c, http.StatusBadRequest, core.CodeKeyTooLong, keyTooLongMessage(app))
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		respondError(c, http.StatusNotFound, core.CodeInvalidKeyPattern, "key must match "+app.Config.AppKeyPattern.String())
+	} else if fallback, hasFallback, err := defaultValue(c); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "default must be valid json")
+	} else if data, err := app.GetDataFromUser(owner, key); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) && hasFallback {
+			respondWithKey(c, key, fallback, nil)
+		} else if errors.Is(err, badger.ErrKeyNotFound) {
+			respondError(c, http.StatusNoContent, core.CodeKeyNotFound, "key not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve unit of data"})
-			core.Logger.Error("failed to retrieve unit of data", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve unit of data")
+			app.Logger.Error("failed to retrieve unit of data", zap.Error(err))
 		}
+	} else if meta, err := app.GetDataMeta(owner, key); err != nil {
+		respondWithKey(c, key, data, nil)
 	} else {
-		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		respondWithKey(c, key, data, meta.UpdatedAt)
 	}
 }
 
+// defaultValue returns the JSON passed as default query parameter to respond with for missing keys, minified like
+// stored values. It's never stored.
+func defaultValue(c *gin.Context) ([]byte, bool, error) {
+	raw, ok := c.GetQuery("default")
+	if !ok {
+		return nil, false, nil
+	}
+
+	value, err := middleware.MinifyJsonBytes([]byte(raw), appOf(c).Config.AppMinifyJsonNumbers)
+	return value, true, err
+}
+
+// respondWithKey responds with the value of key, wrapped in a DataEnvelope and indented if requested.
+// The value is stored minified, indenting it only changes the response.
+func respondWithKey(c *gin.Context, key string, data []byte, lastModified *time.Time) {
+	var err error
+
+	// The envelope carries the ETag of the value so it can be sent as If-Match when deleting the key
+	etag := core.ETag(data)
+	body := data
+
+	if c.Query("envelope") == "true" {
+		if body, err = marshalUnescaped(DataEnvelope{Key: key, Value: data, ETag: etag, ModifiedAt: lastModified}); err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve unit of data")
+			appOf(c).Logger.Error("failed to create envelope", zap.Error(err))
+			return
+		}
+	}
+
+	if c.Query("pretty") == "true" {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve unit of data")
+			appOf(c).Logger.Error("failed to indent data", zap.Error(err))
+			return
+		}
+
+		body = indented.Bytes()
+	}
+
+	if c.Query("download") == "true" {
+		c.Header("Content-Disposition", attachmentDisposition(key+".json"))
+	}
+
+	respondWithRepresentation(c, etag, body, lastModified)
+}
+
+// attachmentDisposition returns the Content-Disposition of a download saved as filename. Names which aren't printable
+// ASCII are additionally sent encoded as filename* (RFC 5987), filename is kept with them replaced for older clients.
+func attachmentDisposition(filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || strings.ContainsRune("\"\\/%", r) {
+			return '_'
+		}
+
+		return r
+	}, filename)
+
+	if fallback == filename {
+		return "attachment; filename=\"" + filename + "\""
+	}
+
+	var encoded strings.Builder
+	for _, b := range []byte(filename) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9', strings.IndexByte("!#$&+-.^_`|~", b) >= 0:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return "attachment; filename=\"" + fallback + "\"; filename*=UTF-8''" + encoded.String()
+}
+
 // SetData godoc
 // @Summary      Set data by key
-// @Description  Store or update data for a specific key. JSON data is minified and validated.
+// @Description  Store or update data for a specific key. JSON data is minified and validated, it must be valid UTF-8.
+// @Description  POST and PUT both create or replace the key, PUT is available for clients expecting it.
+// @Description  Keys other users shared with read-write access are stored by passing their name as owner, the limits of the owner apply.
 // @Tags         data
 // @Accept       json
 // @Produce      json
 // @Param        key path string true "Data key"
+// @Param        owner query string false "User who shared the key"
 // @Param        data body map[string]interface{} true "JSON data to store"
 // @Success      200 "Data stored successfully"
-// @Failure      400 {object} ErrorResponse "Invalid key pattern or invalid body"
-// @Failure      401 {object} ErrorResponse "Unauthorized"
-// @Failure      403 {object} ErrorResponse "Too many keys (limit exceeded)"
-// @Failure      413 {object} ErrorResponse "Request entity too large"
-// @Failure      500 {object} ErrorResponse "Failed to set data"
+// @Failure      400 {object} core.ErrorResponse "Invalid key pattern, key too long, invalid body, invalid UTF-8 or JSON exceeding its limits"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Too many keys (limit exceeded) or key of the owner not shared with write access"
+// @Failure      413 {object} core.ErrorResponse "Request entity too large"
+// @Failure      500 {object} core.ErrorResponse "Failed to set data"
+// @Failure      507 {object} core.ErrorResponse "Maximum amount of keys across all users reached"
 // @Security     CookieAuth
 // @Router       /data/{key} [post]
+// @Router       /data/{key} [put]
 func SetData(c *gin.Context) {
+	app := appOf(c)
 	key := c.Param("key")
 	user := authenticateUser(c)
+	var limitError *middleware.JsonLimitError
 
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-	} else if !core.Config.AppKeyPattern.MatchString(key) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
-	} else if count := core.GetDataCountForUser(user.Name, key); count > core.Config.AppKeysPerUser {
-		c.JSON(http.StatusForbidden, gin.H{"error": "too many keys, limit is " + strconv.FormatInt(core.Config.AppKeysPerUser, 10)})
-	} else if size, err := getContentLength(c); err != nil || size > core.Config.AppDataMaxSize {
-		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request entity too large, limit is " + strconv.FormatInt(core.Config.AppDataMaxSize, 10) + " kilobytes"})
-	} else if body, err := c.GetRawData(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
-	} else if err := core.SetDataForUser(user.Name, key, body); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set data"})
-		core.Logger.Error("failed to set data", zap.Error(err))
+		respondUnauthorized(c)
+	} else if owner, status, failure := dataOwner(c, user, key, true); status != 0 {
+		c.JSON(status, failure)
+	} else if status, failure := checkDataKey(app, owner, key); status != 0 {
+		c.JSON(status, failure)
+	} else if size, err := getContentLength(c); err != nil || size > app.Config.AppDataMaxSize {
+		respondError(c, http.StatusRequestEntityTooLarge, core.CodeTooLarge, tooLargeMessage(app))
+	} else if body, err := c.GetRawData(); errors.As(err, &limitError) {
+		respondJsonLimitExceeded(c, limitError)
+	} else if errors.Is(err, middleware.ErrInvalidEncoding) {
+		respondInvalidEncoding(c)
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid body")
+	} else if err := app.SetDataForUser(owner, key, body); errors.Is(err, core.ErrStorageFull) {
+		respondStorageFull(c)
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to set data")
+		app.Logger.Error("failed to set data", zap.Error(err))
 	} else {
 		c.Status(http.StatusOK)
 	}
 }
 
+// errPatchTooLarge is returned by PatchData if the patched value exceeds the maximum data size.
+var errPatchTooLarge = errors.New("patched value too large")
+
+// PatchData godoc
+// @Summary      Patch data by key
+// @Description  Apply a JSON patch (RFC 6902) to the data stored under key. All operations are applied at once or, if one of them fails, none.
+// @Description  Test operations can be used to only apply the patch if certain values haven't been changed. Object keys are sorted in the result.
+// @Tags         data
+// @Accept       json-patch+json
+// @Produce      json
+// @Param        key path string true "Data key"
+// @Param        owner query string false "User who shared the key with read-write access"
+// @Param        patch body []map[string]interface{} true "JSON patch operations"
+// @Success      200 {object} map[string]interface{} "Patched data"
+// @Failure      400 {object} core.ErrorResponse "Invalid key pattern, key too long or invalid body"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Key of the owner not shared with write access"
+// @Failure      404 {object} core.ErrorResponse "Key not found"
+// @Failure      409 {object} core.ErrorResponse "A test operation failed"
+// @Failure      413 {object} core.ErrorResponse "Request entity or patched value too large"
+// @Failure      415 {object} core.ErrorResponse "Content type isn't application/json-patch+json"
+// @Failure      422 {object} core.ErrorResponse "Invalid patch"
+// @Failure      500 {object} core.ErrorResponse "Failed to patch data"
+// @Failure      507 {object} core.ErrorResponse "Maximum amount of keys across all users reached"
+// @Security     CookieAuth
+// @Router       /data/{key} [patch]
+func PatchData(c *gin.Context) {
+	app := appOf(c)
+	key := c.Param("key")
+	user := authenticateUser(c)
+	var patched []byte
+	var maxBytesError *http.MaxBytesError
+	var limitError *middleware.JsonLimitError
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if c.ContentType() != "application/json-patch+json" {
+		respondError(c, http.StatusUnsupportedMediaType, core.CodeUnsupportedMediaType, "content type must be application/json-patch+json")
+	} else if owner, status, failure := dataOwner(c, user, key, true); status != 0 {
+		c.JSON(status, failure)
+	} else if status, failure := checkDataKey(app, owner, key); status != 0 {
+		c.JSON(status, failure)
+	} else if body, err := c.GetRawData(); errors.As(err, &maxBytesError) {
+		respondError(c, http.StatusRequestEntityTooLarge, core.CodeTooLarge, tooLargeMessage(app))
+	} else if errors.Is(err, middleware.ErrInvalidEncoding) {
+		respondInvalidEncoding(c)
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid body")
+	} else if err := app.UpdateDataForUser(owner, key, func(current []byte) ([]byte, error) {
+		if current == nil {
+			return nil, core.ErrDataNotFound
+		} else if result, err := core.ApplyJSONPatch(current, body); err != nil {
+			return nil, err
+		} else if patched, err = processJsonBytes(app, result); err != nil {
+			return nil, err
+		} else if int64(len(patched)) > app.Config.AppDataMaxSize {
+			return nil, errPatchTooLarge
+		}
+
+		return patched, nil
+	}); err != nil {
+		switch {
+		case errors.Is(err, core.ErrDataNotFound):
+			respondError(c, http.StatusNotFound, core.CodeKeyNotFound, "key not found")
+		case errors.Is(err, core.ErrPatchTestFailed):
+			respondError(c, http.StatusConflict, core.CodePatchTestFailed, err.Error())
+		case errors.Is(err, core.ErrInvalidPatch):
+			respondError(c, http.StatusUnprocessableEntity, core.CodeInvalidPatch, err.Error())
+		case errors.As(err, &limitError):
+			respondJsonLimitExceeded(c, limitError)
+		case errors.Is(err, errPatchTooLarge):
+			respondError(c, http.StatusRequestEntityTooLarge, core.CodeTooLarge, tooLargeMessage(app))
+		case errors.Is(err, core.ErrStorageFull):
+			respondStorageFull(c)
+		default:
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to patch data")
+			app.Logger.Error("failed to patch data", zap.Error(err))
+		}
+	} else {
+		c.Header("ETag", core.ETag(patched))
+		c.Data(http.StatusOK, "application/json; charset=utf-8", patched)
+	}
+}
+
 // DeleteData godoc
 // @Summary      Delete data by key
 // @Description  Remove data for a specific key (always returns 200, even if key doesn't exist)
+// @Description  If the trash is enabled, the key is moved to the trash instead unless purge is set.
+// @Description  With If-Match the key is only deleted if its ETag matches, otherwise 412 is returned.
+// @Description  Keys other users shared with read-write access are deleted by passing their name as owner.
 // @Tags         data
 // @Produce      json
 // @Param        key path string true "Data key"
+// @Param        owner query string false "User who shared the key"
+// @Param        purge query bool false "Delete the key permanently, including a trashed version of it"
+// @Param        If-Match header string false "Only delete the key if its current ETag matches"
 // @Success      200 "Data deleted successfully"
-// @Failure      401 {object} ErrorResponse "Unauthorized"
-// @Failure      500 {object} ErrorResponse "Failed to delete data"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Key of the owner not shared with write access"
+// @Failure      412 {object} core.ErrorResponse "Data has been changed or deleted since it was read"
+// @Failure      500 {object} core.ErrorResponse "Failed to delete data"
 // @Security     CookieAuth
 // @Router       /data/{key} [delete]
 func DeleteData(c *gin.Context) {
+	app := appOf(c)
 	key := c.Param("key")
 	user := authenticateUser(c)
 
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-	} else if err := core.DeleteDataFromUser(user.Name, key); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete data"})
-		core.Logger.Error("failed to delete data", zap.Error(err))
+		respondUnauthorized(c)
+	} else if owner, status, failure := dataOwner(c, user, key, true); status != 0 {
+		c.JSON(status, failure)
+	} else if err := deleteData(c, owner, key, c.GetHeader("If-Match")); errors.Is(err, core.ErrPreconditionFailed) {
+		respondError(c, http.StatusPreconditionFailed, core.CodePreconditionFailed, "data has been changed or deleted")
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to delete data")
+		app.Logger.Error("failed to delete data", zap.Error(err))
 	} else {
 		c.Status(http.StatusOK)
 	}
 }
 
+// deleteData deletes or trashes key, if etag isn't empty only if the current value matches it, see matchETagTxn.
+func deleteData(c *gin.Context, name, key string, etag string) error {
+	app := appOf(c)
+
+	if !app.Config.TrashEnabled {
+		return app.DeleteDataFromUserIfMatch(name, key, etag)
+	} else if c.Query("purge") == "true" {
+		return app.PurgeDataFromUserIfMatch(name, key, etag)
+	}
+
+	return app.TrashDataFromUserIfMatch(name, key, etag)
+}
+
+// checkDataKey validates if a user is allowed to store data under key, returning the http status and error if not.
+func checkDataKey(app *core.App, name, key string) (int, core.ErrorResponse) {
+	if isKeyTooLong(app, key) {
+		return http.StatusBadRequest, core.ErrorResponse{Error: keyTooLongMessage(app), Code: core.CodeKeyTooLong}
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		return http.StatusBadRequest, core.ErrorResponse{Error: "key must match " + app.Config.AppKeyPattern.String(), Code: core.CodeInvalidKeyPattern}
+	} else if slices.Contains(core.ReservedKeys, key) {
+		return http.StatusBadRequest, core.ErrorResponse{Error: reservedKeyMessage(key), Code: core.CodeKeyReserved}
+	} else if count := app.GetDataCountForUser(name, key); count > app.Config.AppKeysPerUser {
+		return http.StatusForbidden, keyLimitExceeded(app, count-1)
+	}
+
+	return 0, core.ErrorResponse{}
+}
+
+// isKeyTooLong checks the length of key independent of the key pattern, a non-positive maximum disables the check.
+func isKeyTooLong(app *core.App, key string) bool {
+	return app.Config.AppKeyMaxLength > 0 && int64(len(key)) > app.Config.AppKeyMaxLength
+}
+
+func keyTooLongMessage(app *core.App) string {
+	return "key too long, limit is " + strconv.FormatInt(app.Config.AppKeyMaxLength, 10) + " bytes"
+}
+
+func reservedKeyMessage(key string) string {
+	return "key " + strconv.Quote(key) + " is reserved"
+}
+
+func tooLargeMessage(app *core.App) string {
+	return "request entity too large, limit is " + strconv.FormatInt(app.Config.AppDataMaxSize, 10) + " kilobytes"
+}
+
 func getContentLength(c *gin.Context) (int64, error) {
 	return strconv.ParseInt(c.GetHeader("Content-Length"), 10, 64)
 }
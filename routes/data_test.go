@@ -1,10 +1,17 @@
 package routes
 
 import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
 	"github.com/stretchr/testify/assert"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -56,6 +63,127 @@ func TestInvalidJSON(t *testing.T) {
 	})
 }
 
+func TestInvalidUTF8(t *testing.T) {
+	token := loginUser(t)
+	t.Cleanup(func() {
+		core.Config.AppCanonicalizeJson = false
+	})
+
+	for _, canonicalize := range []bool{false, true} {
+		core.Config.AppCanonicalizeJson = canonicalize
+
+		for _, body := range []string{
+			"{\"hello\": \"\xff\xfe\"}",     // invalid start bytes
+			"{\"hello\": \"w\xe2\x82rld\"}", // truncated multibyte sequence
+			"{\"hello\": \"\xc0\xaf\"}",     // overlong encoding
+			"[\"\xed\xa0\x80\", \"world\"]", // surrogate half
+		} {
+			tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+				Body:  body,
+				Token: token,
+				Handler: func(response *httptest.ResponseRecorder) {
+					assert.Equal(t, http.StatusBadRequest, response.Code)
+				},
+			})
+
+			tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+				Body:  "{\"theme\": \"\xff\"}",
+				Token: token,
+				Handler: func(response *httptest.ResponseRecorder) {
+					assert.Equal(t, http.StatusBadRequest, response.Code)
+				},
+			})
+		}
+	}
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account/settings", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{}", response.Body.String())
+		},
+	})
+
+	// Patches aren't minified but validated as well
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    "[{\"op\": \"add\", \"path\": \"/hello\", \"value\": \"\xff\"}]",
+		Token:   token,
+		Headers: map[string]string{"Content-Type": "application/json-patch+json"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+			assert.Contains(t, response.Body.String(), string(core.CodeInvalidEncoding))
+		},
+	})
+
+	// Valid multibyte characters are stored as they are
+	value := "[\"" + strings.Repeat("\u00f6\u20ac\U0001f600", 100) + "\"]"
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  value,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, value, response.Body.String())
+		},
+	})
+}
+
+func TestJsonLimits(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.AppJsonMaxDepth = 3
+	core.Config.AppJsonMaxArrayLength = 3
+	core.Config.AppJsonMaxElements = 5
+	t.Cleanup(func() {
+		core.Config.AppJsonMaxDepth = 0
+		core.Config.AppJsonMaxArrayLength = 0
+		core.Config.AppJsonMaxElements = 0
+		core.Config.AppCanonicalizeJson = false
+	})
+
+	for _, canonicalize := range []bool{false, true} {
+		core.Config.AppCanonicalizeJson = canonicalize
+
+		for body, expected := range map[string]int64{
+			"[[[1]]]":                        0,
+			"{\"a\": [1, 2], \"b\": [3]}":    0,
+			"[\"[[[[,,,,\\\"]]]]\", {}, []]": 0,
+			"[[[[1]]]]":                      3,
+			"{\"a\": {\"b\": {\"c\": {}}}}":  3,
+			"[1, 2, 3, 4]":                   3,
+			"{\"a\": [1, 2], \"b\": [3, 4]}": 5,
+		} {
+			tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+				Body:  body,
+				Token: token,
+				Handler: func(response *httptest.ResponseRecorder) {
+					if expected == 0 {
+						assert.Equal(t, http.StatusOK, response.Code, body)
+						return
+					}
+
+					var result core.ErrorResponse
+					assert.Equal(t, http.StatusBadRequest, response.Code, body)
+					assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+					assert.Equal(t, core.CodeJsonLimitExceeded, result.Code, body)
+					assert.Equal(t, expected, *result.Limit, body)
+				},
+			})
+		}
+	}
+}
+
 func TestSingleObject(t *testing.T) {
 	token := loginUser(t)
 
@@ -76,6 +204,37 @@ func TestSingleObject(t *testing.T) {
 	})
 }
 
+func TestPutData(t *testing.T) {
+	token := loginUser(t)
+
+	// Creates the key the first time and replaces it afterwards, just like POST
+	for _, body := range []string{"{\"hello\": \"world\"}", "[1, 2]"} {
+		tryAuthorizedPut("/data/bar", AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "[1,2]", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPut("/data/bar", AuthorizedBodyConfig{
+		Body:  "{invalid",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
+
 func TestEmpty(t *testing.T) {
 	token := loginUser(t)
 
@@ -127,6 +286,97 @@ func TestInvalidKeys(t *testing.T) {
 	})
 }
 
+func TestPatchData(t *testing.T) {
+	token := loginUser(t)
+	jsonPatch := map[string]string{"Content-Type": "application/json-patch+json"}
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    "[]",
+		Token:   token,
+		Headers: jsonPatch,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"name\": \"foo\", \"tags\": [\"a\", \"b\"], \"count\": 1.5, \"a/b\": {\"c~d\": true}}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Merge patches and regular json aren't accepted
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"name\": \"bar\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body: `[
+			{"op": "test", "path": "/count", "value": 15e-1},
+			{"op": "replace", "path": "/name", "value": "bar"},
+			{"op": "add", "path": "/tags/1", "value": "c"},
+			{"op": "add", "path": "/tags/-", "value": "d"},
+			{"op": "remove", "path": "/tags/0"},
+			{"op": "copy", "from": "/tags", "path": "/copied"},
+			{"op": "move", "from": "/a~1b/c~0d", "path": "/moved"},
+			{"op": "remove", "path": "/a~1b"}
+		]`,
+		Token:   token,
+		Headers: jsonPatch,
+		Handler: func(response *httptest.ResponseRecorder) {
+			expected := "{\"copied\":[\"c\",\"b\",\"d\"],\"count\":1.5,\"moved\":true,\"name\":\"bar\",\"tags\":[\"c\",\"b\",\"d\"]}"
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, expected, response.Body.String())
+			assert.Equal(t, core.ETag([]byte(expected)), response.Header().Get("ETag"))
+		},
+	})
+
+	// A failing test leaves the value untouched, even if previous operations succeeded
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    `[{"op": "replace", "path": "/name", "value": "baz"}, {"op": "test", "path": "/count", "value": 2}]`,
+		Token:   token,
+		Headers: jsonPatch,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	for _, patch := range []string{
+		`{"op": "remove", "path": "/name"}`,
+		`[{"op": "invalid", "path": "/name"}]`,
+		`[{"op": "remove", "path": "/unknown"}]`,
+		`[{"op": "remove", "path": "name"}]`,
+		`[{"op": "add", "path": "/tags/01", "value": 1}]`,
+		`[{"op": "add", "path": "/tags/4", "value": 1}]`,
+		`[{"op": "replace", "path": "/name"}]`,
+		`[{"op": "move", "from": "/tags", "path": "/tags/0"}]`,
+		`[{"op": "remove", "path": "/a~2b"}]`,
+	} {
+		tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+			Body:    patch,
+			Token:   token,
+			Headers: jsonPatch,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusUnprocessableEntity, response.Code, patch)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\"name\":\"bar\"")
+		},
+	})
+}
+
 func TestDeleteData(t *testing.T) {
 	token := loginUser(t)
 
@@ -235,3 +485,1229 @@ func TestTooMany(t *testing.T) {
 		},
 	})
 }
+
+func TestDataCount(t *testing.T) {
+	token := loginUser(t)
+
+	for _, key := range []string{"note_1", "note_2", "todo"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{\"hello\": \"world!\"}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data/count", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"count\":3,\"limit\":3}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/count?prefix=note_", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"count\":2,\"limit\":3}", response.Body.String())
+		},
+	})
+
+	tryUnauthorizedGet("/data/count", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestKeyMaxLength(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.AppKeyMaxLength = 8
+	t.Cleanup(func() {
+		core.Config.AppKeyMaxLength = 0
+	})
+
+	tryAuthorizedPost("/data/abcdefghi", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+			assert.Equal(t, "{\"error\":\"key too long, limit is 8 bytes\",\"code\":\"KEY_TOO_LONG\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/abcdefghi", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/abcdefgh", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestReadOnly(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/readonly", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	core.Config.ReadOnly = true
+	t.Cleanup(func() {
+		core.Config.ReadOnly = false
+	})
+
+	tryAuthorizedPost("/data/readonly", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"moon!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+			assert.Equal(t, "{\"error\":\"this instance is read-only\",\"code\":\"READ_ONLY\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedDelete("/data/readonly", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/readonly", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"hello\":\"world!\"}", response.Body.String())
+		},
+	})
+
+	// Lookups which only take their parameters as body are allowed
+	for url, body := range map[string]string{
+		"/data/exists":             "[\"readonly\"]",
+		"/data/poll":               "{\"readonly\": \"\"}",
+		"/account/verify-password": "{\"currentPassword\": \"hgEiPCZP\"}",
+	} {
+		tryAuthorizedPost(url, AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code, url)
+			},
+		})
+	}
+
+	loginAs(t, "foo", "hgEiPCZP")
+}
+
+func TestCanonicalizeJson(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.AppCanonicalizeJson = true
+	t.Cleanup(func() {
+		core.Config.AppCanonicalizeJson = false
+	})
+
+	tryAuthorizedPost("/data/canonical", AuthorizedBodyConfig{
+		Body:  "{\"b\": [1.0, 2.50, 1E3], \"a\": \"\\u0041\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/canonical", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"a\":\"A\",\"b\":[1,2.5,1000]}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPost("/data/canonical", AuthorizedBodyConfig{
+		Body:  "{\"b\": ",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
+
+func TestPreserveNumbers(t *testing.T) {
+	token := loginUser(t)
+	t.Cleanup(func() {
+		core.Config.AppMinifyJsonNumbers = false
+	})
+
+	for minify, expected := range map[bool]string{
+		false: "{\"id\":1234567890123456789,\"big\":1000000000000000000,\"float\":2.50}",
+		true:  "{\"id\":1234567890123456789,\"big\":1e18,\"float\":2.5}",
+	} {
+		core.Config.AppMinifyJsonNumbers = minify
+
+		tryAuthorizedPost("/data/numbers", AuthorizedBodyConfig{
+			Body:  "{\"id\": 1234567890123456789, \"big\": 1000000000000000000, \"float\": 2.50}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+
+		tryAuthorizedGet("/data/numbers", AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, expected, response.Body.String())
+			},
+		})
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	token := loginUser(t)
+	other := loginAs(t, "baz", "8d7f6g5h")
+
+	core.Config.DedupEnabled = true
+	core.Config.TrashEnabled = true
+	t.Cleanup(func() {
+		core.Config.DedupEnabled = false
+		core.Config.TrashEnabled = false
+	})
+
+	for _, session := range []string{token, other} {
+		for _, key := range []string{"a", "b"} {
+			tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+				Body:  "{\"hello\": \"world!\"}",
+				Token: session,
+				Handler: func(response *httptest.ResponseRecorder) {
+					assert.Equal(t, http.StatusOK, response.Code)
+				},
+			})
+		}
+	}
+
+	// Overwrite, trash and delete values referencing the same blob
+	tryAuthorizedPost("/data/a", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"moon!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/b", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/a?purge=true", AuthorizedConfig{
+		Token: other,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"a\":{\"hello\":\"moon!\"}}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/b", AuthorizedConfig{
+		Token: other,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"hello\":\"world!\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/b/meta", AuthorizedConfig{
+		Token: other,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Contains(t, response.Body.String(), "{\"key\":\"b\",\"size\":18,")
+		},
+	})
+
+	// The trashed value still references the blob
+	deleted, err := core.CollectBlobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+
+	tryAuthorizedPost("/data/trash/b/restore", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/b", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"hello\":\"world!\"}", response.Body.String())
+		},
+	})
+}
+
+func TestValidateKey(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/data/validate-key?key=foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"valid\":true,\"pattern\":\"^[\\\\w]{0,32}$\",\"maxLength\":0}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/validate-key?key=f%C3%B6%C3%B6", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\"valid\":false")
+		},
+	})
+
+	tryUnauthorizedGet("/data/validate-key?key=foo", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestReservedKeys(t *testing.T) {
+	token := loginUser(t)
+
+	// Keys named like routes below /data couldn't be read
+	for _, key := range []string{"count", "stats", "keys", "query"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Contains(t, response.Body.String(), string(core.CodeKeyReserved))
+			},
+		})
+
+		tryAuthorizedGet("/data/validate-key?key="+key, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Contains(t, response.Body.String(), "\"valid\":false")
+			},
+		})
+	}
+
+	tryAuthorizedPost("/data/counts", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestDataCaching(t *testing.T) {
+	token := loginUser(t)
+	var etag, lastModified string
+
+	tryAuthorizedPost("/data/cached", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/cached", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "private, no-cache", response.Header().Get("Cache-Control"))
+			etag = response.Header().Get("ETag")
+			lastModified = response.Header().Get("Last-Modified")
+			assert.NotEmpty(t, etag)
+			assert.NotEmpty(t, lastModified)
+		},
+	})
+
+	tryAuthorizedGet("/data/cached", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotModified, response.Code)
+			assert.Empty(t, response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/cached", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Modified-Since": lastModified},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotModified, response.Code)
+		},
+	})
+
+	core.Config.AppDataCacheMaxAge = 30
+	t.Cleanup(func() {
+		core.Config.AppDataCacheMaxAge = 0
+	})
+
+	tryAuthorizedPost("/data/cached", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"moon!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/cached", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "private, max-age=30", response.Header().Get("Cache-Control"))
+			assert.NotEqual(t, etag, response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NotEmpty(t, response.Header().Get("ETag"))
+			assert.Empty(t, response.Header().Get("Last-Modified"))
+		},
+	})
+}
+
+func TestConditionalDelete(t *testing.T) {
+	token := loginUser(t)
+	var etag string
+
+	tryAuthorizedPost("/data/conditional", AuthorizedBodyConfig{
+		Body:  "{\"version\": 1}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/conditional", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedPost("/data/conditional", AuthorizedBodyConfig{
+		Body:  "{\"version\": 2}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// The key changed since it was read
+	tryAuthorizedDelete("/data/conditional", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/conditional", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedDelete("/data/conditional", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "W/" + etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/conditional", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"other\", " + etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/conditional", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	// Keys that don't exist never match, without If-Match deleting them still succeeds
+	tryAuthorizedDelete("/data/conditional", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "*"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/conditional", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPut("/data/foo/share", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+			assert.ElementsMatch(t, []string{"GET", "POST"}, strings.Split(response.Header().Get("Allow"), ", "))
+			assert.Equal(t, "{\"error\":\"method not allowed\",\"code\":\"METHOD_NOT_ALLOWED\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPost("/swagger/index.html", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+			assert.Equal(t, "GET", response.Header().Get("Allow"))
+		},
+	})
+
+	tryAuthorizedGet("/swagger/index.html", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.NotEqual(t, http.StatusMethodNotAllowed, response.Code)
+			assert.Empty(t, response.Header().Get("Allow"))
+		},
+	})
+
+	tryAuthorizedGet("/unknown", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	loginUser(t)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, core.UpdateDataForUser("foo", "counter", func(current []byte) ([]byte, error) {
+				count := 0
+				if current != nil {
+					count, _ = strconv.Atoi(string(current))
+				}
+
+				return []byte(strconv.Itoa(count + 1)), nil
+			}))
+		}()
+	}
+
+	wg.Wait()
+
+	data, err := core.GetDataFromUser("foo", "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "50", string(data))
+}
+
+func TestDataNDJSON(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"Accept": "application/x-ndjson"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "application/x-ndjson; charset=utf-8", response.Header().Get("Content-Type"))
+			assert.Empty(t, response.Body.String())
+		},
+	})
+
+	for key, body := range map[string]string{"a": "{\"list\": [1, 2]}", "b": "\"line\\nbreak\""} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Token: token,
+			Body:  body,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"Accept": "application/x-ndjson"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Header().Get("ETag"))
+			assert.Equal(t, "{\"key\":\"a\",\"value\":{\"list\":[1,2]}}\n{\"key\":\"b\",\"value\":\"line\\nbreak\"}\n", response.Body.String())
+		},
+	})
+
+	// The object response stays the default
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"a\":{\"list\":[1,2]},\"b\":\"line\\nbreak\"}", response.Body.String())
+		},
+	})
+}
+
+func TestDataEnvelope(t *testing.T) {
+	token := loginUser(t)
+	var etag string
+
+	tryAuthorizedPost("/data/wrapped", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"a\": \"<b>\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/wrapped", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"a\":\"<b>\"}", response.Body.String())
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedGet("/data/wrapped?envelope=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body DataEnvelope
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, etag, response.Header().Get("ETag"))
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, "wrapped", body.Key)
+			assert.Equal(t, "{\"a\":\"<b>\"}", string(body.Value))
+			assert.Equal(t, etag, body.ETag)
+			assert.NotNil(t, body.ModifiedAt)
+		},
+	})
+
+	tryAuthorizedGet("/data/wrapped?envelope=true", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotModified, response.Code)
+		},
+	})
+
+	// The ETag of the envelope can be used to delete the key conditionally
+	tryAuthorizedDelete("/data/wrapped", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestDataDefault(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/data/missing?default="+url.QueryEscape("{\"theme\": \"dark\"}"), AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"theme\":\"dark\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/missing?default="+url.QueryEscape("{invalid"), AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+			assert.Contains(t, response.Body.String(), string(core.CodeInvalidJson))
+		},
+	})
+
+	// The default is never stored
+	tryAuthorizedGet("/data/missing", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/missing", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"theme\": \"light\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/missing?default="+url.QueryEscape("{}"), AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"theme\":\"light\"}", response.Body.String())
+		},
+	})
+}
+
+func TestDataDownload(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/notes", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"text\": \"hello\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/notes?download=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "attachment; filename=\"notes.json\"", response.Header().Get("Content-Disposition"))
+			assert.Equal(t, "{\"text\":\"hello\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/notes", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Empty(t, response.Header().Get("Content-Disposition"))
+		},
+	})
+
+	for filename, expected := range map[string]string{
+		"notes.json":        "attachment; filename=\"notes.json\"",
+		"n\u00f6tes 1.json": "attachment; filename=\"n_tes 1.json\"; filename*=UTF-8''n%C3%B6tes%201.json",
+		"a\"b%c.json":       "attachment; filename=\"a_b_c.json\"; filename*=UTF-8''a%22b%25c.json",
+	} {
+		assert.Equal(t, expected, attachmentDisposition(filename), filename)
+	}
+}
+
+func TestDataFlatten(t *testing.T) {
+	token := loginUser(t)
+
+	for key, body := range map[string]string{
+		"settings": "{\"theme\": \"dark\", \"list\": [{\"name\": \"<a>\"}, 1.50], \"empty\": {}}",
+		"counter":  "3",
+	} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Token: token,
+			Body:  body,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data?flatten=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"counter\":3,\"settings.empty\":{},\"settings.list.0.name\":\"<a>\",\"settings.list.1\":1.50,\"settings.theme\":\"dark\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"counter\":3,\"settings\":{\"theme\":\"dark\",\"list\":[{\"name\":\"<a>\"},1.50],\"empty\":{}}}", response.Body.String())
+		},
+	})
+}
+
+func TestDataPretty(t *testing.T) {
+	token := loginUser(t)
+	var etag string
+
+	tryAuthorizedPost("/data/pretty", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"a\": {\"list\": [1, 2]}}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/pretty", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"a\":{\"list\":[1,2]}}", response.Body.String())
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedGet("/data/pretty?pretty=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, etag, response.Header().Get("ETag"))
+			assert.Equal(t, "{\n  \"a\": {\n    \"list\": [\n      1,\n      2\n    ]\n  }\n}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/pretty?pretty=true&envelope=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body DataEnvelope
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\n  \"key\": \"pretty\",\n")
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, etag, body.ETag)
+		},
+	})
+
+	// Indenting doesn't change what is stored
+	tryAuthorizedGet("/data/pretty", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"a\":{\"list\":[1,2]}}", response.Body.String())
+		},
+	})
+}
+
+func TestDataKeyspaceIsolation(t *testing.T) {
+	token := loginUser(t)
+
+	assert.NoError(t, core.CreateUser(core.User{Name: "foo/bar", Password: "foobar1234"}))
+	assert.NoError(t, core.CreateUser(core.User{Name: "foo\\", Password: "foobar1234"}))
+	assert.NoError(t, core.SetDataForUser("foo\\", "bar", []byte("1")))
+
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: loginAs(t, "foo/bar", "foobar1234"),
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Neither user reaches into the keyspace of foo, although their names start with it
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{}", response.Body.String())
+		},
+	})
+
+	_, err := core.GetDataFromUser("foo", "bar/baz")
+	assert.Error(t, err)
+
+	data, err := core.GetAllDataFromUser("foo\\")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"bar\":1}", string(data))
+
+	data, err = core.GetAllDataFromUser("foo/bar")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"baz\":{\"hello\":\"world!\"}}", string(data))
+}
+
+func TestDataExists(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/exists", AuthorizedBodyConfig{
+		Body:  "[\"foo\", \"bar\", \"föö\", \"\"]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body ExistsResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, map[string]bool{"foo": true, "bar": false, "föö": false, "": false}, body.Exists)
+			assert.Equal(t, []string{"föö", ""}, body.Invalid)
+		},
+	})
+
+	tryAuthorizedPost("/data/exists", AuthorizedBodyConfig{
+		Body:  "{\"foo\": true}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryUnauthorizedPost("/data/exists", UnauthorizedBodyConfig{
+		Body: "[\"foo\"]",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestPollData(t *testing.T) {
+	token := loginUser(t)
+
+	for key, body := range map[string]string{"a": "{\"v\":1}", "b": "{\"v\":2}"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	poll := func(known map[string]string) PollResponse {
+		body, _ := json.Marshal(known)
+		var result PollResponse
+
+		tryAuthorizedPost("/data/poll", AuthorizedBodyConfig{
+			Body:  string(body),
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &result))
+			},
+		})
+
+		return result
+	}
+
+	// Unknown keys are returned, keys which don't exist yet are neither changed nor deleted
+	result := poll(map[string]string{"a": "", "b": "", "c": "", "föö": ""})
+	assert.Equal(t, []string{"a", "b"}, slices.Sorted(maps.Keys(result.Changed)))
+	assert.Equal(t, "{\"v\":1}", string(result.Changed["a"].Value))
+	assert.Equal(t, core.ETag([]byte("{\"v\":1}")), result.Changed["a"].ETag)
+	assert.Empty(t, result.Deleted)
+	assert.Equal(t, []string{"föö"}, result.Invalid)
+
+	known := map[string]string{"a": result.Changed["a"].ETag, "b": result.Changed["b"].ETag, "c": ""}
+	result = poll(known)
+	assert.Empty(t, result.Changed)
+	assert.Empty(t, result.Deleted)
+
+	tryAuthorizedPost("/data/a", AuthorizedBodyConfig{
+		Body:  "{\"v\":3}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/b", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	result = poll(known)
+	assert.Equal(t, []string{"a"}, slices.Sorted(maps.Keys(result.Changed)))
+	assert.Equal(t, "{\"v\":3}", string(result.Changed["a"].Value))
+	assert.Equal(t, []string{"b"}, result.Deleted)
+
+	tryAuthorizedPost("/data/poll", AuthorizedBodyConfig{
+		Body:  "[\"a\"]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryUnauthorizedPost("/data/poll", UnauthorizedBodyConfig{
+		Body: "{\"a\": \"\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestIncrementDataBatch(t *testing.T) {
+	token := loginUser(t)
+
+	incrementBatch := func(body string, status int, expected string) {
+		tryAuthorizedPost("/data/increment-batch", AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code)
+
+				if len(expected) != 0 {
+					assert.JSONEq(t, expected, response.Body.String())
+				}
+			},
+		})
+	}
+
+	// Missing counters start at zero
+	incrementBatch("{\"a\": 1, \"b\": 5}", http.StatusOK, "{\"a\": 1, \"b\": 5}")
+	incrementBatch("{\"a\": -3, \"b\": 0.5}", http.StatusOK, "{\"a\": -2, \"b\": 5.5}")
+	incrementBatch("{\"a\": 9007199254740993}", http.StatusOK, "{\"a\": 9007199254740991}")
+
+	tryAuthorizedPost("/data/c", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Nothing is incremented if a stored value isn't a number
+	tryAuthorizedPost("/data/increment-batch", AuthorizedBodyConfig{
+		Body:  "{\"a\": 1, \"c\": 1}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body NotNumericResponse
+			assert.Equal(t, http.StatusConflict, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, core.CodeNotNumeric, body.Code)
+			assert.Equal(t, []string{"c"}, body.Keys)
+		},
+	})
+
+	tryAuthorizedGet("/data/a", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "9007199254740991", response.Body.String())
+		},
+	})
+
+	incrementBatch("{\"a\": \"1\"}", http.StatusBadRequest, "")
+	incrementBatch("[1]", http.StatusBadRequest, "")
+	incrementBatch("{\"föö\": 1}", http.StatusBadRequest, "")
+
+	// Limit of keys per user is 3
+	incrementBatch("{\"a\": 1, \"d\": 1}", http.StatusForbidden, "")
+
+	tryUnauthorizedPost("/data/increment-batch", UnauthorizedBodyConfig{
+		Body: "{\"a\": 1}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestConcurrentIncrementDataBatch(t *testing.T) {
+	loginUser(t)
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, _, err := core.IncrementDataForUser("foo", map[string]json.Number{"a": "1", "b": "2"})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	results, _, err := core.IncrementDataForUser("foo", map[string]json.Number{"a": "0", "b": "0"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]json.Number{"a": "50", "b": "100"}, results)
+}
+
+func TestGlobalMaxKeys(t *testing.T) {
+	token := loginUser(t)
+	core.Config.GlobalMaxKeys = 2
+	t.Cleanup(func() {
+		core.Config.GlobalMaxKeys = 0
+	})
+
+	// Updating a stored key doesn't count as another one
+	for _, key := range []string{"a", "b", "a"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/data/c", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusInsufficientStorage, response.Code)
+			assert.Equal(t, "{\"error\":\"maximum amount of keys across all users reached\",\"code\":\"STORAGE_FULL\",\"limit\":2,\"current\":2}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedDelete("/data/a", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/c", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Keys aren't counted while the limit is disabled, but again once it's enabled on start
+	core.Config.GlobalMaxKeys = 0
+	tryAuthorizedPost("/data/d", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	count, err := core.CountAllData()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	core.Config.GlobalMaxKeys = 3
+	assert.NoError(t, core.Migrate(false))
+
+	count, err = core.CountAllData()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestGlobalMaxKeysConcurrently(t *testing.T) {
+	loginUser(t)
+	core.Config.GlobalMaxKeys = 100
+	t.Cleanup(func() {
+		core.Config.GlobalMaxKeys = 0
+	})
+
+	// Every write of any user changes the global amount of keys, concurrent ones have to be retried
+	write := func(users []string, keys int) {
+		var wg sync.WaitGroup
+		for _, user := range users {
+			for index := 0; index < keys; index++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, core.SetDataForUser(user, "key"+strconv.Itoa(index), []byte("{}")))
+				}()
+			}
+		}
+
+		wg.Wait()
+	}
+
+	write([]string{"foo", "bar", "baz"}, 10)
+	count, err := core.CountAllData()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), count)
+
+	// Deleting a user conflicts with the writes of others as well
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, core.DeleteUser("baz"))
+	}()
+
+	write([]string{"qux"}, 10)
+	wg.Wait()
+
+	count, err = core.CountAllData()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), count)
+}
+
+func TestDataStats(t *testing.T) {
+	token := loginUser(t)
+	core.Config.DataStatsDelimiter = "_"
+	t.Cleanup(func() {
+		core.Config.DataStatsDelimiter = ":"
+	})
+
+	for key, body := range map[string]string{"budget_2024": "{\"a\":1}", "budget_2025": "{\"a\":12}", "settings": "[]"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	for query, expected := range map[string]string{
+		"":                "{\"keys\":3,\"bytes\":17,\"groups\":[{\"prefix\":\"\",\"keys\":1,\"bytes\":2},{\"prefix\":\"budget_\",\"keys\":2,\"bytes\":15}]}",
+		"?prefix=budget_": "{\"keys\":2,\"bytes\":15,\"groups\":[{\"prefix\":\"budget_\",\"keys\":2,\"bytes\":15}]}",
+		"?prefix=unknown": "{\"keys\":0,\"bytes\":0,\"groups\":[]}",
+	} {
+		tryAuthorizedGet("/data/stats"+query, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, expected, response.Body.String())
+			},
+		})
+	}
+
+	tryUnauthorizedGet("/data/stats", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestErrorCodes(t *testing.T) {
+	token := loginUser(t)
+
+	for url, code := range map[string]core.ErrorCode{
+		"/data/in-valid":    core.CodeInvalidKeyPattern,
+		"/data/a?owner=baz": core.CodeKeyNotShared,
+	} {
+		tryAuthorizedPost(url, AuthorizedBodyConfig{
+			Body:  "{}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				var body core.ErrorResponse
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+				assert.Equal(t, code, body.Code, url)
+				assert.NotEmpty(t, body.Error, url)
+			},
+		})
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				if key == "d" {
+					assert.Equal(t, http.StatusForbidden, response.Code)
+					assert.Equal(t, "{\"error\":\"too many keys, limit is 3\",\"code\":\"KEY_LIMIT_EXCEEDED\",\"limit\":3,\"current\":3}", response.Body.String())
+				}
+			},
+		})
+	}
+}
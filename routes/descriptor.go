@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"net/http"
+	"sort"
+)
+
+// Optional features which can be reported by ServerMeta
+const (
+	featureReadOnly         = "read-only"
+	featureRegistration     = "registration"
+	featureInviteOnly       = "invite-only"
+	featureTrash            = "trash"
+	featureTrackLastAccess  = "track-last-access"
+	featureCanonicalizeJson = "canonicalize-json"
+	featureSwagger          = "swagger"
+)
+
+// ServerMeta godoc
+// @Summary      Describe the server
+// @Description  Get the limits, patterns and optional features of this instance so clients can adapt to its configuration. Doesn't require authentication and contains no secrets.
+// @Tags         health
+// @Produce      json
+// @Success      200 {object} MetaResponse "Limits and enabled features"
+// @Router       /meta [get]
+func ServerMeta(c *gin.Context) {
+	app := appOf(c)
+	c.JSON(http.StatusOK, MetaResponse{
+		KeyPattern:    app.Config.AppKeyPattern.String(),
+		KeyMaxLength:  app.Config.AppKeyMaxLength,
+		UserPattern:   app.Config.AppUserPattern.String(),
+		MaxKeys:       app.Config.AppKeysPerUser,
+		MaxDataSize:   app.Config.AppDataMaxSize,
+		JWTExpiration: int64(app.Config.JWTExpiration.Seconds()),
+		Features:      enabledFeatures(app),
+	})
+}
+
+func enabledFeatures(app *core.App) []string {
+	features := make([]string, 0)
+
+	for feature, enabled := range map[string]bool{
+		featureReadOnly:         app.Config.ReadOnly,
+		featureRegistration:     app.Config.AllowRegistration,
+		featureInviteOnly:       app.Config.AllowRegistration && app.Config.RegistrationRequireInvite,
+		featureTrash:            app.Config.TrashEnabled,
+		featureTrackLastAccess:  app.Config.TrackLastAccess,
+		featureCanonicalizeJson: app.Config.AppCanonicalizeJson,
+		featureSwagger:          swaggerEnabled(app.Config),
+	} {
+		if enabled {
+			features = append(features, feature)
+		}
+	}
+
+	sort.Strings(features)
+	return features
+}
@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// ExportAccount godoc
+// @Summary      Export the current account
+// @Description  Download everything stored for the current user (profile, settings, data, metadata and trash) as a single JSON document, the password is never included
+// @Tags         account
+// @Produce      json
+// @Success      200 {object} AccountExport "Full export of the account"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to export account"
+// @Security     CookieAuth
+// @Router       /account/export-full [get]
+func ExportAccount(c *gin.Context) {
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else {
+		streamExport(c, user.Name, user.Name)
+	}
+}
+
+// ExportUser godoc
+// @Summary      Export a user
+// @Description  Download everything stored for a user (profile, settings, data, metadata and trash) as a single JSON document, the password is never included (admin only)
+// @Tags         user
+// @Produce      json
+// @Param        name path string true "Username"
+// @Success      200 {object} AccountExport "Full export of the user"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      404 {object} core.ErrorResponse "User not found"
+// @Failure      500 {object} core.ErrorResponse "Failed to export user"
+// @Security     CookieAuth
+// @Router       /user/{name}/export [get]
+func ExportUser(c *gin.Context) {
+	admin := authenticateAdmin(c)
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else {
+		streamExport(c, usernameParam(c), admin.Name)
+	}
+}
+
+// streamExport sends the export of name as download, the export is recorded in the audit log along with who requested it.
+func streamExport(c *gin.Context, name, requestedBy string) {
+	app := appOf(c)
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Disposition", attachmentDisposition(name+".json"))
+	c.Header("Cache-Control", "private, no-store")
+
+	err := app.ExportUser(name, c.Writer)
+
+	// Once the first bytes are sent the status can't be changed anymore, all we can do is to log the error
+	if err != nil && !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+
+		if errors.Is(err, core.ErrUserNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeUserNotFound, "user not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to export user")
+			app.Logger.Error("failed to export user", zap.String("user", name), zap.Error(err))
+		}
+	} else if err != nil {
+		app.Logger.Error("failed to export user", zap.String("user", name), zap.Error(err))
+	} else {
+		app.Audit("user exported", zap.String("user", name), zap.String("requestedBy", requestedBy))
+	}
+}
@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExportAccount(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Body:  "{\"theme\": \"dark\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account/export-full", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body AccountExport
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "attachment; filename=\"foo.json\"", response.Header().Get("Content-Disposition"))
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, "foo", body.User.Name)
+			assert.False(t, body.User.Admin)
+			assert.NotNil(t, body.User.CreatedAt)
+			assert.NotNil(t, body.User.LastLoginAt)
+			assert.Equal(t, "dark", body.Settings["theme"])
+			assert.Equal(t, map[string]interface{}{"hello": "world!"}, body.Data["foo"])
+			assert.Contains(t, body.Meta, "foo")
+			assert.Empty(t, body.Trash)
+			assert.NotContains(t, response.Body.String(), "password")
+		},
+	})
+
+	tryUnauthorizedGet("/account/export-full", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+}
+
+func TestExportUser(t *testing.T) {
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	tryAuthorizedGet("/user/baz/export", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/user/foo/export", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body AccountExport
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, "foo", body.User.Name)
+			assert.Empty(t, body.Data)
+			assert.Empty(t, body.Settings)
+		},
+	})
+
+	tryAuthorizedPost("/user/baz", AuthorizedBodyConfig{
+		Body:  "{\"disabled\":true}",
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/user/baz/export", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body AccountExport
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.True(t, body.User.Disabled)
+			assert.NotNil(t, body.User.CreatedAt)
+			assert.Nil(t, body.User.LastLoginAt)
+			assert.NotContains(t, response.Body.String(), "password")
+		},
+	})
+
+	tryAuthorizedGet("/user/unknown/export", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+			assert.Empty(t, response.Header().Get("Content-Disposition"))
+		},
+	})
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// ForgetAccount godoc
+// @Summary      Erase the current account
+// @Description  Permanently erase the current user along with everything stored for them (data, trash, metadata, settings and invites created by them) and end the session.
+// @Description  Requires the current password, this can't be undone.
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        request body ReauthRequest true "Current password of the user"
+// @Success      200 {object} core.ForgetSummary "What has been erased"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized or current password incorrect"
+// @Failure      500 {object} core.ErrorResponse "Failed to erase account"
+// @Security     CookieAuth
+// @Router       /account/forget [post]
+func ForgetAccount(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+	var body reauthBody
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if c.ShouldBindJSON(&body) != nil {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if authenticated, err := app.AuthenticateUser(user.Name, body.CurrentPassword); err != nil || authenticated == nil {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if summary, ok := forgetUser(c, user.Name, user.Name); ok {
+
+		// Tokens issued before a user of the same name is created are rejected anyway, but the session ends right away
+		if parsed, err := app.ParseAuthToken(getAuthToken(c)); err == nil && parsed != nil {
+			if err := app.InvalidateToken(parsed); err != nil {
+				app.Logger.Error("failed to store invalidated token", zap.Error(err))
+			}
+		}
+
+		clearSessionCookie(c)
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// ForgetUser godoc
+// @Summary      Erase a user
+// @Description  Permanently erase a user along with everything stored for them (data, trash, metadata, settings and invites created by them), this can't be undone (admin only)
+// @Tags         user
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Username"
+// @Param        request body ReauthRequest false "Current password of the admin (if re-authentication is required)"
+// @Param        X-Confirmation-Token header string false "Token of the previous attempt (if confirmation is required)"
+// @Success      200 {object} core.ForgetSummary "What has been erased"
+// @Failure      400 {object} core.ErrorResponse "Confirmation token invalid or expired"
+// @Failure      401 {object} core.ErrorResponse "Current password of the admin incorrect (if re-authentication is required)"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      404 {object} core.ErrorResponse "User not found"
+// @Failure      409 {object} core.ErrorResponse "Cannot remove the last admin"
+// @Failure      428 {object} ConfirmationRequiredResponse "Confirmation required, send the token back to erase the user"
+// @Failure      500 {object} core.ErrorResponse "Failed to erase user"
+// @Security     CookieAuth
+// @Router       /user/{name}/forget [post]
+func ForgetUser(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	var body reauthBody
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if app.Config.AdminReauthRequired && (c.ShouldBindJSON(&body) != nil || !hasReauthenticated(app, admin, body.CurrentPassword)) {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if status, failure := checkLastAdmin(app, usernameParam(c)); status != 0 {
+		c.JSON(status, failure)
+	} else if name := usernameParam(c); !confirmAction(c, admin, "forget-user:"+name, userImpact(app, "permanently erase", name)) {
+		return
+	} else if summary, ok := forgetUser(c, name, admin.Name); ok {
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// forgetUser erases name and records it in the audit log, if it fails the error response is sent.
+func forgetUser(c *gin.Context, name, requestedBy string) (*core.ForgetSummary, bool) {
+	app := appOf(c)
+	summary, err := app.ForgetUser(name)
+
+	if errors.Is(err, core.ErrUserNotFound) {
+		respondError(c, http.StatusNotFound, core.CodeUserNotFound, "user not found")
+		return nil, false
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to erase user")
+		app.Logger.Error("failed to erase user", zap.String("user", name), zap.Error(err))
+		return nil, false
+	}
+
+	app.Audit("user erased", zap.String("user", name), zap.String("requestedBy", requestedBy))
+	return summary, true
+}
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestForgetAccount(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/account/settings", AuthorizedBodyConfig{
+		Body:  "{\"theme\": \"dark\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/account/forget", AuthorizedBodyConfig{
+		Body:  "{\"currentPassword\": \"wrong\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/account/forget", AuthorizedBodyConfig{
+		Body:  "{\"currentPassword\": \"hgEiPCZP\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var summary core.ForgetSummary
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &summary))
+			assert.Equal(t, core.ForgetSummary{Keys: 1, Meta: 1, Settings: true}, summary)
+			assert.Contains(t, response.Header().Get("Set-Cookie"), "gt=;")
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	user, err := core.GetUser("foo")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	// Nothing is left behind if the name is used again
+	assert.NoError(t, core.CreateUser(core.User{Name: "foo", Password: "hgEiPCZP"}))
+	data, err := core.GetAllDataFromUser("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	settings, err := core.GetSettings("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(settings))
+}
+
+func TestForgetUserSessions(t *testing.T) {
+	start := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	clock := core.NewFakeClock(start)
+	previous := core.Default.Clock
+
+	core.Default.Clock = clock
+	core.Config.AllowRegistration = true
+	t.Cleanup(func() {
+		core.Default.Clock = previous
+		core.Config.AllowRegistration = false
+	})
+
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+	clock.Advance(time.Minute)
+
+	tryAuthorizedPost("/user/foo/forget", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	clock.Advance(time.Minute)
+
+	// Sessions of the erased user don't work for a new user of the same name
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"foo\", \"password\": \"Rk2Lw9xQ\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: loginAs(t, "foo", "Rk2Lw9xQ"),
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestForgetUser(t *testing.T) {
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	core.Config.AllowRegistration = true
+	t.Cleanup(func() {
+		core.Config.AllowRegistration = false
+	})
+
+	tryAuthorizedPost("/invites", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/baz/forget", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/baz/forget", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var summary core.ForgetSummary
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &summary))
+			assert.Equal(t, core.ForgetSummary{}, summary)
+		},
+	})
+
+	tryAuthorizedPost("/user/baz/forget", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	// Invites created by an admin are erased along with them
+	tryAuthorizedPost("/account/forget", AuthorizedBodyConfig{
+		Body:  "{\"currentPassword\": \"EczUR8dn\"}",
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var summary core.ForgetSummary
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &summary))
+			assert.Equal(t, 1, summary.Invites)
+		},
+	})
+}
@@ -2,7 +2,9 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"net/http"
+	"time"
 )
 
 // Health godoc
@@ -17,3 +19,39 @@ func Health(c *gin.Context) {
 	// We assume, if the api is able to respond to this request, it is healthy.
 	c.Status(http.StatusOK)
 }
+
+// Statuses reported by Ready
+const (
+	readinessOk          = "ok"
+	readinessDegraded    = "degraded"
+	readinessUnavailable = "unavailable"
+)
+
+// Ready godoc
+// @Summary      Readiness check
+// @Description  Check if the database can be read and how long it took. The server is reported as degraded if it took longer than GENESIS_HEALTH_DEGRADED_MS, which is still answered with 200 as requests are served.
+// @Tags         health
+// @Produce      json
+// @Success      200 {object} ReadinessResponse "Server is ready, possibly degraded"
+// @Failure      503 {object} ReadinessResponse "Database is unavailable"
+// @Router       /health/ready [get]
+func Ready(c *gin.Context) {
+	app := appOf(c)
+	latency, err := app.PingDatabase()
+	response := ReadinessResponse{
+		Status:    readinessOk,
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+	}
+
+	if err != nil {
+		response.Status = readinessUnavailable
+		app.Logger.Error("failed to ping database", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	} else if threshold := app.Config.HealthDegradedLatency; threshold > 0 && latency > threshold {
+		response.Status = readinessDegraded
+		app.Logger.Warn("database is slow", zap.Duration("latency", latency), zap.Duration("threshold", threshold))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -1,10 +1,13 @@
 package routes
 
 import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestHealth(t *testing.T) {
@@ -23,3 +26,74 @@ func TestHealth(t *testing.T) {
 		},
 	})
 }
+
+func TestReady(t *testing.T) {
+	tryUnauthorizedGet("/health/ready", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body ReadinessResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, "ok", body.Status)
+		},
+	})
+
+	// Any read takes longer than a nanosecond
+	core.Config.HealthDegradedLatency = time.Nanosecond
+	t.Cleanup(func() {
+		core.Config.HealthDegradedLatency = 250 * time.Millisecond
+	})
+
+	tryUnauthorizedGet("/health/ready", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body ReadinessResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, "degraded", body.Status)
+			assert.Greater(t, body.LatencyMs, 0.0)
+		},
+	})
+}
+
+func TestServerMeta(t *testing.T) {
+	core.Config.TrashEnabled = true
+	t.Cleanup(func() {
+		core.Config.TrashEnabled = false
+	})
+
+	tryUnauthorizedGet("/meta", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body MetaResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, core.Config.AppKeyPattern.String(), body.KeyPattern)
+			assert.Equal(t, core.Config.AppUserPattern.String(), body.UserPattern)
+			assert.Equal(t, core.Config.AppKeysPerUser, body.MaxKeys)
+			assert.Equal(t, core.Config.AppDataMaxSize, body.MaxDataSize)
+			assert.Equal(t, int64(core.Config.JWTExpiration.Seconds()), body.JWTExpiration)
+			assert.Contains(t, body.Features, "trash")
+			assert.NotContains(t, body.Features, "registration")
+			assert.NotContains(t, response.Body.String(), string(core.Config.JWTSecret))
+		},
+	})
+}
+
+func TestH2C(t *testing.T) {
+	core.Config.H2C = true
+	t.Cleanup(func() {
+		core.Config.H2C = false
+	})
+
+	server := httptest.NewServer(SetupRoutes().Handler())
+	defer server.Close()
+
+	// Prior knowledge, as used by reverse proxies speaking h2c
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	if response, err := client.Get(server.URL + "/health"); assert.NoError(t, err) {
+		_ = response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, 2, response.ProtoMajor)
+	}
+}
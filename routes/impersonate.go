@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// Impersonate godoc
+// @Summary      Impersonate a user
+// @Description  Start acting as another user for support purposes (admin only). Issues a short-lived session for the target user which can't be used for admin actions.
+// @Description  Supports mode=token like /login to receive the token in the body.
+// @Tags         user
+// @Produce      json
+// @Param        name path string true "Username"
+// @Param        mode query string false "Set to 'token' to receive the JWT in the response body"
+// @Success      200 {object} core.PublicUser "Impersonated user"
+// @Failure      400 {object} core.ErrorResponse "Cannot impersonate yourself"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      404 {object} core.ErrorResponse "User not found"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /user/{name}/impersonate [post]
+func Impersonate(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	name := usernameParam(c)
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if name == admin.Name {
+		respondError(c, http.StatusBadRequest, core.CodeSelfNotAllowed, "you cannot impersonate yourself")
+	} else if target, err := app.GetUser(name); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve user")
+		app.Logger.Error("failed to retrieve user", zap.Error(err))
+	} else if target == nil {
+		respondError(c, http.StatusNotFound, core.CodeUserNotFound, "user not found")
+	} else if token, expiresAt, err := app.CreateImpersonationToken(admin, target); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to create auth token")
+		app.Logger.Error("failed to create impersonation token", zap.Error(err))
+	} else {
+		app.Audit("impersonation started", zap.String("admin", admin.Name), zap.String("user", target.Name))
+		respondWithSession(c, target, token, expiresAt, admin.Name)
+	}
+}
+
+// StopImpersonation godoc
+// @Summary      Stop impersonating a user
+// @Description  Invalidates the impersonation session and issues a new session for the impersonating admin
+// @Tags         account
+// @Produce      json
+// @Param        mode query string false "Set to 'token' to receive the JWT in the response body"
+// @Success      200 {object} core.PublicUser "Impersonating admin"
+// @Failure      400 {object} core.ErrorResponse "Current session is not impersonating anyone"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /account/impersonate/stop [post]
+func StopImpersonation(c *gin.Context) {
+	app := appOf(c)
+	parsed, err := app.ParseAuthToken(getAuthToken(c))
+
+	if err != nil || parsed == nil {
+		respondUnauthorized(c)
+	} else if len(parsed.Impersonator) == 0 {
+		respondError(c, http.StatusBadRequest, core.CodeNotImpersonating, "not impersonating anyone")
+	} else if admin, err := app.GetUser(parsed.Impersonator); err != nil || admin == nil || !parsed.IssuedFor(admin) {
+		respondUnauthorized(c)
+	} else if err := app.InvalidateToken(parsed); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to store invalidated token")
+		app.Logger.Error("failed to store invalidated token", zap.Error(err))
+	} else if token, expiresAt, err := app.CreateAuthToken(admin); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to create auth token")
+		app.Logger.Error("failed to create auth token", zap.Error(err))
+	} else {
+		app.Audit("impersonation stopped", zap.String("admin", admin.Name), zap.String("user", parsed.User))
+		respondWithSession(c, admin, token, expiresAt, "")
+	}
+}
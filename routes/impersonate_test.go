@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImpersonate(t *testing.T) {
+	userToken := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+	var impersonationToken, restoredToken string
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: userToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/bar/impersonate", AuthorizedBodyConfig{
+		Token: userToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/unknown/impersonate", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/foo/impersonate", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"name\":\"foo\",\"admin\":false}", response.Body.String())
+			impersonationToken = response.Header().Get("Set-Cookie")
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: impersonationToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"hello\":\"world!\"}", response.Body.String())
+		},
+	})
+
+	// impersonation sessions cannot be used for admin actions
+	tryAuthorizedGet("/user", AuthorizedConfig{
+		Token: impersonationToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/account/impersonate/stop", AuthorizedBodyConfig{
+		Token: impersonationToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"name\":\"bar\",\"admin\":true}", response.Body.String())
+			restoredToken = response.Header().Get("Set-Cookie")
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: impersonationToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/user", AuthorizedConfig{
+		Token: restoredToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/account/impersonate/stop", AuthorizedBodyConfig{
+		Token: restoredToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+type createInviteBody struct {
+	Admin           bool   `json:"admin"`
+	TTL             int64  `json:"ttl"`
+	CurrentPassword string `json:"currentPassword"`
+}
+
+// CreateInvite godoc
+// @Summary      Create an invite
+// @Description  Mint a single-use invite for registering a new account (admin only)
+// @Tags         invites
+// @Accept       json
+// @Produce      json
+// @Param        invite body CreateInviteRequest false "Options of the invite"
+// @Success      201 {object} core.Invite "Invite created successfully"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON or ttl"
+// @Failure      401 {object} core.ErrorResponse "Current password of the admin incorrect (if re-authentication is required)"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /invites [post]
+func CreateInvite(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	var body createInviteBody
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if c.Request.ContentLength != 0 && c.ShouldBindJSON(&body) != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+	} else if !hasReauthenticated(app, admin, body.CurrentPassword) {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if body.TTL < 0 {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "ttl must not be negative")
+	} else {
+		ttl := app.Config.InviteTTL
+		if body.TTL > 0 {
+			ttl = time.Duration(body.TTL) * time.Minute
+		}
+
+		if invite, err := app.CreateInvite(admin.Name, body.Admin, ttl); err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to create invite")
+			app.Logger.Error("failed to create invite", zap.Error(err))
+		} else {
+			app.Audit("invite created", zap.String("admin", admin.Name), zap.String("invite", invite.ID), zap.Bool("adminInvite", invite.Admin))
+			c.JSON(http.StatusCreated, invite)
+		}
+	}
+}
+
+// Invites godoc
+// @Summary      List invites
+// @Description  List all invites which haven't been redeemed or expired yet, oldest first (admin only)
+// @Tags         invites
+// @Produce      json
+// @Param        offset query int false "Amount of invites to skip"
+// @Param        limit query int false "Maximum amount of invites to return (default 100, max 1000)"
+// @Success      200 {object} InvitesResponse "Open invites"
+// @Header       200 {integer} X-Total-Count "Total amount of invites"
+// @Header       200 {string} Link "Links to the next and previous page (RFC 8288)"
+// @Failure      400 {object} core.ErrorResponse "Invalid pagination parameters"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /invites [get]
+func Invites(c *gin.Context) {
+	app := appOf(c)
+	if authenticateAdmin(c) == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if offset, limit, ok := parsePagination(c); !ok {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "invalid offset or limit")
+	} else if invites, err := app.GetInvites(); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve invites")
+		app.Logger.Error("failed to retrieve invites", zap.Error(err))
+	} else {
+		setPaginationHeaders(c, len(invites), offset, limit)
+		c.JSON(http.StatusOK, InvitesResponse{
+			Total:   len(invites),
+			Invites: paginate(invites, offset, limit),
+		})
+	}
+}
+
+// DeleteInvite godoc
+// @Summary      Revoke an invite
+// @Description  Revoke an invite which hasn't been redeemed yet (admin only)
+// @Tags         invites
+// @Param        id path string true "Invite ID"
+// @Success      200 "Invite revoked successfully"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      404 {object} core.ErrorResponse "Invite not found"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /invites/{id} [delete]
+func DeleteInvite(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	id := c.Param("id")
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if err := app.DeleteInvite(id); err != nil {
+		if errors.Is(err, core.ErrInviteNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeInviteNotFound, "invite not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to revoke invite")
+			app.Logger.Error("failed to revoke invite", zap.Error(err))
+		}
+	} else {
+		app.Audit("invite revoked", zap.String("admin", admin.Name), zap.String("invite", id))
+		c.Status(http.StatusOK)
+	}
+}
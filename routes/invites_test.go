@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInvites(t *testing.T) {
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	core.Config.AllowRegistration = true
+	core.Config.RegistrationRequireInvite = true
+	t.Cleanup(func() {
+		core.Config.AllowRegistration = false
+		core.Config.RegistrationRequireInvite = false
+	})
+
+	tryAuthorizedPost("/invites", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	var invite, adminInvite, revokedInvite core.Invite
+
+	tryAuthorizedPost("/invites", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &invite))
+			assert.Equal(t, "bar", invite.CreatedBy)
+			assert.False(t, invite.Admin)
+			assert.Len(t, invite.ID, 32)
+		},
+	})
+
+	tryAuthorizedPost("/invites", AuthorizedBodyConfig{
+		Token: adminToken,
+		Body:  "{\"admin\": true, \"ttl\": 60}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &adminInvite))
+			assert.True(t, adminInvite.Admin)
+			assert.Equal(t, time.Hour, adminInvite.ExpiresAt.Sub(adminInvite.CreatedAt))
+		},
+	})
+
+	tryAuthorizedPost("/invites", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &revokedInvite))
+		},
+	})
+
+	tryAuthorizedGet("/invites", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body InvitesResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, 3, body.Total)
+		},
+	})
+
+	tryAuthorizedDelete("/invites/"+revokedInvite.ID, AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/invites/"+revokedInvite.ID, AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	// Registering requires a valid invite
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"Rk2Lw9xQ\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"Rk2Lw9xQ\", \"invite\": \"" + revokedInvite.ID + "\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"Rk2Lw9xQ\", \"invite\": \"" + invite.ID + "\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+			assert.Equal(t, "{\"name\":\"qux\",\"admin\":false}", response.Body.String())
+		},
+	})
+
+	// Invites can only be redeemed once
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"quux\", \"password\": \"Rk2Lw9xQ\", \"invite\": \"" + invite.ID + "\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	// A failed registration doesn't consume the invite
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"Rk2Lw9xQ\", \"invite\": \"" + adminInvite.ID + "\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"quux\", \"password\": \"Rk2Lw9xQ\", \"invite\": \"" + adminInvite.ID + "\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+			assert.Equal(t, "{\"name\":\"quux\",\"admin\":true}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/invites", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body InvitesResponse
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, 0, body.Total)
+		},
+	})
+}
@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// limitExceeded creates the error of a request rejected because limit has been reached with current, resetAt is nil
+// if the limit doesn't reset on its own.
+func limitExceeded(code core.ErrorCode, message string, limit, current int64, resetAt *time.Time) core.ErrorResponse {
+	return core.ErrorResponse{Error: message, Code: code, Limit: &limit, Current: &current, ResetAt: resetAt}
+}
+
+// keyLimitExceeded creates the error of a user or team which can't store another key as it already has current ones.
+func keyLimitExceeded(app *core.App, current int64) core.ErrorResponse {
+	return limitExceeded(core.CodeKeyLimitExceeded, "too many keys, limit is "+strconv.FormatInt(app.Config.AppKeysPerUser, 10), app.Config.AppKeysPerUser, current, nil)
+}
+
+// respondKeyLimitExceeded answers with 403 as user can't store another key, see keyLimitExceeded.
+func respondKeyLimitExceeded(c *gin.Context, user string) {
+	app := appOf(c)
+	c.JSON(http.StatusForbidden, keyLimitExceeded(app, app.CountDataForUser(user, "")))
+}
+
+// respondStorageFull answers with 507 as the maximum amount of keys across all users has been reached.
+func respondStorageFull(c *gin.Context) {
+	app := appOf(c)
+
+	current, err := app.CountAllData()
+	if err != nil {
+		app.Logger.Error("failed to count keys", zap.Error(err))
+	}
+
+	c.JSON(http.StatusInsufficientStorage, limitExceeded(core.CodeStorageFull, core.ErrStorageFull.Error(), app.Config.GlobalMaxKeys, current, nil))
+}
+
+// respondRateLimited answers with 429 and a Retry-After header as limit has been reached for the current window.
+func respondRateLimited(c *gin.Context, limit core.RateLimit, message string) {
+	resetAt := limit.ResetAt.UTC()
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(resetAt.Sub(appOf(c).Now()).Seconds()))))
+	c.JSON(http.StatusTooManyRequests, limitExceeded(core.CodeTooManyRequests, message, limit.Limit, limit.Current, &resetAt))
+}
+
+// respondJsonLimitExceeded answers with 400 as the structure of a JSON body exceeds err, see GENESIS_JSON_MAX_DEPTH.
+func respondJsonLimitExceeded(c *gin.Context, err *middleware.JsonLimitError) {
+	c.JSON(http.StatusBadRequest, limitExceeded(core.CodeJsonLimitExceeded, err.Error(), err.Limit, err.Current, nil))
+}
+
+func respondInvalidEncoding(c *gin.Context) {
+	respondError(c, http.StatusBadRequest, core.CodeInvalidEncoding, middleware.ErrInvalidEncoding.Error())
+}
@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DataMeta godoc
+// @Summary      Get metadata of a key
+// @Description  Retrieve information about a key without its value, lastAccessedAt is only available if access tracking is enabled
+// @Tags         data
+// @Produce      json
+// @Param        key path string true "Data key"
+// @Success      200 {object} core.DataMeta "Metadata of the key"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      404 {object} core.ErrorResponse "Key not found or invalid key pattern"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve metadata"
+// @Security     CookieAuth
+// @Router       /data/{key}/meta [get]
+func DataMeta(c *gin.Context) {
+	app := appOf(c)
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		respondError(c, http.StatusNotFound, core.CodeInvalidKeyPattern, "key must match "+app.Config.AppKeyPattern.String())
+	} else if meta, err := app.GetDataMeta(user.Name, key); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeKeyNotFound, "key not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve metadata")
+			app.Logger.Error("failed to retrieve metadata", zap.Error(err))
+		}
+	} else {
+		c.JSON(http.StatusOK, meta)
+	}
+}
+
+// SetDataLabels godoc
+// @Summary      Label a key
+// @Description  Attach labels to a key, e.g. {"category": "notes"}. Given labels are set while others are kept, a null value removes a label.
+// @Description  Names must not contain '=', names and values are limited to 128 bytes and a key can have at most 32 labels.
+// @Tags         data
+// @Accept       json
+// @Produce      json
+// @Param        key path string true "Data key"
+// @Param        labels body map[string]string true "Labels to set or remove"
+// @Success      200 {object} map[string]string "All labels of the key"
+// @Failure      400 {object} core.ErrorResponse "Invalid json or labels"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      404 {object} core.ErrorResponse "Key not found or invalid key pattern"
+// @Failure      500 {object} core.ErrorResponse "Failed to store labels"
+// @Security     CookieAuth
+// @Router       /data/{key}/labels [post]
+func SetDataLabels(c *gin.Context) {
+	app := appOf(c)
+	key := c.Param("key")
+	user := authenticateUser(c)
+	var update map[string]*string
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		respondError(c, http.StatusNotFound, core.CodeInvalidKeyPattern, "key must match "+app.Config.AppKeyPattern.String())
+	} else if err := c.ShouldBindJSON(&update); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json, expected an object of labels")
+	} else if labels, err := app.SetDataLabels(user.Name, key, update); err != nil {
+		if errors.Is(err, core.ErrDataNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeKeyNotFound, "key not found")
+		} else if errors.Is(err, core.ErrInvalidLabels) {
+			respondError(c, http.StatusBadRequest, core.CodeInvalidLabels, err.Error())
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to store labels")
+			app.Logger.Error("failed to store labels", zap.Error(err))
+		}
+	} else {
+		c.JSON(http.StatusOK, labels)
+	}
+}
+
+// DataKeys godoc
+// @Summary      List keys
+// @Description  List the keys of the authenticated user without their values, optionally only those with a label.
+// @Tags         data
+// @Produce      json
+// @Param        label query string false "Name of a label, or name=value to only include keys where it has this value"
+// @Success      200 {object} KeysResponse "Keys in order"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve keys"
+// @Security     CookieAuth
+// @Router       /data/keys [get]
+func DataKeys(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if keys, err := app.GetKeysFromUser(user.Name, c.Query("label")); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve keys")
+		app.Logger.Error("failed to retrieve keys", zap.Error(err))
+	} else {
+		c.JSON(http.StatusOK, KeysResponse{Keys: keys})
+	}
+}
+
+// QueryData godoc
+// @Summary      List keys by an indexed field
+// @Description  List the keys of the authenticated user whose value has the given value in an indexed field, or any value if none is given.
+// @Description  Only fields declared in GENESIS_DATA_INDEXES can be queried. Strings are matched as they are, numbers and booleans by their JSON representation.
+// @Tags         data
+// @Produce      json
+// @Param        field query string true "Dot-separated path of an indexed field, e.g. status"
+// @Param        value query string false "Value the field must have"
+// @Success      200 {object} KeysResponse "Matching keys in order"
+// @Failure      400 {object} core.ErrorResponse "Missing field or field not indexed"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to query keys"
+// @Security     CookieAuth
+// @Router       /data/query [get]
+func QueryData(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+	field := c.Query("field")
+
+	var value *string
+	if raw, ok := c.GetQuery("value"); ok {
+		value = &raw
+	}
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if len(field) == 0 {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "field is required")
+	} else if keys, err := app.QueryDataIndex(user.Name, field, value); errors.Is(err, core.ErrFieldNotIndexed) {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "field "+strconv.Quote(field)+" is not indexed")
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to query keys")
+		app.Logger.Error("failed to query keys", zap.Error(err))
+	} else {
+		c.JSON(http.StatusOK, KeysResponse{Keys: keys})
+	}
+}
+
+// PruneData godoc
+// @Summary      Delete keys not accessed since a given time
+// @Description  Delete all keys which haven't been read or written since notAccessedSince, requires access tracking to be enabled.
+// @Description  Keys without a recorded access are kept. If the trash is enabled, keys are moved to the trash unless purge is set.
+// @Tags         data
+// @Produce      json
+// @Param        notAccessedSince query string true "RFC 3339 timestamp"
+// @Param        purge query bool false "Delete the keys permanently"
+// @Success      200 {object} PruneResponse "Deleted keys"
+// @Failure      400 {object} core.ErrorResponse "Missing or invalid timestamp, or access tracking disabled"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to delete data"
+// @Security     CookieAuth
+// @Router       /data [delete]
+func PruneData(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+		return
+	} else if !app.Config.TrackLastAccess {
+		// Access times aren't updated anymore once tracking is disabled, so keys in use would look stale
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "pruning requires access tracking to be enabled")
+		return
+	}
+
+	since, err := time.Parse(time.RFC3339, c.Query("notAccessedSince"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidParameter, "notAccessedSince must be a RFC 3339 timestamp")
+		return
+	}
+
+	keys, err := app.GetKeysNotAccessedSince(user.Name, since)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve metadata")
+		app.Logger.Error("failed to retrieve metadata", zap.Error(err))
+		return
+	}
+
+	for _, key := range keys {
+		if err := deleteData(c, user.Name, key, ""); err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to delete data")
+			app.Logger.Error("failed to delete data", zap.Error(err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, PruneResponse{Deleted: keys})
+}
@@ -0,0 +1,300 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDataMeta(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/meta", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/meta/meta", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var meta core.DataMeta
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &meta))
+			assert.Equal(t, "meta", meta.Key)
+			assert.Equal(t, int64(18), meta.Size)
+			assert.NotNil(t, meta.UpdatedAt)
+			assert.Nil(t, meta.LastAccessedAt)
+		},
+	})
+
+	tryAuthorizedGet("/data/missing/meta", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+}
+
+func TestPruneData(t *testing.T) {
+	token := loginUser(t)
+
+	core.Config.TrackLastAccess = true
+	t.Cleanup(func() {
+		core.Config.TrackLastAccess = false
+	})
+
+	for _, key := range []string{"old", "new"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{\"hello\": \"world!\"}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	cutoff := time.Now().UTC().Format(time.RFC3339Nano)
+
+	// Reading a key counts as access
+	tryAuthorizedGet("/data/new", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/new/meta", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var meta core.DataMeta
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &meta))
+			assert.NotNil(t, meta.LastAccessedAt)
+		},
+	})
+
+	tryAuthorizedDelete("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	// If-Match only applies to single keys
+	tryAuthorizedDelete("/data?notAccessedSince="+cutoff, AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"5d41402abc4b2a76b9719d911017c592\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"deleted\":[\"old\"]}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"new\":{\"hello\":\"world!\"}}", response.Body.String())
+		},
+	})
+
+	// Once tracking is disabled, recorded access times are outdated and nothing is pruned
+	core.Config.TrackLastAccess = false
+	tryAuthorizedDelete("/data?notAccessedSince="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano), AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"new\":{\"hello\":\"world!\"}}", response.Body.String())
+		},
+	})
+}
+
+func TestDataLabels(t *testing.T) {
+	token := loginUser(t)
+
+	for _, key := range []string{"a", "b", "c"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	for key, body := range map[string]string{
+		"a": "{\"category\": \"notes\", \"pinned\": \"yes\"}",
+		"b": "{\"category\": \"notes/archived\"}",
+		"c": "{\"category\": \"notes\"}",
+	} {
+		tryAuthorizedPost("/data/"+key+"/labels", AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	// Labels not sent are kept, null removes them
+	tryAuthorizedPost("/data/a/labels", AuthorizedBodyConfig{
+		Body:  "{\"pinned\": null, \"color\": \"red\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"category\":\"notes\",\"color\":\"red\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/a/meta", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var meta core.DataMeta
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &meta))
+			assert.Equal(t, core.Labels{"category": "notes", "color": "red"}, meta.Labels)
+		},
+	})
+
+	// Deleting a key removes it from the index
+	tryAuthorizedDelete("/data/c", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	for query, expected := range map[string]string{
+		"":                               "{\"keys\":[\"a\",\"b\"]}",
+		"?label=category":                "{\"keys\":[\"a\",\"b\"]}",
+		"?label=category=notes":          "{\"keys\":[\"a\"]}",
+		"?label=category=notes/archived": "{\"keys\":[\"b\"]}",
+		"?label=pinned":                  "{\"keys\":[]}",
+		"?label=color=blue":              "{\"keys\":[]}",
+	} {
+		tryAuthorizedGet("/data/keys"+query, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, expected, response.Body.String(), query)
+			},
+		})
+	}
+
+	for url, expected := range map[string]struct {
+		body   string
+		status int
+		code   core.ErrorCode
+	}{
+		"/data/missing/labels": {"{\"category\": \"notes\"}", http.StatusNotFound, core.CodeKeyNotFound},
+		"/data/a/labels":       {"{\"a=b\": \"c\"}", http.StatusBadRequest, core.CodeInvalidLabels},
+	} {
+		tryAuthorizedPost(url, AuthorizedBodyConfig{
+			Body:  expected.body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				var failure core.ErrorResponse
+				assert.Equal(t, expected.status, response.Code, url)
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &failure))
+				assert.Equal(t, expected.code, failure.Code, url)
+			},
+		})
+	}
+}
+
+func TestQueryData(t *testing.T) {
+	token := loginUser(t)
+
+	for key, body := range map[string]string{
+		"task_a": "{\"status\": \"open\", \"owner\": {\"name\": \"foo\"}}",
+		"task_b": "{\"status\": \"done\"}",
+		"note":   "{\"status\": \"open\"}",
+	} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	// Existing keys are indexed once the declared indexes change
+	core.Config.DataIndexes = []core.DataIndex{{KeyPattern: "task_*", Field: "status"}, {KeyPattern: "*", Field: "owner.name"}}
+	t.Cleanup(func() {
+		core.Config.DataIndexes = nil
+	})
+
+	rebuilt, err := core.RebuildIndexes(false)
+	assert.NoError(t, err)
+	assert.True(t, rebuilt)
+
+	rebuilt, err = core.RebuildIndexes(false)
+	assert.NoError(t, err)
+	assert.False(t, rebuilt)
+
+	// Updates replace previous index entries
+	tryAuthorizedPost("/data/task_b", AuthorizedBodyConfig{
+		Body:  "{\"status\": \"open\", \"owner\": {\"name\": \"bar\"}}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	for query, expected := range map[string]string{
+		"?field=status":                 "{\"keys\":[\"task_a\",\"task_b\"]}",
+		"?field=status&value=open":      "{\"keys\":[\"task_a\",\"task_b\"]}",
+		"?field=status&value=done":      "{\"keys\":[]}",
+		"?field=owner.name&value=bar":   "{\"keys\":[\"task_b\"]}",
+		"?field=owner.name":             "{\"keys\":[\"task_a\",\"task_b\"]}",
+		"?field=owner.name&value=other": "{\"keys\":[]}",
+	} {
+		tryAuthorizedGet("/data/query"+query, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, expected, response.Body.String(), query)
+			},
+		})
+	}
+
+	// Deleting a key removes its index entries
+	tryAuthorizedDelete("/data/task_a", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/query?field=status&value=open", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"keys\":[\"task_b\"]}", response.Body.String())
+		},
+	})
+
+	for _, query := range []string{"", "?field=title", "?value=open"} {
+		tryAuthorizedGet("/data/query"+query, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				var failure core.ErrorResponse
+				assert.Equal(t, http.StatusBadRequest, response.Code, query)
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &failure))
+				assert.Equal(t, core.CodeInvalidParameter, failure.Code, query)
+			},
+		})
+	}
+}
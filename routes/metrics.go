@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
+	"net/http"
+)
+
+// Metrics godoc
+// @Summary      Prometheus metrics
+// @Description  Request counters per route and status code as well as the share of 4xx and 5xx responses per route within the last GENESIS_METRICS_WINDOW minutes, in the Prometheus text format (only available if metrics are enabled)
+// @Description  The outcome of scheduled backups is included if GENESIS_BACKUP_INTERVAL is set.
+// @Tags         health
+// @Produce      plain
+// @Success      200 {string} string "Metrics"
+// @Router       /metrics [get]
+func Metrics(metrics *middleware.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		_, _ = metrics.WriteTo(c.Writer)
+
+		if app := appOf(c); app.Config.BackupInterval > 0 {
+			writeBackupMetrics(c, app.BackupStatus())
+		}
+	}
+}
+
+// writeBackupMetrics appends the outcome of scheduled backups to the metrics, the timestamp is zero without any backup.
+func writeBackupMetrics(c *gin.Context, stats core.BackupStats) {
+	var lastSuccess int64
+	if stats.LastSuccessAt != nil {
+		lastSuccess = stats.LastSuccessAt.Unix()
+	}
+
+	_, _ = fmt.Fprintf(c.Writer, "# HELP genesis_backups_total Number of scheduled backups uploaded to object storage by result.\n"+
+		"# TYPE genesis_backups_total counter\n"+
+		"genesis_backups_total{result=\"success\"} %d\n"+
+		"genesis_backups_total{result=\"failure\"} %d\n"+
+		"# HELP genesis_backup_last_success_timestamp_seconds Time of the last successfully uploaded backup.\n"+
+		"# TYPE genesis_backup_last_success_timestamp_seconds gauge\n"+
+		"genesis_backup_last_success_timestamp_seconds %d\n", stats.Succeeded, stats.Failed, lastSuccess)
+}
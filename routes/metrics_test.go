@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"context"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	tryUnauthorizedGet("/metrics", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	core.Config.MetricsEnabled = true
+	t.Cleanup(func() {
+		core.Config.MetricsEnabled = false
+	})
+
+	// Metrics are kept per router, which is why it's reused for all requests
+	router := SetupRoutes()
+	request := func(method, url string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, nil)
+		router.ServeHTTP(response, req)
+		return response
+	}
+
+	request("GET", "/health")
+	request("GET", "/health")
+	request("GET", "/data/foo")
+	request("GET", "/data/bar")
+	request("GET", "/unknown")
+
+	response := request("GET", "/metrics")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.True(t, strings.HasPrefix(response.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+
+	body := response.Body.String()
+	for _, line := range []string{
+		"genesis_http_requests_total{method=\"GET\",route=\"/health\",code=\"200\"} 2",
+		"genesis_http_requests_total{method=\"GET\",route=\"/data/:key\",code=\"401\"} 2",
+		"genesis_http_requests_total{method=\"GET\",route=\"unmatched\",code=\"404\"} 1",
+		"genesis_http_window_requests{method=\"GET\",route=\"/data/:key\"} 2",
+		"genesis_http_error_rate{method=\"GET\",route=\"/data/:key\",class=\"4xx\"} 1",
+		"genesis_http_error_rate{method=\"GET\",route=\"/data/:key\",class=\"5xx\"} 0",
+		"genesis_http_error_rate{method=\"GET\",route=\"/health\",class=\"4xx\"} 0",
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+}
+
+func TestSlowRequests(t *testing.T) {
+	token := loginUser(t)
+	observed, logs := observer.New(zap.WarnLevel)
+	logger := core.Default.Logger
+
+	core.Config.SlowRequestThreshold = time.Nanosecond
+	core.Default.Logger = zap.New(observed)
+	t.Cleanup(func() {
+		core.Config.SlowRequestThreshold = 0
+		core.Default.Logger = logger
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	entries := logs.FilterMessage("slow request").All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "/data", entries[0].ContextMap()["path"])
+	assert.Equal(t, "foo", entries[0].ContextMap()["user"])
+	assert.Equal(t, int64(http.StatusOK), entries[0].ContextMap()["status"])
+}
+
+func TestDebugLogBodies(t *testing.T) {
+	token := loginUser(t)
+	observed, logs := observer.New(zap.InfoLevel)
+	logger := core.Default.Logger
+
+	core.Config.DebugLogBodies = true
+	core.Config.DebugLogBodiesPaths = []string{"/login"}
+	core.Config.DebugLogBodiesUsers = []string{"foo"}
+	core.Config.DebugLogBodiesMaxSize = 4096
+	core.Default.Logger = zap.New(observed)
+	t.Cleanup(func() {
+		core.Config.DebugLogBodies = false
+		core.Config.DebugLogBodiesPaths = nil
+		core.Config.DebugLogBodiesUsers = nil
+		core.Default.Logger = logger
+	})
+
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"bar\", \"password\": \"EczUR8dn\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryUnauthorizedGet("/health", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	entries := logs.FilterMessage("request bodies").All()
+	assert.Len(t, entries, 2)
+
+	login := entries[0].ContextMap()
+	assert.Equal(t, "/login", login["path"])
+	assert.Equal(t, "{\"user\": \"bar\", \"password\": \"[redacted]\"}", login["request"])
+	assert.Equal(t, "{\"name\":\"bar\",\"admin\":true}", login["response"])
+
+	data := entries[1].ContextMap()
+	assert.Equal(t, "foo", data["user"])
+	assert.Equal(t, "{\"hello\": \"world!\"}", data["request"])
+	assert.Equal(t, false, data["requestTruncated"])
+
+	// Passwords cut off by the size limit are redacted as well
+	core.Config.DebugLogBodiesMaxSize = 30
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"bar\", \"password\": \"EczUR8dn\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	entries = logs.FilterMessage("request bodies").All()
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "{\"user\": \"bar\", \"password\": \"[redacted]\"", entries[2].ContextMap()["request"])
+	assert.Equal(t, true, entries[2].ContextMap()["requestTruncated"])
+
+	// Users are resolved by the app serving the request, which needn't be the Default one
+	db, err := core.OpenInMemoryDatabase()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	config := core.Config
+	config.DebugLogBodiesPaths = nil
+	config.DebugLogBodiesUsers = []string{"qux"}
+	config.AppUsersToCreate = []core.User{{Name: "qux", Password: "q8w7e6r5"}}
+	config.JWTSecret = []byte("a secret only known to this app..")
+
+	app := core.NewApp(&config, zap.New(observed), db)
+	assert.NoError(t, app.Migrate(false))
+	app.InitializeUsers()
+	router := SetupAppRoutes(app)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/login", strings.NewReader("{\"user\": \"qux\", \"password\": \"q8w7e6r5\"}"))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	cookie := response.Header().Get("Set-Cookie")
+
+	response = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/data", nil)
+	request.Header.Set("Cookie", cookie)
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	entries = logs.FilterMessage("request bodies").All()
+	assert.Len(t, entries, 4)
+	assert.Equal(t, "qux", entries[3].ContextMap()["user"])
+	assert.Equal(t, response.Header().Get("X-Request-Id"), entries[3].ContextMap()["requestId"])
+}
+
+func TestBackupMetrics(t *testing.T) {
+	var mutex sync.Mutex
+	objects := make(map[string]int)
+	failing := false
+
+	// Fake object storage, only keeping the size of each object
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if failing || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/backups/")
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[key] = len(body)
+		case http.MethodDelete:
+			delete(objects, key)
+		case http.MethodGet:
+			_, _ = io.WriteString(w, "<ListBucketResult>")
+			for stored := range objects {
+				if strings.HasPrefix(stored, r.URL.Query().Get("prefix")) {
+					_, _ = io.WriteString(w, "<Contents><Key>"+stored+"</Key></Contents>")
+				}
+			}
+			_, _ = io.WriteString(w, "</ListBucketResult>")
+		}
+	}))
+	defer storage.Close()
+
+	endpoint := core.Config.BackupS3Endpoint
+	core.Config.MetricsEnabled = true
+	core.Config.BackupInterval = time.Hour
+	core.Config.BackupRetention = 2
+	core.Config.BackupS3Endpoint = storage.URL
+	core.Config.BackupS3Bucket = "backups"
+	core.Config.BackupS3Prefix = "genesis/"
+	core.Config.BackupS3AccessKey = "access"
+	core.Config.BackupS3SecretKey = "secret"
+	t.Cleanup(func() {
+		core.Config.MetricsEnabled = false
+		core.Config.BackupInterval = 0
+		core.Config.BackupRetention = 0
+		core.Config.BackupS3Endpoint = endpoint
+		core.Config.BackupS3Bucket = ""
+		core.Config.BackupS3Prefix = ""
+		core.Config.BackupS3AccessKey = ""
+		core.Config.BackupS3SecretKey = ""
+	})
+
+	loginUser(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for day := range 3 {
+		key, err := core.UploadBackup(context.Background(), start.AddDate(0, 0, day))
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(key, "genesis/genesis-2026010"))
+	}
+
+	// Only the latest backups are kept
+	mutex.Lock()
+	assert.Len(t, objects, 2)
+	assert.NotContains(t, objects, "genesis/genesis-20260101T000000Z.bak")
+	assert.Greater(t, objects["genesis/genesis-20260103T000000Z.bak"], 0)
+	failing = true
+	mutex.Unlock()
+
+	_, err := core.UploadBackup(context.Background(), start.AddDate(0, 0, 3))
+	assert.Error(t, err)
+
+	tryUnauthorizedGet("/metrics", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			body := response.Body.String()
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, body, "genesis_backups_total{result=\"success\"} 3\n")
+			assert.Contains(t, body, "genesis_backups_total{result=\"failure\"} 1\n")
+			assert.Contains(t, body, "genesis_backup_last_success_timestamp_seconds "+strconv.FormatInt(start.AddDate(0, 0, 2).Unix(), 10)+"\n")
+		},
+	})
+}
@@ -0,0 +1,257 @@
+package routes
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// schemaVersionKey is where the version of the database schema is stored
+var schemaVersionKey = []byte("sys/schema")
+
+// newMigrationApp creates an app backed by an empty in-memory database, which is closed once the test is done.
+func newMigrationApp(t *testing.T, configure func(config *core.AppConfig)) (*core.App, *badger.DB, *observer.ObservedLogs) {
+	db, err := core.OpenInMemoryDatabase()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	config := core.Config
+	config.ReadOnly = false
+	if configure != nil {
+		configure(&config)
+	}
+
+	observed, logs := observer.New(zap.InfoLevel)
+	return core.NewApp(&config, zap.New(observed), db), db, logs
+}
+
+func readSchemaVersion(t *testing.T, db *badger.DB) int {
+	version := -1
+	assert.NoError(t, db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(schemaVersionKey)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(value []byte) error {
+			version, err = strconv.Atoi(string(value))
+			return err
+		})
+	}))
+
+	return version
+}
+
+func countKeys(t *testing.T, db *badger.DB) int {
+	count := 0
+	assert.NoError(t, db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			count++
+		}
+
+		return nil
+	}))
+
+	return count
+}
+
+func TestMigrate(t *testing.T) {
+	app, db, logs := newMigrationApp(t, nil)
+	assert.NoError(t, app.Migrate(false))
+
+	// Each migration is applied once and the latest version recorded
+	version := readSchemaVersion(t, db)
+	assert.Positive(t, version)
+	assert.Len(t, logs.FilterMessage("applied migration").All(), version)
+
+	assert.NoError(t, app.Migrate(false))
+	assert.Equal(t, version, readSchemaVersion(t, db))
+	assert.Len(t, logs.FilterMessage("applied migration").All(), version)
+
+	// Databases of newer versions are left alone
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		return txn.Set(schemaVersionKey, []byte(strconv.Itoa(version+1)))
+	}))
+
+	assert.ErrorIs(t, app.Migrate(false), core.ErrSchemaTooNew)
+	assert.ErrorIs(t, app.Migrate(true), core.ErrSchemaTooNew)
+	assert.Equal(t, version+1, readSchemaVersion(t, db))
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	app, db, logs := newMigrationApp(t, func(config *core.AppConfig) {
+		config.GlobalMaxKeys = 10
+	})
+
+	// Pending migrations are only logged
+	assert.NoError(t, app.Migrate(true))
+	assert.Zero(t, countKeys(t, db))
+
+	pending := len(logs.FilterMessage("pending migration").All())
+	assert.Positive(t, pending)
+	assert.Empty(t, logs.FilterMessage("applied migration").All())
+
+	assert.NoError(t, app.Migrate(false))
+	assert.Equal(t, pending, readSchemaVersion(t, db))
+}
+
+func TestMigrateReadOnly(t *testing.T) {
+	app, db, _ := newMigrationApp(t, func(config *core.AppConfig) {
+		config.ReadOnly = true
+	})
+
+	// Pending migrations can be listed but not applied
+	assert.ErrorIs(t, app.Migrate(false), core.ErrReadOnlyMigration)
+	assert.NoError(t, app.Migrate(true))
+	assert.Zero(t, countKeys(t, db))
+
+	// Databases which are up to date can be used as they are
+	app.Config.ReadOnly = false
+	assert.NoError(t, app.Migrate(false))
+
+	app.Config.ReadOnly = true
+	assert.NoError(t, app.Migrate(false))
+}
+
+// collectKeys returns all keys starting with one of prefixes along with their values.
+func collectKeys(t *testing.T, db *badger.DB, prefixes ...string) map[string]string {
+	keys := make(map[string]string)
+	assert.NoError(t, db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for _, prefix := range prefixes {
+			for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+				value, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+
+				keys[string(it.Item().Key())] = string(value)
+			}
+		}
+
+		return nil
+	}))
+
+	return keys
+}
+
+func TestMigrateEscapedNames(t *testing.T) {
+	app, db, _ := newMigrationApp(t, func(config *core.AppConfig) {
+		config.DedupEnabled = true
+	})
+
+	assert.NoError(t, app.Migrate(false))
+	_, err := app.CreateUsers([]core.User{{Name: "a/b", Password: "foobar1234"}, {Name: "a", Password: "foobar1234"}})
+	assert.NoError(t, err)
+	_, err = app.CreateTeam("t/1", "a")
+	assert.NoError(t, err)
+
+	// All values are the same, so they reference a single blob
+	value := []byte("{\"hello\":\"world\"}")
+	assert.NoError(t, app.SetDataForUser("a/b", "x", value))
+	assert.NoError(t, app.SetDataForUser("a/b", "y", value))
+	assert.NoError(t, app.SetDataForUser("a", "b", value))
+	assert.NoError(t, app.SetDataForTeam("t/1", "k", value))
+	assert.NoError(t, app.TrashDataFromUser("a/b", "y"))
+	assert.NoError(t, app.SetSettings("a/b", []byte("{\"theme\":\"dark\"}")))
+	assert.NoError(t, app.ShareData("a/b", "x", "a", core.PermissionRead))
+	assert.NoError(t, app.ShareData("a", "z", "a/b", core.PermissionReadWrite))
+
+	trash, err := app.GetTrashFromUser("a/b")
+	assert.NoError(t, err)
+	assert.Len(t, trash, 1)
+
+	blobs := collectKeys(t, db, "blb/", "brc/")
+	assert.Len(t, blobs, 2)
+
+	// Names were stored as they are before the second migration
+	assert.NoError(t, db.Update(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		entries := make([]*badger.Entry, 0)
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if key := string(item.Key()); strings.Contains(key, "\\/") {
+				value, err := item.ValueCopy(nil)
+				if err != nil {
+					it.Close()
+					return err
+				}
+
+				entry := badger.NewEntry([]byte(strings.ReplaceAll(key, "\\/", "/")), value).WithMeta(item.UserMeta())
+				entry.ExpiresAt = item.ExpiresAt()
+				entries = append(entries, entry)
+
+				if err := txn.Delete(item.KeyCopy(nil)); err != nil {
+					it.Close()
+					return err
+				}
+			}
+		}
+
+		it.Close()
+		assert.NotEmpty(t, entries)
+
+		for _, entry := range entries {
+			if err := txn.SetEntry(entry); err != nil {
+				return err
+			}
+		}
+
+		return txn.Set(schemaVersionKey, []byte("1"))
+	}))
+
+	assert.NoError(t, app.Migrate(false))
+
+	// Each user finds their data where it was before
+	data, err := app.GetAllDataFromUser("a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"x\":{\"hello\":\"world\"}}", string(data))
+
+	data, err = app.GetAllDataFromUser("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"b\":{\"hello\":\"world\"}}", string(data))
+
+	data, err = app.GetAllDataFromTeam("t/1")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"k\":{\"hello\":\"world\"}}", string(data))
+
+	settings, err := app.GetSettings("a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"theme\":\"dark\"}", string(settings))
+
+	migrated, err := app.GetTrashFromUser("a/b")
+	assert.NoError(t, err)
+	assert.Len(t, migrated, 1)
+	assert.Equal(t, "y", migrated[0].Key)
+	assert.WithinDuration(t, trash[0].ExpiresAt, migrated[0].ExpiresAt, 2*time.Second)
+
+	shared, err := app.GetSharedWithUser("a")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.SharedKey{{Owner: "a/b", Key: "x", Permission: core.PermissionRead}}, shared)
+
+	shared, err = app.GetSharedWithUser("a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.SharedKey{{Owner: "a", Key: "z", Permission: core.PermissionReadWrite}}, shared)
+
+	// References of the blob are kept, so it's only removed along with the last value
+	assert.Equal(t, blobs, collectKeys(t, db, "blb/", "brc/"))
+	assert.NoError(t, app.DeleteUser("a/b"))
+	assert.NoError(t, app.DeleteUser("a"))
+	assert.Len(t, collectKeys(t, db, "blb/", "brc/"), 2)
+	assert.NoError(t, app.DeleteTeam("t/1"))
+	assert.Empty(t, collectKeys(t, db, "blb/", "brc/"))
+}
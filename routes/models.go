@@ -1,5 +1,12 @@
 package routes
 
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
+	"time"
+)
+
 // LoginRequest represents the login credentials
 // @Description Login credentials for authentication
 type LoginRequest struct {
@@ -7,6 +14,16 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required" example:"password123"`
 }
 
+// TokenResponse represents the login response for non-browser clients
+// @Description User info and JWT returned in the body when logging in with mode=token
+type TokenResponse struct {
+	Name         string    `json:"name" example:"admin"`
+	Admin        bool      `json:"admin" example:"true"`
+	Impersonator string    `json:"impersonator,omitempty" example:""`
+	Token        string    `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresAt    time.Time `json:"expiresAt" example:"2025-01-01T00:00:00Z"`
+}
+
 // UpdatePasswordRequest represents the password update request
 // @Description Request to update user password
 type UpdatePasswordRequest struct {
@@ -14,12 +31,6 @@ type UpdatePasswordRequest struct {
 	NewPassword     string `json:"newPassword" binding:"required" validate:"gte=8,lte=64" example:"newPassword123"`
 }
 
-// ErrorResponse represents an error response
-// @Description Error response
-type ErrorResponse struct {
-	Error string `json:"error" example:"error message"`
-}
-
 // SuccessResponse represents a success response
 // @Description Success response
 type SuccessResponse struct {
@@ -32,6 +43,41 @@ type CreateUserRequest struct {
 	Name     string `json:"name" binding:"required" validate:"required,gte=3,lte=32" example:"john"`
 	Password string `json:"password" binding:"required" validate:"required,gte=8,lte=64" example:"password123"`
 	Admin    bool   `json:"admin" example:"false"`
+	// Password of the admin, only required if GENESIS_REQUIRE_REAUTH_FOR_ADMIN_WRITES is enabled
+	CurrentPassword string `json:"currentPassword,omitempty" example:"adminPassword123"`
+}
+
+// RegisterRequest represents the request to register a new account
+// @Description Request to create a new non-admin user (only if registration is enabled)
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required" validate:"required,gte=3,lte=32" example:"john"`
+	Password string `json:"password" binding:"required" validate:"required,gte=8,lte=64" example:"password123"`
+	// Invite minted by an admin, required if GENESIS_REGISTRATION_REQUIRE_INVITE is enabled
+	Invite string `json:"invite,omitempty" example:"9b1deb4d3b7d4bad9bdd2b0d7b3dcb6d"`
+}
+
+// CreateInviteRequest represents the options of a new invite
+// @Description Options of a new invite, all fields are optional
+type CreateInviteRequest struct {
+	// Whether the user registering with the invite becomes an admin
+	Admin bool `json:"admin" example:"false"`
+	// Lifetime in minutes, defaults to GENESIS_INVITE_TTL
+	TTL int64 `json:"ttl,omitempty" example:"1440"`
+	// Password of the admin, only required if GENESIS_REQUIRE_REAUTH_FOR_ADMIN_WRITES is enabled
+	CurrentPassword string `json:"currentPassword,omitempty" example:"adminPassword123"`
+}
+
+// CreateTeamRequest represents the request to create a new team
+// @Description Request to create a new team (admin only), names follow the same rules as user names
+type CreateTeamRequest struct {
+	Name string `json:"name" binding:"required" example:"family"`
+}
+
+// InvitesResponse represents a page of open invites
+// @Description Invites which haven't been redeemed or expired yet (admin only)
+type InvitesResponse struct {
+	Total   int            `json:"total" example:"2"`
+	Invites []*core.Invite `json:"invites"`
 }
 
 // UpdateUserRequest represents the request to update a user
@@ -39,4 +85,269 @@ type CreateUserRequest struct {
 type UpdateUserRequest struct {
 	Admin    *bool   `json:"admin,omitempty" example:"false"`
 	Password *string `json:"password,omitempty" validate:"omitempty,gte=8,lte=64" example:"newPassword123"`
+	Disabled *bool   `json:"disabled,omitempty" example:"false"`
+	// Password of the admin, only required if GENESIS_REQUIRE_REAUTH_FOR_ADMIN_WRITES is enabled
+	CurrentPassword string `json:"currentPassword,omitempty" example:"adminPassword123"`
+}
+
+// ReauthRequest represents the password confirmation for admin actions
+// @Description Password of the admin, only required if GENESIS_REQUIRE_REAUTH_FOR_ADMIN_WRITES is enabled
+type ReauthRequest struct {
+	CurrentPassword string `json:"currentPassword" example:"adminPassword123"`
+}
+
+// AdvanceClockRequest represents how far to move the clock in test mode
+// @Description Positive duration in Go syntax, e.g. 90s or 1h30m
+type AdvanceClockRequest struct {
+	By string `json:"by" binding:"required" example:"1h30m"`
+}
+
+// ClockResponse represents the time of the clock of the app
+// @Description Current time of the clock of the app
+type ClockResponse struct {
+	Now time.Time `json:"now" example:"2025-01-01T00:00:00Z"`
+}
+
+// UsageResponse represents a page of the storage usage report
+// @Description Storage usage per user (admin only)
+type UsageResponse struct {
+	Total int               `json:"total" example:"3"`
+	Users []*core.UserUsage `json:"users"`
+}
+
+// InvalidatedTokensResponse represents the invalidated tokens
+// @Description Amount of invalidated tokens, the tokens themselves are only included if requested
+type InvalidatedTokensResponse struct {
+	Total  int                      `json:"total" example:"12"`
+	Tokens []*core.InvalidatedToken `json:"tokens,omitempty"`
+}
+
+// BatchResult represents the outcome of storing a single key of a batch
+// @Description Result of storing a single key, error and code are only set if it failed
+type BatchResult struct {
+	Key    string         `json:"key" example:"settings"`
+	Status int            `json:"status" example:"200"`
+	Error  string         `json:"error,omitempty" example:""`
+	Code   core.ErrorCode `json:"code,omitempty" example:""`
+}
+
+// BatchResponse represents the outcome of a batch write
+// @Description Summary of a batch write with the result of each key
+type BatchResponse struct {
+	Stored  int           `json:"stored" example:"2"`
+	Failed  int           `json:"failed" example:"0"`
+	Results []BatchResult `json:"results"`
+}
+
+// CreatedDataResponse represents a key generated by the server
+// @Description Key the value has been stored under
+type CreatedDataResponse struct {
+	Key string `json:"key" example:"01ARZ3NDEKTSV4RRFFQ69G5FAV"`
+}
+
+// CountResponse represents the amount of keys of a user
+// @Description Amount of keys and the maximum amount of keys per user
+type CountResponse struct {
+	Count int64 `json:"count" example:"4"`
+	Limit int64 `json:"limit" example:"6"`
+}
+
+// KeysResponse represents a list of keys
+// @Description Keys of a user in order
+type KeysResponse struct {
+	Keys []string `json:"keys" example:"notes,settings"`
+}
+
+// KeyValidationResponse represents the result of validating a key
+// @Description Whether a key is valid and the rules it's checked against, maxLength is 0 if unlimited
+type KeyValidationResponse struct {
+	Valid     bool   `json:"valid" example:"true"`
+	Pattern   string `json:"pattern" example:"^[a-z0-9_]{0,32}$"`
+	MaxLength int64  `json:"maxLength" example:"255"`
+	Error     string `json:"error,omitempty" example:""`
+}
+
+// ExistsResponse represents which keys of a user exist
+// @Description Whether each key exists, invalid keys never exist and are listed separately
+type ExistsResponse struct {
+	Exists  map[string]bool `json:"exists"`
+	Invalid []string        `json:"invalid,omitempty" example:"not valid"`
+}
+
+// PollResponse represents the keys of a user which changed since they've been polled
+// @Description Current value and ETag of each key whose ETag differs, keys which have been deleted and invalid keys
+type PollResponse struct {
+	Changed map[string]PolledValue `json:"changed"`
+	Deleted []string               `json:"deleted" example:"settings"`
+	Invalid []string               `json:"invalid,omitempty" example:"not valid"`
+}
+
+// PolledValue represents the current value of a polled key
+// @Description Value of a key along with its ETag, which is sent in the next poll
+type PolledValue struct {
+	Value json.RawMessage `json:"value" swaggertype:"object"`
+	ETag  string          `json:"etag" example:"\"5d41402abc4b2a76b9719d911017c592\""`
+}
+
+// NotNumericResponse represents a batch increment rejected because of stored values which aren't numbers
+// @Description Error response listing the keys whose value isn't a number, nothing has been incremented
+type NotNumericResponse struct {
+	core.ErrorResponse
+	Keys []string `json:"keys" example:"settings"`
+}
+
+// ConfirmationRequiredResponse represents a destructive admin action which hasn't been executed yet
+// @Description Error response with the token to send back as X-Confirmation-Token header to execute the action
+type ConfirmationRequiredResponse struct {
+	core.ErrorResponse
+	core.Confirmation
+}
+
+// PruneResponse represents the keys deleted by a prune
+// @Description Keys which have been deleted
+type PruneResponse struct {
+	Deleted []string `json:"deleted" example:"drafts"`
+}
+
+const (
+	importStatusCreated = "created"
+	importStatusExists  = "exists"
+	importStatusInvalid = "invalid"
+	importStatusLimit   = "limit"
+	importStatusFailed  = "failed"
+	importStatusSkipped = "skipped"
+)
+
+// ImportUsersRequest represents the users to import
+// @Description Users to create (admin only), a plain array of users is accepted as well
+type ImportUsersRequest struct {
+	Users []core.User `json:"users" binding:"required"`
+	// Password of the admin, only required if GENESIS_REQUIRE_REAUTH_FOR_ADMIN_WRITES is enabled
+	CurrentPassword string `json:"currentPassword,omitempty" example:"adminPassword123"`
+}
+
+// UnmarshalJSON accepts a plain array of users as well, which can't carry the password of the admin.
+func (r *ImportUsersRequest) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && trimmed[0] == '[' {
+		return json.Unmarshal(data, &r.Users)
+	}
+
+	type request ImportUsersRequest
+	return json.Unmarshal(data, (*request)(r))
+}
+
+// ImportResult represents the outcome of creating a single user of an import
+// @Description Result of creating a single user, status is one of created, exists, invalid, limit, failed or skipped
+type ImportResult struct {
+	Name   string `json:"name" example:"john"`
+	Status string `json:"status" example:"created"`
+	Error  string `json:"error,omitempty" example:""`
+}
+
+// ImportResponse represents the outcome of a user import
+// @Description Summary of a user import with the result of each user
+type ImportResponse struct {
+	Created int            `json:"created" example:"2"`
+	Failed  int            `json:"failed" example:"0"`
+	Results []ImportResult `json:"results"`
+}
+
+func (r *ImportResponse) countStatus(status string) int {
+	count := 0
+
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
+// BulkUpdateRequest represents a change applied to multiple users at once
+// @Description Filter selecting the users and the fields to update
+type BulkUpdateRequest struct {
+	Filter          core.UserFilter `json:"filter"`
+	Update          BulkUserUpdate  `json:"update"`
+	CurrentPassword string          `json:"currentPassword" example:"password123"`
+}
+
+// BulkUserUpdate represents the fields which can be updated in bulk, passwords are always updated individually
+// @Description Fields to update for all selected users
+type BulkUserUpdate struct {
+	Admin *bool `json:"admin,omitempty" example:"false"`
+}
+
+// BulkUpdateResponse represents the outcome of a bulk update
+// @Description Summary of a bulk update with the result of each selected user
+type BulkUpdateResponse struct {
+	Updated int                     `json:"updated" example:"2"`
+	Skipped int                     `json:"skipped" example:"1"`
+	Results []core.UserUpdateResult `json:"results"`
+}
+
+// ReadinessResponse describes whether the server can serve requests
+// @Description Status of the server, either ok, degraded or unavailable, and how long reading from the database took
+type ReadinessResponse struct {
+	Status    string  `json:"status" example:"ok"`
+	LatencyMs float64 `json:"latencyMs" example:"0.12"`
+}
+
+// MetaResponse describes the limits and features of the server
+// @Description Limits, patterns and optional features of this instance
+type MetaResponse struct {
+	KeyPattern   string `json:"keyPattern" example:"^[a-z0-9_]{0,32}$"`
+	KeyMaxLength int64  `json:"keyMaxLength" example:"255"`
+	UserPattern  string `json:"userPattern" example:"^[a-z]{3,32}$"`
+	// Maximum amount of keys per user
+	MaxKeys int64 `json:"maxKeys" example:"50"`
+	// Maximum size of a single value in bytes
+	MaxDataSize int64 `json:"maxDataSize" example:"300000"`
+	// Lifetime of sessions in seconds
+	JWTExpiration int64    `json:"jwtExpiration" example:"1200"`
+	Features      []string `json:"features" example:"trash,registration"`
+}
+
+// AccountExport represents the full export of a user
+// @Description Everything stored for a user except for the password
+type AccountExport struct {
+	ExportedAt time.Time              `json:"exportedAt" example:"2025-01-01T00:00:00Z"`
+	User       core.ExportedUser      `json:"user"`
+	Settings   map[string]interface{} `json:"settings"`
+	// Values of all keys
+	Data map[string]interface{} `json:"data"`
+	// When keys were last updated or accessed
+	Meta map[string]interface{} `json:"meta"`
+	// Values of trashed keys
+	Trash map[string]interface{} `json:"trash"`
+}
+
+// ShareRequest represents the request to share a key with another user
+// @Description User to share a key with and their permission
+type ShareRequest struct {
+	User       string          `json:"user" binding:"required" example:"john"`
+	Permission core.Permission `json:"permission" binding:"required" example:"read" enums:"read,read-write"`
+}
+
+// SharedDataResponse represents all data of a user including the keys shared with them
+// @Description Own data as object and keys shared by other users, shared keys which aren't stored have no value
+type SharedDataResponse struct {
+	Data   json.RawMessage `json:"data" swaggertype:"object"`
+	Shared []SharedValue   `json:"shared"`
+}
+
+// SharedValue represents a key shared by another user along with its value
+// @Description Key shared by another user
+type SharedValue struct {
+	core.SharedKey
+	Value json.RawMessage `json:"value,omitempty" swaggertype:"object"`
+}
+
+// DataEnvelope represents a single key along with its metadata
+// @Description Value of a key wrapped with its ETag and time of the last modification, if known
+type DataEnvelope struct {
+	Key        string          `json:"key" example:"settings"`
+	Value      json.RawMessage `json:"value" swaggertype:"object"`
+	ETag       string          `json:"etag" example:"\"5d41402abc4b2a76b9719d911017c592\""`
+	ModifiedAt *time.Time      `json:"modifiedAt,omitempty" example:"2025-01-01T00:00:00Z"`
 }
@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// parsePagination reads the offset and limit query parameters, ok is false if either of them is invalid.
+func parsePagination(c *gin.Context) (offset int, limit int, ok bool) {
+	offset, limit = 0, defaultPageLimit
+
+	if raw := c.Query("offset"); raw != "" {
+		if value, err := strconv.Atoi(raw); err != nil || value < 0 {
+			return 0, 0, false
+		} else {
+			offset = value
+		}
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		if value, err := strconv.Atoi(raw); err != nil || value < 1 || value > maxPageLimit {
+			return 0, 0, false
+		} else {
+			limit = value
+		}
+	}
+
+	return offset, limit, true
+}
+
+// paginate returns the part of list described by offset and limit.
+func paginate[T any](list []T, offset, limit int) []T {
+	if offset >= len(list) {
+		return make([]T, 0)
+	}
+
+	return list[offset:min(offset+limit, len(list))]
+}
+
+// setPaginationHeaders announces the total amount of items via X-Total-Count and links to the adjacent pages as
+// defined by RFC 8288, the links keep all other query parameters of the current request.
+func setPaginationHeaders(c *gin.Context, total, offset, limit int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	links := make([]string, 0, 2)
+
+	if offset+limit < total {
+		links = append(links, "<"+pageURL(c, offset+limit, limit)+">; rel=\"next\"")
+	}
+
+	if offset > 0 {
+		links = append(links, "<"+pageURL(c, max(offset-limit, 0), limit)+">; rel=\"prev\"")
+	}
+
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageURL returns the current request URL pointing to the page described by offset and limit.
+func pageURL(c *gin.Context, offset, limit int) string {
+	page := *c.Request.URL
+	query := page.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	page.RawQuery = query.Encode()
+	return page.RequestURI()
+}
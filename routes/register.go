@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type registerBody struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Invite   string `json:"invite"`
+}
+
+// Register godoc
+// @Summary      Register a new account
+// @Description  Create a new non-admin user without being logged in, only available if GENESIS_ALLOW_REGISTRATION is enabled
+// @Description  An invite minted by an admin can be passed to redeem it, which is required if GENESIS_REGISTRATION_REQUIRE_INVITE is enabled
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        user body RegisterRequest true "Name and password of the new user"
+// @Success      201 {object} core.PublicUser "User created successfully"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, validation failed or user name reserved"
+// @Failure      403 {object} core.ErrorResponse "Invite missing, invalid or expired, or the maximum amount of users is reached"
+// @Failure      409 {object} core.ErrorResponse "User already exists"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Router       /register [post]
+func Register(c *gin.Context) {
+	app := appOf(c)
+	var body registerBody
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+		return
+	}
+
+	user := core.User{Name: body.Name, Password: body.Password}
+
+	if message := validateNewUser(app, validator.New(), &user); len(message) != 0 {
+		respondError(c, http.StatusBadRequest, core.CodeValidationFailed, message)
+	} else if app.Config.RegistrationRequireInvite && len(body.Invite) == 0 {
+		respondError(c, http.StatusForbidden, core.CodeInviteRequired, "invite required")
+	} else if err := createRegisteredUser(app, &user, body.Invite); err != nil {
+		if errors.Is(err, core.ErrInviteNotFound) {
+			respondError(c, http.StatusForbidden, core.CodeInvalidInvite, "invalid or expired invite")
+		} else if errors.Is(err, core.ErrUsernameReserved) {
+			respondError(c, http.StatusBadRequest, core.CodeUsernameReserved, "user name is reserved")
+		} else if errors.Is(err, core.ErrUserAlreadyExists) {
+			respondError(c, http.StatusConflict, core.CodeUserExists, "user already exists")
+		} else if errors.Is(err, core.ErrTooManyUsers) {
+			respondError(c, http.StatusForbidden, core.CodeUserLimitExceeded, "maximum amount of users reached")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "internal server error")
+			app.Logger.Error("failed to register user", zap.Error(err))
+		}
+	} else {
+		c.JSON(http.StatusCreated, core.PublicUser{Name: user.Name, Admin: user.Admin})
+	}
+}
+
+// createRegisteredUser creates user, redeeming the invite if there is one, in which case the admin flag is taken from it.
+func createRegisteredUser(app *core.App, user *core.User, invite string) error {
+	if len(invite) == 0 {
+		return app.CreateUser(*user)
+	}
+
+	redeemed, err := app.CreateUserWithInvite(*user, invite)
+	if err != nil {
+		return err
+	}
+
+	user.Admin = redeemed.Admin
+	app.Audit("invite redeemed", zap.String("user", user.Name), zap.String("invite", redeemed.ID), zap.String("admin", redeemed.CreatedBy))
+	return nil
+}
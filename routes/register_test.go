@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	core.ResetDatabase()
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"Rk2Lw9xQ\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	core.Config.AllowRegistration = true
+	t.Cleanup(func() {
+		core.Config.AllowRegistration = false
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"Rk2Lw9xQ\", \"admin\": true}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+			assert.Equal(t, "{\"name\":\"qux\",\"admin\":false}", response.Body.String())
+		},
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"Rk2Lw9xQ\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"qux\", \"password\": \"short\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"Invalid Name!\", \"password\": \"Rk2Lw9xQ\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	loginAs(t, "qux", "Rk2Lw9xQ")
+
+	core.Config.AppMaxUsers = 4
+	t.Cleanup(func() {
+		core.Config.AppMaxUsers = 0
+	})
+
+	tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+		Body: "{\"name\": \"quux\", \"password\": \"Rk2Lw9xQ\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+}
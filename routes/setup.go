@@ -6,6 +6,8 @@ import (
 	"github.com/simonwep/genesis/middleware"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"net/http"
+	"path"
 )
 
 // @title           Genesis API
@@ -28,44 +30,250 @@ import (
 // @name gt
 // @description JWT token stored in HTTP-only cookie
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT token obtained via POST /login?mode=token, sent as "Bearer <token>"
+
+// appKey is the context key of the app handling a request
+const appKey = "app"
+
+// SetupRoutes creates the router for the Default app.
 func SetupRoutes() *gin.Engine {
+	return SetupAppRoutes(core.Default)
+}
+
+// SetupAppRoutes creates the router for app, handlers access it via appOf.
+func SetupAppRoutes(app *core.App) *gin.Engine {
 
 	// Set mode
-	gin.SetMode(core.Config.AppGinMode)
+	gin.SetMode(app.Config.AppGinMode)
 
 	// Create router
 	root := gin.New()
 
-	// Middleware
-	root.Use(gin.Recovery())
+	// Cleartext HTTP/2 for reverse proxies speaking it, HTTP/2 over TLS is negotiated by the server itself
+	root.UseH2C = app.Config.H2C
+
+	// Answer unsupported methods on existing paths with 405 and an Allow header instead of 404
+	root.HandleMethodNotAllowed = true
+	root.NoMethod(func(c *gin.Context) {
+		respondError(c, http.StatusMethodNotAllowed, core.CodeMethodNotAllowed, "method not allowed")
+	})
+
+	// Middlewares every request passes, optional ones are toggled by the config
+	var metrics *middleware.Metrics
+	if app.Config.MetricsEnabled {
+		metrics = middleware.NewMetrics(app.Config.MetricsWindow)
+	}
+
+	for _, m := range globalMiddlewares(app, metrics) {
+		root.Use(m.handler)
+	}
+
+	// Process json bodies, canonicalization is opt-in as it changes the stored bytes
+	jsonBody := middleware.MinifyJson(app.Config.AppMinifyJsonNumbers, jsonLimits(app))
+	if app.Config.AppCanonicalizeJson {
+		jsonBody = middleware.CanonicalizeJson(jsonLimits(app))
+	}
 
 	// Wrap routes under common path
-	router := root.Group(core.Config.BaseUrl)
+	router := root.Group(app.Config.BaseUrl)
 
 	// Auth and account endpoints
 	router.POST("/login", Login)
+	router.GET("/account", Account)
 	router.POST("/account/update", UpdateAccount)
+	router.POST("/account/verify-password", VerifyPassword)
+	router.GET("/account/settings", Settings)
+	router.PUT("/account/settings", middleware.LimitBodySize(app.Config.AppDataMaxSize), jsonBody, UpdateSettings)
+	router.POST("/account/impersonate/stop", StopImpersonation)
+	router.GET("/account/export-full", ExportAccount)
+	router.POST("/account/forget", ForgetAccount)
 	router.POST("/logout", Logout)
 
+	// Self-registration (optionally gated by invites) is opt-in, by default only admins can create users
+	if app.Config.AllowRegistration {
+		router.POST("/register", Register)
+		router.POST("/invites", CreateInvite)
+		router.GET("/invites", Invites)
+		router.DELETE("/invites/:id", DeleteInvite)
+	}
+
 	// User endpoints
 	router.GET("/user", GetUser)
 	router.POST("/user", CreateUser)
+	router.POST("/user/import", ImportUsers)
+	router.POST("/user/bulk-update", BulkUpdateUsers)
 	router.POST("/user/:name", UpdateUser)
 	router.DELETE("/user/:name", DeleteUser)
+	router.POST("/user/:name/impersonate", Impersonate)
+	router.GET("/user/:name/export", ExportUser)
+	router.POST("/user/:name/forget", ForgetUser)
+
+	// Admin endpoints
+	router.GET("/admin/usage", StorageUsage)
+	router.GET("/admin/invalidated-tokens", InvalidatedTokens)
+	router.POST("/admin/compact", CompactDatabase)
+	router.POST("/admin/reindex", Reindex)
+
+	// Adjusting the clock is only meant for integration tests of anything expiring
+	if app.Config.TestMode {
+		router.POST("/test/clock", AdvanceClock)
+	}
 
 	// Data endpoints
-	router.POST("/data/:key", middleware.LimitBodySize(core.Config.AppDataMaxSize), middleware.MinifyJson(), SetData)
+	router.POST("/data/:key", middleware.LimitBodySize(app.Config.AppDataMaxSize), jsonBody, SetData)
+	router.PUT("/data/:key", middleware.LimitBodySize(app.Config.AppDataMaxSize), jsonBody, SetData)
+	router.POST("/data", middleware.LimitBodySize(app.Config.AppDataMaxSize*(app.Config.AppKeysPerUser+1)), SetDataBatch)
+	router.PATCH("/data/:key", middleware.LimitBodySize(app.Config.AppDataMaxSize), middleware.ValidateEncoding(), PatchData)
 	router.DELETE("/data/:key", DeleteData)
+	router.DELETE("/data", PruneData)
+	router.GET("/data/count", DataCount)
+	router.GET("/data/stats", DataStats)
+	router.GET("/data/keys", DataKeys)
+	router.GET("/data/query", QueryData)
+	router.POST("/data/exists", middleware.LimitBodySize(app.Config.AppDataMaxSize), DataExists)
+	router.POST("/data/poll", middleware.LimitBodySize(app.Config.AppDataMaxSize), PollData)
+	router.POST("/data/increment-batch", middleware.LimitBodySize(app.Config.AppDataMaxSize), IncrementDataBatch)
+	router.GET("/data/validate-key", ValidateKey)
 	router.GET("/data/:key", DataByKey)
+	router.GET("/data/:key/meta", DataMeta)
+	router.POST("/data/:key/labels", middleware.LimitBodySize(app.Config.AppDataMaxSize), SetDataLabels)
+	router.POST("/data/:key/share", ShareData)
+	router.GET("/data/:key/share", Grants)
+	router.DELETE("/data/:key/share/:name", RevokeShare)
 	router.GET("/data", Data)
 
-	// Heal check endpoints
+	// Team endpoints, data of a team is subject to the same limits as the data of a user
+	router.POST("/teams", CreateTeam)
+	router.GET("/teams", Teams)
+	router.DELETE("/teams/:team", DeleteTeam)
+	router.PUT("/teams/:team/members/:name", AddTeamMember)
+	router.DELETE("/teams/:team/members/:name", RemoveTeamMember)
+	router.GET("/teams/:team/data", TeamData)
+	router.GET("/teams/:team/data/:key", TeamDataByKey)
+	router.POST("/teams/:team/data/:key", middleware.LimitBodySize(app.Config.AppDataMaxSize), jsonBody, SetTeamData)
+	router.DELETE("/teams/:team/data/:key", DeleteTeamData)
+
+	// Trash endpoints
+	if app.Config.TrashEnabled {
+		router.GET("/data/trash", Trash)
+		router.POST("/data/trash/:key/restore", RestoreTrash)
+	}
+
+	// Heal check and server description endpoints
 	router.GET("/health", Health)
+	router.GET("/health/ready", Ready)
+	router.GET("/meta", ServerMeta)
+
+	// Prometheus metrics
+	if metrics != nil {
+		router.GET("/metrics", Metrics(metrics))
+	}
 
-	// Swagger documentation
-	if core.Config.SwaggerEnabled {
-		router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Swagger documentation, only for logged-in users outside of debug mode
+	if swaggerEnabled(app.Config) {
+		if app.Config.AppGinMode == "" || app.Config.AppGinMode == gin.DebugMode {
+			router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+		} else {
+			router.GET("/swagger/*any", requireUser, ginSwagger.WrapHandler(swaggerFiles.Handler))
+		}
+	}
+
+	// Frontend bundle, served for paths not taken by any of the routes above
+	if len(app.Config.StaticDir) != 0 {
+		root.NoRoute(StaticFiles(app.Config.StaticDir, app.Config.StaticPath, apiPrefixes(root, app.Config.BaseUrl)))
 	}
 
 	return root
 }
+
+// namedMiddleware is a middleware applied to all requests, the name identifies it in the chain.
+type namedMiddleware struct {
+	name    string
+	handler gin.HandlerFunc
+}
+
+// globalMiddlewares returns the middlewares enabled for app in the order requests pass them, which is fixed regardless
+// of which ones are enabled. Recovery and the app come first, so the middlewares after them resolve users with the
+// right app, get a request id to log and can't crash the server with a panic.
+// Metrics are only included if metrics is given, as the same instance serves the metrics endpoint.
+func globalMiddlewares(app *core.App, metrics *middleware.Metrics) []namedMiddleware {
+	chain := []namedMiddleware{
+		{"recovery", middleware.Recover(app.Logger, sessionUser)},
+		{"app", func(c *gin.Context) {
+			c.Set(appKey, app)
+		}},
+	}
+
+	if metrics != nil {
+		chain = append(chain, namedMiddleware{"metrics", metrics.Handler()})
+	}
+
+	if app.Config.SlowRequestThreshold > 0 {
+		chain = append(chain, namedMiddleware{"slow-requests", middleware.LogSlowRequests(app.Config.SlowRequestThreshold, app.Logger, sessionUser)})
+	}
+
+	// Bodies are only logged for targeted paths or users
+	if app.Config.DebugLogBodies {
+		users := make([]string, 0, len(app.Config.DebugLogBodiesUsers))
+		for _, name := range app.Config.DebugLogBodiesUsers {
+			users = append(users, app.NormalizeUsername(name))
+		}
+
+		chain = append(chain, namedMiddleware{"debug-bodies", middleware.LogBodies(app.Config.DebugLogBodiesPaths, users, app.Config.DebugLogBodiesMaxSize, app.Logger, sessionUser)})
+	}
+
+	// Bound the requests a single user can have in flight, e.g. many parallel heavy reads
+	if app.Config.MaxConcurrentPerUser > 0 {
+		chain = append(chain, namedMiddleware{"concurrency-limit", middleware.LimitConcurrency(app.Config.MaxConcurrentPerUser, sessionUser)})
+	}
+
+	// Only login is allowed to modify anything in read-only mode as it merely issues a token, the other routes only
+	// take their parameters as body
+	if app.Config.ReadOnly {
+		allowed := make([]string, 0)
+		for _, route := range []string{"login", "account/verify-password", "data/exists", "data/poll"} {
+			allowed = append(allowed, path.Join("/", app.Config.BaseUrl, route))
+		}
+
+		chain = append(chain, namedMiddleware{"read-only", middleware.RejectWrites(allowed...)})
+	}
+
+	return chain
+}
+
+// swaggerEnabled reports whether the documentation is served, which it isn't in release mode unless
+// GENESIS_SWAGGER_ENABLED is set explicitly, so it can't be exposed by accident.
+func swaggerEnabled(config *core.AppConfig) bool {
+	return config.SwaggerEnabled && (config.AppGinMode != gin.ReleaseMode || config.SwaggerForceEnabled)
+}
+
+// requireUser aborts requests without a valid session.
+func requireUser(c *gin.Context) {
+	if authenticateUser(c) == nil {
+		respondUnauthorized(c)
+	}
+}
+
+// appOf returns the app handling the request, contexts created outside a router fall back to the Default app.
+func appOf(c *gin.Context) *core.App {
+	if app, ok := c.Get(appKey); ok {
+		return app.(*core.App)
+	}
+
+	return core.Default
+}
+
+// respondError sends a core.ErrorResponse, internal errors are logged along with where they occurred and include the
+// request id so they can be found in the logs.
+func respondError(c *gin.Context, status int, code core.ErrorCode, message string) {
+	response := core.ErrorResponse{Error: message, Code: code}
+	if status == http.StatusInternalServerError {
+		middleware.CaptureStack(c)
+		response.RequestID = middleware.RequestID(c)
+	}
+
+	c.JSON(status, response)
+}
@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	core.LoadConfig("../.env.test")
+	core.OpenDefaultDatabase()
+	os.Exit(m.Run())
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	config := core.Config
+	t.Cleanup(func() {
+		core.Config = config
+	})
+
+	names := func(metrics *middleware.Metrics) []string {
+		list := make([]string, 0)
+		for _, m := range globalMiddlewares(core.Default, metrics) {
+			list = append(list, m.name)
+		}
+
+		return list
+	}
+
+	core.Config.SlowRequestThreshold = 0
+	core.Config.DebugLogBodies = false
+	core.Config.MaxConcurrentPerUser = 0
+	core.Config.ReadOnly = false
+	assert.Equal(t, []string{"recovery", "app"}, names(nil))
+
+	// The order stays the same regardless of which ones are enabled
+	core.Config.ReadOnly = true
+	core.Config.SlowRequestThreshold = time.Second
+	assert.Equal(t, []string{"recovery", "app", "slow-requests", "read-only"}, names(nil))
+
+	core.Config.DebugLogBodies = true
+	core.Config.MaxConcurrentPerUser = 4
+	assert.Equal(t, []string{
+		"recovery", "app", "metrics", "slow-requests", "debug-bodies", "concurrency-limit", "read-only",
+	}, names(middleware.NewMetrics(time.Minute)))
+}
+
+func TestSwaggerModes(t *testing.T) {
+	token := loginUser(t)
+	config := core.Config
+	t.Cleanup(func() {
+		core.Config = config
+		gin.SetMode(config.AppGinMode)
+	})
+
+	for _, test := range []struct {
+		mode          string
+		enabled       bool
+		forceEnabled  bool
+		anonymous     int
+		authenticated int
+	}{
+		{gin.DebugMode, true, false, http.StatusOK, http.StatusOK},
+		{"", true, false, http.StatusOK, http.StatusOK},
+		{gin.TestMode, true, false, http.StatusUnauthorized, http.StatusOK},
+		{gin.ReleaseMode, true, false, http.StatusNotFound, http.StatusNotFound},
+		{gin.ReleaseMode, true, true, http.StatusUnauthorized, http.StatusOK},
+		{gin.DebugMode, false, false, http.StatusNotFound, http.StatusNotFound},
+		{gin.ReleaseMode, false, false, http.StatusNotFound, http.StatusNotFound},
+	} {
+		core.Config.AppGinMode = test.mode
+		core.Config.SwaggerEnabled = test.enabled
+		core.Config.SwaggerForceEnabled = test.forceEnabled
+
+		tryUnauthorizedGet("/swagger/index.html", UnauthorizedConfig{
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, test.anonymous, response.Code, "mode %q, enabled %v, forced %v", test.mode, test.enabled, test.forceEnabled)
+			},
+		})
+
+		tryAuthorizedGet("/swagger/index.html", AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, test.authenticated, response.Code, "mode %q, enabled %v, forced %v", test.mode, test.enabled, test.forceEnabled)
+			},
+		})
+
+		tryAuthorizedGet("/meta", AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, test.authenticated == http.StatusOK, strings.Contains(response.Body.String(), "\"swagger\""))
+			},
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	observed, logs := observer.New(zap.ErrorLevel)
+	logger := core.Default.Logger
+
+	core.Default.Logger = zap.New(observed)
+	t.Cleanup(func() {
+		core.Default.Logger = logger
+	})
+
+	router := SetupRoutes()
+	router.GET("/panic", func(c *gin.Context) {
+		panic("secret details")
+	})
+	router.GET("/failure", func(c *gin.Context) {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to do something")
+	})
+
+	for url, message := range map[string]string{
+		"/panic":   "recovered from panic",
+		"/failure": "internal server error",
+	} {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodGet, url, nil)
+		router.ServeHTTP(response, request)
+
+		var failure core.ErrorResponse
+		id := response.Header().Get(middleware.RequestIDHeader)
+		assert.Equal(t, http.StatusInternalServerError, response.Code, url)
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &failure))
+		assert.NotContains(t, response.Body.String(), "secret", url)
+		assert.Equal(t, core.CodeInternal, failure.Code, url)
+		assert.NotEmpty(t, id, url)
+		assert.Equal(t, id, failure.RequestID, url)
+
+		// The stack points to where it failed, not to the middleware
+		entries := logs.FilterMessage(message).All()
+		assert.Len(t, entries, 1, url)
+		assert.Equal(t, id, entries[0].ContextMap()["requestId"], url)
+		assert.Contains(t, entries[0].ContextMap()["stack"], "routes.TestRecovery.func", url)
+	}
+
+	// Ids set by proxies are kept if they're safe to log
+	for id, kept := range map[string]bool{"abc-123.x": true, "not valid!": false, strings.Repeat("a", 65): false} {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest(http.MethodGet, "/health", nil)
+		request.Header.Set(middleware.RequestIDHeader, id)
+		router.ServeHTTP(response, request)
+
+		assert.Equal(t, kept, response.Header().Get(middleware.RequestIDHeader) == id, id)
+		assert.NotEmpty(t, response.Header().Get(middleware.RequestIDHeader), id)
+	}
+}
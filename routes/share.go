@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// ShareData godoc
+// @Summary      Share a key
+// @Description  Grant another user read or read-write access to a key of the authenticated user, replacing a previous grant.
+// @Description  The key doesn't have to be stored yet, grants are kept until revoked or either user is deleted.
+// @Tags         data
+// @Accept       json
+// @Param        key path string true "Data key"
+// @Param        share body ShareRequest true "User and permission"
+// @Success      200 "Key shared successfully"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, key, permission or sharing with oneself"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      404 {object} core.ErrorResponse "User not found"
+// @Failure      500 {object} core.ErrorResponse "Failed to share key"
+// @Security     CookieAuth
+// @Router       /data/{key}/share [post]
+func ShareData(c *gin.Context) {
+	app := appOf(c)
+	key := c.Param("key")
+	user := authenticateUser(c)
+	var body ShareRequest
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if status, failure := checkShareKey(app, key); status != 0 {
+		c.JSON(status, failure)
+	} else if err := c.ShouldBindJSON(&body); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+	} else if body.User = app.NormalizeUsername(body.User); body.User == user.Name {
+		respondError(c, http.StatusBadRequest, core.CodeSelfNotAllowed, "cannot share a key with yourself")
+	} else if err := app.ShareData(user.Name, key, body.User, body.Permission); err != nil {
+		if errors.Is(err, core.ErrInvalidPermission) {
+			respondError(c, http.StatusBadRequest, core.CodeInvalidPermission, err.Error())
+		} else if errors.Is(err, core.ErrUserNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeUserNotFound, "user not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to share key")
+			app.Logger.Error("failed to share key", zap.Error(err))
+		}
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// Grants godoc
+// @Summary      List grants of a key
+// @Description  List the users a key of the authenticated user is shared with
+// @Tags         data
+// @Produce      json
+// @Param        key path string true "Data key"
+// @Success      200 {array} core.Grant "Users and their permission"
+// @Failure      400 {object} core.ErrorResponse "Invalid key"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve grants"
+// @Security     CookieAuth
+// @Router       /data/{key}/share [get]
+func Grants(c *gin.Context) {
+	app := appOf(c)
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if status, failure := checkShareKey(app, key); status != 0 {
+		c.JSON(status, failure)
+	} else if grants, err := app.GetGrants(user.Name, key); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve grants")
+		app.Logger.Error("failed to retrieve grants", zap.Error(err))
+	} else {
+		c.JSON(http.StatusOK, grants)
+	}
+}
+
+// RevokeShare godoc
+// @Summary      Revoke access to a key
+// @Description  Revoke the access of a user to a key of the authenticated user (always returns 200, even if the key wasn't shared with them)
+// @Tags         data
+// @Param        key path string true "Data key"
+// @Param        name path string true "Username"
+// @Success      200 "Access revoked successfully"
+// @Failure      400 {object} core.ErrorResponse "Invalid key"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to revoke access"
+// @Security     CookieAuth
+// @Router       /data/{key}/share/{name} [delete]
+func RevokeShare(c *gin.Context) {
+	app := appOf(c)
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if status, failure := checkShareKey(app, key); status != 0 {
+		c.JSON(status, failure)
+	} else if err := app.RevokeShare(user.Name, key, usernameParam(c)); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to revoke access")
+		app.Logger.Error("failed to revoke access", zap.Error(err))
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// dataOwner returns whose key a data request refers to, which is the user unless the owner query parameter names another user.
+// Keys of other users require a grant, write access is needed for anything but reading. Returns the http status and error
+// error if access isn't granted, without revealing if the key exists.
+func dataOwner(c *gin.Context, user *core.User, key string, write bool) (string, int, core.ErrorResponse) {
+	app := appOf(c)
+	owner := app.NormalizeUsername(c.Query("owner"))
+
+	if len(owner) == 0 || owner == user.Name {
+		return user.Name, 0, core.ErrorResponse{}
+	} else if permission, err := app.GetPermission(owner, key, user.Name); err != nil {
+		app.Logger.Error("failed to check permission", zap.Error(err))
+		return "", http.StatusInternalServerError, core.ErrorResponse{Error: "failed to check permission", Code: core.CodeInternal}
+	} else if !permission.CanRead() || (write && !permission.CanWrite()) {
+		return "", http.StatusForbidden, core.ErrorResponse{Error: "key not shared with you", Code: core.CodeKeyNotShared}
+	}
+
+	return owner, 0, core.ErrorResponse{}
+}
+
+// withSharedData wraps data of name in a SharedDataResponse listing the keys other users shared with them.
+func withSharedData(app *core.App, name string, data []byte) ([]byte, error) {
+	shared, err := app.GetSharedWithUser(name)
+	if err != nil {
+		return nil, err
+	}
+
+	response := SharedDataResponse{Data: data, Shared: make([]SharedValue, 0, len(shared))}
+	for _, key := range shared {
+		value, err := app.GetDataFromUser(key.Owner, key.Key)
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, err
+		}
+
+		response.Shared = append(response.Shared, SharedValue{SharedKey: key, Value: value})
+	}
+
+	return marshalUnescaped(response)
+}
+
+// marshalUnescaped encodes v as JSON without escaping HTML characters, so stored values are passed through as they are.
+func marshalUnescaped(v any) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// checkShareKey validates key like checkDataKey, but without counting keys as grants don't store anything.
+func checkShareKey(app *core.App, key string) (int, core.ErrorResponse) {
+	if isKeyTooLong(app, key) {
+		return http.StatusBadRequest, core.ErrorResponse{Error: keyTooLongMessage(app), Code: core.CodeKeyTooLong}
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		return http.StatusBadRequest, core.ErrorResponse{Error: "key must match " + app.Config.AppKeyPattern.String(), Code: core.CodeInvalidKeyPattern}
+	}
+
+	return 0, core.ErrorResponse{}
+}
@@ -0,0 +1,237 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShareData(t *testing.T) {
+	token := loginUser(t)
+	otherToken := loginAs(t, "baz", "8d7f6g5h")
+
+	tryAuthorizedPost("/data/shared", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"a\":\"<b>\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Keys aren't accessible without a grant
+	tryAuthorizedGet("/data/shared?owner=foo", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	for _, body := range []string{"{\"user\":\"baz\",\"permission\":\"write\"}", "{\"user\":\"foo\",\"permission\":\"read\"}", "{}"} {
+		tryAuthorizedPost("/data/shared/share", AuthorizedBodyConfig{
+			Token: token,
+			Body:  body,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/data/shared/share", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"user\":\"unknown\",\"permission\":\"read\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/shared/share", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"user\":\"baz\",\"permission\":\"read\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/shared/share", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "[{\"user\":\"baz\",\"permission\":\"read\"}]", response.Body.String())
+		},
+	})
+
+	// Read access only allows reading
+	tryAuthorizedGet("/data/shared?owner=foo", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"a\":\"<b>\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPost("/data/shared?owner=foo", AuthorizedBodyConfig{
+		Token: otherToken,
+		Body:  "{}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/shared?owner=foo", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	// Shared keys are only listed if asked for
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data?shared=true", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body SharedDataResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, "{}", string(body.Data))
+			assert.Len(t, body.Shared, 1)
+			assert.Equal(t, core.SharedKey{Owner: "foo", Key: "shared", Permission: core.PermissionRead}, body.Shared[0].SharedKey)
+			assert.Equal(t, "{\"a\":\"<b>\"}", string(body.Shared[0].Value))
+		},
+	})
+
+	// Read-write access allows storing and deleting the key of the owner
+	tryAuthorizedPost("/data/shared/share", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"user\":\"baz\",\"permission\":\"read-write\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/shared?owner=foo", AuthorizedBodyConfig{
+		Token: otherToken,
+		Body:  "{\"b\": 1}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/shared", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"b\":1}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/shared", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	// Other keys of the owner stay inaccessible
+	tryAuthorizedPost("/data/other?owner=foo", AuthorizedBodyConfig{
+		Token: otherToken,
+		Body:  "{}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/shared?owner=foo", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/shared", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	// Revoking removes access
+	tryAuthorizedDelete("/data/shared/share/baz", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/shared?owner=foo", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+}
+
+func TestShareDataOfDeletedUser(t *testing.T) {
+	loginUser(t)
+
+	assert.NoError(t, core.ShareData("foo", "shared", "baz", core.PermissionRead))
+	assert.NoError(t, core.ShareData("baz", "other", "foo", core.PermissionReadWrite))
+	assert.NoError(t, core.DeleteUser("baz"))
+
+	grants, err := core.GetGrants("foo", "shared")
+	assert.NoError(t, err)
+	assert.Empty(t, grants)
+
+	shared, err := core.GetSharedWithUser("foo")
+	assert.NoError(t, err)
+	assert.Empty(t, shared)
+}
+
+func TestShareDataKeyspaceIsolation(t *testing.T) {
+	loginUser(t)
+
+	assert.NoError(t, core.CreateUser(core.User{Name: "foo/bar", Password: "foobar1234"}))
+	assert.NoError(t, core.ShareData("foo/bar", "key", "baz", core.PermissionRead))
+	assert.NoError(t, core.ShareData("foo", "bar/key", "baz", core.PermissionReadWrite))
+	assert.NoError(t, core.ShareData("foo", "a/b", "foo/bar", core.PermissionRead))
+
+	// Owners and keys are told apart although their names and keys overlap
+	shared, err := core.GetSharedWithUser("baz")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.SharedKey{
+		{Owner: "foo", Key: "bar/key", Permission: core.PermissionReadWrite},
+		{Owner: "foo/bar", Key: "key", Permission: core.PermissionRead},
+	}, shared)
+
+	permission, err := core.GetPermission("foo/bar", "key", "baz")
+	assert.NoError(t, err)
+	assert.Equal(t, core.PermissionRead, permission)
+
+	grants, err := core.GetGrants("foo", "a/b")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.Grant{{User: "foo/bar", Permission: core.PermissionRead}}, grants)
+
+	grants, err = core.GetGrants("foo", "a")
+	assert.NoError(t, err)
+	assert.Empty(t, grants)
+
+	// Only the grants of the deleted user are removed
+	assert.NoError(t, core.DeleteUser("foo/bar"))
+
+	shared, err = core.GetSharedWithUser("baz")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.SharedKey{{Owner: "foo", Key: "bar/key", Permission: core.PermissionReadWrite}}, shared)
+
+	grants, err = core.GetGrants("foo", "a/b")
+	assert.NoError(t, err)
+	assert.Empty(t, grants)
+}
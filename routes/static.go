@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticIndex is served for paths which don't match a file, so routing is left to the frontend
+const staticIndex = "index.html"
+
+// StaticFiles serves files from dir for GET and HEAD requests below mount which didn't match any route.
+// Paths without a file extension which don't exist fall back to the index, paths starting with one of apiPrefixes are
+// never handled, so unknown API endpoints are still answered with 404 instead of the frontend.
+func StaticFiles(dir string, mount string, apiPrefixes []string) gin.HandlerFunc {
+	files := http.Dir(dir)
+	mount = strings.TrimSuffix(path.Join("/", mount), "/") + "/"
+
+	return func(c *gin.Context) {
+		requested := c.Request.URL.Path
+
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		} else if requested+"/" != mount && !strings.HasPrefix(requested, mount) {
+			return
+		}
+
+		for _, prefix := range apiPrefixes {
+			if requested == prefix || strings.HasPrefix(requested, prefix+"/") {
+				return
+			}
+		}
+
+		name := path.Clean("/" + strings.TrimPrefix(requested+"/", mount))
+		if serveStaticFile(c, files, name) {
+			return
+		} else if path.Ext(name) == "" {
+			serveStaticFile(c, files, "/"+staticIndex)
+		}
+	}
+}
+
+// serveStaticFile serves the regular file name of files, returns false if there is none.
+func serveStaticFile(c *gin.Context, files http.FileSystem, name string) bool {
+	file, err := files.Open(name)
+	if err != nil {
+		return false
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+	return true
+}
+
+// apiPrefixes returns the paths static files are never served for, which is the base URL of the API if there is one
+// and the first path segment of each route of router otherwise.
+func apiPrefixes(router *gin.Engine, baseUrl string) []string {
+	base := strings.TrimSuffix(path.Join("/", baseUrl), "/")
+	if len(base) != 0 {
+		return []string{base}
+	}
+
+	prefixes := make([]string, 0)
+
+	for _, route := range router.Routes() {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route.Path, "/"), "/")
+		if prefix := "/" + segment; len(segment) != 0 && !slices.Contains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes
+}
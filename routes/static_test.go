@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0o644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "assets"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "assets", "app.js"), []byte("console.log(1)"), 0o644))
+
+	core.Config.StaticDir = dir
+	t.Cleanup(func() {
+		core.Config.StaticDir = ""
+		core.Config.StaticPath = ""
+	})
+
+	for url, expected := range map[string]string{
+		"/":                 "<html></html>",
+		"/assets/app.js":    "console.log(1)",
+		"/settings/profile": "<html></html>",
+		"/../.env.test":     "",
+		"/assets/app.css":   "",
+		"/data/a/b":         "",
+	} {
+		tryUnauthorizedGet(url, UnauthorizedConfig{
+			Handler: func(response *httptest.ResponseRecorder) {
+				if len(expected) == 0 {
+					assert.Equal(t, http.StatusNotFound, response.Code, url)
+				} else {
+					assert.Equal(t, http.StatusOK, response.Code, url)
+					assert.Equal(t, expected, response.Body.String(), url)
+				}
+			},
+		})
+	}
+
+	// Swagger requires a session outside of debug mode, the frontend isn't served instead
+	tryUnauthorizedGet("/swagger/unknown", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	// API endpoints are never shadowed
+	tryUnauthorizedGet("/health", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Body.String())
+		},
+	})
+
+	tryUnauthorizedPost("/settings", UnauthorizedBodyConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	core.Config.StaticPath = "/app"
+
+	for url, status := range map[string]int{
+		"/app":               http.StatusOK,
+		"/app/settings":      http.StatusOK,
+		"/app/assets/app.js": http.StatusOK,
+		"/settings":          http.StatusNotFound,
+		"/application":       http.StatusNotFound,
+	} {
+		tryUnauthorizedGet(url, UnauthorizedConfig{
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code, url)
+			},
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package routes
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+)
+
+type createTeamBody struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateTeam godoc
+// @Summary      Create a team
+// @Description  Create a team without any members (admin only), team names follow the same rules as user names
+// @Tags         teams
+// @Accept       json
+// @Produce      json
+// @Param        team body CreateTeamRequest true "Team details"
+// @Success      201 {object} core.Team "Team created successfully"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON or team name"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      409 {object} core.ErrorResponse "Team already exists"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /teams [post]
+func CreateTeam(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	var body createTeamBody
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if err := c.ShouldBindJSON(&body); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+	} else if !app.Config.AppUserPattern.MatchString(body.Name) {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidTeamName, "invalid team name, must match "+app.Config.AppUserPattern.String())
+	} else if team, err := app.CreateTeam(body.Name, admin.Name); err != nil {
+		if errors.Is(err, core.ErrTeamAlreadyExists) {
+			respondError(c, http.StatusConflict, core.CodeTeamExists, "team already exists")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to create team")
+			app.Logger.Error("failed to create team", zap.Error(err))
+		}
+	} else {
+		app.Audit("team created", zap.String("admin", admin.Name), zap.String("team", team.Name))
+		c.JSON(http.StatusCreated, team)
+	}
+}
+
+// Teams godoc
+// @Summary      List teams
+// @Description  List all teams for admins, other users only see the teams they are a member of
+// @Tags         teams
+// @Produce      json
+// @Success      200 {array} core.Team "List of teams"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve teams"
+// @Security     CookieAuth
+// @Router       /teams [get]
+func Teams(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if teams, err := app.GetTeams(); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve teams")
+		app.Logger.Error("failed to retrieve teams", zap.Error(err))
+	} else {
+		if authenticateAdmin(c) == nil {
+			teams = slices.DeleteFunc(teams, func(team *core.Team) bool {
+				return !slices.Contains(team.Members, user.Name)
+			})
+		}
+
+		c.JSON(http.StatusOK, teams)
+	}
+}
+
+// DeleteTeam godoc
+// @Summary      Delete a team
+// @Description  Delete a team along with all of its data (admin only)
+// @Tags         teams
+// @Param        team path string true "Team name"
+// @Success      200 "Team deleted successfully"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      404 {object} core.ErrorResponse "Team not found"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /teams/{team} [delete]
+func DeleteTeam(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	name := c.Param("team")
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if err := app.DeleteTeam(name); err != nil {
+		if errors.Is(err, core.ErrTeamNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeTeamNotFound, "team not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to delete team")
+			app.Logger.Error("failed to delete team", zap.Error(err))
+		}
+	} else {
+		app.Audit("team deleted", zap.String("admin", admin.Name), zap.String("team", name))
+		c.Status(http.StatusOK)
+	}
+}
+
+// AddTeamMember godoc
+// @Summary      Add a team member
+// @Description  Add a user to a team (admin only), adding an existing member has no effect
+// @Tags         teams
+// @Produce      json
+// @Param        team path string true "Team name"
+// @Param        name path string true "Username"
+// @Success      200 {object} core.Team "Updated team"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      404 {object} core.ErrorResponse "Team or user not found"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /teams/{team}/members/{name} [put]
+func AddTeamMember(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	name := c.Param("team")
+	member := usernameParam(c)
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if team, err := app.AddTeamMember(name, member); err != nil {
+		if errors.Is(err, core.ErrTeamNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeTeamNotFound, "team not found")
+		} else if errors.Is(err, core.ErrUserNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeUserNotFound, "user not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to add team member")
+			app.Logger.Error("failed to add team member", zap.Error(err))
+		}
+	} else {
+		app.Audit("team member added", zap.String("admin", admin.Name), zap.String("team", name), zap.String("user", member))
+		c.JSON(http.StatusOK, team)
+	}
+}
+
+// RemoveTeamMember godoc
+// @Summary      Remove a team member
+// @Description  Remove a user from a team (admin only), removing a user who isn't a member has no effect
+// @Tags         teams
+// @Produce      json
+// @Param        team path string true "Team name"
+// @Param        name path string true "Username"
+// @Success      200 {object} core.Team "Updated team"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      404 {object} core.ErrorResponse "Team not found"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /teams/{team}/members/{name} [delete]
+func RemoveTeamMember(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	name := c.Param("team")
+	member := usernameParam(c)
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if team, err := app.RemoveTeamMember(name, member); err != nil {
+		if errors.Is(err, core.ErrTeamNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeTeamNotFound, "team not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to remove team member")
+			app.Logger.Error("failed to remove team member", zap.Error(err))
+		}
+	} else {
+		app.Audit("team member removed", zap.String("admin", admin.Name), zap.String("team", name), zap.String("user", member))
+		c.JSON(http.StatusOK, team)
+	}
+}
+
+// TeamData godoc
+// @Summary      Get all team data
+// @Description  Retrieve all data of a team as a JSON object (members only), supports conditional requests via If-None-Match
+// @Tags         teams
+// @Produce      json
+// @Param        team path string true "Team name"
+// @Param        If-None-Match header string false "ETag of a previous response"
+// @Success      200 {object} map[string]interface{} "Team data as JSON object"
+// @Success      304 "Data hasn't changed"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Not a member of the team"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve data"
+// @Security     CookieAuth
+// @Router       /teams/{team}/data [get]
+func TeamData(c *gin.Context) {
+	app := appOf(c)
+	team := c.Param("team")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if status, failure := checkTeamMember(app, team, user); status != 0 {
+		c.JSON(status, failure)
+	} else if data, err := app.GetAllDataFromTeam(team); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve data")
+		app.Logger.Error("failed to retrieve team data", zap.Error(err))
+	} else {
+		respondWithData(c, data, nil)
+	}
+}
+
+// TeamDataByKey godoc
+// @Summary      Get team data by key
+// @Description  Retrieve the data a team stored under a specific key (members only), supports conditional requests via If-None-Match
+// @Tags         teams
+// @Produce      json
+// @Param        team path string true "Team name"
+// @Param        key path string true "Data key"
+// @Param        If-None-Match header string false "ETag of a previous response"
+// @Success      200 {object} map[string]interface{} "Data for the specified key"
+// @Success      304 "Data hasn't changed"
+// @Failure      204 "No content found for key"
+// @Failure      400 {object} core.ErrorResponse "Key too long"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Not a member of the team"
+// @Failure      404 {object} core.ErrorResponse "Invalid key pattern"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve data"
+// @Security     CookieAuth
+// @Router       /teams/{team}/data/{key} [get]
+func TeamDataByKey(c *gin.Context) {
+	app := appOf(c)
+	team := c.Param("team")
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if status, failure := checkTeamMember(app, team, user); status != 0 {
+		c.JSON(status, failure)
+	} else if isKeyTooLong(app, key) {
+		respondError(c, http.StatusBadRequest, core.CodeKeyTooLong, keyTooLongMessage(app))
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		respondError(c, http.StatusNotFound, core.CodeInvalidKeyPattern, "key must match "+app.Config.AppKeyPattern.String())
+	} else if data, err := app.GetDataFromTeam(team, key); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			respondError(c, http.StatusNoContent, core.CodeKeyNotFound, "key not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve unit of data")
+			app.Logger.Error("failed to retrieve unit of team data", zap.Error(err))
+		}
+	} else {
+		respondWithData(c, data, nil)
+	}
+}
+
+// SetTeamData godoc
+// @Summary      Set team data by key
+// @Description  Store or update data of a team for a specific key (members only). The same limits as for personal data apply per team.
+// @Tags         teams
+// @Accept       json
+// @Produce      json
+// @Param        team path string true "Team name"
+// @Param        key path string true "Data key"
+// @Param        data body map[string]interface{} true "JSON data to store"
+// @Success      200 "Data stored successfully"
+// @Failure      400 {object} core.ErrorResponse "Invalid key pattern, key too long, invalid body, invalid UTF-8 or JSON exceeding its limits"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Not a member of the team or too many keys (limit exceeded)"
+// @Failure      413 {object} core.ErrorResponse "Request entity too large"
+// @Failure      500 {object} core.ErrorResponse "Failed to set data"
+// @Failure      507 {object} core.ErrorResponse "Maximum amount of keys across all users reached"
+// @Security     CookieAuth
+// @Router       /teams/{team}/data/{key} [post]
+func SetTeamData(c *gin.Context) {
+	app := appOf(c)
+	team := c.Param("team")
+	key := c.Param("key")
+	user := authenticateUser(c)
+	var limitError *middleware.JsonLimitError
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if status, failure := checkTeamMember(app, team, user); status != 0 {
+		c.JSON(status, failure)
+	} else if status, failure := checkTeamDataKey(app, team, key); status != 0 {
+		c.JSON(status, failure)
+	} else if size, err := getContentLength(c); err != nil || size > app.Config.AppDataMaxSize {
+		respondError(c, http.StatusRequestEntityTooLarge, core.CodeTooLarge, tooLargeMessage(app))
+	} else if body, err := c.GetRawData(); errors.As(err, &limitError) {
+		respondJsonLimitExceeded(c, limitError)
+	} else if errors.Is(err, middleware.ErrInvalidEncoding) {
+		respondInvalidEncoding(c)
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidBody, "invalid body")
+	} else if err := app.SetDataForTeam(team, key, body); errors.Is(err, core.ErrStorageFull) {
+		respondStorageFull(c)
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to set data")
+		app.Logger.Error("failed to set team data", zap.Error(err))
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// DeleteTeamData godoc
+// @Summary      Delete team data by key
+// @Description  Remove data of a team for a specific key (members only, always returns 200, even if key doesn't exist)
+// @Description  With If-Match the key is only deleted if its ETag matches, otherwise 412 is returned.
+// @Tags         teams
+// @Produce      json
+// @Param        team path string true "Team name"
+// @Param        key path string true "Data key"
+// @Param        If-Match header string false "Only delete the key if its current ETag matches"
+// @Success      200 "Data deleted successfully"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Not a member of the team"
+// @Failure      412 {object} core.ErrorResponse "Data has been changed or deleted since it was read"
+// @Failure      500 {object} core.ErrorResponse "Failed to delete data"
+// @Security     CookieAuth
+// @Router       /teams/{team}/data/{key} [delete]
+func DeleteTeamData(c *gin.Context) {
+	app := appOf(c)
+	team := c.Param("team")
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if status, failure := checkTeamMember(app, team, user); status != 0 {
+		c.JSON(status, failure)
+	} else if err := app.DeleteDataFromTeamIfMatch(team, key, c.GetHeader("If-Match")); errors.Is(err, core.ErrPreconditionFailed) {
+		respondError(c, http.StatusPreconditionFailed, core.CodePreconditionFailed, "data has been changed or deleted")
+	} else if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to delete data")
+		app.Logger.Error("failed to delete team data", zap.Error(err))
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// checkTeamMember checks if user is a member of team, returning the http status and error if not.
+// Teams which don't exist are treated like teams the user isn't a member of to not reveal which teams exist.
+func checkTeamMember(app *core.App, team string, user *core.User) (int, core.ErrorResponse) {
+	if member, err := app.IsTeamMember(team, user.Name); err != nil {
+		app.Logger.Error("failed to check team membership", zap.Error(err))
+		return http.StatusInternalServerError, core.ErrorResponse{Error: "failed to check team membership", Code: core.CodeInternal}
+	} else if !member {
+		return http.StatusForbidden, core.ErrorResponse{Error: "not a member of this team", Code: core.CodeNotTeamMember}
+	}
+
+	return 0, core.ErrorResponse{}
+}
+
+// checkTeamDataKey validates if a team is allowed to store data under key, see checkDataKey.
+func checkTeamDataKey(app *core.App, team, key string) (int, core.ErrorResponse) {
+	if isKeyTooLong(app, key) {
+		return http.StatusBadRequest, core.ErrorResponse{Error: keyTooLongMessage(app), Code: core.CodeKeyTooLong}
+	} else if !app.Config.AppKeyPattern.MatchString(key) {
+		return http.StatusBadRequest, core.ErrorResponse{Error: "key must match " + app.Config.AppKeyPattern.String(), Code: core.CodeInvalidKeyPattern}
+	} else if count := app.GetDataCountForTeam(team, key); count > app.Config.AppKeysPerUser {
+		return http.StatusForbidden, keyLimitExceeded(app, count-1)
+	}
+
+	return 0, core.ErrorResponse{}
+}
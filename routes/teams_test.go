@@ -0,0 +1,280 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTeams(t *testing.T) {
+	token := loginUser(t)
+	otherToken := loginAs(t, "baz", "8d7f6g5h")
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	tryAuthorizedPost("/teams", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\": \"family\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/teams", AuthorizedBodyConfig{
+		Token: adminToken,
+		Body:  "{\"name\": \"family\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			var team core.Team
+			assert.Equal(t, http.StatusCreated, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &team))
+			assert.Equal(t, "family", team.Name)
+			assert.Equal(t, "bar", team.CreatedBy)
+			assert.Empty(t, team.Members)
+		},
+	})
+
+	tryAuthorizedPost("/teams", AuthorizedBodyConfig{
+		Token: adminToken,
+		Body:  "{\"name\": \"family\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/teams", AuthorizedBodyConfig{
+		Token: adminToken,
+		Body:  "{\"name\": \"a/b\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	// Only members have access to the data of a team
+	tryAuthorizedPost("/teams/family/data/shared", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"list\": [1]}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/teams/family/members/foo", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var team core.Team
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &team))
+			assert.Equal(t, []string{"foo"}, team.Members)
+		},
+	})
+
+	tryAuthorizedPut("/teams/family/members/baz", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/teams/family/members/unknown", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedPut("/teams/unknown/members/foo", AuthorizedBodyConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/teams", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\"name\":\"family\"")
+		},
+	})
+
+	tryAuthorizedPost("/teams/family/data/shared", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"list\": [1]}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Other members see the same data, personal data is unaffected
+	tryAuthorizedGet("/teams/family/data/shared", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"list\":[1]}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/shared", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/teams/family/data", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"shared\":{\"list\":[1]}}", response.Body.String())
+		},
+	})
+
+	// The same limits as for personal data apply
+	for _, key := range []string{"a", "b"} {
+		tryAuthorizedPost("/teams/family/data/"+key, AuthorizedBodyConfig{
+			Token: otherToken,
+			Body:  "{}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/teams/family/data/c", AuthorizedBodyConfig{
+		Token: otherToken,
+		Body:  "{}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/teams/family/data/a", AuthorizedBodyConfig{
+		Token: otherToken,
+		Body:  "{\"updated\": true}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/teams/family/data/a", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Removed members lose access
+	tryAuthorizedDelete("/teams/family/members/baz", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var team core.Team
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &team))
+			assert.Equal(t, []string{"foo"}, team.Members)
+		},
+	})
+
+	tryAuthorizedGet("/teams/family/data", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/teams", AuthorizedConfig{
+		Token: otherToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "[]", response.Body.String())
+		},
+	})
+
+	// Deleting a team removes its data
+	tryAuthorizedDelete("/teams/family", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/teams/family", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	_, err := core.CreateTeam("family", "bar")
+	assert.NoError(t, err)
+	data, err := core.GetAllDataFromTeam("family")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+}
+
+func TestTeamMembershipOfDeletedUser(t *testing.T) {
+	loginUser(t)
+
+	_, err := core.CreateTeam("family", "bar")
+	assert.NoError(t, err)
+	_, err = core.AddTeamMember("family", "baz")
+	assert.NoError(t, err)
+
+	assert.NoError(t, core.DeleteUser("baz"))
+	member, err := core.IsTeamMember("family", "baz")
+	assert.NoError(t, err)
+	assert.False(t, member)
+}
+
+func TestTeamGlobalMaxKeys(t *testing.T) {
+	token := loginUser(t)
+	core.Config.GlobalMaxKeys = 2
+	t.Cleanup(func() {
+		core.Config.GlobalMaxKeys = 0
+	})
+
+	_, err := core.CreateTeam("family", "bar")
+	assert.NoError(t, err)
+	_, err = core.AddTeamMember("family", "foo")
+	assert.NoError(t, err)
+
+	// Keys of users and teams count towards the same limit
+	for path, status := range map[string]int{"/data/a": http.StatusOK, "/teams/family/data/b": http.StatusOK} {
+		tryAuthorizedPost(path, AuthorizedBodyConfig{
+			Body:  "{}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code, path)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/teams/family/data/c", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusInsufficientStorage, response.Code)
+			assert.Contains(t, response.Body.String(), string(core.CodeStorageFull))
+		},
+	})
+
+	tryAuthorizedDelete("/teams/family/data/b", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	count, err := core.CountAllData()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	// Team keys are counted again on start as well
+	assert.NoError(t, core.SetDataForTeam("family", "d", []byte("{}")))
+	assert.NoError(t, core.Migrate(false))
+
+	count, err = core.CountAllData()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
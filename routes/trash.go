@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// Trash godoc
+// @Summary      List trashed keys
+// @Description  List all deleted keys which can still be restored (only available if the trash is enabled)
+// @Tags         data
+// @Produce      json
+// @Success      200 {array} core.TrashEntry "Trashed keys"
+// @Header       200 {integer} X-Total-Count "Total amount of trashed keys"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve trash"
+// @Security     CookieAuth
+// @Router       /data/trash [get]
+func Trash(c *gin.Context) {
+	app := appOf(c)
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if entries, err := app.GetTrashFromUser(user.Name); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve trash")
+		app.Logger.Error("failed to retrieve trash", zap.Error(err))
+	} else {
+		setPaginationHeaders(c, len(entries), 0, len(entries))
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// RestoreTrash godoc
+// @Summary      Restore a trashed key
+// @Description  Move a deleted key back from the trash (only available if the trash is enabled)
+// @Tags         data
+// @Produce      json
+// @Param        key path string true "Data key"
+// @Success      200 "Key restored successfully"
+// @Failure      401 {object} core.ErrorResponse "Unauthorized"
+// @Failure      403 {object} core.ErrorResponse "Too many keys (limit exceeded)"
+// @Failure      404 {object} core.ErrorResponse "Key not found in trash"
+// @Failure      409 {object} core.ErrorResponse "Key has been stored again in the meantime"
+// @Failure      500 {object} core.ErrorResponse "Failed to restore key"
+// @Failure      507 {object} core.ErrorResponse "Maximum amount of keys across all users reached"
+// @Security     CookieAuth
+// @Router       /data/trash/{key}/restore [post]
+func RestoreTrash(c *gin.Context) {
+	app := appOf(c)
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		respondUnauthorized(c)
+	} else if count := app.GetDataCountForUser(user.Name, key); count > app.Config.AppKeysPerUser {
+		c.JSON(http.StatusForbidden, keyLimitExceeded(app, count-1))
+	} else if err := app.RestoreDataFromTrash(user.Name, key); err != nil {
+		if errors.Is(err, core.ErrTrashEntryNotFound) {
+			respondError(c, http.StatusNotFound, core.CodeKeyNotFound, "key not found in trash")
+		} else if errors.Is(err, core.ErrDataAlreadyExists) {
+			respondError(c, http.StatusConflict, core.CodeKeyExists, "key already exists")
+		} else if errors.Is(err, core.ErrStorageFull) {
+			respondStorageFull(c)
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to restore key")
+			app.Logger.Error("failed to restore key", zap.Error(err))
+		}
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/simonwep/genesis/core"
@@ -9,6 +10,20 @@ import (
 	"net/http"
 )
 
+type createUserBody struct {
+	core.User
+	CurrentPassword string `json:"currentPassword"`
+}
+
+type updateUserBody struct {
+	core.PartialUser
+	CurrentPassword string `json:"currentPassword"`
+}
+
+type reauthBody struct {
+	CurrentPassword string `json:"currentPassword"`
+}
+
 // CreateUser godoc
 // @Summary      Create a new user
 // @Description  Create a new user (admin only)
@@ -17,36 +32,229 @@ import (
 // @Produce      json
 // @Param        user body CreateUserRequest true "User details"
 // @Success      201 {object} SuccessResponse "User created successfully"
-// @Failure      400 {object} ErrorResponse "Invalid JSON or validation failed"
-// @Failure      403 {object} ErrorResponse "Forbidden - admin only"
-// @Failure      409 {object} ErrorResponse "User already exists"
-// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, validation failed or user name reserved"
+// @Failure      401 {object} core.ErrorResponse "Current password of the admin incorrect (if re-authentication is required)"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only or maximum amount of users reached"
+// @Failure      409 {object} core.ErrorResponse "User already exists"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
 // @Security     CookieAuth
 // @Router       /user [post]
 func CreateUser(c *gin.Context) {
+	app := appOf(c)
 	validate := validator.New()
-	var body core.User
+	admin := authenticateAdmin(c)
+	var body createUserBody
 
-	if !isAsAdminAuthenticated(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can create users"})
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "only admins can create users")
 	} else if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-	} else if !core.Config.AppUserPattern.MatchString(body.Name) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user name, must match " + core.Config.AppUserPattern.String()})
-	} else if err := validate.Struct(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation of json failed, must contain name, password and admin"})
-	} else if err := core.CreateUser(body); err != nil {
-		if errors.Is(err, core.ErrUserAlreadyExists) {
-			c.JSON(http.StatusConflict, gin.H{"error": "user already exists"})
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+	} else if !hasReauthenticated(app, admin, body.CurrentPassword) {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if message := validateNewUser(app, validate, &body.User); len(message) != 0 {
+		respondError(c, http.StatusBadRequest, core.CodeValidationFailed, message)
+	} else if err := app.CreateUser(body.User); err != nil {
+		if errors.Is(err, core.ErrUsernameReserved) {
+			respondError(c, http.StatusBadRequest, core.CodeUsernameReserved, "user name is reserved")
+		} else if errors.Is(err, core.ErrUserAlreadyExists) {
+			respondError(c, http.StatusConflict, core.CodeUserExists, "user already exists")
+		} else if errors.Is(err, core.ErrTooManyUsers) {
+			respondError(c, http.StatusForbidden, core.CodeUserLimitExceeded, "maximum amount of users reached")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
-			core.Logger.Error("failed to create user", zap.Error(err))
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "internal server error")
+			app.Logger.Error("failed to create user", zap.Error(err))
 		}
 	} else {
 		c.JSON(http.StatusCreated, gin.H{"message": "user created"})
 	}
 }
 
+// ImportUsers godoc
+// @Summary      Import multiple users
+// @Description  Create multiple users at once (admin only). Each user is validated and created individually, failing rows are reported without aborting the import.
+// @Description  With atomic=true either all users are created or none, in which case the failing row is reported and all others are marked as skipped.
+// @Description  If re-authentication is required the password of the admin has to be sent as currentPassword along with the users.
+// @Tags         user
+// @Accept       json
+// @Produce      json
+// @Param        users body ImportUsersRequest true "Users to create"
+// @Param        atomic query bool false "Abort the whole import if a single row fails"
+// @Success      200 {object} ImportResponse "Result per user"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, or an invalid row in an atomic import"
+// @Failure      401 {object} core.ErrorResponse "Current password of the admin incorrect (if re-authentication is required)"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only, or the maximum amount of users is reached in an atomic import"
+// @Failure      409 {object} core.ErrorResponse "User already exists in an atomic import"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
+// @Security     CookieAuth
+// @Router       /user/import [post]
+func ImportUsers(c *gin.Context) {
+	app := appOf(c)
+	validate := validator.New()
+	admin := authenticateAdmin(c)
+	atomic := c.Query("atomic") == "true"
+	var request ImportUsersRequest
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "only admins can import users")
+		return
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json, expected users")
+		return
+	} else if !hasReauthenticated(app, admin, request.CurrentPassword) {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+		return
+	}
+
+	users := request.Users
+	valid, rows := make([]core.User, 0, len(users)), make([]int, 0, len(users))
+	response := ImportResponse{Results: make([]ImportResult, len(users))}
+	for index, user := range users {
+		response.Results[index] = ImportResult{Name: user.Name, Status: importStatusCreated}
+
+		if message := validateNewUser(app, validate, &user); len(message) != 0 {
+			response.Results[index].Status, response.Results[index].Error = importStatusInvalid, message
+		} else {
+			valid, rows = append(valid, user), append(rows, index)
+		}
+	}
+
+	status := http.StatusOK
+	if atomic {
+		if response.countStatus(importStatusInvalid) != 0 {
+			status = http.StatusBadRequest
+		} else if index, err := app.CreateUsers(users); index != -1 {
+			response.Results[index].Status, response.Results[index].Error = importUserResult(app, err)
+
+			switch {
+			case errors.Is(err, core.ErrUsernameReserved):
+				status = http.StatusBadRequest
+			case errors.Is(err, core.ErrUserAlreadyExists):
+				status = http.StatusConflict
+			case errors.Is(err, core.ErrTooManyUsers):
+				status = http.StatusForbidden
+			default:
+				status = http.StatusInternalServerError
+			}
+		} else if err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "internal server error")
+			app.Logger.Error("failed to import users", zap.Error(err))
+			return
+		}
+
+		// Nothing has been created if a single row failed
+		if status != http.StatusOK {
+			for index := range response.Results {
+				if response.Results[index].Status == importStatusCreated {
+					response.Results[index].Status = importStatusSkipped
+				}
+			}
+		}
+	} else {
+		results, err := app.CreateEachUser(valid)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "internal server error")
+			app.Logger.Error("failed to import users", zap.Error(err))
+			return
+		}
+
+		for index, err := range results {
+			response.Results[rows[index]].Status, response.Results[rows[index]].Error = importUserResult(app, err)
+		}
+	}
+
+	response.Created = response.countStatus(importStatusCreated)
+	response.Failed = len(users) - response.Created
+	c.JSON(status, response)
+}
+
+// BulkUpdateUsers godoc
+// @Summary      Update multiple users
+// @Description  Apply the same change to all users matching a filter within a single transaction (admin only).
+// @Description  The authenticated admin is never updated and reported as skipped, as are users which already match the update.
+// @Description  Nothing is updated if no admin would be left.
+// @Tags         user
+// @Accept       json
+// @Produce      json
+// @Param        request body BulkUpdateRequest true "Filter and update"
+// @Success      200 {object} BulkUpdateResponse "Result per user"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, empty filter or no fields to update"
+// @Failure      401 {object} core.ErrorResponse "Current password of the admin incorrect (if re-authentication is required)"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      409 {object} core.ErrorResponse "Cannot remove the last admin"
+// @Failure      500 {object} core.ErrorResponse "Failed to update users"
+// @Security     CookieAuth
+// @Router       /user/bulk-update [post]
+func BulkUpdateUsers(c *gin.Context) {
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	var body BulkUpdateRequest
+
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if err := c.ShouldBindJSON(&body); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+	} else if !hasReauthenticated(app, admin, body.CurrentPassword) {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if len(body.Filter.Names) == 0 && body.Filter.Admin == nil {
+		respondError(c, http.StatusBadRequest, core.CodeValidationFailed, "filter must contain names or admin")
+	} else if body.Update.Admin == nil {
+		respondError(c, http.StatusBadRequest, core.CodeNoFields, "no fields to update")
+	} else if results, err := app.UpdateUsers(body.Filter, core.PartialUser{Admin: body.Update.Admin}, admin.Name); err != nil {
+		if errors.Is(err, core.ErrLastAdmin) {
+			respondError(c, http.StatusConflict, core.CodeLastAdmin, err.Error())
+		} else {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to update users")
+			app.Logger.Error("failed to update users", zap.Error(err))
+		}
+	} else {
+		response := BulkUpdateResponse{Results: results}
+		for _, result := range results {
+			if result.Status == core.UserUpdateStatusUpdated {
+				response.Updated++
+			} else {
+				response.Skipped++
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// importUserResult maps the result of creating a single user to its import status and error message.
+func importUserResult(app *core.App, err error) (string, string) {
+	switch {
+	case err == nil:
+		return importStatusCreated, ""
+	case errors.Is(err, core.ErrUsernameReserved):
+		return importStatusInvalid, "user name is reserved"
+	case errors.Is(err, core.ErrUserAlreadyExists):
+		return importStatusExists, "user already exists"
+	case errors.Is(err, core.ErrTooManyUsers):
+		return importStatusLimit, "maximum amount of users reached"
+	default:
+		app.Logger.Error("failed to create user", zap.Error(err))
+		return importStatusFailed, "internal server error"
+	}
+}
+
+// validateNewUser validates a user to be created and returns an error message if it's invalid.
+func validateNewUser(app *core.App, validate *validator.Validate, user *core.User) string {
+	user.Name = app.NormalizeUsername(user.Name)
+
+	if !app.Config.AppUserPattern.MatchString(user.Name) {
+		return "invalid user name, must match " + app.Config.AppUserPattern.String()
+	} else if err := validate.Struct(user); err != nil {
+		return "validation of json failed, must contain name, password and admin"
+	}
+
+	return ""
+}
+
+// usernameParam returns the normalized name path parameter.
+func usernameParam(c *gin.Context) string {
+	return appOf(c).NormalizeUsername(c.Param("name"))
+}
+
 // UpdateUser godoc
 // @Summary      Update a user
 // @Description  Update user details by name (admin only, cannot update self)
@@ -56,31 +264,48 @@ func CreateUser(c *gin.Context) {
 // @Param        name path string true "Username"
 // @Param        user body UpdateUserRequest true "User update details"
 // @Success      200 "User updated successfully"
-// @Failure      400 {object} ErrorResponse "Invalid JSON or validation failed"
-// @Failure      403 {object} ErrorResponse "Forbidden - admin only or cannot update self"
-// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Failure      400 {object} core.ErrorResponse "Invalid JSON, validation failed or neither admin, password nor disabled given or the password has been used before"
+// @Failure      401 {object} core.ErrorResponse "Current password of the admin incorrect (if re-authentication is required)"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only or cannot update self"
+// @Failure      409 {object} core.ErrorResponse "Cannot remove the last admin"
+// @Failure      500 {object} core.ErrorResponse "Internal server error"
 // @Security     CookieAuth
 // @Router       /user/{name} [post]
 func UpdateUser(c *gin.Context) {
-	user := authenticateUser(c)
+	app := appOf(c)
+	user := authenticateAdmin(c)
 	validate := validator.New()
-	name := c.Param("name")
-	var body core.PartialUser
+	name := usernameParam(c)
+	var body updateUserBody
 
-	if user == nil || !user.Admin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "user not found or you are not an admin"})
+	if user == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "user not found or you are not an admin")
 	} else if name == user.Name {
-		c.JSON(http.StatusForbidden, gin.H{"error": "you cannot update yourself"})
+		respondError(c, http.StatusForbidden, core.CodeSelfNotAllowed, "you cannot update yourself")
 	} else if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json"})
-	} else if err := validate.Struct(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation of json failed, may contain admin or password"})
-	} else if _, err := core.GetUser(name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve user"})
-		core.Logger.Error("failed to retrieve user", zap.Error(err))
-	} else if err := core.UpdateUser(name, body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "update failed"})
+		respondError(c, http.StatusBadRequest, core.CodeInvalidJson, "invalid json")
+	} else if !hasReauthenticated(app, user, body.CurrentPassword) {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if err := validate.Struct(&body.PartialUser); err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeValidationFailed, "validation of json failed, may contain admin, password or disabled")
+	} else if body.Admin == nil && body.Password == nil && body.Disabled == nil {
+		respondError(c, http.StatusBadRequest, core.CodeNoFields, "no fields to update")
+	} else if _, err := app.GetUser(name); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve user")
+		app.Logger.Error("failed to retrieve user", zap.Error(err))
+	} else if status, failure := checkDemotion(app, name, body.PartialUser); status != 0 {
+		c.JSON(status, failure)
+	} else if err := app.UpdateUser(name, body.PartialUser); errors.Is(err, core.ErrPasswordReused) {
+		respondError(c, http.StatusBadRequest, core.CodePasswordReused, "password has been used before")
+	} else if err != nil {
+		respondError(c, http.StatusBadRequest, core.CodeValidationFailed, "update failed")
 	} else {
+		if body.Disabled != nil && *body.Disabled {
+			app.Audit("user disabled", zap.String("admin", user.Name), zap.String("user", name))
+		} else if body.Disabled != nil {
+			app.Audit("user enabled", zap.String("admin", user.Name), zap.String("user", name))
+		}
+
 		c.Status(http.StatusOK)
 	}
 }
@@ -89,22 +314,36 @@ func UpdateUser(c *gin.Context) {
 // @Summary      Delete a user
 // @Description  Delete user by name (admin only)
 // @Tags         user
+// @Accept       json
 // @Produce      json
 // @Param        name path string true "Username"
+// @Param        request body ReauthRequest false "Current password of the admin (if re-authentication is required)"
+// @Param        X-Confirmation-Token header string false "Token of the previous attempt (if confirmation is required)"
 // @Success      200 "User deleted successfully"
-// @Failure      403 {object} ErrorResponse "Forbidden - admin only"
-// @Failure      500 {object} ErrorResponse "Failed to delete user"
+// @Failure      400 {object} core.ErrorResponse "Confirmation token invalid or expired"
+// @Failure      401 {object} core.ErrorResponse "Current password of the admin incorrect (if re-authentication is required)"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      409 {object} core.ErrorResponse "Cannot remove the last admin"
+// @Failure      428 {object} ConfirmationRequiredResponse "Confirmation required, send the token back to delete the user"
+// @Failure      500 {object} core.ErrorResponse "Failed to delete user"
 // @Security     CookieAuth
 // @Router       /user/{name} [delete]
 func DeleteUser(c *gin.Context) {
-	name := c.Param("name")
+	app := appOf(c)
+	admin := authenticateAdmin(c)
+	name := usernameParam(c)
+	var body reauthBody
 
-	if !isAsAdminAuthenticated(c) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-	} else {
-		if err := core.DeleteUser(name); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user"})
-			core.Logger.Error("Failed to delete user", zap.String("name", name), zap.Error(err))
+	if admin == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if app.Config.AdminReauthRequired && (c.ShouldBindJSON(&body) != nil || !hasReauthenticated(app, admin, body.CurrentPassword)) {
+		respondError(c, http.StatusUnauthorized, core.CodePasswordIncorrect, "current password incorrect")
+	} else if status, failure := checkLastAdmin(app, name); status != 0 {
+		c.JSON(status, failure)
+	} else if confirmAction(c, admin, "delete-user:"+name, userImpact(app, "delete", name)) {
+		if err := app.DeleteUser(name); err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to delete user")
+			app.Logger.Error("Failed to delete user", zap.String("name", name), zap.Error(err))
 		} else {
 			c.Status(http.StatusOK)
 		}
@@ -117,24 +356,120 @@ func DeleteUser(c *gin.Context) {
 // @Tags         user
 // @Produce      json
 // @Success      200 {array} core.PublicUser "List of users"
-// @Failure      403 {object} ErrorResponse "Forbidden - admin only"
-// @Failure      500 {object} ErrorResponse "Failed to retrieve users"
+// @Header       200 {integer} X-Total-Count "Total amount of users"
+// @Failure      403 {object} core.ErrorResponse "Forbidden - admin only"
+// @Failure      500 {object} core.ErrorResponse "Failed to retrieve users"
 // @Security     CookieAuth
 // @Router       /user [get]
 func GetUser(c *gin.Context) {
-	user := authenticateUser(c)
+	app := appOf(c)
+	user := authenticateAdmin(c)
 
-	if user == nil || !user.Admin {
-		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-	} else if list, err := core.GetUsers(user.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve users"})
-		core.Logger.Error("failed to retrieve users", zap.Error(err))
+	if user == nil {
+		respondError(c, http.StatusForbidden, core.CodeForbidden, "forbidden")
+	} else if list, err := app.GetUsers(user.Name); err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to retrieve users")
+		app.Logger.Error("failed to retrieve users", zap.Error(err))
 	} else {
+		setPaginationHeaders(c, len(list), 0, len(list))
 		c.JSON(http.StatusOK, list)
 	}
 }
 
+// confirmAction reports whether a destructive action of admin has been confirmed, which is always the case unless
+// GENESIS_REQUIRE_CONFIRMATION_FOR_ADMIN_DELETES is enabled. Otherwise, the token of a previous attempt has to be sent
+// as X-Confirmation-Token header. Without one, a token is issued along with the impact of the action and sent as 428,
+// invalid tokens are rejected.
+func confirmAction(c *gin.Context, admin *core.User, action string, impact func() (string, error)) bool {
+	app := appOf(c)
+	if !app.Config.AdminConfirmRequired {
+		return true
+	}
+
+	token := c.GetHeader("X-Confirmation-Token")
+	if len(token) != 0 {
+		if err := app.ConsumeConfirmation(admin.Name, action, token); errors.Is(err, core.ErrInvalidConfirmation) {
+			respondError(c, http.StatusBadRequest, core.CodeInvalidConfirmation, "confirmation token is invalid or expired")
+			return false
+		} else if err != nil {
+			respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to confirm action")
+			app.Logger.Error("failed to confirm action", zap.String("action", action), zap.Error(err))
+			return false
+		}
+
+		return true
+	}
+
+	description, err := impact()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to describe action")
+		app.Logger.Error("failed to describe action", zap.String("action", action), zap.Error(err))
+		return false
+	}
+
+	confirmation, err := app.CreateConfirmation(admin.Name, action, description)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, core.CodeInternal, "failed to create confirmation")
+		app.Logger.Error("failed to create confirmation", zap.String("action", action), zap.Error(err))
+		return false
+	}
+
+	c.JSON(http.StatusPreconditionRequired, ConfirmationRequiredResponse{
+		ErrorResponse: core.ErrorResponse{Error: "confirmation required", Code: core.CodeConfirmationRequired},
+		Confirmation:  *confirmation,
+	})
+
+	return false
+}
+
+// userImpact describes that verb applies to the user name along with all of their keys.
+func userImpact(app *core.App, verb, name string) func() (string, error) {
+	return func() (string, error) {
+		keys, err := app.GetKeysFromUser(name, "")
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("will %s user %s and %d keys", verb, name, len(keys)), nil
+	}
+}
+
 func isAsAdminAuthenticated(c *gin.Context) bool {
-	user := authenticateUser(c)
-	return user != nil && user.Admin
+	return authenticateAdmin(c) != nil
+}
+
+// hasReauthenticated verifies the password of admin if GENESIS_REQUIRE_REAUTH_FOR_ADMIN_WRITES is enabled.
+func hasReauthenticated(app *core.App, admin *core.User, password string) bool {
+	if !app.Config.AdminReauthRequired {
+		return true
+	}
+
+	user, err := app.AuthenticateUser(admin.Name, password)
+	return err == nil && user != nil
+}
+
+// checkDemotion applies checkLastAdmin if update revokes the admin rights of name or disables them.
+func checkDemotion(app *core.App, name string, update core.PartialUser) (int, core.ErrorResponse) {
+	if (update.Admin == nil || *update.Admin) && (update.Disabled == nil || !*update.Disabled) {
+		return 0, core.ErrorResponse{}
+	}
+
+	return checkLastAdmin(app, name)
+}
+
+// checkLastAdmin prevents removing the admin rights of name if no other admin is left, returning the http status and error if so.
+func checkLastAdmin(app *core.App, name string) (int, core.ErrorResponse) {
+	if user, err := app.GetUser(name); err != nil {
+		app.Logger.Error("failed to retrieve user", zap.Error(err))
+		return http.StatusInternalServerError, core.ErrorResponse{Error: "failed to retrieve user", Code: core.CodeInternal}
+	} else if user == nil || !user.Admin || user.Disabled {
+		return 0, core.ErrorResponse{}
+	} else if count, err := app.CountAdmins(); err != nil {
+		app.Logger.Error("failed to count admins", zap.Error(err))
+		return http.StatusInternalServerError, core.ErrorResponse{Error: "failed to count admins", Code: core.CodeInternal}
+	} else if count <= 1 {
+		return http.StatusConflict, core.ErrorResponse{Error: "cannot remove the last admin", Code: core.CodeLastAdmin}
+	}
+
+	return 0, core.ErrorResponse{}
 }
@@ -1,10 +1,13 @@
 package routes
 
 import (
+	"encoding/json"
+	"github.com/simonwep/genesis/core"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestUnauthorizedAccess(t *testing.T) {
@@ -50,6 +53,7 @@ func TestRetrieveUsers(t *testing.T) {
 			baz := "{\"name\":\"baz\",\"admin\":false}"
 			foo := "{\"name\":\"foo\",\"admin\":false}"
 			assert.Equal(t, "["+baz+","+foo+"]", response.Body.String())
+			assert.Equal(t, "2", response.Header().Get("X-Total-Count"))
 		},
 	})
 }
@@ -114,6 +118,169 @@ func TestCreateUser(t *testing.T) {
 	})
 }
 
+func TestCaseInsensitiveUsernames(t *testing.T) {
+	token := loginAdmin(t)
+
+	core.Config.UsernameCaseInsensitive = true
+	t.Cleanup(func() {
+		core.Config.UsernameCaseInsensitive = false
+	})
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\":\"Test2\",\"password\":\"foobar1235\",\"admin\":false}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\":\"test2\",\"password\":\"foobar1235\",\"admin\":false}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	userToken := loginAs(t, "TEST2", "foobar1235")
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: userToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\"name\":\"test2\"")
+		},
+	})
+}
+
+func TestReservedUsernames(t *testing.T) {
+	token := loginAdmin(t)
+
+	core.Config.ReservedUsernames = []string{"root", "System"}
+	core.Config.AllowRegistration = true
+	t.Cleanup(func() {
+		core.Config.ReservedUsernames = nil
+		core.Config.AllowRegistration = false
+	})
+
+	for _, name := range []string{"root", "ROOT", "system"} {
+		tryAuthorizedPost("/user", AuthorizedBodyConfig{
+			Token: token,
+			Body:  "{\"name\":\"" + name + "\",\"password\":\"foobar1235\",\"admin\":false}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Contains(t, response.Body.String(), string(core.CodeUsernameReserved))
+			},
+		})
+
+		tryUnauthorizedPost("/register", UnauthorizedBodyConfig{
+			Body: "{\"name\": \"" + name + "\", \"password\": \"Rk2Lw9xQ\"}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+				assert.Contains(t, response.Body.String(), string(core.CodeUsernameReserved))
+			},
+		})
+	}
+
+	tryAuthorizedPost("/user/import?atomic=true", AuthorizedBodyConfig{
+		Body:  "[{\"name\": \"carol\", \"password\": \"password3\"}, {\"name\": \"Root\", \"password\": \"password1\"}]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+			assert.Contains(t, response.Body.String(), "{\"name\":\"carol\",\"status\":\"skipped\"}")
+			assert.Contains(t, response.Body.String(), "user name is reserved")
+		},
+	})
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\":\"rooted\",\"password\":\"foobar1235\",\"admin\":false}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+		},
+	})
+}
+
+func TestNormalizeUsernames(t *testing.T) {
+	loginAdmin(t)
+
+	t.Cleanup(func() {
+		core.Config.UsernameCaseInsensitive = false
+	})
+
+	assert.NoError(t, core.CreateUser(core.User{Name: "Alice", Password: "password1"}))
+	assert.NoError(t, core.CreateUser(core.User{Name: "alice", Password: "password2"}))
+	assert.NoError(t, core.SetDataForUser("Alice", "test", []byte("{}")))
+	assert.NoError(t, core.ShareData("foo", "test", "Alice", core.PermissionRead))
+
+	// Colliding names are rejected without renaming anyone
+	core.Config.UsernameCaseInsensitive = true
+	assert.ErrorIs(t, core.NormalizeUsernames(false), core.ErrUsernameCollision)
+
+	core.Config.UsernameCaseInsensitive = false
+	assert.NoError(t, core.DeleteUser("alice"))
+
+	core.Config.UsernameCaseInsensitive = true
+	assert.NoError(t, core.NormalizeUsernames(false))
+
+	user, err := core.GetUser("ALICE")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Name)
+
+	data, err := core.GetDataFromUser("alice", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	grants, err := core.GetGrants("foo", "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []core.Grant{{User: "alice", Permission: core.PermissionRead}}, grants)
+}
+
+func TestUserTemplate(t *testing.T) {
+	token := loginAdmin(t)
+
+	core.Config.UserTemplate = &core.UserTemplate{
+		Settings: json.RawMessage("{\"theme\": \"dark\"}"),
+		Data:     map[string]json.RawMessage{"budget": json.RawMessage("{\"entries\": []}")},
+	}
+	t.Cleanup(func() {
+		core.Config.UserTemplate = nil
+	})
+
+	assert.NoError(t, core.ValidateUserTemplate())
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\":\"test2\",\"password\":\"foobar1235\",\"admin\":false}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+		},
+	})
+
+	userToken := loginAs(t, "test2", "foobar1235")
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: userToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"budget\":{\"entries\":[]}}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/account/settings", AuthorizedConfig{
+		Token: userToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"theme\":\"dark\"}", response.Body.String())
+		},
+	})
+
+	// Templates exceeding the limits are rejected on start
+	core.Config.UserTemplate.Data = map[string]json.RawMessage{"a": json.RawMessage("1"), "b": json.RawMessage("2"), "c": json.RawMessage("3"), "d": json.RawMessage("4")}
+	assert.ErrorIs(t, core.ValidateUserTemplate(), core.ErrInvalidUserTemplate)
+
+	core.Config.UserTemplate.Data = map[string]json.RawMessage{"a/b": json.RawMessage("1")}
+	assert.ErrorIs(t, core.ValidateUserTemplate(), core.ErrInvalidUserTemplate)
+}
+
 func TestUpdateUser(t *testing.T) {
 	token := loginAdmin(t)
 
@@ -124,6 +291,16 @@ func TestUpdateUser(t *testing.T) {
 		},
 	})
 
+	// nothing to update
+	tryAuthorizedPost("/user/foo", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+			assert.Equal(t, "{\"error\":\"no fields to update\",\"code\":\"NO_FIELDS\"}", response.Body.String())
+		},
+	})
+
 	// invalid password
 	tryAuthorizedPost("/user/foo", AuthorizedBodyConfig{
 		Token: token,
@@ -209,3 +386,406 @@ func TestPartialUpdate(t *testing.T) {
 		},
 	})
 }
+
+func TestAdminReauth(t *testing.T) {
+	token := loginAdmin(t)
+
+	core.Config.AdminReauthRequired = true
+	defer func() { core.Config.AdminReauthRequired = false }()
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\":\"test2\",\"password\":\"foobar1235\",\"admin\":false}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\":\"test2\",\"password\":\"foobar1235\",\"admin\":false,\"currentPassword\":\"EczUR8dn\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/test2", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"password\":\"foobar1236\",\"currentPassword\":\"wrong1234\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/test2", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"password\":\"foobar1236\",\"currentPassword\":\"EczUR8dn\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/user/test2", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryRequest("/user/test2", "DELETE", "{\"currentPassword\":\"EczUR8dn\"}", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Imports carry the password along with the users
+	for body, expected := range map[string]int{
+		"[{\"name\":\"test3\",\"password\":\"foobar1235\"}]":                                               http.StatusUnauthorized,
+		"{\"users\":[{\"name\":\"test3\",\"password\":\"foobar1235\"}],\"currentPassword\":\"wrong1234\"}": http.StatusUnauthorized,
+		"{\"users\":[{\"name\":\"test3\",\"password\":\"foobar1235\"}],\"currentPassword\":\"EczUR8dn\"}":  http.StatusOK,
+	} {
+		tryAuthorizedPost("/user/import", AuthorizedBodyConfig{
+			Token: token,
+			Body:  body,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, expected, response.Code, body)
+			},
+		})
+	}
+
+	user, err := core.GetUser("test3")
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+}
+
+func TestAdminConfirmation(t *testing.T) {
+	token := loginUser(t)
+	adminToken := loginAs(t, "bar", "EczUR8dn")
+
+	core.Config.AdminConfirmRequired = true
+	t.Cleanup(func() {
+		core.Config.AdminConfirmRequired = false
+	})
+
+	for _, key := range []string{"a", "b"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Token: token,
+			Body:  "{}",
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	var confirmation ConfirmationRequiredResponse
+	tryAuthorizedDelete("/user/foo", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionRequired, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &confirmation))
+			assert.Equal(t, core.CodeConfirmationRequired, confirmation.Code)
+			assert.Equal(t, "will delete user foo and 2 keys", confirmation.Impact)
+			assert.NotEmpty(t, confirmation.Token)
+		},
+	})
+
+	// Tokens only confirm the action they've been issued for
+	for _, attempt := range []struct {
+		method string
+		url    string
+		token  string
+	}{
+		{"DELETE", "/user/foo", "invalid"},
+		{"POST", "/user/foo/forget", confirmation.Token},
+	} {
+		tryRequest(attempt.url, attempt.method, "", AuthorizedConfig{
+			Token:   adminToken,
+			Headers: map[string]string{"X-Confirmation-Token": attempt.token},
+			Handler: func(response *httptest.ResponseRecorder) {
+				var failure core.ErrorResponse
+				assert.Equal(t, http.StatusBadRequest, response.Code, attempt.url)
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &failure))
+				assert.Equal(t, core.CodeInvalidConfirmation, failure.Code, attempt.url)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/user", AuthorizedConfig{
+		Token: adminToken,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Contains(t, response.Body.String(), "\"foo\"")
+		},
+	})
+
+	// Tokens can only be used once
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+		tryAuthorizedDelete("/user/foo", AuthorizedConfig{
+			Token:   adminToken,
+			Headers: map[string]string{"X-Confirmation-Token": confirmation.Token},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code)
+			},
+		})
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	token := loginAdmin(t)
+
+	tryAuthorizedPost("/user/import", AuthorizedBodyConfig{
+		Body:  "[{\"name\": \"alice\", \"password\": \"password1\"}, {\"name\": \"foo\", \"password\": \"password2\"}, {\"name\": \"bob\", \"password\": \"short\"}]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NotContains(t, response.Body.String(), "password1")
+
+			var body ImportResponse
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, 1, body.Created)
+			assert.Equal(t, 2, body.Failed)
+			assert.Equal(t, "created", body.Results[0].Status)
+			assert.Equal(t, "exists", body.Results[1].Status)
+			assert.Equal(t, "invalid", body.Results[2].Status)
+		},
+	})
+
+	loginAs(t, "alice", "password1")
+
+	tryAuthorizedPost("/user/import?atomic=true", AuthorizedBodyConfig{
+		Body:  "[{\"name\": \"carol\", \"password\": \"password3\"}, {\"name\": \"alice\", \"password\": \"password1\"}]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+			assert.Contains(t, response.Body.String(), "{\"name\":\"carol\",\"status\":\"skipped\"}")
+		},
+	})
+
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"carol\", \"password\": \"password3\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user/import", AuthorizedBodyConfig{
+		Body:  "{\"name\": \"carol\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
+
+func TestMaxUsers(t *testing.T) {
+	token := loginAdmin(t)
+
+	core.Config.AppMaxUsers = 5
+	t.Cleanup(func() {
+		core.Config.AppMaxUsers = 0
+	})
+
+	tryAuthorizedPost("/user/import?atomic=true", AuthorizedBodyConfig{
+		Body:  "[{\"name\": \"alice\", \"password\": \"password1\"}, {\"name\": \"bob\", \"password\": \"password2\"}, {\"name\": \"carol\", \"password\": \"password3\"}]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+			assert.Contains(t, response.Body.String(), "{\"name\":\"carol\",\"status\":\"limit\",\"error\":\"maximum amount of users reached\"}")
+		},
+	})
+
+	tryAuthorizedPost("/user/import", AuthorizedBodyConfig{
+		Body:  "[{\"name\": \"alice\", \"password\": \"password1\"}, {\"name\": \"bob\", \"password\": \"password2\"}]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Body:  "{\"name\": \"carol\", \"password\": \"password3\", \"admin\": false}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+}
+
+func TestLastAdmin(t *testing.T) {
+	token := loginAdmin(t)
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"name\":\"qux\",\"password\":\"foobar1235\",\"admin\":true}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusCreated, response.Code)
+		},
+	})
+
+	// With two admins, one of them can be demoted
+	tryAuthorizedPost("/user/qux", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"admin\":false}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	count, err := core.CountAdmins()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// The remaining one can't be removed
+	tryAuthorizedDelete("/user/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+			assert.Equal(t, "{\"error\":\"cannot remove the last admin\",\"code\":\"LAST_ADMIN\"}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPost("/user/bar/forget", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	// Once there is another admin again, it can be removed
+	tryAuthorizedPost("/user/qux", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"admin\":true}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/user/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+}
+
+func TestBulkUpdateUsers(t *testing.T) {
+	tryAuthorizedPost("/user/bulk-update", AuthorizedBodyConfig{
+		Token: loginUser(t),
+		Body:  "{\"filter\":{\"admin\":false},\"update\":{\"admin\":true}}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	token := loginAdmin(t)
+
+	for _, body := range []string{"{}", "{\"filter\":{\"admin\":false}}", "{\"update\":{\"admin\":true}}"} {
+		tryAuthorizedPost("/user/bulk-update", AuthorizedBodyConfig{
+			Token: token,
+			Body:  body,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/user/bulk-update", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"filter\":{\"names\":[\"foo\",\"bar\",\"unknown\"]},\"update\":{\"admin\":true}}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body BulkUpdateResponse
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.Equal(t, 1, body.Updated)
+			assert.Equal(t, 2, body.Skipped)
+			assert.Equal(t, []core.UserUpdateResult{
+				{Name: "bar", Status: core.UserUpdateStatusSkipped},
+				{Name: "foo", Status: core.UserUpdateStatusUpdated},
+				{Name: "unknown", Status: core.UserUpdateStatusNotFound},
+			}, body.Results)
+		},
+	})
+
+	tryAuthorizedPost("/user/bulk-update", AuthorizedBodyConfig{
+		Token: token,
+		Body:  "{\"filter\":{\"admin\":true},\"update\":{\"admin\":false}}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Contains(t, response.Body.String(), "\"updated\":1,\"skipped\":1")
+		},
+	})
+
+	count, err := core.CountAdmins()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// The last admin is never demoted, even if they aren't the one updating
+	_, err = core.UpdateUsers(core.UserFilter{Names: []string{"bar"}}, core.PartialUser{Admin: new(bool)}, "")
+	assert.ErrorIs(t, err, core.ErrLastAdmin)
+
+	user, err := core.GetUser("bar")
+	assert.NoError(t, err)
+	assert.True(t, user.Admin)
+}
+
+func TestDisableInactiveUsers(t *testing.T) {
+	token := loginAdmin(t)
+	session := loginAs(t, "foo", "hgEiPCZP")
+
+	core.Config.InactivityDisableAfter = 24 * time.Hour
+	t.Cleanup(func() {
+		core.Config.InactivityDisableAfter = 0
+		core.Config.InactivityDisableAdmins = false
+	})
+
+	// Users who never logged in are disabled as well, admins are exempt by default
+	disabled, err := core.DisableInactiveUsers(time.Now().Add(48 * time.Hour))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"baz", "foo"}, disabled)
+
+	tryUnauthorizedPost("/login", UnauthorizedBodyConfig{
+		Body: "{\"user\": \"foo\", \"password\": \"hgEiPCZP\"}",
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account", AuthorizedConfig{
+		Token: session,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/user", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Contains(t, response.Body.String(), "{\"name\":\"foo\",\"admin\":false,\"disabled\":true}")
+		},
+	})
+
+	tryAuthorizedPost("/user/foo", AuthorizedBodyConfig{
+		Body:  "{\"disabled\":false}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	loginAs(t, "foo", "hgEiPCZP")
+
+	// Re-enabled users get a fresh period of inactivity
+	disabled, err = core.DisableInactiveUsers(time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, disabled)
+
+	// The last admin is kept even if admins aren't exempt
+	core.Config.InactivityDisableAdmins = true
+	disabled, err = core.DisableInactiveUsers(time.Now().Add(48 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, disabled)
+
+	user, err := core.GetUser("bar")
+	assert.NoError(t, err)
+	assert.False(t, user.Disabled)
+}
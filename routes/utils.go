@@ -18,12 +18,14 @@ type UnauthorizedBodyConfig struct {
 
 type AuthorizedConfig struct {
 	Token   string
+	Headers map[string]string
 	Handler func(*httptest.ResponseRecorder)
 }
 
 type AuthorizedBodyConfig struct {
 	Body    string
 	Token   string
+	Headers map[string]string
 	Handler func(*httptest.ResponseRecorder)
 }
 
@@ -32,11 +34,16 @@ func tryRequest(url, method, body string, config AuthorizedConfig) {
 
 	response := httptest.NewRecorder()
 	request, _ := http.NewRequest(method, url, strings.NewReader(body))
+	request.RequestURI = url
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Content-Length", strconv.FormatInt(int64(len(body)), 10))
 	request.Header.Set("Cookie", config.Token)
 
+	for key, value := range config.Headers {
+		request.Header.Set(key, value)
+	}
+
 	router.ServeHTTP(response, request)
 	config.Handler(response)
 }
@@ -58,6 +65,7 @@ func tryUnauthorizedGet(url string, config UnauthorizedConfig) {
 func tryAuthorizedPost(url string, config AuthorizedBodyConfig) {
 	tryRequest(url, "POST", config.Body, AuthorizedConfig{
 		Token:   config.Token,
+		Headers: config.Headers,
 		Handler: config.Handler,
 	})
 }
@@ -69,3 +77,19 @@ func tryAuthorizedDelete(url string, config AuthorizedConfig) {
 func tryAuthorizedGet(url string, config AuthorizedConfig) {
 	tryRequest(url, "GET", "", config)
 }
+
+func tryAuthorizedPut(url string, config AuthorizedBodyConfig) {
+	tryRequest(url, "PUT", config.Body, AuthorizedConfig{
+		Token:   config.Token,
+		Headers: config.Headers,
+		Handler: config.Handler,
+	})
+}
+
+func tryAuthorizedPatch(url string, config AuthorizedBodyConfig) {
+	tryRequest(url, "PATCH", config.Body, AuthorizedConfig{
+		Token:   config.Token,
+		Headers: config.Headers,
+		Handler: config.Handler,
+	})
+}
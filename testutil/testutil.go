@@ -0,0 +1,59 @@
+// Package testutil spins up isolated Genesis instances for integration tests of projects embedding Genesis.
+package testutil
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/routes"
+)
+
+const (
+	AdminName     = "admin"
+	AdminPassword = "genesis-admin"
+)
+
+// New starts an instance backed by an empty in-memory database with a single admin (AdminName, AdminPassword).
+// It's independent of the Default app and other instances, the configuration starts as a copy of core.Config and can
+// be adjusted via configure. core.LoadConfig is called if it hasn't been already. The database is migrated like on
+// startup. The returned cleanup function closes the database once the instance is no longer needed.
+func New(configure ...func(config *core.AppConfig)) (*gin.Engine, func(), error) {
+	core.LoadConfig()
+
+	db, err := core.OpenInMemoryDatabase()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	cleanup := func() {
+		_ = db.Close()
+	}
+
+	config := core.Config
+	config.AppGinMode = gin.TestMode
+	config.ReadOnly = false
+	config.AppUsersToCreate = []core.User{{Name: AdminName, Password: AdminPassword, Admin: true}}
+	config.LoginRateLimit = 0
+	config.LoginRateLimitPerIP = 0
+	config.JWTSecret = make([]byte, 32)
+
+	if _, err := rand.Read(config.JWTSecret); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	for _, fn := range configure {
+		fn(&config)
+	}
+
+	app := core.NewApp(&config, core.Logger, db)
+	if err := app.Migrate(false); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	app.InitializeUsers()
+	return routes.SetupAppRoutes(app), cleanup, nil
+}
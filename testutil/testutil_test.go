@@ -0,0 +1,65 @@
+package testutil
+
+import (
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	core.LoadConfig("../.env.test")
+	os.Exit(m.Run())
+}
+
+func login(t *testing.T, router http.Handler) string {
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/login", strings.NewReader("{\"user\": \""+AdminName+"\", \"password\": \""+AdminPassword+"\"}"))
+	request.Header.Set("Content-Type", "application/json")
+
+	router.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	return response.Header().Get("Set-Cookie")
+}
+
+func TestNew(t *testing.T) {
+	router, cleanup, err := New(func(config *core.AppConfig) {
+		config.AppKeysPerUser = 1
+	})
+	assert.NoError(t, err)
+	defer cleanup()
+
+	// Instances run side by side without sharing data or configuration
+	other, otherCleanup, err := New()
+	assert.NoError(t, err)
+	defer otherCleanup()
+
+	token := login(t, router)
+
+	for _, key := range []string{"foo", "bar"} {
+		response := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/data/"+key, strings.NewReader("{\"hello\":\"world\"}"))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Cookie", token)
+		router.ServeHTTP(response, request)
+
+		if key == "foo" {
+			assert.Equal(t, http.StatusOK, response.Code)
+		} else {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		}
+	}
+
+	assert.NotEqual(t, int64(1), core.Config.AppKeysPerUser)
+
+	response := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/data", nil)
+	request.Header.Set("Cookie", login(t, other))
+	other.ServeHTTP(response, request)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "{}", response.Body.String())
+}